@@ -0,0 +1,45 @@
+package main
+
+import (
+	"dgw-technical-test/config/database"
+	admin_repo "dgw-technical-test/internal/repositories/admin"
+	review_repo "dgw-technical-test/internal/repositories/review"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	admin_service "dgw-technical-test/internal/services/admin"
+
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runBootstrapAdmin implements `bootstrap-admin`, which creates the first Super Admin.
+// The password is read from BOOTSTRAP_ADMIN_PASSWORD when -password is omitted so it stays out of shell history.
+func runBootstrapAdmin(args []string) error {
+	fs := flag.NewFlagSet("bootstrap-admin", flag.ContinueOnError)
+	name := fs.String("name", "", "name of the Super Admin")
+	email := fs.String("email", "", "email of the Super Admin")
+	password := fs.String("password", os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"), "password of the Super Admin (defaults to $BOOTSTRAP_ADMIN_PASSWORD)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || *email == "" || *password == "" {
+		fs.Usage()
+		return fmt.Errorf("-name, -email and -password are required")
+	}
+
+	config.InitDB()
+	defer config.CloseDB()
+
+	adminService := admin_service.NewAdminService(
+		admin_repo.NewAdminRepository(config.Pool),
+		review_repo.NewReviewRepository(config.Pool),
+		unitofwork.NewUnitOfWork(config.Pool),
+	)
+	if err := adminService.BootstrapSuperAdmin(context.Background(), *name, *email, *password); err != nil {
+		return err
+	}
+
+	fmt.Printf("Super Admin %s created\n", *email)
+	return nil
+}
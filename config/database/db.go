@@ -7,7 +7,6 @@ import (
 	"time"
 	"io/ioutil"
 	"os"
-	"strings"
 	"github.com/joho/godotenv"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -69,34 +68,36 @@ func InitDB(){
 func MigrateData(){
 	// use recover to handle any potential panics
 	defer HandlePanic()
-	
+
+	// read the filename from the first argument
+	filename := "config/database/ddl.sql"
+
+	if err := RunSQLFile(filename); err != nil {
+		panic(err)
+	}
+
+	// output successful table creation and population
+	fmt.Println("All Tables Created and Populated Successfully!")
+}
+
+// RunSQLFile connects to the DB and executes the statements of a SQL file, e.g. a migration, all or nothing
+func RunSQLFile(filename string) error {
 	// create a context with a timeout (e.g., 30 seconds)
 	ctx, cancel := context.WithTimeout(context.Background(), 30_000_000_000)
 	defer cancel()
 
-	// read the filename from the first argument
-	filename := "config/database/ddl.sql"
-	
 	// read SQL commands from the file with the given filename
 	sqlCommands, err := ReadSQLCommands(filename)
-	
-	// connect to the DB
-	InitDB();
-	
 	if err != nil {
-		panic(err)
+		return err
 	}
-	
-	defer CloseDB();
-	
+
+	// connect to the DB
+	InitDB()
+	defer CloseDB()
+
 	// execute SQL commands
-	err = ExecuteSQLCommands(ctx, Pool, sqlCommands)
-	if err != nil {
-		panic(err)
-	}
-	
-	// output successful table creation and population
-	fmt.Println("All Tables Created and Populated Successfully!")
+	return ExecuteSQLCommands(ctx, Pool, sqlCommands)
 }
 
 // func to handle panic using recover
@@ -115,17 +116,21 @@ func ReadSQLCommands(filename string) (string, error) {
 	return string(data), nil
 }
 
-// function to execute SQL commands on the db
+// ExecuteSQLCommands runs a SQL file in a single transaction, so a statement that fails leaves the schema
+// as it was and the file can be run again. The file is sent whole rather than split on semicolons: without
+// arguments pgx uses the simple query protocol, which takes several statements at once.
 func ExecuteSQLCommands(ctx context.Context, db *pgxpool.Pool, commands string) error {
-	statements := strings.Split(commands, ";") // split SQL commands by semicolon
-	for _, stmt := range statements {
-		stmt = strings.TrimSpace(stmt)		   // Trim whitespace
-		if stmt != "" {
-			_, err := db.Exec(ctx, stmt)
-			if err != nil {
-				return fmt.Errorf("failed to execute statement %q: %w", stmt, err)
-			}
-		}
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, commands); err != nil {
+		return fmt.Errorf("failed to execute SQL commands, nothing was applied: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit SQL commands: %w", err)
 	}
 	return nil
 }
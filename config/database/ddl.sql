@@ -1,8 +1,25 @@
--- DDL Queries: Schema Creation (9)
+-- DDL Queries: Schema Creation (27)
 -- Drop the dependent tables first (those that reference other tables)
+DROP TABLE IF EXISTS credit_repayments CASCADE;
+DROP TABLE IF EXISTS credit_instalments CASCADE;
+DROP TABLE IF EXISTS credit_receivables CASCADE;
+DROP TABLE IF EXISTS credit_facilities CASCADE;
+DROP TABLE IF EXISTS order_holds CASCADE;
+DROP TABLE IF EXISTS cart_items CASCADE;
+DROP TABLE IF EXISTS order_status_history CASCADE;
+DROP TABLE IF EXISTS refund_items CASCADE;
+DROP TABLE IF EXISTS refunds CASCADE;
+DROP TABLE IF EXISTS stock_reservations CASCADE;
+DROP TABLE IF EXISTS idempotency_keys CASCADE;
+DROP TABLE IF EXISTS payouts CASCADE;
+DROP TABLE IF EXISTS ledger_lines CASCADE;
+DROP TABLE IF EXISTS ledger_entries CASCADE;
+DROP TABLE IF EXISTS ledger_accounts CASCADE;
 DROP TABLE IF EXISTS wallet_transactions CASCADE;
 DROP TABLE IF EXISTS reviews CASCADE;
 DROP TABLE IF EXISTS logs CASCADE;         
+DROP TABLE IF EXISTS sessions CASCADE;
+DROP TABLE IF EXISTS admin_invitations CASCADE;
 DROP TABLE IF EXISTS payments CASCADE;             
 DROP TABLE IF EXISTS order_items CASCADE;          
 DROP TABLE IF EXISTS orders CASCADE;               
@@ -17,12 +34,39 @@ CREATE TABLE admins (
     name VARCHAR(100) NOT NULL,
     email VARCHAR(100) UNIQUE NOT NULL,
     password VARCHAR(100) NOT NULL,
-    role VARCHAR(100) NOT NULL,
-    jwt_token TEXT,
+    role VARCHAR(100) NOT NULL CHECK (role IN ('Super Admin', 'Store Admin')),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Table: Admin Invitations (single-use tokens issued by a Super Admin, only the SHA-256 hash of the token is stored)
+CREATE TABLE admin_invitations (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(100) NOT NULL,
+    role VARCHAR(100) NOT NULL CHECK (role IN ('Super Admin', 'Store Admin')),
+    token_hash CHAR(64) UNIQUE NOT NULL,
+    invited_by INTEGER REFERENCES admins(id) ON DELETE SET NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table: Sessions (one row per issued refresh token, the id is the jti of its access tokens)
+-- Refreshing revokes the row as 'rotated' and inserts a new one in the same family
+CREATE TABLE sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    family_id VARCHAR(64) NOT NULL,
+    subject_type VARCHAR(20) NOT NULL CHECK (subject_type IN ('admin', 'farmer')),
+    subject_id INTEGER NOT NULL,
+    refresh_token_hash CHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    revoked_reason VARCHAR(50) CHECK (revoked_reason IN ('logout', 'rotated', 'revoke_all', 'reuse_detected')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_sessions_subject ON sessions (subject_type, subject_id) WHERE revoked_at IS NULL;
+CREATE INDEX idx_sessions_family ON sessions (family_id);
+
 -- Table: Farmers
 CREATE TABLE farmers (
     id SERIAL PRIMARY KEY,
@@ -32,8 +76,7 @@ CREATE TABLE farmers (
     address VARCHAR(500),
     phone_number VARCHAR(100),
     farm_type VARCHAR(100),
-    wallet_balance DECIMAL(10, 2) DEFAULT 0.00,
-    jwt_token TEXT,
+    wallet_balance DECIMAL(19, 2) DEFAULT 0.00 CHECK (wallet_balance >= 0), -- cache of the farmer's ledger balance, see ledger_lines
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -42,15 +85,87 @@ CREATE TABLE farmers (
 CREATE TABLE wallet_transactions (
     id SERIAL PRIMARY KEY,
     farmer_id INTEGER REFERENCES farmers(id) ON DELETE CASCADE,
-    order_id VARCHAR(255) NOT NULL,  -- Add order_id field
+    order_id VARCHAR(255) NOT NULL UNIQUE,  -- gateway order ID or internal reference, one wallet transaction each
     transaction_type VARCHAR(100),
-    amount DECIMAL(10, 2) NOT NULL,
+    amount DECIMAL(19, 2) NOT NULL,
     status VARCHAR(50) CHECK (status IN ('pending', 'settlement', 'failed')) DEFAULT 'pending',
     description TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- Add created_at column
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP  -- Add updated_at column
 );
 
+-- Table: Ledger Accounts (system accounts are seeded below, farmer wallets are opened on first use)
+CREATE TABLE ledger_accounts (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(100) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('asset', 'liability', 'revenue', 'expense', 'equity')),
+    farmer_id INTEGER UNIQUE REFERENCES farmers(id) ON DELETE RESTRICT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table: Ledger Entries (immutable journal, the reference makes posting idempotent per entry type)
+CREATE TABLE ledger_entries (
+    id SERIAL PRIMARY KEY,
+    entry_type VARCHAR(50) NOT NULL CHECK (entry_type IN ('top_up', 'order_payment', 'refund', 'adjustment', 'payout_hold', 'payout_settlement', 'payout_reversal', 'order_hold', 'order_hold_capture', 'order_hold_release', 'credit_sale', 'credit_fee', 'credit_repayment', 'credit_reduction')),
+    reference VARCHAR(255) NOT NULL,
+    description TEXT,
+    admin_id INTEGER REFERENCES admins(id), -- set for adjustments, admins with ledger history can't be deleted
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (entry_type, reference)
+);
+
+-- Table: Ledger Lines (each line either debits or credits one account and an entry's lines balance)
+CREATE TABLE ledger_lines (
+    id SERIAL PRIMARY KEY,
+    entry_id INTEGER NOT NULL REFERENCES ledger_entries(id) ON DELETE RESTRICT,
+    account_id INTEGER NOT NULL REFERENCES ledger_accounts(id) ON DELETE RESTRICT,
+    debit DECIMAL(19, 2) NOT NULL DEFAULT 0 CHECK (debit >= 0),
+    credit DECIMAL(19, 2) NOT NULL DEFAULT 0 CHECK (credit >= 0),
+    CHECK ((debit = 0) <> (credit = 0))
+);
+CREATE INDEX idx_ledger_lines_account ON ledger_lines (account_id);
+CREATE INDEX idx_ledger_lines_entry ON ledger_lines (entry_id);
+
+-- the journal is append-only: updates and deletes are silently discarded
+CREATE RULE ledger_entries_no_update AS ON UPDATE TO ledger_entries DO INSTEAD NOTHING;
+CREATE RULE ledger_entries_no_delete AS ON DELETE TO ledger_entries DO INSTEAD NOTHING;
+CREATE RULE ledger_lines_no_update AS ON UPDATE TO ledger_lines DO INSTEAD NOTHING;
+CREATE RULE ledger_lines_no_delete AS ON DELETE TO ledger_lines DO INSTEAD NOTHING;
+
+-- Table: Payouts (wallet money paid out to a farmer's bank account, held in the ledger until the provider resolves it)
+CREATE TABLE payouts (
+    id SERIAL PRIMARY KEY,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    reference VARCHAR(255) UNIQUE NOT NULL, -- sent to the payout provider and used as the ledger reference
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount > 0),
+    bank_code VARCHAR(50) NOT NULL,
+    account_number VARCHAR(50) NOT NULL,
+    account_name VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'completed', 'failed')),
+    provider_reference VARCHAR(255),
+    failure_reason TEXT,
+    next_submit_at TIMESTAMP, -- when the payout worker may submit a pending payout again
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_payouts_farmer ON payouts (farmer_id, created_at DESC);
+CREATE INDEX idx_payouts_pending ON payouts (created_at) WHERE status = 'pending';
+
+-- Table: Idempotency Keys (responses of money-moving requests, replayed when a client retries with the same key)
+CREATE TABLE idempotency_keys (
+    id SERIAL PRIMARY KEY,
+    subject VARCHAR(100) NOT NULL, -- principal that sent the key, e.g. farmer:12
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL, -- sha256 of method, path and body
+    status_code INTEGER, -- NULL while the original request is in progress
+    content_type VARCHAR(255),
+    response_body BYTEA,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    UNIQUE (subject, idempotency_key)
+);
+
 -- Table: Suppliers
 CREATE TABLE suppliers (
     id SERIAL PRIMARY KEY,
@@ -68,22 +183,162 @@ CREATE TABLE products (
     supplier_id INTEGER REFERENCES suppliers(id) ON DELETE CASCADE, 
     name VARCHAR(250) NOT NULL,                             
     description TEXT,                                      
-    price DECIMAL(10, 2) NOT NULL,                          
+    price DECIMAL(19, 2) NOT NULL,                          
     stock_quantity INT NOT NULL,                            
     category VARCHAR(100),                                  
     brand VARCHAR(100),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,         
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP          
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    -- catalog search document in Indonesian and English, names weigh most, then brands, then descriptions
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('indonesian', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('indonesian', COALESCE(brand, '')), 'B') ||
+        setweight(to_tsvector('english', COALESCE(brand, '')), 'B') ||
+        setweight(to_tsvector('indonesian', COALESCE(description, '')), 'C') ||
+        setweight(to_tsvector('english', COALESCE(description, '')), 'C')
+    ) STORED
+);
+
+CREATE INDEX idx_products_search ON products USING GIN (search_vector);
+CREATE INDEX idx_products_category ON products (category);
+CREATE INDEX idx_products_brand ON products (brand);
+CREATE INDEX idx_products_supplier ON products (supplier_id);
+CREATE INDEX idx_products_price ON products (price, id);
+CREATE INDEX idx_products_created ON products (created_at DESC, id DESC);
+
+-- Table: Cart Items (a farmer's cart, priced from the catalog only when it is checked out)
+CREATE TABLE cart_items (
+    id SERIAL PRIMARY KEY,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (farmer_id, product_id)
 );
 
 -- Table: Orders
 CREATE TABLE orders (
     id SERIAL PRIMARY KEY,
     farmer_id INTEGER REFERENCES farmers(id) ON DELETE CASCADE,
-    status VARCHAR(100) CHECK (status IN ('pending', 'settlement', 'cancelled')),
-    total_price DECIMAL(10, 2),
-    is_processed BOOLEAN DEFAULT FALSE,
-    payment_method VARCHAR(250),
+    -- lifecycle state, only changed through the transitions in internal/domain/order
+    status VARCHAR(100) NOT NULL CHECK (status IN ('pending', 'awaiting_payment', 'paid', 'packed', 'shipped', 'delivered', 'cancelled', 'refunded', 'expired')),
+    total_price DECIMAL(19, 2),
+    payment_method VARCHAR(250), -- wallet, online, split or credit once paid
+    payment_due_at TIMESTAMP,
+    next_expiry_check_at TIMESTAMP, -- the expiry worker doesn't look at the overdue order again before then
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_orders_pending_due ON orders(payment_due_at) WHERE status IN ('pending', 'awaiting_payment');
+CREATE INDEX idx_orders_created ON orders (created_at DESC, id DESC);
+CREATE INDEX idx_orders_farmer_created ON orders (farmer_id, created_at DESC, id DESC);
+
+-- Table: Order Status History (every status change of an order with who made it, when and why)
+CREATE TABLE order_status_history (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(100), -- NULL for the creation of the order
+    to_status VARCHAR(100) NOT NULL,
+    actor_type VARCHAR(20) NOT NULL CHECK (actor_type IN ('admin', 'farmer', 'system')),
+    actor_id INTEGER, -- admin or farmer ID, NULL for the system
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_order_status_history_order ON order_status_history (order_id, created_at);
+
+-- Table: Payments (every charge attempt made at the payment gateway for an order)
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER REFERENCES orders(id) ON DELETE CASCADE,
+    gateway_order_id VARCHAR(255) UNIQUE NOT NULL,
+    transaction_id VARCHAR(255),
+    channel VARCHAR(50),
+    payment_type VARCHAR(100),
+    bank VARCHAR(100),
+    va_number VARCHAR(100),
+    amount DECIMAL(19, 2) NOT NULL,
+    status VARCHAR(100) NOT NULL DEFAULT 'pending',
+    raw_response JSONB,
+    applied_at TIMESTAMP,                      -- set on the one charge whose settlement paid the order
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_payments_order_id ON payments(order_id);
+CREATE UNIQUE INDEX idx_payments_applied ON payments(order_id) WHERE applied_at IS NOT NULL;
+
+-- Table: Order Holds (wallet part of a split payment, held in the ledger until the online part settles)
+CREATE TABLE order_holds (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    reference VARCHAR(255) UNIQUE NOT NULL, -- ledger and wallet_transactions reference
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'held' CHECK (status IN ('held', 'captured', 'released')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+-- an order has at most one hold in flight
+CREATE UNIQUE INDEX idx_order_holds_active ON order_holds (order_id) WHERE status = 'held';
+
+-- Table: Credit Facilities (pay-later credit an admin grants a farmer, one per farmer)
+CREATE TABLE credit_facilities (
+    id SERIAL PRIMARY KEY,
+    farmer_id INTEGER UNIQUE NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    credit_limit DECIMAL(19, 2) NOT NULL CHECK (credit_limit >= 0),
+    tenor_days INTEGER NOT NULL CHECK (tenor_days > 0), -- days from the purchase to the last instalment
+    instalments INTEGER NOT NULL CHECK (instalments > 0),
+    fee_bps INTEGER NOT NULL DEFAULT 0 CHECK (fee_bps >= 0), -- flat fee on the order total in basis points
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended')),
+    admin_id INTEGER REFERENCES admins(id), -- admin who last changed the facility
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table: Credit Receivables (what a farmer owes for an order bought on credit, orders.payment_method = 'credit')
+CREATE TABLE credit_receivables (
+    id SERIAL PRIMARY KEY,
+    facility_id INTEGER NOT NULL REFERENCES credit_facilities(id) ON DELETE RESTRICT,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    order_id INTEGER UNIQUE NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    reference VARCHAR(255) UNIQUE NOT NULL, -- ledger reference of the credit sale
+    principal DECIMAL(19, 2) NOT NULL CHECK (principal > 0),
+    fee DECIMAL(19, 2) NOT NULL DEFAULT 0 CHECK (fee >= 0),
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount > 0), -- principal and fee
+    outstanding DECIMAL(19, 2) NOT NULL CHECK (outstanding >= 0 AND outstanding <= amount),
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'paid')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_credit_receivables_farmer ON credit_receivables (farmer_id, created_at DESC);
+
+-- Table: Credit Instalments (repayment schedule of a receivable, repayments pay the earliest first)
+CREATE TABLE credit_instalments (
+    id SERIAL PRIMARY KEY,
+    receivable_id INTEGER NOT NULL REFERENCES credit_receivables(id) ON DELETE RESTRICT,
+    sequence INTEGER NOT NULL,
+    due_date DATE NOT NULL,
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount >= 0), -- reduced when the order is refunded
+    paid_amount DECIMAL(19, 2) NOT NULL DEFAULT 0 CHECK (paid_amount >= 0 AND paid_amount <= amount),
+    status VARCHAR(20) NOT NULL DEFAULT 'due' CHECK (status IN ('due', 'paid')),
+    paid_at TIMESTAMP,
+    UNIQUE (receivable_id, sequence)
+);
+CREATE INDEX idx_credit_instalments_overdue ON credit_instalments (due_date) WHERE status = 'due';
+
+-- Table: Credit Repayments (money paid against a receivable from the wallet or through a payment channel)
+CREATE TABLE credit_repayments (
+    id SERIAL PRIMARY KEY,
+    receivable_id INTEGER NOT NULL REFERENCES credit_receivables(id) ON DELETE RESTRICT,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    reference VARCHAR(255) UNIQUE NOT NULL, -- gateway order ID of an online repayment, ledger reference of both
+    method VARCHAR(20) NOT NULL CHECK (method IN ('wallet', 'online')),
+    channel VARCHAR(50),
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount > 0),
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'settled', 'failed')),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
@@ -94,15 +349,61 @@ CREATE TABLE order_items (
     order_id INTEGER REFERENCES orders(id) ON DELETE CASCADE,
     product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
     quantity INT,
-    price DECIMAL(10, 2),
+    price DECIMAL(19, 2),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Table: Stock Reservations (quantities held for an order until it is paid, cancelled or the reservation expires)
+CREATE TABLE stock_reservations (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER REFERENCES orders(id) ON DELETE CASCADE,
+    product_id INTEGER REFERENCES products(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    status VARCHAR(100) NOT NULL CHECK (status IN ('active', 'released', 'consumed')) DEFAULT 'active',
+    expires_at TIMESTAMP NOT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+CREATE INDEX idx_stock_reservations_order_id ON stock_reservations(order_id);
+CREATE INDEX idx_stock_reservations_active ON stock_reservations(product_id, expires_at) WHERE status = 'active';
+
+-- Table: Refunds (money returned for a paid order, to the wallet or through the payment gateway)
+CREATE TABLE refunds (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    reference VARCHAR(255) UNIQUE NOT NULL, -- ledger reference for wallet refunds, refund key at the gateway
+    method VARCHAR(20) NOT NULL CHECK (method IN ('wallet', 'gateway', 'split')), -- split refunds send gateway_amount through the gateway and the rest to the wallet
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount > 0),
+    gateway_order_id VARCHAR(255), -- the settled charge refunded by a gateway or split refund
+    gateway_amount DECIMAL(19, 2) CHECK (gateway_amount > 0), -- whole rupiah sent to the gateway
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'completed', 'failed')),
+    reason TEXT NOT NULL,
+    admin_id INTEGER REFERENCES admins(id) ON DELETE SET NULL,
+    provider_reference VARCHAR(255),
+    failure_reason TEXT, -- gateway error of a failed refund
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_refunds_order ON refunds (order_id);
+
+-- Table: Refund Items (units of an order item returned by a refund, they never exceed the ordered quantity)
+CREATE TABLE refund_items (
+    id SERIAL PRIMARY KEY,
+    refund_id INTEGER NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE RESTRICT,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    amount DECIMAL(19, 2) NOT NULL
+);
+CREATE INDEX idx_refund_items_order_item ON refund_items (order_item_id);
+
 -- Table: Logs
 CREATE TABLE logs (
     id SERIAL PRIMARY KEY,
-    admin_id INTEGER REFERENCES admins(id) ON DELETE CASCADE,
+    admin_id INTEGER REFERENCES admins(id) ON DELETE CASCADE, -- NULL for actions taken by the system
+    actor VARCHAR(100) NOT NULL DEFAULT 'admin' CHECK (actor IN ('admin', 'system')),
     action VARCHAR(100),
     timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     details TEXT
@@ -121,10 +422,18 @@ CREATE TABLE reviews (
 );
 
 -- DML Query: populating the created schemas
--- Insert sample admins
-INSERT INTO admins (name, email, password, role) VALUES
-('Super Admin Diana', 'superadmin@dgwmart.com', 'adminpass123', 'Super Admin'),
-('Admin Adi', 'admin.adi@dgwmart.com', 'adminpass456', 'Store Admin');
+-- Admins are not seeded: create the first Super Admin with `go run . bootstrap-admin`
+-- and invite the rest through POST /admins/invitations
+
+-- Insert the system ledger accounts
+INSERT INTO ledger_accounts (code, name, type) VALUES
+('gateway_clearing', 'Payment gateway clearing', 'asset'),
+('sales_revenue', 'Sales revenue', 'revenue'),
+('adjustments', 'Manual adjustments', 'equity'),
+('payout_holding', 'Payouts in flight', 'liability'),
+('order_holding', 'Split payments in flight', 'liability'),
+('credit_receivables', 'Credit receivables', 'asset'),
+('credit_fees', 'Credit fees', 'revenue');
 
 -- Insert sample suppliers
 INSERT INTO suppliers (name, address, phone_number, category) VALUES
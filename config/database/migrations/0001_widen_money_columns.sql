@@ -0,0 +1,14 @@
+-- Migration 0001: widen every money column to DECIMAL(19, 2)
+-- DECIMAL(10, 2) capped balances and prices at 99,999,999.99 IDR. Amounts are handled in the
+-- application as integer sen (internal/money), so two decimal places are kept.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0001_widen_money_columns.sql
+
+ALTER TABLE farmers ALTER COLUMN wallet_balance TYPE DECIMAL(19, 2);
+ALTER TABLE wallet_transactions ALTER COLUMN amount TYPE DECIMAL(19, 2);
+ALTER TABLE ledger_lines ALTER COLUMN debit TYPE DECIMAL(19, 2), ALTER COLUMN credit TYPE DECIMAL(19, 2);
+ALTER TABLE payouts ALTER COLUMN amount TYPE DECIMAL(19, 2);
+ALTER TABLE products ALTER COLUMN price TYPE DECIMAL(19, 2);
+ALTER TABLE orders ALTER COLUMN total_price TYPE DECIMAL(19, 2);
+ALTER TABLE payments ALTER COLUMN amount TYPE DECIMAL(19, 2);
+ALTER TABLE order_items ALTER COLUMN price TYPE DECIMAL(19, 2);
@@ -0,0 +1,35 @@
+-- Migration 0002: refunds of paid orders
+-- Adds the refunds and refund_items tables and the partially_refunded and refunded order statuses.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0002_refunds.sql
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (status IN ('pending', 'settlement', 'partially_refunded', 'refunded', 'cancelled'));
+
+CREATE TABLE refunds (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    reference VARCHAR(255) UNIQUE NOT NULL,
+    method VARCHAR(20) NOT NULL CHECK (method IN ('wallet', 'gateway')),
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount > 0),
+    gateway_order_id VARCHAR(255),
+    gateway_amount DECIMAL(19, 2) CHECK (gateway_amount > 0),
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'completed')),
+    reason TEXT NOT NULL,
+    admin_id INTEGER REFERENCES admins(id) ON DELETE SET NULL,
+    provider_reference VARCHAR(255),
+    failure_reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_refunds_order ON refunds (order_id);
+
+CREATE TABLE refund_items (
+    id SERIAL PRIMARY KEY,
+    refund_id INTEGER NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE RESTRICT,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    amount DECIMAL(19, 2) NOT NULL
+);
+CREATE INDEX idx_refund_items_order_item ON refund_items (order_item_id);
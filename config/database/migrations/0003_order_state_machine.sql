@@ -0,0 +1,34 @@
+-- Migration 0003: explicit order state machine
+-- Renames the order statuses to the states of internal/domain/order, drops orders.is_processed (paid
+-- orders are told apart by their status) and adds order_status_history, seeded with the current status.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0003_order_state_machine.sql
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_status_check;
+
+UPDATE orders SET status = 'paid' WHERE status IN ('settlement', 'partially_refunded');
+UPDATE orders SET status = 'paid' WHERE status = 'pending' AND is_processed = TRUE;
+UPDATE orders o SET status = 'awaiting_payment'
+WHERE o.status = 'pending' AND EXISTS (SELECT 1 FROM payments p WHERE p.order_id = o.id AND p.status = 'pending');
+
+ALTER TABLE orders ALTER COLUMN status SET NOT NULL;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check CHECK (status IN ('pending', 'awaiting_payment', 'paid', 'packed', 'shipped', 'delivered', 'cancelled', 'refunded', 'expired'));
+ALTER TABLE orders DROP COLUMN is_processed;
+
+DROP INDEX IF EXISTS idx_orders_pending_due;
+CREATE INDEX idx_orders_pending_due ON orders(payment_due_at) WHERE status IN ('pending', 'awaiting_payment');
+
+CREATE TABLE order_status_history (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    from_status VARCHAR(100),
+    to_status VARCHAR(100) NOT NULL,
+    actor_type VARCHAR(20) NOT NULL CHECK (actor_type IN ('admin', 'farmer', 'system')),
+    actor_id INTEGER,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_order_status_history_order ON order_status_history (order_id, created_at);
+
+INSERT INTO order_status_history (order_id, from_status, to_status, actor_type, reason, created_at)
+SELECT id, NULL, status, 'system', 'status before the order state machine was introduced', updated_at FROM orders;
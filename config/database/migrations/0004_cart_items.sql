@@ -0,0 +1,14 @@
+-- Migration 0004: farmer carts
+-- Adds the cart_items table behind /farmers/cart and /farmers/checkout.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0004_cart_items.sql
+
+CREATE TABLE cart_items (
+    id SERIAL PRIMARY KEY,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (farmer_id, product_id)
+);
@@ -0,0 +1,7 @@
+-- Migration 0005: order history listings
+-- Adds the indexes behind GET /farmers/orders and GET /admins/orders, which page newest first on (created_at, id).
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0005_order_listing_indexes.sql
+
+CREATE INDEX IF NOT EXISTS idx_orders_created ON orders (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_orders_farmer_created ON orders (farmer_id, created_at DESC, id DESC);
@@ -0,0 +1,9 @@
+-- Migration 0006: payment channels
+-- Records the channel (bca_va, qris, indomaret, ...) each online charge was created through.
+-- Charges created before channels existed were all BCA virtual accounts.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0006_payment_channels.sql
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS channel VARCHAR(50);
+
+UPDATE payments SET channel = 'bca_va' WHERE channel IS NULL AND payment_type = 'bank_transfer' AND bank = 'bca';
@@ -0,0 +1,23 @@
+-- Migration 0007: split payments
+-- Adds the order_holds table, the order_holding ledger account and the ledger entry types behind
+-- POST /farmers/pay-order/split/:order_id and split checkouts.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0007_split_payments.sql
+
+CREATE TABLE IF NOT EXISTS order_holds (
+    id SERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    reference VARCHAR(255) UNIQUE NOT NULL,
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'held' CHECK (status IN ('held', 'captured', 'released')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_holds_active ON order_holds (order_id) WHERE status = 'held';
+
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_entry_type_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_entry_type_check CHECK (entry_type IN ('top_up', 'order_payment', 'refund', 'adjustment', 'payout_hold', 'payout_settlement', 'payout_reversal', 'order_hold', 'order_hold_capture', 'order_hold_release'));
+
+INSERT INTO ledger_accounts (code, name, type) VALUES ('order_holding', 'Split payments in flight', 'liability')
+ON CONFLICT (code) DO NOTHING;
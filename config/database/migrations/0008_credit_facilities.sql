@@ -0,0 +1,68 @@
+-- Migration 0008: credit facilities
+-- Adds the credit facility, receivable, instalment and repayment tables, the credit ledger accounts and
+-- the ledger entry types behind pay-later orders (orders.payment_method = 'credit').
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0008_credit_facilities.sql
+
+CREATE TABLE IF NOT EXISTS credit_facilities (
+    id SERIAL PRIMARY KEY,
+    farmer_id INTEGER UNIQUE NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    credit_limit DECIMAL(19, 2) NOT NULL CHECK (credit_limit >= 0),
+    tenor_days INTEGER NOT NULL CHECK (tenor_days > 0),
+    instalments INTEGER NOT NULL CHECK (instalments > 0),
+    fee_bps INTEGER NOT NULL DEFAULT 0 CHECK (fee_bps >= 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended')),
+    admin_id INTEGER REFERENCES admins(id),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS credit_receivables (
+    id SERIAL PRIMARY KEY,
+    facility_id INTEGER NOT NULL REFERENCES credit_facilities(id) ON DELETE RESTRICT,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    order_id INTEGER UNIQUE NOT NULL REFERENCES orders(id) ON DELETE RESTRICT,
+    reference VARCHAR(255) UNIQUE NOT NULL,
+    principal DECIMAL(19, 2) NOT NULL CHECK (principal > 0),
+    fee DECIMAL(19, 2) NOT NULL DEFAULT 0 CHECK (fee >= 0),
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount > 0),
+    outstanding DECIMAL(19, 2) NOT NULL CHECK (outstanding >= 0 AND outstanding <= amount),
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'paid')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_credit_receivables_farmer ON credit_receivables (farmer_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS credit_instalments (
+    id SERIAL PRIMARY KEY,
+    receivable_id INTEGER NOT NULL REFERENCES credit_receivables(id) ON DELETE RESTRICT,
+    sequence INTEGER NOT NULL,
+    due_date DATE NOT NULL,
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount >= 0),
+    paid_amount DECIMAL(19, 2) NOT NULL DEFAULT 0 CHECK (paid_amount >= 0 AND paid_amount <= amount),
+    status VARCHAR(20) NOT NULL DEFAULT 'due' CHECK (status IN ('due', 'paid')),
+    paid_at TIMESTAMP,
+    UNIQUE (receivable_id, sequence)
+);
+CREATE INDEX IF NOT EXISTS idx_credit_instalments_overdue ON credit_instalments (due_date) WHERE status = 'due';
+
+CREATE TABLE IF NOT EXISTS credit_repayments (
+    id SERIAL PRIMARY KEY,
+    receivable_id INTEGER NOT NULL REFERENCES credit_receivables(id) ON DELETE RESTRICT,
+    farmer_id INTEGER NOT NULL REFERENCES farmers(id) ON DELETE RESTRICT,
+    reference VARCHAR(255) UNIQUE NOT NULL,
+    method VARCHAR(20) NOT NULL CHECK (method IN ('wallet', 'online')),
+    channel VARCHAR(50),
+    amount DECIMAL(19, 2) NOT NULL CHECK (amount > 0),
+    status VARCHAR(20) NOT NULL CHECK (status IN ('pending', 'settled', 'failed')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_entry_type_check;
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_entry_type_check CHECK (entry_type IN ('top_up', 'order_payment', 'refund', 'adjustment', 'payout_hold', 'payout_settlement', 'payout_reversal', 'order_hold', 'order_hold_capture', 'order_hold_release', 'credit_sale', 'credit_fee', 'credit_repayment', 'credit_reduction'));
+
+INSERT INTO ledger_accounts (code, name, type) VALUES
+('credit_receivables', 'Credit receivables', 'asset'),
+('credit_fees', 'Credit fees', 'revenue')
+ON CONFLICT (code) DO NOTHING;
@@ -0,0 +1,21 @@
+-- Migration 0009: product catalog search
+-- Adds the generated search document behind the q parameter of GET /products/view-products and the indexes
+-- behind its filters and sorts. Needs PostgreSQL 12 or later for generated columns and the indonesian text search config.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0009_product_search.sql
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('indonesian', COALESCE(name, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+    setweight(to_tsvector('indonesian', COALESCE(brand, '')), 'B') ||
+    setweight(to_tsvector('english', COALESCE(brand, '')), 'B') ||
+    setweight(to_tsvector('indonesian', COALESCE(description, '')), 'C') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_products_search ON products USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_products_category ON products (category);
+CREATE INDEX IF NOT EXISTS idx_products_brand ON products (brand);
+CREATE INDEX IF NOT EXISTS idx_products_supplier ON products (supplier_id);
+CREATE INDEX IF NOT EXISTS idx_products_price ON products (price, id);
+CREATE INDEX IF NOT EXISTS idx_products_created ON products (created_at DESC, id DESC);
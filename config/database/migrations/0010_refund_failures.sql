@@ -0,0 +1,14 @@
+-- Migration 0010: split refunds and failed gateway refunds
+-- Orders paid by split payment are refunded partly through the gateway and partly to the wallet, and a gateway
+-- refund the gateway refuses becomes failed until an admin retries it with POST /admins/refunds/:refund_id/retry.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0010_refund_failures.sql
+
+ALTER TABLE refunds DROP CONSTRAINT IF EXISTS refunds_method_check;
+ALTER TABLE refunds ADD CONSTRAINT refunds_method_check CHECK (method IN ('wallet', 'gateway', 'split'));
+
+ALTER TABLE refunds DROP CONSTRAINT IF EXISTS refunds_status_check;
+ALTER TABLE refunds ADD CONSTRAINT refunds_status_check CHECK (status IN ('pending', 'completed', 'failed'));
+
+-- refunds that kept a gateway error while pending were refused by the gateway
+UPDATE refunds SET status = 'failed', updated_at = NOW() WHERE status = 'pending' AND failure_reason IS NOT NULL;
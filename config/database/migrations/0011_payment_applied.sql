@@ -0,0 +1,20 @@
+-- Migration 0011: the charge that paid an order
+-- payments.applied_at marks the one charge whose settlement paid the order, so a later settlement of another
+-- charge of the same order is reported for a manual refund instead of being taken as a repeat notification.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0011_payment_applied.sql
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS applied_at TIMESTAMP;
+
+-- orders paid online or by split payment were paid by their latest settled charge
+UPDATE payments p SET applied_at = p.updated_at
+FROM orders o
+WHERE o.id = p.order_id
+  AND o.payment_method IN ('online', 'split')
+  AND p.id = (
+      SELECT MAX(s.id) FROM payments s
+      WHERE s.order_id = o.id AND s.status IN ('settlement', 'capture')
+  )
+  AND NOT EXISTS (SELECT 1 FROM payments a WHERE a.order_id = o.id AND a.applied_at IS NOT NULL);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_applied ON payments(order_id) WHERE applied_at IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Migration 0012: expiry checks that can be put off
+-- The expiry worker handles each overdue order on its own and pushes orders it couldn't resolve, such as
+-- those whose charge the gateway couldn't report on, to orders.next_expiry_check_at so they don't hold up the rest.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0012_order_expiry_checks.sql
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS next_expiry_check_at TIMESTAMP;
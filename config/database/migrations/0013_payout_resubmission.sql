@@ -0,0 +1,8 @@
+-- Migration 0013: pending payouts submitted again in the background
+-- A payout whose submission to the provider failed stays pending; the payout worker submits it again under
+-- the same reference and pushes its next attempt to payouts.next_submit_at so it doesn't hold up the rest.
+-- Run once against databases created from an earlier ddl.sql:
+--   go run . migrate config/database/migrations/0013_payout_resubmission.sql
+
+ALTER TABLE payouts ADD COLUMN IF NOT EXISTS next_submit_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_payouts_pending ON payouts (created_at) WHERE status = 'pending';
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"dgw-technical-test/config/database"
+	"dgw-technical-test/internal/auth"
+	credit_handler "dgw-technical-test/internal/handlers/credit"
+	farmer_handler "dgw-technical-test/internal/handlers/farmer"
+	order_handler "dgw-technical-test/internal/handlers/order"
+	payout_handler "dgw-technical-test/internal/handlers/payout"
+	"dgw-technical-test/internal/middleware"
+	credit_model "dgw-technical-test/internal/models/credit"
+	"dgw-technical-test/internal/money"
+
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
+	payout_gateway "dgw-technical-test/internal/gateways/payout"
+
+	credit_service "dgw-technical-test/internal/services/credit"
+	farmer_service "dgw-technical-test/internal/services/farmer"
+	hold_service "dgw-technical-test/internal/services/hold"
+	ledger_service "dgw-technical-test/internal/services/ledger"
+	order_service "dgw-technical-test/internal/services/order"
+	payout_service "dgw-technical-test/internal/services/payout"
+	policy_service "dgw-technical-test/internal/services/policy"
+	pricing_service "dgw-technical-test/internal/services/pricing"
+
+	credit_repo "dgw-technical-test/internal/repositories/credit"
+	farmer_repo "dgw-technical-test/internal/repositories/farmer"
+	hold_repo "dgw-technical-test/internal/repositories/hold"
+	ledger_repo "dgw-technical-test/internal/repositories/ledger"
+	log_repo "dgw-technical-test/internal/repositories/log"
+	order_repo "dgw-technical-test/internal/repositories/order"
+	payment_repo "dgw-technical-test/internal/repositories/payment"
+	payout_repo "dgw-technical-test/internal/repositories/payout"
+	product_repo "dgw-technical-test/internal/repositories/product"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	review_repo "dgw-technical-test/internal/repositories/review"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/midtrans/midtrans-go"
+	"github.com/midtrans/midtrans-go/coreapi"
+)
+
+// farmerFixture holds the resources seeded for one farmer
+type farmerFixture struct {
+	ID              int
+	AwaitingOrderID int    // order awaiting payment of a pending charge
+	PaidOrderID     int    // order paid from the wallet, open for reviews
+	WalletOrderID   int    // pending order to pay from the wallet
+	OnlineOrderID   int    // pending order to charge online
+	SplitOrderID    int    // pending order to pay by split payment
+	CreditOrderID   int    // pending order to buy on credit
+	ReceivableID    int    // open receivable of an order bought on credit
+	RepaymentID     int    // pending online repayment of the receivable
+	PayoutID        int    // completed payout
+	TopUpRef        string // pending wallet top-up
+	PaymentRef      string // wallet payment, not a top-up
+}
+
+// routeTestApp is the part of the application the route tests need, wired like InitializeApp apart from authentication
+type routeTestApp struct {
+	UnitOfWork    *unitofwork.UnitOfWork
+	LedgerService *ledger_service.LedgerService
+	FarmerService *farmer_service.FarmerService
+	CreditService *credit_service.CreditService
+
+	// Router serves the farmer routes scoped by the ownership policy as the given farmer
+	Router func(farmerID int) *gin.Engine
+}
+
+// TestFarmerRoutesAreScopedToTheOwner checks that every farmer route taking the ID of an order, top-up,
+// receivable, repayment or payout answers 404 for another farmer's resource, the same as for one that
+// doesn't exist, and succeeds for the farmer's own.
+// It needs a PostgreSQL database in TEST_DATABASE_URL and recreates its tables from ddl.sql, so point it
+// at a database used for nothing else, e.g. a postgres service container in CI. The policy itself is
+// covered without a database in internal/services/policy.
+func TestFarmerRoutesAreScopedToTheOwner(t *testing.T) {
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, databaseURL)
+	if err != nil {
+		t.Fatalf("failed to connect to the test database: %v", err)
+	}
+	defer pool.Close()
+
+	ddl, err := config.ReadSQLCommands("config/database/ddl.sql")
+	if err != nil {
+		t.Fatalf("failed to read ddl.sql: %v", err)
+	}
+	if err := config.ExecuteSQLCommands(ctx, pool, ddl); err != nil {
+		t.Fatalf("failed to create the schema: %v", err)
+	}
+
+	// status checks find every charge still pending, so no order or wallet changes state
+	gateway, err := payment_gateway.NewFakeGateway("pending", "")
+	if err != nil {
+		t.Fatalf("failed to create the fake gateway: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	app := newRouteTestApp(t, pool, gateway)
+
+	owner := seedFarmer(t, ctx, pool, app, gateway, "owner")
+	other := seedFarmer(t, ctx, pool, app, gateway, "other")
+
+	review := `{"rating": 5, "comment": "good"}`
+	split := `{"wallet_amount": 20000}`
+	repayment := `{"amount": 1000, "method": "online"}`
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"order of another farmer", http.MethodGet, fmt.Sprintf("/farmers/orders/%d", other.PaidOrderID), "", http.StatusNotFound},
+		{"own order", http.MethodGet, fmt.Sprintf("/farmers/orders/%d", owner.PaidOrderID), "", http.StatusOK},
+		{"payment of another farmer", http.MethodGet, fmt.Sprintf("/farmers/check-status/%d", other.AwaitingOrderID), "", http.StatusNotFound},
+		{"own payment", http.MethodGet, fmt.Sprintf("/farmers/check-status/%d", owner.AwaitingOrderID), "", http.StatusOK},
+		{"top-up of another farmer", http.MethodGet, "/farmers/wallet/top-up/" + other.TopUpRef + "/status", "", http.StatusNotFound},
+		{"own wallet payment is not a top-up", http.MethodGet, "/farmers/wallet/top-up/" + owner.PaymentRef + "/status", "", http.StatusNotFound},
+		{"own top-up", http.MethodGet, "/farmers/wallet/top-up/" + owner.TopUpRef + "/status", "", http.StatusOK},
+		{"review of another farmer's order", http.MethodPost, fmt.Sprintf("/farmers/%d/add-review", other.PaidOrderID), review, http.StatusNotFound},
+		{"review of own order", http.MethodPost, fmt.Sprintf("/farmers/%d/add-review", owner.PaidOrderID), review, http.StatusOK},
+		{"online payment of another farmer's order", http.MethodPost, fmt.Sprintf("/farmers/pay-order/online/%d", other.OnlineOrderID), "", http.StatusNotFound},
+		{"online payment of own order", http.MethodPost, fmt.Sprintf("/farmers/pay-order/online/%d", owner.OnlineOrderID), "", http.StatusOK},
+		{"wallet payment of another farmer's order", http.MethodPost, fmt.Sprintf("/farmers/pay-order/wallet/%d", other.WalletOrderID), "", http.StatusNotFound},
+		{"wallet payment of own order", http.MethodPost, fmt.Sprintf("/farmers/pay-order/wallet/%d", owner.WalletOrderID), "", http.StatusOK},
+		{"split payment of another farmer's order", http.MethodPost, fmt.Sprintf("/farmers/pay-order/split/%d", other.SplitOrderID), split, http.StatusNotFound},
+		{"split payment of own order", http.MethodPost, fmt.Sprintf("/farmers/pay-order/split/%d", owner.SplitOrderID), split, http.StatusOK},
+		{"credit purchase of another farmer's order", http.MethodPost, fmt.Sprintf("/farmers/pay-order/credit/%d", other.CreditOrderID), "", http.StatusNotFound},
+		{"credit purchase of own order", http.MethodPost, fmt.Sprintf("/farmers/pay-order/credit/%d", owner.CreditOrderID), "", http.StatusOK},
+		{"repayment of another farmer's receivable", http.MethodPost, fmt.Sprintf("/farmers/credit/receivables/%d/repayments", other.ReceivableID), repayment, http.StatusNotFound},
+		{"repayment of own receivable", http.MethodPost, fmt.Sprintf("/farmers/credit/receivables/%d/repayments", owner.ReceivableID), repayment, http.StatusCreated},
+		{"repayment of another farmer", http.MethodGet, fmt.Sprintf("/farmers/credit/repayments/%d", other.RepaymentID), "", http.StatusNotFound},
+		{"own repayment", http.MethodGet, fmt.Sprintf("/farmers/credit/repayments/%d", owner.RepaymentID), "", http.StatusOK},
+		{"payout of another farmer", http.MethodGet, fmt.Sprintf("/farmers/wallet/payouts/%d", other.PayoutID), "", http.StatusNotFound},
+		{"own payout", http.MethodGet, fmt.Sprintf("/farmers/wallet/payouts/%d", owner.PayoutID), "", http.StatusOK},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			app.Router(owner.ID).ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Errorf("%s %s: got status %d, want %d: %s", tc.method, tc.path, rec.Code, tc.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+// newRouteTestApp wires the services and handlers of the scoped farmer routes on pool and gateway
+func newRouteTestApp(t *testing.T, pool *pgxpool.Pool, gateway payment_gateway.PaymentGateway) *routeTestApp {
+	t.Helper()
+
+	farmerRepository := farmer_repo.NewFarmerRepository(pool)
+	productRepository := product_repo.NewProductRepository(pool)
+	orderRepository := order_repo.NewOrderRepository(pool)
+	logRepository := log_repo.NewLogRepository(pool)
+	reviewRepository := review_repo.NewReviewRepository(pool)
+	paymentRepository := payment_repo.NewPaymentRepository(pool)
+	reservationRepository := reservation_repo.NewReservationRepository(pool)
+	ledgerRepository := ledger_repo.NewLedgerRepository(pool)
+	payoutRepository := payout_repo.NewPayoutRepository(pool)
+	holdRepository := hold_repo.NewHoldRepository(pool)
+	creditRepository := credit_repo.NewCreditRepository(pool)
+	unitOfWork := unitofwork.NewUnitOfWork(pool)
+
+	paymentChannels, err := payment_gateway.NewChannelCatalog()
+	if err != nil {
+		t.Fatalf("failed to create the payment channels: %v", err)
+	}
+	payoutProvider, err := payout_gateway.NewFakePayoutProvider("completed")
+	if err != nil {
+		t.Fatalf("failed to create the fake payout provider: %v", err)
+	}
+
+	ledgerService := ledger_service.NewLedgerService(ledgerRepository, unitOfWork)
+	pricingService := pricing_service.NewPricingService(productRepository)
+	ownershipPolicy := policy_service.NewOwnershipPolicy(orderRepository, farmerRepository)
+	holdService := hold_service.NewHoldService(holdRepository, farmerRepository, ledgerService)
+	creditService := credit_service.NewCreditService(creditRepository, farmerRepository, logRepository, unitOfWork, ledgerService, gateway, paymentChannels)
+	farmerService := farmer_service.NewFarmerService(farmerRepository, productRepository, orderRepository, reviewRepository, paymentRepository, reservationRepository, logRepository, unitOfWork, gateway, paymentChannels, ledgerService, pricingService, ownershipPolicy, holdService, creditService)
+	payoutService := payout_service.NewPayoutService(payoutRepository, farmerRepository, unitOfWork, ledgerService, payoutProvider)
+	orderService := order_service.NewOrderService(orderRepository)
+
+	// these routes don't log in, so the farmer handler needs no auth service
+	farmerHandler := farmer_handler.NewFarmerHandler(farmerService, nil)
+	orderHandler := order_handler.NewOrderHandler(orderService)
+	creditHandler := credit_handler.NewCreditHandler(creditService, farmerService)
+	payoutHandler := payout_handler.NewPayoutHandler(payoutService)
+
+	router := func(farmerID int) *gin.Engine {
+		router := gin.New()
+
+		// stands in for JWTAuthMiddleware
+		authMiddleware := func(c *gin.Context) {
+			auth.SetPrincipal(c, &auth.Principal{SubjectType: auth.SubjectFarmer, ID: farmerID, Role: auth.RoleFarmer})
+			c.Next()
+		}
+		farmerAccount := middleware.RequirePermission(middleware.PermFarmerAccount)
+
+		farmerRoutes := router.Group("/farmers")
+		farmerRoutes.GET("/orders/:order_id", authMiddleware, farmerAccount, orderHandler.GetFarmerOrder)
+		farmerRoutes.GET("/check-status/:order_id", authMiddleware, farmerAccount, farmerHandler.CheckAndProcessOrderStatus)
+		farmerRoutes.GET("/wallet/top-up/:order_id/status", authMiddleware, farmerAccount, farmerHandler.GetTopUpStatus)
+		farmerRoutes.GET("/wallet/payouts/:payout_id", authMiddleware, farmerAccount, payoutHandler.GetPayout)
+		farmerRoutes.POST("/pay-order/wallet/:order_id", authMiddleware, farmerAccount, farmerHandler.PayOrder)
+		farmerRoutes.POST("/pay-order/online/:order_id", authMiddleware, farmerAccount, farmerHandler.ProcessOnlinePayment)
+		farmerRoutes.POST("/pay-order/split/:order_id", authMiddleware, farmerAccount, farmerHandler.PaySplit)
+		farmerRoutes.POST("/pay-order/credit/:order_id", authMiddleware, farmerAccount, creditHandler.PayOrderOnCredit)
+		farmerRoutes.POST("/credit/receivables/:receivable_id/repayments", authMiddleware, farmerAccount, creditHandler.RepayReceivable)
+		farmerRoutes.GET("/credit/repayments/:repayment_id", authMiddleware, farmerAccount, creditHandler.GetRepayment)
+		farmerRoutes.POST("/:order_id/add-review", authMiddleware, farmerAccount, farmerHandler.AddReview)
+		return router
+	}
+
+	return &routeTestApp{
+		UnitOfWork:    unitOfWork,
+		LedgerService: ledgerService,
+		FarmerService: farmerService,
+		CreditService: creditService,
+		Router:        router,
+	}
+}
+
+// seedFarmer creates a farmer with 200,000 rupiah in the wallet, a credit facility and the resources of farmerFixture.
+// Charges and top-ups are created at the fake gateway, the receivable and the repayment through the services.
+func seedFarmer(t *testing.T, ctx context.Context, pool *pgxpool.Pool, app *routeTestApp, gateway payment_gateway.PaymentGateway, name string) farmerFixture {
+	t.Helper()
+
+	var f farmerFixture
+	err := pool.QueryRow(ctx, `INSERT INTO farmers (name, email, password) VALUES ($1, $2, 'x') RETURNING id`,
+		name, name+"@example.com").Scan(&f.ID)
+	if err != nil {
+		t.Fatalf("failed to seed farmer %s: %v", name, err)
+	}
+
+	err = app.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		return app.LedgerService.RecordTopUp(ctx, tx, f.ID, money.FromRupiah(200000), fmt.Sprintf("seed-%d", f.ID))
+	})
+	if err != nil {
+		t.Fatalf("failed to fund the wallet of %s: %v", name, err)
+	}
+	_, err = pool.Exec(ctx, `INSERT INTO credit_facilities (farmer_id, credit_limit, tenor_days, instalments) VALUES ($1, 1000000, 30, 1)`, f.ID)
+	if err != nil {
+		t.Fatalf("failed to seed the credit facility of %s: %v", name, err)
+	}
+
+	err = pool.QueryRow(ctx, `INSERT INTO orders (farmer_id, status, total_price, payment_due_at)
+		VALUES ($1, 'awaiting_payment', 50000, NOW() + INTERVAL '1 day') RETURNING id`, f.ID).Scan(&f.AwaitingOrderID)
+	if err != nil {
+		t.Fatalf("failed to seed the order awaiting payment of %s: %v", name, err)
+	}
+	err = pool.QueryRow(ctx, `INSERT INTO orders (farmer_id, status, total_price, payment_method)
+		VALUES ($1, 'paid', 50000, 'wallet') RETURNING id`, f.ID).Scan(&f.PaidOrderID)
+	if err != nil {
+		t.Fatalf("failed to seed the paid order of %s: %v", name, err)
+	}
+
+	var creditSaleOrderID int
+	for _, orderID := range []*int{&f.WalletOrderID, &f.OnlineOrderID, &f.SplitOrderID, &f.CreditOrderID, &creditSaleOrderID} {
+		*orderID = seedPendingOrder(t, ctx, pool, f.ID)
+	}
+
+	chargeRef := fmt.Sprintf("store-%d-1", f.AwaitingOrderID)
+	_, err = pool.Exec(ctx, `INSERT INTO payments (order_id, gateway_order_id, channel, payment_type, amount, status)
+		VALUES ($1, $2, 'bca_va', 'bank_transfer', 50000, 'pending')`, f.AwaitingOrderID, chargeRef)
+	if err != nil {
+		t.Fatalf("failed to seed the charge of %s: %v", name, err)
+	}
+
+	f.TopUpRef = fmt.Sprintf("topup-%d-1", f.ID)
+	f.PaymentRef = fmt.Sprintf("wallet-%d-1", f.PaidOrderID)
+	_, err = pool.Exec(ctx, `INSERT INTO wallet_transactions (farmer_id, order_id, transaction_type, amount, status)
+		VALUES ($1, $2, 'TopUp', 50000, 'pending'), ($1, $3, 'Payment', 50000, 'settlement')`, f.ID, f.TopUpRef, f.PaymentRef)
+	if err != nil {
+		t.Fatalf("failed to seed the wallet transactions of %s: %v", name, err)
+	}
+
+	for _, ref := range []string{chargeRef, f.TopUpRef} {
+		_, err := gateway.ChargeTransaction(&coreapi.ChargeReq{
+			PaymentType:        coreapi.PaymentTypeBankTransfer,
+			TransactionDetails: midtrans.TransactionDetails{OrderID: ref, GrossAmt: 50000},
+		})
+		if err != nil {
+			t.Fatalf("failed to charge %s at the fake gateway: %v", ref, err)
+		}
+	}
+
+	receivable, err := app.FarmerService.ProcessCreditPayment(ctx, f.ID, creditSaleOrderID)
+	if err != nil {
+		t.Fatalf("failed to buy an order of %s on credit: %v", name, err)
+	}
+	f.ReceivableID = receivable.ID
+	repayment, _, err := app.CreditService.Repay(ctx, f.ID, f.ReceivableID, credit_model.RepaymentRequest{Amount: money.FromRupiah(1000), Method: credit_model.RepaymentOnline})
+	if err != nil {
+		t.Fatalf("failed to seed the repayment of %s: %v", name, err)
+	}
+	f.RepaymentID = repayment.ID
+
+	err = pool.QueryRow(ctx, `INSERT INTO payouts (farmer_id, reference, amount, bank_code, account_number, account_name, status, provider_reference)
+		VALUES ($1, $2, 10000, 'bca', '1234567890', $3, 'completed', $2) RETURNING id`, f.ID, fmt.Sprintf("payout-%d-1", f.ID), name).Scan(&f.PayoutID)
+	if err != nil {
+		t.Fatalf("failed to seed the payout of %s: %v", name, err)
+	}
+	return f
+}
+
+// seedPendingOrder creates a pending order of one 50,000 rupiah unit of the first catalog product
+func seedPendingOrder(t *testing.T, ctx context.Context, pool *pgxpool.Pool, farmerID int) int {
+	t.Helper()
+
+	var orderID int
+	err := pool.QueryRow(ctx, `INSERT INTO orders (farmer_id, status, total_price, payment_due_at)
+		VALUES ($1, 'pending', 50000, NOW() + INTERVAL '1 day') RETURNING id`, farmerID).Scan(&orderID)
+	if err != nil {
+		t.Fatalf("failed to seed a pending order: %v", err)
+	}
+	_, err = pool.Exec(ctx, `INSERT INTO order_items (order_id, product_id, quantity, price) VALUES ($1, 1, 1, 50000)`, orderID)
+	if err != nil {
+		t.Fatalf("failed to seed the items of order %d: %v", orderID, err)
+	}
+	return orderID
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrInvalidClaims is returned when a verified token doesn't describe a known principal
+var ErrInvalidClaims = errors.New("invalid token claims")
+
+// Claims represents the JWT claims issued to admins and farmers.
+// The registered sub is the admin or farmer ID and jti is the session ID.
+type Claims struct {
+	SubjectType string `json:"sub_type"`
+	Role        string `json:"role"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// NewClaims builds the access token claims for a principal's session
+func NewClaims(p Principal, sessionID string, issuedAt, expiresAt time.Time) Claims {
+	return Claims{
+		SubjectType: p.SubjectType,
+		Role:        p.Role,
+		Name:        p.Name,
+		Email:       p.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   p.Subject(),
+			ID:        sessionID,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+}
+
+// Principal converts verified claims into the principal they describe
+func (c *Claims) Principal() (*Principal, error) {
+	if c.SubjectType != SubjectAdmin && c.SubjectType != SubjectFarmer {
+		return nil, ErrInvalidClaims
+	}
+	if c.ID == "" {
+		return nil, ErrInvalidClaims
+	}
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil || id <= 0 {
+		return nil, ErrInvalidClaims
+	}
+
+	return &Principal{
+		SubjectType: c.SubjectType,
+		ID:          id,
+		Role:        c.Role,
+		Name:        c.Name,
+		Email:       c.Email,
+		SessionID:   c.ID,
+	}, nil
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned when an email and password don't match an account
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// HashPassword hashes a password with bcrypt for storage
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// CheckPassword compares a stored bcrypt hash with a password, returning ErrInvalidCredentials on mismatch
+func CheckPassword(hashedPassword, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Subject types carried in the sub_type claim
+const (
+	SubjectAdmin  = "admin"
+	SubjectFarmer = "farmer"
+)
+
+// Roles carried in the role claim; admin roles match the admins.role column
+const (
+	RoleSuperAdmin = "Super Admin"
+	RoleStoreAdmin = "Store Admin"
+	RoleFarmer     = "Farmer"
+)
+
+// AdminRoles lists the roles an admin account may have
+var AdminRoles = []string{RoleSuperAdmin, RoleStoreAdmin}
+
+// IsAdminRole reports whether role is a valid admin role
+func IsAdminRole(role string) bool {
+	for _, r := range AdminRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// principalKey is the gin context key holding the *Principal of the authenticated request
+const principalKey = "principal"
+
+// Principal is the authenticated admin or farmer behind a request
+type Principal struct {
+	SubjectType string
+	ID          int // admins.id or farmers.id depending on SubjectType
+	Role        string
+	Name        string
+	Email       string
+	SessionID   string // jti of the access token, see the sessions table
+}
+
+// IsAdmin reports whether the principal is an admin
+func (p *Principal) IsAdmin() bool {
+	return p.SubjectType == SubjectAdmin
+}
+
+// IsFarmer reports whether the principal is a farmer
+func (p *Principal) IsFarmer() bool {
+	return p.SubjectType == SubjectFarmer
+}
+
+// Subject returns the ID as carried in the sub claim
+func (p *Principal) Subject() string {
+	return strconv.Itoa(p.ID)
+}
+
+// SetPrincipal places the authenticated principal on the gin context
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(principalKey, p)
+}
+
+// PrincipalFrom returns the authenticated principal; it must run behind the JWT middleware
+func PrincipalFrom(c *gin.Context) *Principal {
+	return c.MustGet(principalKey).(*Principal)
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Signer signs access tokens with the active key and verifies tokens signed by any known key
+type Signer interface {
+	// Sign signs the claims with the active key, setting its kid header
+	Sign(claims jwt.Claims) (string, error)
+	// Keyfunc resolves the verification key of a token from its kid and alg headers
+	Keyfunc(token *jwt.Token) (interface{}, error)
+	// JWKS returns the public keys clients can use to verify tokens; symmetric keys are never published
+	JWKS() JWKS
+}
+
+// Key is a signing or verification key identified by its kid
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{} // nil for keys only kept to verify tokens signed before a rotation
+	VerifyKey interface{}
+}
+
+// KeySet is the Signer backed by one active key and any number of previous keys kept for verification
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKeySet creates a KeySet signing with active and also accepting tokens signed by previous
+func NewKeySet(active *Key, previous ...*Key) (*KeySet, error) {
+	if active == nil || active.SignKey == nil {
+		return nil, errors.New("active signing key is required")
+	}
+
+	ks := &KeySet{active: active, keys: map[string]*Key{}}
+	for _, k := range append([]*Key{active}, previous...) {
+		if k.ID == "" {
+			return nil, errors.New("key ID is required")
+		}
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+	return ks, nil
+}
+
+// Sign signs the claims with the active key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.SignKey)
+}
+
+// Keyfunc looks the key up by kid and rejects tokens whose alg doesn't match the key
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
+	}
+	return key.VerifyKey, nil
+}
+
+// NewHMACKey creates an HS256 key from a shared secret
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}
+}
+
+// NewPrivateKey creates an RS256 or EdDSA signing key from an RSA or Ed25519 private key
+func NewPrivateKey(id string, private crypto.PrivateKey) (*Key, error) {
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, SignKey: k, VerifyKey: &k.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, SignKey: k, VerifyKey: k.Public()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+}
+
+// NewPublicKey creates a verification-only RS256 or EdDSA key from an RSA or Ed25519 public key
+func NewPublicKey(id string, public crypto.PublicKey) (*Key, error) {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, VerifyKey: k}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, VerifyKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", public)
+	}
+}
+
+// NewSignerFromEnv builds the KeySet configured by the JWT_* environment variables:
+//
+//	JWT_ALGORITHM              HS256 (default), RS256 or EdDSA
+//	JWT_KEY_ID                 kid of the active key (default "default")
+//	JWT_SECRET                 shared secret for HS256
+//	JWT_PRIVATE_KEY_FILE       PEM private key for RS256 or EdDSA
+//	JWT_PREVIOUS_PUBLIC_KEYS   comma separated kid=path.pem public keys still accepted after a rotation
+func NewSignerFromEnv() (*KeySet, error) {
+	kid := os.Getenv("JWT_KEY_ID")
+	if kid == "" {
+		kid = "default"
+	}
+
+	var active *Key
+	switch alg := os.Getenv("JWT_ALGORITHM"); alg {
+	case "", "HS256":
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			return nil, errors.New("JWT_SECRET not set in environment variables")
+		}
+		active = NewHMACKey(kid, []byte(secret))
+	case "RS256", "EdDSA":
+		path := os.Getenv("JWT_PRIVATE_KEY_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", alg)
+		}
+		private, err := readPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if active, err = NewPrivateKey(kid, private); err != nil {
+			return nil, err
+		}
+		if active.Method.Alg() != alg {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE holds a %s key but JWT_ALGORITHM is %s", active.Method.Alg(), alg)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", alg)
+	}
+
+	var previous []*Key
+	for _, entry := range strings.Split(os.Getenv("JWT_PREVIOUS_PUBLIC_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid JWT_PREVIOUS_PUBLIC_KEYS entry %q, want kid=path", entry)
+		}
+		public, err := readPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := NewPublicKey(id, public)
+		if err != nil {
+			return nil, err
+		}
+		previous = append(previous, key)
+	}
+
+	return NewKeySet(active, previous...)
+}
+
+// readPrivateKey reads a PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) PEM private key
+func readPrivateKey(path string) (crypto.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("failed to parse private key %s", path)
+}
+
+// readPublicKey reads a PKIX PEM public key
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return block, nil
+}
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Status is the lifecycle state of an order, stored in orders.status
+type Status string
+
+const (
+	StatusPending         Status = "pending"          // created, no payment attempt yet
+	StatusAwaitingPayment Status = "awaiting_payment" // an online charge was created and isn't settled yet
+	StatusPaid            Status = "paid"
+	StatusPacked          Status = "packed"
+	StatusShipped         Status = "shipped"
+	StatusDelivered       Status = "delivered"
+	StatusCancelled       Status = "cancelled" // cancelled by an admin, a paid order is refunded first
+	StatusRefunded        Status = "refunded"  // every unit was refunded
+	StatusExpired         Status = "expired"   // left unpaid past its payment deadline
+)
+
+// transitions is the allowed-transition table: the states each state may move to
+var transitions = map[Status][]Status{
+	StatusPending:         {StatusAwaitingPayment, StatusPaid, StatusCancelled, StatusExpired},
+	StatusAwaitingPayment: {StatusPending, StatusPaid, StatusCancelled, StatusExpired},
+	StatusPaid:            {StatusPacked, StatusCancelled, StatusRefunded},
+	StatusPacked:          {StatusShipped, StatusCancelled, StatusRefunded},
+	StatusShipped:         {StatusDelivered, StatusRefunded},
+	StatusDelivered:       {StatusRefunded},
+	StatusCancelled:       {},
+	StatusRefunded:        {},
+	StatusExpired:         {},
+}
+
+// Valid reports whether s is a known state
+func (s Status) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether an order may move from s to next
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// AwaitsPayment reports whether the order can still be paid
+func (s Status) AwaitsPayment() bool {
+	return s == StatusPending || s == StatusAwaitingPayment
+}
+
+// IsPaid reports whether the order was paid and not yet cancelled or fully refunded
+func (s Status) IsPaid() bool {
+	switch s {
+	case StatusPaid, StatusPacked, StatusShipped, StatusDelivered:
+		return true
+	}
+	return false
+}
+
+// IsTerminal reports whether no transition leaves s
+func (s Status) IsTerminal() bool {
+	return s.Valid() && len(transitions[s]) == 0
+}
+
+// ErrIllegalTransition is matched by every TransitionError with errors.Is
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// TransitionError is returned when an order is asked to move to a state the transition table doesn't allow
+type TransitionError struct {
+	OrderID int
+	From    Status
+	To      Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order %d can't move from %s to %s", e.OrderID, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// ValidateTransition returns a *TransitionError unless the order may move from from to to
+func ValidateTransition(orderID int, from, to Status) error {
+	if !from.CanTransitionTo(to) {
+		return &TransitionError{OrderID: orderID, From: from, To: to}
+	}
+	return nil
+}
+
+// Actor types recorded in order_status_history.actor_type
+const (
+	ActorAdmin  = "admin"
+	ActorFarmer = "farmer"
+	ActorSystem = "system" // background workers and payment gateway notifications
+)
+
+// Actor is who moved an order to a new state
+type Actor struct {
+	Type string
+	ID   int // admin or farmer ID, 0 for the system
+}
+
+func AdminActor(adminID int) Actor {
+	return Actor{Type: ActorAdmin, ID: adminID}
+}
+
+func FarmerActor(farmerID int) Actor {
+	return Actor{Type: ActorFarmer, ID: farmerID}
+}
+
+func SystemActor() Actor {
+	return Actor{Type: ActorSystem}
+}
@@ -0,0 +1,289 @@
+package gateways
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/midtrans/midtrans-go/coreapi"
+)
+
+// status codes returned by Midtrans for each transaction status
+var fakeStatusCodes = map[string]string{
+	"pending":    "201",
+	"settlement": "200",
+	"expire":     "407",
+	"deny":       "202",
+	"cancel":     "200",
+}
+
+// fakeCharge is a charge recorded by the fake gateway
+type fakeCharge struct {
+	TransactionID string
+	OrderID       string
+	GrossAmount   int64
+	PaymentType   string
+	Bank          string
+	VANumber      string
+	CreatedAt     time.Time
+	Status        string
+	Cancelled     bool                               // cancelled charges keep the cancel status
+	Refunded      int64                              // sum of the accepted refunds
+	Refunds       map[string]*coreapi.RefundResponse // accepted refunds by refund key
+}
+
+// FakeGateway is an in-process PaymentGateway for local development and tests.
+// Charges are always created as pending; status checks answer with the configured status.
+type FakeGateway struct {
+	mu        sync.Mutex
+	status    string
+	serverKey string
+	charges   map[string]*fakeCharge
+	seq       int
+}
+
+// NewFakeGateway creates a fake gateway whose status checks return the given status (settlement by default).
+// Notifications are signed with serverKey, which defaults to "fake-server-key".
+func NewFakeGateway(status, serverKey string) (*FakeGateway, error) {
+	if status == "" {
+		status = "settlement"
+	}
+	if serverKey == "" {
+		serverKey = "fake-server-key"
+	}
+	if _, ok := fakeStatusCodes[status]; !ok {
+		return nil, fmt.Errorf("unsupported fake payment status %q", status)
+	}
+
+	return &FakeGateway{
+		status:    status,
+		serverKey: serverKey,
+		charges:   make(map[string]*fakeCharge),
+	}, nil
+}
+
+// ChargeTransaction records the charge and answers with a pending charge carrying the payment details of its type
+func (g *FakeGateway) ChargeTransaction(req *coreapi.ChargeReq) (*coreapi.ChargeResponse, error) {
+	if req == nil || req.TransactionDetails.OrderID == "" {
+		return nil, fmt.Errorf("fake gateway: %w: order ID is required", ErrRejected)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, exists := g.charges[req.TransactionDetails.OrderID]; exists {
+		return nil, fmt.Errorf("fake gateway: %w: order ID %s has already been taken", ErrRejected, req.TransactionDetails.OrderID)
+	}
+
+	g.seq++
+	paymentType := string(req.PaymentType)
+	if paymentType == "" {
+		paymentType = string(coreapi.PaymentTypeBankTransfer)
+	}
+	bank := ""
+	if paymentType == string(coreapi.PaymentTypeBankTransfer) {
+		bank = "bca"
+		if req.BankTransfer != nil && req.BankTransfer.Bank != "" {
+			bank = string(req.BankTransfer.Bank)
+		}
+	}
+
+	charge := &fakeCharge{
+		TransactionID: fmt.Sprintf("fake-%d-%d", time.Now().UnixNano(), g.seq),
+		OrderID:       req.TransactionDetails.OrderID,
+		GrossAmount:   req.TransactionDetails.GrossAmt,
+		PaymentType:   paymentType,
+		Bank:          bank,
+		CreatedAt:     time.Now(),
+		Status:        "pending",
+		Refunds:       make(map[string]*coreapi.RefundResponse),
+	}
+	if bank != "" {
+		charge.VANumber = fmt.Sprintf("8808%08d", g.seq)
+	}
+	g.charges[charge.OrderID] = charge
+
+	resp := &coreapi.ChargeResponse{
+		TransactionID:     charge.TransactionID,
+		OrderID:           charge.OrderID,
+		GrossAmount:       strconv.FormatInt(charge.GrossAmount, 10) + ".00",
+		PaymentType:       charge.PaymentType,
+		TransactionTime:   charge.CreatedAt.Format("2006-01-02 15:04:05"),
+		TransactionStatus: charge.Status,
+		StatusCode:        fakeStatusCodes[charge.Status],
+		StatusMessage:     "Success, transaction is created",
+		Currency:          "IDR",
+		ExpiryTime:        charge.CreatedAt.Add(24 * time.Hour).Format("2006-01-02 15:04:05"),
+	}
+
+	switch coreapi.CoreapiPaymentType(charge.PaymentType) {
+	case coreapi.PaymentTypeBankTransfer:
+		resp.Bank = charge.Bank
+		if charge.Bank == "permata" {
+			resp.PermataVaNumber = charge.VANumber
+		} else {
+			resp.VaNumbers = charge.vaNumbers()
+		}
+	case coreapi.PaymentTypeEChannel:
+		resp.BillerCode = "70012"
+		resp.BillKey = fmt.Sprintf("9%011d", g.seq)
+	case coreapi.PaymentTypeQris, coreapi.PaymentTypeGopay, coreapi.PaymentTypeShopeepay:
+		base := "https://fake-gateway.local/v2/" + charge.PaymentType + "/" + charge.TransactionID
+		// like Midtrans, QRIS only answers with a QR code and ShopeePay only with a deeplink
+		if charge.PaymentType != string(coreapi.PaymentTypeShopeepay) {
+			resp.Actions = append(resp.Actions, coreapi.Action{Name: "generate-qr-code", Method: "GET", URL: base + "/qr-code"})
+		}
+		if charge.PaymentType != string(coreapi.PaymentTypeQris) {
+			resp.Actions = append(resp.Actions, coreapi.Action{Name: "deeplink-redirect", Method: "GET", URL: base + "/deeplink"})
+		} else {
+			resp.QRString = fmt.Sprintf("00020101021226620014COM.GO-JEK.WWW011893600914%08d", g.seq)
+			resp.Acquirer = "gopay"
+		}
+	case coreapi.PaymentTypeConvenienceStore:
+		if req.ConvStore != nil {
+			resp.Store = req.ConvStore.Store
+		}
+		resp.PaymentCode = fmt.Sprintf("%016d", g.seq)
+	}
+	return resp, nil
+}
+
+// vaNumbers returns the virtual account of a bank transfer charge in the shape of a status response
+func (c *fakeCharge) vaNumbers() []coreapi.VANumber {
+	if c.VANumber == "" || c.Bank == "permata" {
+		return nil
+	}
+	return []coreapi.VANumber{{Bank: c.Bank, VANumber: c.VANumber}}
+}
+
+// CheckTransaction answers with the configured status and the accepted refunds of a previously charged order ID
+func (g *FakeGateway) CheckTransaction(orderID string) (*coreapi.TransactionStatusResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, ok := g.charges[orderID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: %w: %s", ErrTransactionNotFound, orderID)
+	}
+	if !charge.Cancelled {
+		charge.Status = g.status
+	}
+
+	resp := &coreapi.TransactionStatusResponse{
+		TransactionTime:   charge.CreatedAt.Format("2006-01-02 15:04:05"),
+		GrossAmount:       strconv.FormatInt(charge.GrossAmount, 10) + ".00",
+		Currency:          "IDR",
+		OrderID:           charge.OrderID,
+		PaymentType:       charge.PaymentType,
+		StatusCode:        fakeStatusCodes[charge.Status],
+		TransactionID:     charge.TransactionID,
+		TransactionStatus: charge.Status,
+		StatusMessage:     "Success, transaction is found",
+		VaNumbers:         charge.vaNumbers(),
+	}
+	if charge.Status == "settlement" {
+		resp.SettlementTime = time.Now().Format("2006-01-02 15:04:05")
+	}
+	for _, refund := range charge.Refunds {
+		resp.Refunds = append(resp.Refunds, coreapi.RefundDetails{
+			RefundChargebackID:   refund.RefundChargebackID,
+			RefundChargebackUUID: refund.RefundChargebackUUID,
+			RefundAmount:         refund.RefundAmount,
+			RefundKey:            refund.RefundKey,
+		})
+	}
+	if charge.Refunded > 0 {
+		resp.RefundAmount = strconv.FormatInt(charge.Refunded, 10) + ".00"
+	}
+	return resp, nil
+}
+
+// RefundTransaction refunds a settled charge up to its gross amount. A refund key that was
+// already accepted answers with the original refund instead of refunding twice.
+func (g *FakeGateway) RefundTransaction(orderID string, req *coreapi.RefundReq) (*coreapi.RefundResponse, error) {
+	if req == nil || req.RefundKey == "" || req.Amount <= 0 {
+		return nil, fmt.Errorf("fake gateway: %w: refund key and a positive amount are required", ErrRejected)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, ok := g.charges[orderID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: %w: %s", ErrTransactionNotFound, orderID)
+	}
+	if resp, ok := charge.Refunds[req.RefundKey]; ok {
+		return resp, nil
+	}
+
+	// like status checks, the charge has the configured status by the time it is refunded
+	if !charge.Cancelled {
+		charge.Status = g.status
+	}
+	if charge.Status != "settlement" {
+		return nil, fmt.Errorf("fake gateway: %w: transaction %s is %s and can't be refunded", ErrRejected, orderID, charge.Status)
+	}
+	if charge.Refunded+req.Amount > charge.GrossAmount {
+		return nil, fmt.Errorf("fake gateway: %w: refund of %d exceeds the %d left on transaction %s", ErrRejected, req.Amount, charge.GrossAmount-charge.Refunded, orderID)
+	}
+
+	g.seq++
+	charge.Refunded += req.Amount
+	resp := &coreapi.RefundResponse{
+		StatusCode:           "200",
+		StatusMessage:        "Success, refund request is approved",
+		TransactionID:        charge.TransactionID,
+		OrderID:              charge.OrderID,
+		GrossAmount:          strconv.FormatInt(charge.GrossAmount, 10) + ".00",
+		Currency:             "IDR",
+		PaymentType:          charge.PaymentType,
+		TransactionTime:      charge.CreatedAt.Format("2006-01-02 15:04:05"),
+		TransactionStatus:    "partial_refund",
+		RefundChargebackID:   g.seq,
+		RefundChargebackUUID: fmt.Sprintf("fake-refund-%d-%d", time.Now().UnixNano(), g.seq),
+		RefundAmount:         strconv.FormatInt(req.Amount, 10) + ".00",
+		RefundKey:            req.RefundKey,
+	}
+	if charge.Refunded == charge.GrossAmount {
+		resp.TransactionStatus = "refund"
+	}
+	charge.Refunds[req.RefundKey] = resp
+	return resp, nil
+}
+
+// CancelTransaction cancels a charge that hasn't settled by the time it is cancelled
+func (g *FakeGateway) CancelTransaction(orderID string) (*coreapi.CancelResponse, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	charge, ok := g.charges[orderID]
+	if !ok {
+		return nil, fmt.Errorf("fake gateway: %w: %s", ErrTransactionNotFound, orderID)
+	}
+	if !charge.Cancelled {
+		charge.Status = g.status
+	}
+	if charge.Status == "settlement" {
+		return nil, fmt.Errorf("fake gateway: %w: transaction %s is %s and can't be cancelled", ErrRejected, orderID, charge.Status)
+	}
+	charge.Status = "cancel"
+	charge.Cancelled = true
+
+	return &coreapi.CancelResponse{
+		TransactionID:     charge.TransactionID,
+		OrderID:           charge.OrderID,
+		GrossAmount:       strconv.FormatInt(charge.GrossAmount, 10) + ".00",
+		PaymentType:       charge.PaymentType,
+		TransactionTime:   charge.CreatedAt.Format("2006-01-02 15:04:05"),
+		TransactionStatus: charge.Status,
+		StatusCode:        fakeStatusCodes[charge.Status],
+		StatusMessage:     "Success, transaction is canceled",
+		Currency:          "IDR",
+	}, nil
+}
+
+// VerifySignature checks a notification signature against the fake server key
+func (g *FakeGateway) VerifySignature(orderID, statusCode, grossAmount, signatureKey string) bool {
+	return verifySignature(orderID, statusCode, grossAmount, g.serverKey, signatureKey)
+}
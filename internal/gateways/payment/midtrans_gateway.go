@@ -0,0 +1,77 @@
+package gateways
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/midtrans/midtrans-go"
+	"github.com/midtrans/midtrans-go/coreapi"
+)
+
+// MidtransGateway is the PaymentGateway backed by the Midtrans Core API
+type MidtransGateway struct {
+	Client    coreapi.Client
+	ServerKey string
+}
+
+// NewMidtransGateway creates a Midtrans Core API gateway for the sandbox environment
+func NewMidtransGateway(serverKey string) *MidtransGateway {
+	client := coreapi.Client{}
+	client.New(serverKey, midtrans.Sandbox)
+	return &MidtransGateway{Client: client, ServerKey: serverKey}
+}
+
+// ChargeTransaction sends the charge request to Midtrans
+func (g *MidtransGateway) ChargeTransaction(req *coreapi.ChargeReq) (*coreapi.ChargeResponse, error) {
+	resp, err := g.Client.ChargeTransaction(req)
+	if err != nil {
+		return nil, midtransError(err)
+	}
+	return resp, nil
+}
+
+// CheckTransaction fetches the transaction status from Midtrans
+func (g *MidtransGateway) CheckTransaction(orderID string) (*coreapi.TransactionStatusResponse, error) {
+	resp, err := g.Client.CheckTransaction(orderID)
+	if err != nil {
+		return nil, midtransError(err)
+	}
+	return resp, nil
+}
+
+// RefundTransaction asks Midtrans to refund a settled transaction
+func (g *MidtransGateway) RefundTransaction(orderID string, req *coreapi.RefundReq) (*coreapi.RefundResponse, error) {
+	resp, err := g.Client.RefundTransaction(orderID, req)
+	if err != nil {
+		return nil, midtransError(err)
+	}
+	return resp, nil
+}
+
+// CancelTransaction asks Midtrans to cancel a transaction before it settles
+func (g *MidtransGateway) CancelTransaction(orderID string) (*coreapi.CancelResponse, error) {
+	resp, err := g.Client.CancelTransaction(orderID)
+	if err != nil {
+		return nil, midtransError(err)
+	}
+	return resp, nil
+}
+
+// VerifySignature checks a notification signature against the Midtrans server key
+func (g *MidtransGateway) VerifySignature(orderID, statusCode, grossAmount, signatureKey string) bool {
+	return verifySignature(orderID, statusCode, grossAmount, g.ServerKey, signatureKey)
+}
+
+// midtransError wraps ErrTransactionNotFound or ErrRejected around the errors of requests Midtrans answered
+// and refused. Transport errors, timeouts, rate limits and server errors are returned as they are, since
+// Midtrans may have acted on the request.
+func midtransError(err *midtrans.Error) error {
+	code := err.GetStatusCode()
+	switch {
+	case code == http.StatusNotFound:
+		return fmt.Errorf("%w: %v", ErrTransactionNotFound, err)
+	case code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package gateways
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/midtrans/midtrans-go"
+	"github.com/midtrans/midtrans-go/coreapi"
+)
+
+// Payment channels a farmer can pay an order or a top-up with
+const (
+	ChannelBCAVA       = "bca_va"
+	ChannelBNIVA       = "bni_va"
+	ChannelBRIVA       = "bri_va"
+	ChannelPermataVA   = "permata_va"
+	ChannelMandiriBill = "mandiri_bill"
+	ChannelQRIS        = "qris"
+	ChannelGopay       = "gopay"
+	ChannelShopeePay   = "shopeepay"
+	ChannelIndomaret   = "indomaret"
+	ChannelAlfamart    = "alfamart"
+)
+
+// DefaultChannel is used when a request names no channel, the BCA virtual account charged before channels existed
+const DefaultChannel = ChannelBCAVA
+
+// ErrChannelUnavailable is returned for a channel that is unknown or not enabled by PAYMENT_CHANNELS
+var ErrChannelUnavailable = errors.New("payment channel is not available")
+
+// Channel is a way of paying an online charge and the Core API charge type behind it
+type Channel struct {
+	Code        string                     `json:"code"`
+	Name        string                     `json:"name"`
+	PaymentType coreapi.CoreapiPaymentType `json:"payment_type"`
+	bank        midtrans.Bank              // virtual account bank
+	store       string                     // convenience store of a cstore charge
+}
+
+// supportedChannels lists every channel in the order they are offered to farmers
+var supportedChannels = []Channel{
+	{Code: ChannelBCAVA, Name: "BCA Virtual Account", PaymentType: coreapi.PaymentTypeBankTransfer, bank: midtrans.BankBca},
+	{Code: ChannelBNIVA, Name: "BNI Virtual Account", PaymentType: coreapi.PaymentTypeBankTransfer, bank: midtrans.BankBni},
+	{Code: ChannelBRIVA, Name: "BRI Virtual Account", PaymentType: coreapi.PaymentTypeBankTransfer, bank: midtrans.BankBri},
+	{Code: ChannelPermataVA, Name: "Permata Virtual Account", PaymentType: coreapi.PaymentTypeBankTransfer, bank: midtrans.BankPermata},
+	{Code: ChannelMandiriBill, Name: "Mandiri Bill Payment", PaymentType: coreapi.PaymentTypeEChannel},
+	{Code: ChannelQRIS, Name: "QRIS", PaymentType: coreapi.PaymentTypeQris},
+	{Code: ChannelGopay, Name: "GoPay", PaymentType: coreapi.PaymentTypeGopay},
+	{Code: ChannelShopeePay, Name: "ShopeePay", PaymentType: coreapi.PaymentTypeShopeepay},
+	{Code: ChannelIndomaret, Name: "Indomaret", PaymentType: coreapi.PaymentTypeConvenienceStore, store: "indomaret"},
+	{Code: ChannelAlfamart, Name: "Alfamart", PaymentType: coreapi.PaymentTypeConvenienceStore, store: "alfamart"},
+}
+
+// Instructions tell the payer how to complete a pending charge; only the fields of the channel are set
+type Instructions struct {
+	Channel     string `json:"channel"`
+	PaymentType string `json:"payment_type"`
+	Message     string `json:"message"`
+	Bank        string `json:"bank,omitempty"`
+	VANumber    string `json:"va_number,omitempty"`
+	BillerCode  string `json:"biller_code,omitempty"`  // Mandiri bill payment
+	BillKey     string `json:"bill_key,omitempty"`     // Mandiri bill payment
+	QRString    string `json:"qr_string,omitempty"`    // QRIS payload to render as a QR code
+	QRCodeURL   string `json:"qr_code_url,omitempty"`  // QR code image for QRIS and e-wallets
+	DeeplinkURL string `json:"deeplink_url,omitempty"` // opens the e-wallet app on mobile
+	Store       string `json:"store,omitempty"`
+	PaymentCode string `json:"payment_code,omitempty"` // shown at the convenience store cashier
+	ExpiryTime  string `json:"expiry_time,omitempty"`
+}
+
+// ChannelCatalog holds the channels enabled for this deployment
+type ChannelCatalog struct {
+	enabled     []Channel
+	callbackURL string
+}
+
+// NewChannelCatalog enables the channels listed in the comma separated PAYMENT_CHANNELS env var, every
+// supported channel when it is unset. E-wallets send the payer back to PAYMENT_CALLBACK_URL when it is set.
+func NewChannelCatalog() (*ChannelCatalog, error) {
+	catalog := &ChannelCatalog{callbackURL: os.Getenv("PAYMENT_CALLBACK_URL")}
+
+	value := strings.TrimSpace(os.Getenv("PAYMENT_CHANNELS"))
+	if value == "" {
+		catalog.enabled = supportedChannels
+		return catalog, nil
+	}
+
+	for _, code := range strings.Split(value, ",") {
+		channel, ok := supportedChannel(strings.ToLower(strings.TrimSpace(code)))
+		if !ok {
+			return nil, fmt.Errorf("unknown payment channel %q in PAYMENT_CHANNELS", code)
+		}
+		catalog.enabled = append(catalog.enabled, channel)
+	}
+	return catalog, nil
+}
+
+func supportedChannel(code string) (Channel, bool) {
+	for _, channel := range supportedChannels {
+		if channel.Code == code {
+			return channel, true
+		}
+	}
+	return Channel{}, false
+}
+
+// Enabled returns the enabled channels
+func (c *ChannelCatalog) Enabled() []Channel {
+	return c.enabled
+}
+
+// Default returns the code of the channel used when a request names none
+func (c *ChannelCatalog) Default() string {
+	channel, err := c.Lookup("")
+	if err != nil {
+		return ""
+	}
+	return channel.Code
+}
+
+// Lookup returns an enabled channel by its code. An empty code selects DefaultChannel, or the first
+// enabled channel when the default is disabled.
+func (c *ChannelCatalog) Lookup(code string) (Channel, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	for _, channel := range c.enabled {
+		if channel.Code == code || (code == "" && channel.Code == DefaultChannel) {
+			return channel, nil
+		}
+	}
+	if code == "" && len(c.enabled) > 0 {
+		return c.enabled[0], nil
+	}
+	return Channel{}, fmt.Errorf("%w: %q", ErrChannelUnavailable, code)
+}
+
+// ChargeRequest builds the Core API charge of amount whole rupiah through the channel
+func (c *ChannelCatalog) ChargeRequest(channel Channel, orderID string, amount int64, description string) *coreapi.ChargeReq {
+	req := &coreapi.ChargeReq{
+		PaymentType: channel.PaymentType,
+		TransactionDetails: midtrans.TransactionDetails{
+			OrderID:  orderID,
+			GrossAmt: amount,
+		},
+		CustomField1: &description,
+	}
+
+	switch channel.PaymentType {
+	case coreapi.PaymentTypeBankTransfer:
+		req.BankTransfer = &coreapi.BankTransferDetails{Bank: channel.bank}
+	case coreapi.PaymentTypeEChannel:
+		// bill info is printed on the Mandiri bill, both lines are required
+		req.EChannel = &coreapi.EChannelDetail{BillInfo1: "Payment for:", BillInfo2: orderID}
+	case coreapi.PaymentTypeQris:
+		req.Qris = &coreapi.QrisDetails{Acquirer: "gopay"}
+	case coreapi.PaymentTypeGopay:
+		req.Gopay = &coreapi.GopayDetails{EnableCallback: c.callbackURL != "", CallbackUrl: c.callbackURL}
+	case coreapi.PaymentTypeShopeepay:
+		req.ShopeePay = &coreapi.ShopeePayDetails{CallbackUrl: c.callbackURL}
+	case coreapi.PaymentTypeConvenienceStore:
+		req.ConvStore = &coreapi.ConvStoreDetails{Store: channel.store, Message: description}
+	}
+	return req
+}
+
+// InstructionsFor extracts what the payer needs from the charge response of the channel
+func InstructionsFor(channel Channel, resp *coreapi.ChargeResponse) *Instructions {
+	in := &Instructions{
+		Channel:     channel.Code,
+		PaymentType: string(channel.PaymentType),
+		ExpiryTime:  resp.ExpiryTime,
+	}
+
+	switch channel.PaymentType {
+	case coreapi.PaymentTypeBankTransfer:
+		in.Bank = string(channel.bank)
+		// Permata answers with its own field instead of va_numbers
+		in.VANumber = resp.PermataVaNumber
+		if in.VANumber == "" && len(resp.VaNumbers) > 0 {
+			in.VANumber = resp.VaNumbers[0].VANumber
+		}
+		in.Message = fmt.Sprintf("Transfer the exact amount to %s virtual account %s", strings.ToUpper(in.Bank), in.VANumber)
+	case coreapi.PaymentTypeEChannel:
+		in.Bank = string(midtrans.BankMandiri)
+		in.BillerCode = resp.BillerCode
+		in.BillKey = resp.BillKey
+		in.Message = fmt.Sprintf("Pay through Mandiri bill payment with biller code %s and bill key %s", in.BillerCode, in.BillKey)
+	case coreapi.PaymentTypeQris, coreapi.PaymentTypeGopay, coreapi.PaymentTypeShopeepay:
+		in.QRString = resp.QRString
+		for _, action := range resp.Actions {
+			switch action.Name {
+			case "generate-qr-code":
+				in.QRCodeURL = action.URL
+			case "deeplink-redirect":
+				in.DeeplinkURL = action.URL
+			}
+		}
+		if channel.PaymentType == coreapi.PaymentTypeQris {
+			in.Message = "Scan the QR code with any QRIS enabled banking or e-wallet app"
+		} else {
+			in.Message = fmt.Sprintf("Open the deeplink on your phone or scan the QR code to pay with %s", channel.Name)
+		}
+	case coreapi.PaymentTypeConvenienceStore:
+		in.Store = channel.store
+		in.PaymentCode = resp.PaymentCode
+		in.Message = fmt.Sprintf("Show payment code %s at any %s cashier", in.PaymentCode, channel.Name)
+	}
+	return in
+}
@@ -0,0 +1,69 @@
+package gateways
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/midtrans/midtrans-go/coreapi"
+)
+
+var (
+	// ErrRejected is wrapped around the errors of requests the gateway answered and refused. Other errors,
+	// such as timeouts and server errors, leave it unknown whether the gateway acted on the request.
+	ErrRejected = errors.New("rejected by the payment gateway")
+	// ErrTransactionNotFound is returned when the gateway has no transaction with the order ID
+	ErrTransactionNotFound = fmt.Errorf("%w: transaction not found", ErrRejected)
+)
+
+// PaymentGateway abstracts the payment provider used for online charges and status checks
+type PaymentGateway interface {
+	// ChargeTransaction creates a new charge at the payment provider
+	ChargeTransaction(req *coreapi.ChargeReq) (*coreapi.ChargeResponse, error)
+
+	// CheckTransaction retrieves the current status of a charge by its gateway order ID
+	CheckTransaction(orderID string) (*coreapi.TransactionStatusResponse, error)
+
+	// RefundTransaction returns part or all of a settled charge to the payer. The refund key makes
+	// the call idempotent, so a refund can be submitted again after an error.
+	RefundTransaction(orderID string, req *coreapi.RefundReq) (*coreapi.RefundResponse, error)
+
+	// CancelTransaction cancels a charge that wasn't paid yet, so it can no longer be paid
+	CancelTransaction(orderID string) (*coreapi.CancelResponse, error)
+
+	// VerifySignature checks the signature_key sent with an HTTP notification
+	VerifySignature(orderID, statusCode, grossAmount, signatureKey string) bool
+}
+
+// NewPaymentGateway builds the payment gateway selected by the PAYMENT_GATEWAY env var ("midtrans" or "fake")
+func NewPaymentGateway() (PaymentGateway, error) {
+	provider := strings.ToLower(os.Getenv("PAYMENT_GATEWAY"))
+
+	switch provider {
+	case "", "midtrans":
+		return NewMidtransGateway(os.Getenv("MIDTRANS_SERVER_KEY")), nil
+	case "fake":
+		return NewFakeGateway(os.Getenv("FAKE_PAYMENT_STATUS"), os.Getenv("FAKE_PAYMENT_SERVER_KEY"))
+	default:
+		return nil, fmt.Errorf("unknown payment gateway %q", provider)
+	}
+}
+
+// SignatureKey computes the Midtrans notification signature: SHA512(order_id+status_code+gross_amount+server_key)
+func SignatureKey(orderID, statusCode, grossAmount, serverKey string) string {
+	sum := sha512.Sum512([]byte(orderID + statusCode + grossAmount + serverKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifySignature compares the expected signature with the received one in constant time
+func verifySignature(orderID, statusCode, grossAmount, serverKey, signatureKey string) bool {
+	if serverKey == "" || signatureKey == "" {
+		return false
+	}
+	expected := SignatureKey(orderID, statusCode, grossAmount, serverKey)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(signatureKey)) == 1
+}
@@ -0,0 +1,74 @@
+package gateways
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FakePayoutProvider is an in-process PayoutProvider for local development and tests.
+// Every disbursement ends in the configured status: completed, failed, or pending (never resolves).
+type FakePayoutProvider struct {
+	mu            sync.Mutex
+	status        string
+	disbursements map[string]*Disbursement
+}
+
+// NewFakePayoutProvider creates a fake provider resolving disbursements with status (completed by default)
+func NewFakePayoutProvider(status string) (*FakePayoutProvider, error) {
+	if status == "" {
+		status = DisbursementCompleted
+	}
+	switch status {
+	case DisbursementPending, DisbursementCompleted, DisbursementFailed:
+	default:
+		return nil, fmt.Errorf("unsupported fake payout status %q", status)
+	}
+
+	return &FakePayoutProvider{
+		status:        status,
+		disbursements: make(map[string]*Disbursement),
+	}, nil
+}
+
+// CreateDisbursement records the transfer and answers with the configured status
+func (p *FakePayoutProvider) CreateDisbursement(ctx context.Context, req DisbursementRequest) (*Disbursement, error) {
+	if req.Reference == "" || req.Amount <= 0 {
+		return nil, fmt.Errorf("fake payout provider: reference and a positive amount are required")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if d, ok := p.disbursements[req.Reference]; ok {
+		copy := *d
+		return &copy, nil
+	}
+
+	d := &Disbursement{
+		Reference:         req.Reference,
+		ProviderReference: fmt.Sprintf("fake-po-%d", time.Now().UnixNano()),
+		Status:            p.status,
+	}
+	if d.Status == DisbursementFailed {
+		d.FailureReason = "rejected by fake payout provider"
+	}
+	p.disbursements[req.Reference] = d
+
+	copy := *d
+	return &copy, nil
+}
+
+// GetDisbursement answers with the recorded transfer
+func (p *FakePayoutProvider) GetDisbursement(ctx context.Context, reference string) (*Disbursement, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	d, ok := p.disbursements[reference]
+	if !ok {
+		return nil, fmt.Errorf("fake payout provider: disbursement %s doesn't exist", reference)
+	}
+	copy := *d
+	return &copy, nil
+}
@@ -0,0 +1,58 @@
+package gateways
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Disbursement statuses reported by a payout provider
+const (
+	DisbursementPending   = "pending"
+	DisbursementCompleted = "completed"
+	DisbursementFailed    = "failed"
+)
+
+// DisbursementRequest asks the provider to transfer money to a farmer's bank account
+type DisbursementRequest struct {
+	Reference     string // our payout reference, used by the provider for idempotency
+	Amount        int64  // IDR
+	BankCode      string
+	AccountNumber string
+	AccountName   string
+	Description   string
+}
+
+// Disbursement is the provider's view of a transfer
+type Disbursement struct {
+	Reference         string
+	ProviderReference string
+	Status            string
+	FailureReason     string
+}
+
+// PayoutProvider abstracts the disbursement API used to pay wallet money out to bank accounts
+type PayoutProvider interface {
+	// CreateDisbursement submits a transfer; submitting the same reference twice returns the existing transfer
+	CreateDisbursement(ctx context.Context, req DisbursementRequest) (*Disbursement, error)
+
+	// GetDisbursement retrieves the current status of a transfer by our reference
+	GetDisbursement(ctx context.Context, reference string) (*Disbursement, error)
+}
+
+// NewPayoutProvider builds the payout provider selected by the PAYOUT_PROVIDER env var.
+// Only the in-process fake is available until a disbursement API is contracted. The fake moves no
+// money, so it has to be chosen explicitly and an unset provider is an error.
+func NewPayoutProvider() (PayoutProvider, error) {
+	provider := strings.ToLower(os.Getenv("PAYOUT_PROVIDER"))
+
+	switch provider {
+	case "fake":
+		return NewFakePayoutProvider(os.Getenv("FAKE_PAYOUT_STATUS"))
+	case "":
+		return nil, fmt.Errorf("PAYOUT_PROVIDER is not set, use fake for local development")
+	default:
+		return nil, fmt.Errorf("unknown payout provider %q", provider)
+	}
+}
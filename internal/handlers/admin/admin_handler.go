@@ -1,55 +1,137 @@
 package handlers
 
 import (
+	"dgw-technical-test/internal/auth"
+	"dgw-technical-test/internal/middleware"
+	domain "dgw-technical-test/internal/domain/order"
 	admin_model    "dgw-technical-test/internal/models/admin"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
 
 	admin_services "dgw-technical-test/internal/services/admin"
+	refund_services "dgw-technical-test/internal/services/refund"
+	farmer_services "dgw-technical-test/internal/services/farmer"
 	purchase_services "dgw-technical-test/internal/services/purchase"	
+	pricing_services "dgw-technical-test/internal/services/pricing"
+	auth_services "dgw-technical-test/internal/services/auth"
 	
+	"errors"
 	"strconv"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/jackc/pgx/v5"
 )
 
 type AdminHandler struct {
 	AdminService *admin_services.AdminService
 	PurchaseService *purchase_services.PurchaseService
+	AuthService *auth_services.AuthService
 }
 
-func NewAdminHandler(adminService *admin_services.AdminService, purchaseService *purchase_services.PurchaseService) *AdminHandler {
+func NewAdminHandler(adminService *admin_services.AdminService, purchaseService *purchase_services.PurchaseService, authService *auth_services.AuthService) *AdminHandler {
 	return &AdminHandler{
 		AdminService: adminService,
 		PurchaseService: purchaseService,
+		AuthService: authService,
 	}
 }
 
-// RegisterAdmin godoc
-// @Summary Register a new admin
-// @Description Register a new administrator with name, email, password, and role.
-// @Tags admin
+// CreateInvitation godoc
+// @Summary Invite a new admin
+// @Description Super Admin invites a new admin by email and role. The returned single-use token is shown only once and must be sent to the invitee.
+// @Tags Admin
 // @Accept json
 // @Produce json
-// @Param admin body admin_model.RegisterRequest true "Admin Registration Data"
-// @Success 200 {object} map[string]interface{} "message: Admin registered successfully"
-// @Failure 400 {object} map[string]string "message: Invalid request"
-// @Failure 500 {object} map[string]string "message: Could not register admin"
-// @Router /admins/register [post]
-func (h *AdminHandler) RegisterAdmin(c *gin.Context) {
-	var req admin_model.RegisterRequest
-	if err := c.Bind(&req); err != nil {
+// @Param Authorization header string true "Bearer token"
+// @Param invitation body admin_model.InvitationRequest true "Invitation Data"
+// @Success 201 {object} map[string]interface{} "message: Invitation created, invitation_id, email, role, token, expires_at"
+// @Failure 400 {object} map[string]string "message: Invalid request, email or role"
+// @Failure 403 {object} map[string]string "message: Forbidden"
+// @Failure 404 {object} map[string]string "message: Admin not found"
+// @Failure 409 {object} map[string]string "message: Admin already exists"
+// @Failure 500 {object} map[string]string "message: Could not create invitation"
+// @Router /admins/invitations [post]
+func (h *AdminHandler) CreateInvitation(c *gin.Context) {
+	var req admin_model.InvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Request"})
 		return
 	}
 
-	err := h.AdminService.RegisterAdmin(req.Name, req.Email, req.Password, req.Role)
+	// the inviting admin must still exist
+	admin, err := h.AdminService.GetAdminByID(c.Request.Context(), auth.PrincipalFrom(c).ID)
 	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Admin not found"})
+		return
+	}
+
+	invitation, token, err := h.AdminService.CreateInvitation(c.Request.Context(), admin.ID, req.Email, req.Role)
+	switch {
+	case errors.Is(err, admin_services.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid role, must be one of Super Admin or Store Admin"})
+		return
+	case errors.Is(err, admin_services.ErrInvalidAdminData):
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid email"})
+		return
+	case errors.Is(err, admin_services.ErrAdminExists):
+		c.JSON(http.StatusConflict, gin.H{"message": "Admin already exists"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create invitation"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Invitation created",
+		"invitation_id": invitation.ID,
+		"email":         invitation.Email,
+		"role":          invitation.Role,
+		"token":         token,
+		"expires_at":    invitation.ExpiresAt,
+	})
+}
+
+// AcceptInvitation godoc
+// @Summary Accept an admin invitation
+// @Description Redeem a single-use invitation token to create the invited admin account with a name and password.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param invitation body admin_model.AcceptInvitationRequest true "Invitation Token and Account Data"
+// @Success 201 {object} map[string]interface{} "message: Admin registered successfully, email, role"
+// @Failure 400 {object} map[string]string "message: Invalid request, name or password"
+// @Failure 404 {object} map[string]string "message: Invitation is invalid or expired"
+// @Failure 409 {object} map[string]string "message: Admin already exists"
+// @Failure 500 {object} map[string]string "message: Could not register admin"
+// @Router /admins/invitations/accept [post]
+func (h *AdminHandler) AcceptInvitation(c *gin.Context) {
+	var req admin_model.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Request"})
+		return
+	}
+
+	invitation, err := h.AdminService.AcceptInvitation(c.Request.Context(), req.Token, req.Name, req.Password)
+	switch {
+	case errors.Is(err, admin_services.ErrInvalidAdminData):
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Name is required and password must be at least 8 characters"})
+		return
+	case errors.Is(err, admin_services.ErrInvalidInvitation):
+		c.JSON(http.StatusNotFound, gin.H{"message": "Invitation is invalid or expired"})
+		return
+	case errors.Is(err, admin_services.ErrAdminExists):
+		c.JSON(http.StatusConflict, gin.H{"message": "Admin already exists"})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not register admin"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Admin registered successfully"})
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Admin registered successfully",
+		"email":   invitation.Email,
+		"role":    invitation.Role,
+	})
 }
 
 // LoginAdmin godoc
@@ -59,9 +141,10 @@ func (h *AdminHandler) RegisterAdmin(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param admin body admin_model.LoginRequest true "Admin Login Data"
-// @Success 200 {object} map[string]interface{} "token, name, email: Admin login data"
+// @Success 200 {object} admin_model.LoginResponse "Access token, refresh token and admin info"
 // @Failure 400 {object} map[string]string "message: Invalid request"
 // @Failure 401 {object} map[string]string "message: Invalid email or password"
+// @Failure 500 {object} map[string]string "message: Could not log in"
 // @Router /admins/login [post]
 func (h *AdminHandler) LoginAdmin(c *gin.Context) {
 	var req admin_model.LoginRequest
@@ -70,40 +153,45 @@ func (h *AdminHandler) LoginAdmin(c *gin.Context) {
 		return
 	}
 
-	adminData, err := h.AdminService.LoginAdmin(req.Email, req.Password)
-	if err != nil {
+	adminData, tokens, err := h.AuthService.Login(c.Request.Context(), auth.SubjectAdmin, req.Email, req.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid email or password"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not log in"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": adminData.JWTToken,
-		"name":  adminData.Name,
-		"email": adminData.Email,
+	c.JSON(http.StatusOK, admin_model.LoginResponse{
+		Token:                 tokens.AccessToken,
+		ExpiresAt:             tokens.AccessTokenExpiresAt,
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt,
+		Name:                  adminData.Name,
+		Email:                 adminData.Email,
+		Role:                  adminData.Role,
 	})
 }
 
 // FacilitatePurchase godoc
 // @Summary Facilitate a purchase for a farmer
-// @Description Admin facilitates a purchase by logging the order and adjusting inventory
+// @Description Admin facilitates a purchase by logging the order and reserving its stock until the order is paid, cancelled or the reservation expires
 // @Tags Admin
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token"
 // @Param farmerID path int true "Farmer ID"
 // @Param request body purchase_services.FacilitatePurchaseRequest true "Purchase Request Data"
-// @Success 200 {object} map[string]interface{} "message: Purchase facilitated successfully"
-// @Failure 400 {object} map[string]string "message: Invalid request body or farmer ID"
+// @Success 200 {object} map[string]interface{} "message: Purchase facilitated successfully, order_id, total_price, payment_due_at, reserved_until"
+// @Failure 400 {object} map[string]string "message: Invalid request body, farmer ID or order items"
 // @Failure 404 {object} map[string]string "message: Admin not found"
+// @Failure 409 {object} map[string]string "message: Insufficient stock"
 // @Failure 500 {object} map[string]string "message: Failed to facilitate purchase"
 // @Router /admins/facilitate-purchase/{farmerID} [post]
 func (h *AdminHandler) FacilitatePurchase(c *gin.Context) {
-	// authentication - extract admin ID from JWT claims
-	user := c.MustGet("user").(jwt.MapClaims)
-	adminEmail := user["email"].(string) // access the adminEmail
-
-	// Assuming admin.ID exists and GetAdminByEmail returns an admin object which includes an ID
-	if admin, err := h.AdminService.GetAdminByEmail(adminEmail); err != nil {
+	// authentication - the admin ID comes from the authenticated principal; make sure the admin still exists
+	if admin, err := h.AdminService.GetAdminByID(c.Request.Context(), auth.PrincipalFrom(c).ID); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Admin not found"})
 		return
 	} else {
@@ -131,36 +219,51 @@ func (h *AdminHandler) FacilitatePurchase(c *gin.Context) {
 		req.FarmerID = farmerIDInt 
 
 		// Now use admin.ID in your service call
-		if err := h.PurchaseService.FacilitatePurchase(c.Request.Context(), admin.ID, req); err != nil {
+		result, err := h.PurchaseService.FacilitatePurchase(c.Request.Context(), admin.ID, req)
+		if errors.Is(err, reservation_repo.ErrInsufficientStock) {
+			c.JSON(http.StatusConflict, gin.H{"message": "Insufficient stock", "error": err.Error()})
+			return
+		}
+		if errors.Is(err, pricing_services.ErrInvalidQuantity) || errors.Is(err, pricing_services.ErrProductNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid order items", "error": err.Error()})
+			return
+		}
+		if err != nil {
+			// the order is placed in one transaction that was rolled back, so it can be retried under the same key
+			middleware.ReleaseIdempotencyKey(c)
 			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to facilitate purchase", "error": err.Error()})
 			return
 		}
-	}
 
-	// purchase facilitated successfully!
-	c.JSON(http.StatusOK, gin.H{"message": "Purchase facilitated successfully"})
+		// purchase facilitated successfully!
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Purchase facilitated successfully",
+			"order_id":       result.OrderID,
+			"total_price":    result.TotalPrice,
+			"payment_due_at": result.PaymentDueAt,
+			"reserved_until": result.ReservedUntil,
+		})
+	}
 }
 
 // CancelOrderHandler godoc
 // @Summary Cancel an order
-// @Description Admin cancels an order
+// @Description Admin cancels an order. An unpaid order releases its reserved stock, and a charge it awaits is cancelled at the payment gateway first; a paid order, or one whose charge settled before it could be cancelled, is refunded to the wallet or through the payment gateway, the way it was paid, and its items are restocked.
 // @Tags Admin
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer token"
 // @Param orderID path int true "Order ID"
-// @Success 200 {object} map[string]interface{} "message: Order cancelled successfully"
+// @Success 200 {object} map[string]interface{} "message: Order cancelled successfully, refund: the refund of a paid order"
 // @Failure 400 {object} map[string]string "error: Invalid order ID"
-// @Failure 404 {object} map[string]string "message: Admin not found"
+// @Failure 404 {object} map[string]string "message: Admin not found / error: Order not found"
+// @Failure 409 {object} map[string]string "error: Order can't be cancelled / A charge of the order is still pending"
 // @Failure 500 {object} map[string]string "error: Failed to cancel order"
+// @Failure 502 {object} map[string]string "error: Payment gateway couldn't cancel the pending charge"
 // @Router /admins/cancel-order/{orderID} [put]
 func (h *AdminHandler) CancelOrderHandler(c *gin.Context) {
-	// authentication - extract admin ID from JWT claims
-	user := c.MustGet("user").(jwt.MapClaims)
-	adminEmail := user["email"].(string)
-
-	// Retrieve admin from database to get adminID
-	admin, err := h.AdminService.GetAdminByEmail(adminEmail)
+	// authentication - the admin ID comes from the authenticated principal; make sure the admin still exists
+	admin, err := h.AdminService.GetAdminByID(c.Request.Context(), auth.PrincipalFrom(c).ID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Admin not found"})
 		return
@@ -175,14 +278,85 @@ func (h *AdminHandler) CancelOrderHandler(c *gin.Context) {
 	}
 
 	// Invoke CancelOrder service by admin
-	if err := h.PurchaseService.CancelOrder(c.Request.Context(), admin.ID, orderID); err != nil {
+	refund, err := h.PurchaseService.CancelOrder(c.Request.Context(), admin.ID, orderID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.Is(err, refund_services.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	case errors.Is(err, domain.ErrIllegalTransition), errors.Is(err, refund_services.ErrOrderNotRefundable), errors.Is(err, refund_services.ErrInvalidRefund):
+		c.JSON(http.StatusConflict, gin.H{"error": "Order can't be cancelled", "details": err.Error()})
+		return
+	case errors.Is(err, farmer_services.ErrChargePending):
+		c.JSON(http.StatusConflict, gin.H{"error": "A charge of the order is still pending, try again", "details": err.Error()})
+		return
+	case errors.Is(err, farmer_services.ErrChargeUnresolved):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Payment gateway couldn't cancel the pending charge, try again", "details": err.Error()})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order", "details": err.Error()})
 		return
 	}
 
+	if refund != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Order cancelled successfully", "refund": refund})
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Order cancelled successfully"})
 }
 
+// UpdateOrderStatusRequest is the body of a fulfilment status update
+type UpdateOrderStatusRequest struct {
+	Status domain.Status `json:"status" binding:"required" swaggertype:"string" enums:"packed,shipped,delivered"`
+	Reason string        `json:"reason"`
+}
+
+// UpdateOrderStatus godoc
+// @Summary Update the fulfilment status of an order
+// @Description Admin moves a paid order to packed, then shipped, then delivered. Steps can't be skipped or undone.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param orderID path int true "Order ID"
+// @Param request body UpdateOrderStatusRequest true "New status"
+// @Success 200 {object} map[string]interface{} "message: Order status updated successfully"
+// @Failure 400 {object} map[string]string "error: Invalid order ID or status"
+// @Failure 404 {object} map[string]string "error: Order not found"
+// @Failure 409 {object} map[string]string "error: Illegal order status transition"
+// @Failure 500 {object} map[string]string "error: Failed to update order status"
+// @Router /admins/orders/{orderID}/status [put]
+func (h *AdminHandler) UpdateOrderStatus(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("orderID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req UpdateOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	err = h.PurchaseService.UpdateFulfilmentStatus(c.Request.Context(), auth.PrincipalFrom(c).ID, orderID, req.Status, req.Reason)
+	switch {
+	case errors.Is(err, purchase_services.ErrInvalidFulfilmentStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be packed, shipped or delivered"})
+		return
+	case errors.Is(err, pgx.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	case errors.Is(err, domain.ErrIllegalTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": "Illegal order status transition", "details": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully", "status": req.Status})
+}
+
 // ApproveOrRejectReview godoc
 // @Summary Approve or Reject a review
 // @Description Admin approves or rejects a review based on review ID and status query parameter
@@ -198,12 +372,8 @@ func (h *AdminHandler) CancelOrderHandler(c *gin.Context) {
 // @Failure 500 {object} map[string]string "error: Failed to update review status"
 // @Router /admins/reviews/{review_id} [post]
 func (h *AdminHandler) ApproveOrRejectReview(c *gin.Context) {
-	// authentication - extract admin ID from JWT claims
-	user := c.MustGet("user").(jwt.MapClaims)
-	adminEmail := user["email"].(string)
-
-	// check if admin exists within the db
-	_, err := h.AdminService.GetAdminByEmail(adminEmail)
+	// authentication - check the authenticated admin still exists within the db
+	_, err := h.AdminService.GetAdminByID(c.Request.Context(), auth.PrincipalFrom(c).ID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Admin not found"})
 		return
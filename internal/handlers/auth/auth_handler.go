@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"dgw-technical-test/internal/auth"
+	auth_model "dgw-technical-test/internal/models/auth"
+	auth_services "dgw-technical-test/internal/services/auth"
+
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthHandler struct {
+	AuthService *auth_services.AuthService
+}
+
+func NewAuthHandler(authService *auth_services.AuthService) *AuthHandler {
+	return &AuthHandler{AuthService: authService}
+}
+
+// RefreshToken godoc
+// @Summary Refresh an access token
+// @Description Exchanges a refresh token for a new access token and refresh token. The presented refresh token can't be used again; reusing it revokes every session started from the same login.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body auth_model.RefreshRequest true "Refresh token"
+// @Success 200 {object} auth_model.TokenPair "New token pair"
+// @Failure 400 {object} map[string]string "message: Invalid request"
+// @Failure 401 {object} map[string]string "message: Invalid refresh token"
+// @Failure 500 {object} map[string]string "message: Could not refresh token"
+// @Router /auth/refresh [post]
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var req auth_model.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid Request"})
+		return
+	}
+
+	tokens, err := h.AuthService.Refresh(c.Request.Context(), req.RefreshToken)
+	if errors.Is(err, auth_services.ErrInvalidRefreshToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revokes the session of the presented access token together with its refresh token.
+// @Tags Auth
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} map[string]string "message: Logged out successfully"
+// @Failure 401 {object} map[string]string "message: Invalid or expired token"
+// @Failure 500 {object} map[string]string "message: Could not log out"
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	principal := auth.PrincipalFrom(c)
+
+	if err := h.AuthService.Logout(c.Request.Context(), principal.SessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// RevokeAllSessions godoc
+// @Summary Revoke all sessions
+// @Description Revokes every session of the authenticated admin or farmer, including the current one, e.g. after a password leak.
+// @Tags Auth
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} map[string]interface{} "message: All sessions revoked, revoked_sessions"
+// @Failure 401 {object} map[string]string "message: Invalid or expired token"
+// @Failure 500 {object} map[string]string "message: Could not revoke sessions"
+// @Router /auth/sessions/revoke-all [post]
+func (h *AuthHandler) RevokeAllSessions(c *gin.Context) {
+	principal := auth.PrincipalFrom(c)
+
+	revoked, err := h.AuthService.RevokeAllSessions(c.Request.Context(), principal.SubjectType, principal.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions revoked", "revoked_sessions": revoked})
+}
+
+// JWKS godoc
+// @Summary Get the token signing keys
+// @Description Publishes the public keys (JWKS) that verify access tokens, including keys kept after a rotation. The set is empty when tokens are signed with the HS256 shared secret.
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} auth.JWKS "JSON Web Key Set"
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.AuthService.Signer.JWKS())
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"dgw-technical-test/internal/auth"
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
+	cart_model "dgw-technical-test/internal/models/cart"
+	ledger_repo "dgw-technical-test/internal/repositories/ledger"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	cart_services "dgw-technical-test/internal/services/cart"
+	credit_services "dgw-technical-test/internal/services/credit"
+	farmer_services "dgw-technical-test/internal/services/farmer"
+	pricing_services "dgw-technical-test/internal/services/pricing"
+
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CartHandler struct {
+	CartService *cart_services.CartService
+}
+
+func NewCartHandler(cartService *cart_services.CartService) *CartHandler {
+	return &CartHandler{CartService: cartService}
+}
+
+// GetCart godoc
+// @Summary View the cart
+// @Description Returns the farmer's cart at current catalog prices. Prices are only fixed when the cart is checked out.
+// @Tags Farmer
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} cart_model.Cart "Cart"
+// @Failure 500 {object} map[string]string "error: Failed to fetch cart"
+// @Router /farmers/cart [get]
+func (h *CartHandler) GetCart(c *gin.Context) {
+	cart, err := h.CartService.GetCart(c.Request.Context(), auth.PrincipalFrom(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// AddCartItem godoc
+// @Summary Add a product to the cart
+// @Description Adds units of a product to the farmer's cart. The cart can't hold more units than the product has available.
+// @Tags Farmer
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body cart_model.AddCartItemRequest true "Cart item"
+// @Success 200 {object} cart_model.Cart "Updated cart"
+// @Failure 400 {object} map[string]string "error: Invalid request body"
+// @Failure 404 {object} map[string]string "error: Product not found"
+// @Failure 409 {object} map[string]string "error: Insufficient stock"
+// @Failure 500 {object} map[string]string "error: Failed to update cart"
+// @Router /farmers/cart/items [post]
+func (h *CartHandler) AddCartItem(c *gin.Context) {
+	var req cart_model.AddCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	cart, err := h.CartService.AddItem(c.Request.Context(), auth.PrincipalFrom(c).ID, req)
+	if respondCartError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// UpdateCartItem godoc
+// @Summary Change the quantity of a product in the cart
+// @Tags Farmer
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param product_id path int true "Product ID"
+// @Param request body cart_model.UpdateCartItemRequest true "Quantity"
+// @Success 200 {object} cart_model.Cart "Updated cart"
+// @Failure 400 {object} map[string]string "error: Invalid request body"
+// @Failure 404 {object} map[string]string "error: Product not found or not in the cart"
+// @Failure 409 {object} map[string]string "error: Insufficient stock"
+// @Failure 500 {object} map[string]string "error: Failed to update cart"
+// @Router /farmers/cart/items/{product_id} [put]
+func (h *CartHandler) UpdateCartItem(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req cart_model.UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	cart, err := h.CartService.UpdateItem(c.Request.Context(), auth.PrincipalFrom(c).ID, productID, req)
+	if respondCartError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// RemoveCartItem godoc
+// @Summary Remove a product from the cart
+// @Tags Farmer
+// @Produce json
+// @Security BearerAuth
+// @Param product_id path int true "Product ID"
+// @Success 200 {object} cart_model.Cart "Updated cart"
+// @Failure 400 {object} map[string]string "error: Invalid product ID"
+// @Failure 404 {object} map[string]string "error: Product is not in the cart"
+// @Failure 500 {object} map[string]string "error: Failed to update cart"
+// @Router /farmers/cart/items/{product_id} [delete]
+func (h *CartHandler) RemoveCartItem(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	cart, err := h.CartService.RemoveItem(c.Request.Context(), auth.PrincipalFrom(c).ID, productID)
+	if respondCartError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// Checkout godoc
+// @Summary Check out the cart
+// @Description Turns the cart into a pending order priced from the catalog, reserves its stock and empties the cart. With payment_method wallet the order is paid from the wallet in the same step, a low balance places no order and keeps the cart. With payment_method online a charge is created through the chosen channel (see /payments/channels, bca_va by default) and its payment instructions are returned; if the charge fails the order stays pending and can be paid through /farmers/pay-order/online. With payment_method split, wallet_amount is held from the wallet in the same step and the rest is charged online; the order is paid once that charge settles and the held money goes back to the wallet if it doesn't. With payment_method credit the order is paid from the farmer's credit facility in the same step and the returned receivable is repaid in instalments; an order the facility doesn't cover places no order and keeps the cart.
+// @Tags Farmer
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body cart_model.CheckoutRequest true "Checkout"
+// @Success 201 {object} cart_services.CheckoutResult "Order placed"
+// @Failure 400 {object} map[string]string "error: Invalid request body, empty cart, invalid split or unavailable payment channel"
+// @Failure 409 {object} map[string]string "error: Insufficient stock or wallet balance, or the credit facility doesn't cover the order"
+// @Failure 500 {object} map[string]string "error: Failed to check out"
+// @Failure 502 {object} map[string]interface{} "error: Order placed but the online charge failed, order: the pending order"
+// @Router /farmers/checkout [post]
+func (h *CartHandler) Checkout(c *gin.Context) {
+	var req cart_model.CheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	result, err := h.CartService.Checkout(c.Request.Context(), auth.PrincipalFrom(c).ID, req)
+	switch {
+	case errors.Is(err, cart_services.ErrEmptyCart):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
+	case errors.Is(err, payment_gateway.ErrChannelUnavailable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment channel is not available", "details": err.Error()})
+		return
+	case errors.Is(err, farmer_services.ErrInvalidSplit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid split payment", "details": err.Error()})
+		return
+	case errors.Is(err, ledger_repo.ErrInsufficientFunds):
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient wallet balance"})
+		return
+	case errors.Is(err, credit_services.ErrNoCreditFacility):
+		c.JSON(http.StatusConflict, gin.H{"error": "No credit facility"})
+		return
+	case errors.Is(err, credit_services.ErrCreditUnavailable), errors.Is(err, credit_services.ErrCreditLimitExceeded):
+		c.JSON(http.StatusConflict, gin.H{"error": "The credit facility doesn't cover this order", "details": err.Error()})
+		return
+	case errors.Is(err, cart_services.ErrChargeFailed):
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Order placed but the online charge failed", "details": err.Error(), "order": result.Order})
+		return
+	case respondCartError(c, err):
+		return
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// respondCartError writes the response for an error of a cart operation and reports whether there was one
+func respondCartError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, pricing_services.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity", "details": err.Error()})
+	case errors.Is(err, pricing_services.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found", "details": err.Error()})
+	case errors.Is(err, cart_services.ErrCartItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product is not in the cart"})
+	case errors.Is(err, reservation_repo.ErrInsufficientStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient stock", "details": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart", "details": err.Error()})
+	}
+	return true
+}
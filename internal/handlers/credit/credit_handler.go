@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"dgw-technical-test/internal/auth"
+	domain "dgw-technical-test/internal/domain/order"
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
+	"dgw-technical-test/internal/middleware"
+	credit_model "dgw-technical-test/internal/models/credit"
+	ledger_repo "dgw-technical-test/internal/repositories/ledger"
+	credit_services "dgw-technical-test/internal/services/credit"
+	farmer_services "dgw-technical-test/internal/services/farmer"
+
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreditHandler struct {
+	CreditService *credit_services.CreditService
+	FarmerService *farmer_services.FarmerService
+}
+
+func NewCreditHandler(creditService *credit_services.CreditService, farmerService *farmer_services.FarmerService) *CreditHandler {
+	return &CreditHandler{CreditService: creditService, FarmerService: farmerService}
+}
+
+// GetCreditAccount godoc
+// @Summary View the farmer's credit account
+// @Description Returns the farmer's credit facility, what they owe, can still buy on credit and have overdue, and their open receivables with the instalment schedules.
+// @Tags Farmer
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} credit_model.CreditAccount "Credit account"
+// @Failure 404 {object} map[string]string "error: No credit facility"
+// @Failure 500 {object} map[string]string "error: Failed to fetch credit account"
+// @Router /farmers/credit [get]
+func (h *CreditHandler) GetCreditAccount(c *gin.Context) {
+	account, err := h.CreditService.GetAccount(c.Request.Context(), auth.PrincipalFrom(c).ID, false)
+	switch {
+	case errors.Is(err, credit_services.ErrNoCreditFacility):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No credit facility"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch credit account", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// PayOrderOnCredit godoc
+// @Summary Buy an order on credit
+// @Description Pays an unpaid order from the farmer's credit facility. The order is paid at once and the order total plus the facility fee becomes a receivable repaid in instalments. Refused while the facility is suspended, instalments are overdue or the order would take the farmer over their credit limit.
+// @Tags Farmer
+// @Produce json
+// @Security BearerAuth
+// @Param order_id path int true "Order ID"
+// @Success 200 {object} credit_model.Receivable "Receivable with its instalments"
+// @Failure 400 {object} map[string]string "error: Invalid order ID"
+// @Failure 404 {object} map[string]string "error: Order not found"
+// @Failure 409 {object} map[string]string "error: No credit facility, credit not available, credit limit exceeded or the order can't be paid in its current status"
+// @Failure 500 {object} map[string]string "error: Failed to process credit payment"
+// @Router /farmers/pay-order/credit/{order_id} [post]
+func (h *CreditHandler) PayOrderOnCredit(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	receivable, err := h.FarmerService.ProcessCreditPayment(c.Request.Context(), auth.PrincipalFrom(c).ID, orderID)
+	switch {
+	case errors.Is(err, farmer_services.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	case errors.Is(err, domain.ErrIllegalTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": "Order can't be paid in its current status", "details": err.Error()})
+		return
+	case respondCreditError(c, err):
+		return
+	case err != nil:
+		// the purchase ran in one transaction that was rolled back, so it can be retried under the same key
+		middleware.ReleaseIdempotencyKey(c)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process credit payment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, receivable)
+}
+
+// RepayReceivable godoc
+// @Summary Repay a credit receivable
+// @Description Repays part or all of one of the farmer's receivables, earliest instalment first. A wallet repayment is applied at once. An online repayment creates a charge through the chosen channel and returns its payment instructions; it is applied when the charge settles, and whatever exceeds what is still owed by then goes to the wallet. Online repayments must be a whole number of rupiah.
+// @Tags Farmer
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param receivable_id path int true "Receivable ID"
+// @Param request body credit_model.RepaymentRequest true "Repayment"
+// @Success 201 {object} map[string]interface{} "repayment, and instructions for an online repayment"
+// @Failure 400 {object} map[string]string "error: Invalid request body, invalid repayment or unavailable payment channel"
+// @Failure 404 {object} map[string]string "error: Receivable not found"
+// @Failure 409 {object} map[string]string "error: Insufficient wallet balance"
+// @Failure 500 {object} map[string]string "error: Failed to repay"
+// @Router /farmers/credit/receivables/{receivable_id}/repayments [post]
+func (h *CreditHandler) RepayReceivable(c *gin.Context) {
+	receivableID, err := strconv.Atoi(c.Param("receivable_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid receivable ID"})
+		return
+	}
+
+	var req credit_model.RepaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	repayment, instructions, err := h.CreditService.Repay(c.Request.Context(), auth.PrincipalFrom(c).ID, receivableID, req)
+	switch {
+	case errors.Is(err, credit_services.ErrInvalidRepayment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repayment", "details": err.Error()})
+		return
+	case errors.Is(err, payment_gateway.ErrChannelUnavailable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment channel is not available", "details": err.Error()})
+		return
+	case errors.Is(err, credit_services.ErrReceivableNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receivable not found"})
+		return
+	case errors.Is(err, ledger_repo.ErrInsufficientFunds):
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient wallet balance"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to repay", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"repayment": repayment, "instructions": instructions})
+}
+
+// GetRepayment godoc
+// @Summary Check a credit repayment
+// @Description Returns a repayment of the farmer, checking a pending online repayment at the payment gateway and applying it when it settled.
+// @Tags Farmer
+// @Produce json
+// @Security BearerAuth
+// @Param repayment_id path int true "Repayment ID"
+// @Success 200 {object} credit_model.Repayment "Repayment"
+// @Failure 400 {object} map[string]string "error: Invalid repayment ID"
+// @Failure 404 {object} map[string]string "error: Repayment not found"
+// @Failure 500 {object} map[string]string "error: Failed to fetch repayment"
+// @Router /farmers/credit/repayments/{repayment_id} [get]
+func (h *CreditHandler) GetRepayment(c *gin.Context) {
+	repaymentID, err := strconv.Atoi(c.Param("repayment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid repayment ID"})
+		return
+	}
+
+	repayment, err := h.CreditService.GetRepayment(c.Request.Context(), auth.PrincipalFrom(c).ID, repaymentID)
+	switch {
+	case errors.Is(err, credit_services.ErrRepaymentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Repayment not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch repayment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, repayment)
+}
+
+// SaveFacility godoc
+// @Summary Grant or change a farmer's credit facility
+// @Description Creates the farmer's credit facility or replaces its terms: the credit limit, the tenor in days, the number of instalments and a flat fee in basis points. New terms apply to orders bought on credit afterwards. A suspended facility takes no new credit purchases while open receivables are still repaid.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param farmerID path int true "Farmer ID"
+// @Param request body credit_model.FacilityRequest true "Facility terms"
+// @Success 200 {object} credit_model.Facility "Facility"
+// @Failure 400 {object} map[string]string "error: Invalid request body or facility terms"
+// @Failure 404 {object} map[string]string "error: Farmer not found"
+// @Failure 500 {object} map[string]string "error: Failed to save credit facility"
+// @Router /admins/farmers/{farmerID}/credit [put]
+func (h *CreditHandler) SaveFacility(c *gin.Context) {
+	farmerID, err := strconv.Atoi(c.Param("farmerID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID"})
+		return
+	}
+
+	var req credit_model.FacilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "details": err.Error()})
+		return
+	}
+
+	facility, err := h.CreditService.SaveFacility(c.Request.Context(), auth.PrincipalFrom(c).ID, farmerID, req)
+	switch {
+	case errors.Is(err, credit_services.ErrInvalidFacility):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credit facility", "details": err.Error()})
+		return
+	case errors.Is(err, credit_services.ErrFarmerNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Farmer not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save credit facility", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, facility)
+}
+
+// GetFarmerCreditAccount godoc
+// @Summary View a farmer's credit account
+// @Description Returns a farmer's credit facility, what they owe, can still buy on credit and have overdue, and all their receivables with the instalment schedules.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param farmerID path int true "Farmer ID"
+// @Success 200 {object} credit_model.CreditAccount "Credit account"
+// @Failure 400 {object} map[string]string "error: Invalid farmer ID"
+// @Failure 404 {object} map[string]string "error: No credit facility"
+// @Failure 500 {object} map[string]string "error: Failed to fetch credit account"
+// @Router /admins/farmers/{farmerID}/credit [get]
+func (h *CreditHandler) GetFarmerCreditAccount(c *gin.Context) {
+	farmerID, err := strconv.Atoi(c.Param("farmerID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID"})
+		return
+	}
+
+	account, err := h.CreditService.GetAccount(c.Request.Context(), farmerID, true)
+	switch {
+	case errors.Is(err, credit_services.ErrNoCreditFacility):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No credit facility"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch credit account", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// OverdueReport godoc
+// @Summary Overdue credit report
+// @Description Lists unpaid instalments past their due date, oldest first, with the total due and the number of farmers behind on repayments.
+// @Tags Admin
+// @Produce json
+// @Security BearerAuth
+// @Param farmer_id query int false "Only this farmer's instalments"
+// @Success 200 {object} credit_model.OverdueReport "Overdue report"
+// @Failure 400 {object} map[string]string "error: Invalid farmer ID"
+// @Failure 500 {object} map[string]string "error: Failed to build overdue report"
+// @Router /admins/credit/overdue [get]
+func (h *CreditHandler) OverdueReport(c *gin.Context) {
+	farmerID := 0
+	if value := c.Query("farmer_id"); value != "" {
+		var err error
+		if farmerID, err = strconv.Atoi(value); err != nil || farmerID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID"})
+			return
+		}
+	}
+
+	report, err := h.CreditService.OverdueReport(c.Request.Context(), farmerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build overdue report", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// respondCreditError writes the response for an order the farmer's credit facility doesn't cover and reports whether it did
+func respondCreditError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, credit_services.ErrNoCreditFacility):
+		c.JSON(http.StatusConflict, gin.H{"error": "No credit facility"})
+	case errors.Is(err, credit_services.ErrCreditUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Credit is not available", "details": err.Error()})
+	case errors.Is(err, credit_services.ErrCreditLimitExceeded):
+		c.JSON(http.StatusConflict, gin.H{"error": "Credit limit exceeded", "details": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
@@ -1,24 +1,32 @@
 package handlers
 
 import (
+	"dgw-technical-test/internal/auth"
+	"dgw-technical-test/internal/middleware"
+	domain "dgw-technical-test/internal/domain/order"
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
 	"dgw-technical-test/internal/models/farmer"
+	"dgw-technical-test/internal/money"
 	"dgw-technical-test/internal/services/farmer"
+	auth_services "dgw-technical-test/internal/services/auth"
+	ledger_repo "dgw-technical-test/internal/repositories/ledger"
+	hold_services "dgw-technical-test/internal/services/hold"
+	"errors"
 	"net/http"
 	
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 	"strconv"
 )
 
 // FarmerHandler contains services related to farmer operations
 type FarmerHandler struct {
 	FarmerService *services.FarmerService
+	AuthService   *auth_services.AuthService
 }
 
 // NewFarmerHandler creates a new FarmerHandler instance
-func NewFarmerHandler(farmerService *services.FarmerService) *FarmerHandler {
-	return &FarmerHandler{FarmerService: farmerService}
+func NewFarmerHandler(farmerService *services.FarmerService, authService *auth_services.AuthService) *FarmerHandler {
+	return &FarmerHandler{FarmerService: farmerService, AuthService: authService}
 }
 
 // RegisterFarmer godoc
@@ -46,14 +54,14 @@ func (h *FarmerHandler) RegisterFarmer(c *gin.Context) {
 	}
 
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Internal Server Error"})
 		return
 	}
 
 	// Create the farmer in the database with initial wallet_balance set to 0
-	err = h.FarmerService.RegisterFarmer(req.Name, req.Email, string(hashedPassword))
+	err = h.FarmerService.RegisterFarmer(req.Name, req.Email, hashedPassword)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not register farmer"})
 		return
@@ -69,9 +77,10 @@ func (h *FarmerHandler) RegisterFarmer(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param login body models.LoginRequest true "Login credentials"
-// @Success 200 {object} models.LoginResponse "JWT token and farmer info"
+// @Success 200 {object} models.LoginResponse "Access token, refresh token and farmer info"
 // @Failure 400 {object} map[string]string "message: Invalid request"
 // @Failure 401 {object} map[string]string "message: Invalid email or password"
+// @Failure 500 {object} map[string]string "message: Could not log in"
 // @Router /farmers/login [post]
 func (h *FarmerHandler) LoginFarmer(c *gin.Context) {
 	var req models.LoginRequest
@@ -80,25 +89,31 @@ func (h *FarmerHandler) LoginFarmer(c *gin.Context) {
 		return
 	}
 
-	// Login logic using FarmerService
-	farmer, err := h.FarmerService.LoginFarmer(req.Email, req.Password)
-	if err != nil {
+	// Verify the credentials and start a session
+	farmer, tokens, err := h.AuthService.Login(c.Request.Context(), auth.SubjectFarmer, req.Email, req.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid email or password"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not log in"})
+		return
+	}
 
-	// Generate JWT token
-	token, err := h.FarmerService.GenerateJWT(farmer)
+	walletBalance, err := h.FarmerService.GetFarmerWalletBalance(farmer.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not log in"})
 		return
 	}
 
 	c.JSON(http.StatusOK, models.LoginResponse{
-		Token:         token,
+		Token:                 tokens.AccessToken,
+		ExpiresAt:             tokens.AccessTokenExpiresAt,
+		RefreshToken:          tokens.RefreshToken,
+		RefreshTokenExpiresAt: tokens.RefreshTokenExpiresAt,
 		Name:          farmer.Name,
 		Email:         farmer.Email,
-		WalletBalance: farmer.WalletBalance,
+		WalletBalance: walletBalance,
 	})
 }
 
@@ -114,8 +129,8 @@ func (h *FarmerHandler) LoginFarmer(c *gin.Context) {
 // @Router /farmers/wallet-balance [get]
 func (h *FarmerHandler) GetWalletBalance(c *gin.Context) {
 	// Extract farmer ID from JWT claims
-	user := c.MustGet("user").(jwt.MapClaims)  // Directly get the claims here
-	farmerID := int(user["farmer_id"].(float64)) // Access the "farmer_id" from the claims
+	principal := auth.PrincipalFrom(c)
+	farmerID := principal.ID // Access the "farmer_id" from the claims
 
 	// Retrieve wallet balance using FarmerService
 	balance, err := h.FarmerService.GetFarmerWalletBalance(int(farmerID))
@@ -132,26 +147,38 @@ func (h *FarmerHandler) GetWalletBalance(c *gin.Context) {
 
 // PaymentRequest contains structure for farmer transaction
 type PaymentRequest struct {
-	Amount float64 `json:"amount" validate:"required"`
+	Amount  money.Money `json:"amount" validate:"required" swaggertype:"number" example:"150000"`
+	Channel string      `json:"channel" example:"bca_va"` // see GET /payments/channels; bca_va when empty
+}
+
+// OnlinePaymentRequest optionally chooses the channel of an online order payment
+type OnlinePaymentRequest struct {
+	Channel string `json:"channel" example:"qris"` // see GET /payments/channels; bca_va when empty
 }
 
-// WithdrawMoney godoc
-// @Summary Withdraw money from wallet
-// @Description Allows a farmer to withdraw money from their wallet.
+// SplitPaymentRequest pays an order partly from the wallet and the rest online
+type SplitPaymentRequest struct {
+	WalletAmount money.Money `json:"wallet_amount" binding:"required" swaggertype:"number" example:"50000"`
+	Channel      string      `json:"channel" example:"bri_va"` // see GET /payments/channels; bca_va when empty
+}
+
+// TopUpWallet godoc
+// @Summary Top up wallet
+// @Description Creates a charge through the chosen payment channel and returns its payment instructions; the wallet is credited once the farmer pays it.
 // @Tags Farmer
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param amount body PaymentRequest true "Amount to withdraw"
-// @Success 200 {object} map[string]interface{} "message: Withdrawal initiated successfully"
-// @Failure 400 {object} map[string]string "message: Invalid request or amount must be greater than zero"
+// @Param amount body PaymentRequest true "Amount to top up and payment channel"
+// @Success 200 {object} map[string]interface{} "message: Top-up initiated successfully, instructions: how to pay"
+// @Failure 400 {object} map[string]string "message: Invalid request, unavailable payment channel or amount must be a positive whole number of rupiah"
 // @Failure 500 {object} map[string]string "message: Internal server error"
-// @Router /farmers/withdraw [post]
-func (h *FarmerHandler) WithdrawMoney(c *gin.Context) {
+// @Router /farmers/wallet/top-up [post]
+func (h *FarmerHandler) TopUpWallet(c *gin.Context) {
 	// Extract farmer ID from JWT claims
-	user := c.MustGet("user").(jwt.MapClaims)
-	farmerID := int(user["farmer_id"].(float64))  // Access the "farmer_id" from the claims
-	farmerName := user["name"].(string)           // Access the "name" from the claims
+	principal := auth.PrincipalFrom(c)
+	farmerID := principal.ID  // Access the "farmer_id" from the claims
+	farmerName := principal.Name           // Access the "name" from the claims
 
 	// Bind and validate request body
 	var req PaymentRequest
@@ -160,46 +187,61 @@ func (h *FarmerHandler) WithdrawMoney(c *gin.Context) {
 		return
 	}
 
-	if req.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Withdraw amount must be greater than zero"})
+	if !req.Amount.IsPositive() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Top-up amount must be greater than zero"})
 		return
 	}
 
-	// Call service to handle the withdrawal logic
-	transactionID, orderID, vaNumber, err := h.FarmerService.WithdrawMoney(farmerID, req.Amount, farmerName)
+	// Call service to create the top-up charge
+	transactionID, orderID, instructions, err := h.FarmerService.TopUpWallet(farmerID, req.Amount, farmerName, req.Channel)
+	if errors.Is(err, services.ErrWholeRupiahRequired) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Top-up amount must be a whole number of rupiah"})
+		return
+	}
+	if errors.Is(err, payment_gateway.ErrChannelUnavailable) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Payment channel is not available", "details": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
 
-	// Return withdrawal details with VA number
+	// Return top-up details with the payment instructions of the channel
 	c.JSON(http.StatusOK, gin.H{
-		"message":        "Withdrawal initiated successfully",
+		"message":        "Top-up initiated successfully",
 		"transaction_id": transactionID,
 		"order_id":       orderID,
-		"va_number":      vaNumber,
+		"channel":        instructions.Channel,
+		"va_number":      instructions.VANumber, // empty for channels without a virtual account
+		"instructions":   instructions,
 		"gross_amount":   req.Amount,
 		"status":         "Pending",
 	})
 }
 
-// GetWithdrawalStatus godoc
-// @Summary Check withdrawal status
-// @Description Checks the status of a farmer's withdrawal transaction.
+// GetTopUpStatus godoc
+// @Summary Check top-up status
+// @Description Checks the status of a farmer's wallet top-up and credits the wallet once it settled.
 // @Tags Farmer
 // @Accept json
 // @Produce json
 // @Security BearerAuth
-// @Param order_id path string true "Order ID of the transaction"
+// @Param order_id path string true "Order ID of the top-up"
 // @Success 200 {object} map[string]interface{} "Transaction status retrieved successfully"
 // @Failure 400 {object} map[string]string "Invalid transaction request"
+// @Failure 404 {object} map[string]string "message: Top-up not found"
 // @Failure 500 {object} map[string]string "Failed to fetch transaction status"
-// @Router /farmers/withdrawal-status/{order_id} [get]
-func (h *FarmerHandler) GetWithdrawalStatus(c *gin.Context) {
+// @Router /farmers/wallet/top-up/{order_id}/status [get]
+func (h *FarmerHandler) GetTopUpStatus(c *gin.Context) {
 	orderID := c.Param("order_id")
 
-	// Check withdrawal status in the service
-	status, err := h.FarmerService.CheckWithdrawalStatus(orderID)
+	// Check top-up status in the service, only the farmer's own top-ups are found
+	status, err := h.FarmerService.CheckTopUpStatus(c.Request.Context(), auth.PrincipalFrom(c).ID, orderID)
+	if errors.Is(err, services.ErrTopUpNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Top-up not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
@@ -220,6 +262,8 @@ func (h *FarmerHandler) GetWithdrawalStatus(c *gin.Context) {
 // @Success 200 {object} map[string]interface{} "message: Payment successful"
 // @Failure 400 {object} map[string]string "error: Invalid order ID or Farmer is not registered"
 // @Failure 401 {object} map[string]string "error: Unauthorized access"
+// @Failure 404 {object} map[string]string "error: Order not found"
+// @Failure 409 {object} map[string]string "error: Insufficient wallet balance or the order can't be paid in its current status"
 // @Failure 500 {object} map[string]string "error: Failed to process payment or check farmer registration"
 // @Router /farmers/pay-order/{order_id} [post]
 func (h *FarmerHandler) PayOrder(c *gin.Context) {
@@ -231,12 +275,13 @@ func (h *FarmerHandler) PayOrder(c *gin.Context) {
     }
 
 	// Extract farmer ID from JWT claims
-	user := c.MustGet("user").(jwt.MapClaims)  // Directly get the claims here
-	farmerID := int(user["farmer_id"].(float64)) // Access the "farmer_id" from the claims	
+	principal := auth.PrincipalFrom(c)
+	farmerID := principal.ID // Access the "farmer_id" from the claims	
 
 	// check if farmerID is registered in farmers db
 	isRegistered, err := h.FarmerService.IsFarmerRegistered(farmerID)
 	if err != nil {
+		middleware.ReleaseIdempotencyKey(c)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check farmer registration", "details": err.Error()})
 		return
 	}
@@ -248,36 +293,54 @@ func (h *FarmerHandler) PayOrder(c *gin.Context) {
 	}
 
 	// process wallet payment of the farmer
-    err = h.FarmerService.ProcessWalletPayment(c.Request.Context(), farmerID, orderID)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payment", "details": err.Error()})
-        return
-    }
+	err = h.FarmerService.ProcessWalletPayment(c.Request.Context(), farmerID, orderID)
+	if errors.Is(err, ledger_repo.ErrInsufficientFunds) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient wallet balance"})
+		return
+	}
+	if errors.Is(err, services.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if errors.Is(err, domain.ErrIllegalTransition) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order can't be paid in its current status", "details": err.Error()})
+		return
+	}
+	if err != nil {
+		// the payment ran in one transaction that was rolled back, so it can be retried under the same key
+		middleware.ReleaseIdempotencyKey(c)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process payment", "details": err.Error()})
+		return
+	}
 
-    c.JSON(http.StatusOK, gin.H{"message": "Payment successful"})
+	c.JSON(http.StatusOK, gin.H{"message": "Payment successful"})
 }
 
 // ProcessOnlinePayment godoc
 // @Summary Process online payment for an order
-// @Description Allows a farmer to make an online payment for an order.
+// @Description Allows a farmer to make an online payment for an order through a payment channel (see /payments/channels, bca_va when no body is sent) and returns its payment instructions.
 // @Tags Farmers
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param order_id path int true "Order ID"
-// @Success 200 {object} map[string]interface{} "message: Purchase initiated successfully along with transaction details"
-// @Failure 400 {object} map[string]string "error: Payment not authorized or invalid request data"
+// @Param request body OnlinePaymentRequest false "Payment channel"
+// @Success 200 {object} map[string]interface{} "message: Purchase initiated successfully along with transaction details and instructions"
+// @Failure 400 {object} map[string]string "error: Payment not authorized, unavailable payment channel or invalid request data"
 // @Failure 401 {object} map[string]string "error: Unauthorized access"
+// @Failure 404 {object} map[string]string "error: Order not found"
+// @Failure 409 {object} map[string]string "error: Order can't be paid in its current status or an earlier charge is still pending"
 // @Failure 500 {object} map[string]string "error: Failed to process online payment or check farmer registration"
 // @Router /farmers/pay-online/{order_id} [post]
 func (h *FarmerHandler) ProcessOnlinePayment(c *gin.Context) {
 	// Extract farmer ID from JWT claims
-	user := c.MustGet("user").(jwt.MapClaims)  // Directly get the claims here
-	farmerID := int(user["farmer_id"].(float64)) // Access the "farmer_id" from the claims	
+	principal := auth.PrincipalFrom(c)
+	farmerID := principal.ID // Access the "farmer_id" from the claims	
 
 	// check if farmerID is registered in farmers db
 	isRegistered, err := h.FarmerService.IsFarmerRegistered(farmerID)
 	if err != nil {
+		middleware.ReleaseIdempotencyKey(c)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check farmer registration", "details": err.Error()})
 		return
 	}
@@ -289,15 +352,53 @@ func (h *FarmerHandler) ProcessOnlinePayment(c *gin.Context) {
 	}
 
 	// extract order id and prepare online payment statement
-	orderID, _ := strconv.Atoi(c.Param("order_id"))
-    totalCost, itemDescriptions, err := h.FarmerService.PrepareOnlinePayment(c, orderID)
+	orderID, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	// the body is optional, requests without one are charged through the default channel
+	var req OnlinePaymentRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+
+    totalCost, itemDescriptions, err := h.FarmerService.PrepareOnlinePayment(c.Request.Context(), farmerID, orderID)
+    if errors.Is(err, services.ErrOrderNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+        return
+    }
+    if errors.Is(err, domain.ErrIllegalTransition) {
+        c.JSON(http.StatusConflict, gin.H{"error": "Order can't be paid in its current status", "details": err.Error()})
+        return
+    }
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Payment preparation failed", "details": err.Error()})
         return
     }
 
 	// prepare payment response statement to execute online payment
-	paymentResponse, err := h.FarmerService.ExecuteOnlinePayment(orderID, totalCost, itemDescriptions)
+	paymentResponse, instructions, err := h.FarmerService.ExecuteOnlinePayment(c.Request.Context(), farmerID, orderID, req.Channel, totalCost, itemDescriptions)
+    if errors.Is(err, payment_gateway.ErrChannelUnavailable) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Payment channel is not available", "details": err.Error()})
+        return
+    }
+    if errors.Is(err, services.ErrOrderNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+        return
+    }
+    if errors.Is(err, services.ErrChargePending) {
+        c.JSON(http.StatusConflict, gin.H{"error": "An earlier charge of this order is still pending, pay it or wait until it expires", "details": err.Error()})
+        return
+    }
+    if errors.Is(err, domain.ErrIllegalTransition) {
+        c.JSON(http.StatusConflict, gin.H{"error": "Order can't be paid in its current status", "details": err.Error()})
+        return
+    }
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process online payment", "details": err.Error()})
         return
@@ -307,7 +408,9 @@ func (h *FarmerHandler) ProcessOnlinePayment(c *gin.Context) {
         c.JSON(http.StatusOK, gin.H{
             "message":        "Purchase initiated successfully",
             "order_id":       paymentResponse.OrderID,
+            "channel":        instructions.Channel,
             "va_numbers":     paymentResponse.VaNumbers,
+            "instructions":   instructions,
             "total_amount":   totalCost,
             "transaction_id": paymentResponse.TransactionID,
         })
@@ -316,17 +419,81 @@ func (h *FarmerHandler) ProcessOnlinePayment(c *gin.Context) {
     }
 }
 
+// PaySplit godoc
+// @Summary Pay an order partly from the wallet and the rest online
+// @Description Holds wallet_amount of the wallet for the order at once and charges the rest through the chosen channel, returning its payment instructions. The order is paid once the online charge settles; the held money goes back to the wallet when the charge fails at the gateway or the order expires or is cancelled. The online part must be a whole number of rupiah.
+// @Tags Farmers
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param order_id path int true "Order ID"
+// @Param request body SplitPaymentRequest true "Wallet part and payment channel"
+// @Success 200 {object} services.SplitPayment "Wallet part held and online charge created"
+// @Failure 400 {object} map[string]string "error: Invalid request body, invalid split or unavailable payment channel"
+// @Failure 404 {object} map[string]string "error: Order not found"
+// @Failure 409 {object} map[string]string "error: Insufficient wallet balance, wallet funds already held, an earlier charge still pending or the order can't be paid in its current status"
+// @Failure 500 {object} map[string]string "error: Failed to process split payment"
+// @Failure 502 {object} map[string]interface{} "error: Wallet part held but the online charge failed"
+// @Router /farmers/pay-order/split/{order_id} [post]
+func (h *FarmerHandler) PaySplit(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req SplitPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	result, err := h.FarmerService.PayOrderSplit(c.Request.Context(), auth.PrincipalFrom(c).ID, orderID, req.WalletAmount, req.Channel)
+	switch {
+	case errors.Is(err, services.ErrInvalidSplit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid split payment", "details": err.Error()})
+		return
+	case errors.Is(err, payment_gateway.ErrChannelUnavailable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payment channel is not available", "details": err.Error()})
+		return
+	case errors.Is(err, services.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	case errors.Is(err, ledger_repo.ErrInsufficientFunds):
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient wallet balance"})
+		return
+	case errors.Is(err, services.ErrChargePending):
+		c.JSON(http.StatusConflict, gin.H{"error": "An earlier charge of this order is still pending, pay it or wait until it expires", "details": err.Error()})
+		return
+	case errors.Is(err, hold_services.ErrHoldExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Wallet funds are already held for this order, pay the rest through /farmers/pay-order/online"})
+		return
+	case errors.Is(err, domain.ErrIllegalTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": "Order can't be paid in its current status", "details": err.Error()})
+		return
+	case err != nil && result != nil:
+		// the hold stays, the rest can be charged again through /farmers/pay-order/online
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Wallet part held but the online charge failed", "details": err.Error(), "payment": result})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process split payment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // CheckAndProcessOrderStatus godoc
 // @Summary Check and process the order status
-// @Description Verifies and updates the order status based on transaction data from an external payment gateway.
+// @Description Verifies and updates the order status based on the latest recorded charge of the order at the payment gateway.
 // @Tags Farmers
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Param order_id path int true "Order ID"
-// @Param midtrans_order_id query string true "Midtrans Order ID used for fetching transaction status"
 // @Success 200 {object} map[string]interface{} "message: Purchase status checked successfully along with order and transaction details"
 // @Failure 400 {object} map[string]string "error: Invalid order ID or transaction request"
+// @Failure 404 {object} map[string]string "error: Order not found or no online payment found for this order"
 // @Failure 409 {object} map[string]string "message: Transaction has already been processed"
 // @Failure 500 {object} map[string]string "error: Failed to update order status, fetch transaction status, or process inventory update"
 // @Router /farmers/check-status/{order_id} [get]
@@ -334,7 +501,6 @@ func (h *FarmerHandler) CheckAndProcessOrderStatus(c *gin.Context) {
 	// derive order_id from parameter
 	ctx := c.Request.Context()
 	orderID := c.Param("order_id")
-	midtrans_orderID := c.Param("midtrans_order_id")
 
 	// Update the transaction status in the database
 	orderIDInt, err := strconv.Atoi(orderID)
@@ -343,50 +509,35 @@ func (h *FarmerHandler) CheckAndProcessOrderStatus(c *gin.Context) {
 		return
 	}
 
-	// Check if the order has already been processed
-	isProcessed, err := h.FarmerService.CheckIfOrderIsProcessed(ctx, orderIDInt)
+	// Check if the order has already been paid (or can't be paid any more)
+	farmerID := auth.PrincipalFrom(c).ID
+	status, err := h.FarmerService.GetOrderStatus(ctx, farmerID, orderIDInt)
+	if errors.Is(err, services.ErrOrderNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check transaction processing status"})
 		return
 	}
 
 	// check if the transaction is already processed
-	if isProcessed {
-		c.JSON(http.StatusConflict, gin.H{"message": "Transaction has already been processed"})
+	if !status.AwaitsPayment() {
+		c.JSON(http.StatusConflict, gin.H{"message": "Transaction has already been processed", "status": status})
 		return
 	}
 
-	// Fetch transaction status (Simulated call to external payment gateway like Midtrans)
-	resp, err := h.FarmerService.CheckTransaction(midtrans_orderID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch transaction status"})
+	// Fetch the status of the order's latest charge and settle the order when the payment went through
+	resp, err := h.FarmerService.CheckOrderPaymentStatus(ctx, farmerID, orderIDInt)
+	if errors.Is(err, services.ErrPaymentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No online payment found for this order"})
 		return
 	}
-
-	// update order status to settlement
-	err = h.FarmerService.UpdateOrderStatus(ctx, orderIDInt, resp.TransactionStatus)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process transaction status", "details": err.Error()})
 		return
 	}
 
-	// Call the service to update the inventory if the order is in settlement status
-	if resp.TransactionStatus == "settlement" {
-		// update store quantity after settlement (need to make it into a transaction)
-		err = h.FarmerService.UpdateStoreQuantity(ctx, orderIDInt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		// Mark order as processed
-		err = h.FarmerService.MarkOrderAsProcessed(ctx, orderIDInt)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark order as processed"})
-			return
-		}
-	}
-	
 	c.JSON(http.StatusOK, gin.H{
 		"message":        "Purchase status checked successfully",
 		"order_id":       resp.OrderID,
@@ -403,7 +554,7 @@ type ReviewRequest struct {
 
 // AddReview godoc
 // @Summary Add a review for an order
-// @Description Allows a farmer to add a review for an order that has reached 'settled' status.
+// @Description Allows a farmer to add a review for an order that was paid and not cancelled or refunded.
 // @Tags Farmers
 // @Accept json
 // @Produce json
@@ -413,12 +564,13 @@ type ReviewRequest struct {
 // @Success 200 {object} map[string]interface{} "message: Review added successfully"
 // @Failure 400 {object} map[string]string "error: Invalid order ID or review data; or the order is not eligible for review"
 // @Failure 401 {object} map[string]string "error: Unauthorized access if JWT is missing or invalid"
+// @Failure 404 {object} map[string]string "error: Order not found"
 // @Failure 500 {object} map[string]string "error: Internal server error if there's an issue registering the review in the database"
 // @Router /farmers/review/{order_id} [post]
 func (h *FarmerHandler) AddReview(c *gin.Context) {
 	// Extract farmer ID from JWT claims
-	user := c.MustGet("user").(jwt.MapClaims)
-	farmerID := int(user["farmer_id"].(float64))  // Access the "farmer_id" from the claims
+	principal := auth.PrincipalFrom(c)
+	farmerID := principal.ID  // Access the "farmer_id" from the claims
 
 	// check if farmer is registered in db
 	isRegistered, err := h.FarmerService.IsFarmerRegistered(farmerID)
@@ -447,15 +599,17 @@ func (h *FarmerHandler) AddReview(c *gin.Context) {
         return
     }
 
-    // Check if the order is settled
-	var isProcessed, _ = h.FarmerService.CheckIfOrderIsProcessed(c.Request.Context(), orderID)	
-	if !isProcessed {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Reviews can only be added for settled orders"})
+    // Add the review, the service checks that the order is the farmer's and was paid
+    err = h.FarmerService.AddReview(c.Request.Context(), orderID, farmerID, req.Rating, req.Comment)
+    if errors.Is(err, services.ErrOrderNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
         return
     }
-
-    // Add the review
-    if err := h.FarmerService.AddReview(c.Request.Context(), orderID, farmerID, req.Rating, req.Comment); err != nil {
+    if errors.Is(err, services.ErrOrderNotReviewable) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Reviews can only be added for paid orders"})
+        return
+    }
+    if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add review", "details": err.Error()})
         return
     }
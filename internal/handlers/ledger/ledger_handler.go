@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"dgw-technical-test/internal/auth"
+	"dgw-technical-test/internal/middleware"
+	ledger_model "dgw-technical-test/internal/models/ledger"
+	ledger_repo "dgw-technical-test/internal/repositories/ledger"
+	ledger_services "dgw-technical-test/internal/services/ledger"
+
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LedgerHandler struct {
+	LedgerService *ledger_services.LedgerService
+}
+
+func NewLedgerHandler(ledgerService *ledger_services.LedgerService) *LedgerHandler {
+	return &LedgerHandler{LedgerService: ledgerService}
+}
+
+// Reconcile godoc
+// @Summary Reconcile wallet balances with the ledger
+// @Description Super Admin checks that every cached farmers.wallet_balance equals the sum of the farmer's ledger lines and that every ledger entry balances.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Success 200 {object} ledger_model.ReconciliationReport "Reconciliation report"
+// @Failure 403 {object} map[string]string "message: Forbidden"
+// @Failure 500 {object} map[string]string "error: Failed to reconcile ledger"
+// @Router /admins/ledger/reconciliation [get]
+func (h *LedgerHandler) Reconcile(c *gin.Context) {
+	report, err := h.LedgerService.Reconcile(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile ledger", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// CreateAdjustment godoc
+// @Summary Adjust a farmer's wallet
+// @Description Super Admin posts a ledger adjustment to a farmer's wallet; a positive amount credits it and a negative amount debits it.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param request body ledger_model.AdjustmentRequest true "Adjustment"
+// @Success 201 {object} map[string]string "message: Adjustment posted"
+// @Failure 400 {object} map[string]string "error: Invalid adjustment"
+// @Failure 403 {object} map[string]string "message: Forbidden"
+// @Failure 409 {object} map[string]string "error: Insufficient wallet balance"
+// @Failure 500 {object} map[string]string "error: Failed to post adjustment"
+// @Router /admins/ledger/adjustments [post]
+func (h *LedgerHandler) CreateAdjustment(c *gin.Context) {
+	var req ledger_model.AdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	err := h.LedgerService.RecordAdjustment(c.Request.Context(), auth.PrincipalFrom(c).ID, req)
+	switch {
+	case errors.Is(err, ledger_services.ErrInvalidAdjustment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid adjustment, farmer_id, a non-zero amount and a reason are required"})
+		return
+	case errors.Is(err, ledger_repo.ErrInsufficientFunds):
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient wallet balance"})
+		return
+	case err != nil:
+		// the adjustment ran in one transaction that was rolled back, so it can be retried under the same key
+		middleware.ReleaseIdempotencyKey(c)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post adjustment", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Adjustment posted"})
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"dgw-technical-test/internal/auth"
+	domain "dgw-technical-test/internal/domain/order"
+	order_model "dgw-technical-test/internal/models/order"
+	order_services "dgw-technical-test/internal/services/order"
+
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrderHandler struct {
+	OrderService *order_services.OrderService
+}
+
+func NewOrderHandler(orderService *order_services.OrderService) *OrderHandler {
+	return &OrderHandler{OrderService: orderService}
+}
+
+// ListFarmerOrders godoc
+// @Summary List my orders
+// @Description Returns the farmer's orders newest first with their items and product names, one page at a time. Pass next_cursor as cursor to fetch the following page.
+// @Tags Farmer
+// @Produce json
+// @Security BearerAuth
+// @Param status query string false "Order status, e.g. pending, paid or delivered"
+// @Param payment_method query string false "Payment method: wallet, online, split or credit"
+// @Param from query string false "Start date (YYYY-MM-DD), inclusive"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive"
+// @Param limit query int false "Page size, 20 by default and at most 100"
+// @Param cursor query string false "Cursor returned by the previous page"
+// @Success 200 {object} order_model.OrderPage "Orders"
+// @Failure 400 {object} map[string]string "error: Invalid filter"
+// @Failure 500 {object} map[string]string "error: Failed to list orders"
+// @Router /farmers/orders [get]
+func (h *OrderHandler) ListFarmerOrders(c *gin.Context) {
+	filter, ok := bindOrderFilter(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.OrderService.ListFarmerOrders(c.Request.Context(), auth.PrincipalFrom(c).ID, filter)
+	respondOrderPage(c, page, err)
+}
+
+// GetFarmerOrder godoc
+// @Summary View one of my orders
+// @Description Returns one of the farmer's orders with its items, product names and status history. Orders of other farmers are reported as not found.
+// @Tags Farmer
+// @Produce json
+// @Security BearerAuth
+// @Param order_id path int true "Order ID"
+// @Success 200 {object} order_model.Order "Order"
+// @Failure 400 {object} map[string]string "error: Invalid order ID"
+// @Failure 404 {object} map[string]string "error: Order not found"
+// @Failure 500 {object} map[string]string "error: Failed to fetch order"
+// @Router /farmers/orders/{order_id} [get]
+func (h *OrderHandler) GetFarmerOrder(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := h.OrderService.GetFarmerOrder(c.Request.Context(), auth.PrincipalFrom(c).ID, orderID)
+	respondOrder(c, order, err)
+}
+
+// ListOrders godoc
+// @Summary List orders
+// @Description Returns the orders of every farmer newest first with their items and product names, one page at a time. Pass next_cursor as cursor to fetch the following page.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param farmer_id query int false "Farmer ID"
+// @Param status query string false "Order status, e.g. pending, paid or delivered"
+// @Param payment_method query string false "Payment method: wallet, online, split or credit"
+// @Param from query string false "Start date (YYYY-MM-DD), inclusive"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive"
+// @Param limit query int false "Page size, 20 by default and at most 100"
+// @Param cursor query string false "Cursor returned by the previous page"
+// @Success 200 {object} order_model.OrderPage "Orders"
+// @Failure 400 {object} map[string]string "error: Invalid filter"
+// @Failure 403 {object} map[string]string "message: Forbidden"
+// @Failure 500 {object} map[string]string "error: Failed to list orders"
+// @Router /admins/orders [get]
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	filter, ok := bindOrderFilter(c)
+	if !ok {
+		return
+	}
+	if v := c.Query("farmer_id"); v != "" {
+		farmerID, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid farmer ID"})
+			return
+		}
+		filter.FarmerID = farmerID
+	}
+
+	page, err := h.OrderService.ListOrders(c.Request.Context(), filter)
+	respondOrderPage(c, page, err)
+}
+
+// GetOrder godoc
+// @Summary View an order
+// @Description Returns an order of any farmer with its items, product names and status history.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param orderID path int true "Order ID"
+// @Success 200 {object} order_model.Order "Order"
+// @Failure 400 {object} map[string]string "error: Invalid order ID"
+// @Failure 403 {object} map[string]string "message: Forbidden"
+// @Failure 404 {object} map[string]string "error: Order not found"
+// @Failure 500 {object} map[string]string "error: Failed to fetch order"
+// @Router /admins/orders/{orderID} [get]
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("orderID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := h.OrderService.GetOrder(c.Request.Context(), orderID)
+	respondOrder(c, order, err)
+}
+
+// bindOrderFilter reads the filters shared by the farmer and admin order lists, answering 400 when one is malformed
+func bindOrderFilter(c *gin.Context) (order_model.OrderFilter, bool) {
+	filter := order_model.OrderFilter{
+		Status:        domain.Status(c.Query("status")),
+		PaymentMethod: c.Query("payment_method"),
+		Cursor:        c.Query("cursor"),
+	}
+
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return filter, false
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		if filter.From, err = time.Parse(time.DateOnly, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, use YYYY-MM-DD"})
+			return filter, false
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, use YYYY-MM-DD"})
+			return filter, false
+		}
+		// the whole end day is included
+		filter.To = to.AddDate(0, 0, 1)
+	}
+	return filter, true
+}
+
+func respondOrderPage(c *gin.Context, page *order_model.OrderPage, err error) {
+	switch {
+	case errors.Is(err, order_services.ErrInvalidFilter):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list orders", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func respondOrder(c *gin.Context, order *order_model.Order, err error) {
+	switch {
+	case errors.Is(err, order_services.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch order", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	payment_model "dgw-technical-test/internal/models/payment"
+	payment_services "dgw-technical-test/internal/services/payment"
+
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PaymentHandler struct {
+	PaymentService *payment_services.PaymentService
+}
+
+func NewPaymentHandler(paymentService *payment_services.PaymentService) *PaymentHandler {
+	return &PaymentHandler{PaymentService: paymentService}
+}
+
+// HandleNotification godoc
+// @Summary Receive a payment notification
+// @Description Receives a Midtrans HTTP notification, verifies its signature_key, fetches the transaction status from Midtrans and settles the related order, wallet top-up or credit repayment with it.
+// @Tags Payment
+// @Accept json
+// @Produce json
+// @Param notification body payment_model.Notification true "Midtrans HTTP notification"
+// @Success 200 {object} map[string]string "message: Notification processed"
+// @Failure 400 {object} map[string]string "error: Invalid notification payload"
+// @Failure 401 {object} map[string]string "error: Invalid signature"
+// @Failure 404 {object} map[string]string "error: Unknown order"
+// @Failure 500 {object} map[string]string "error: Failed to process notification"
+// @Router /payments/notifications [post]
+func (h *PaymentHandler) HandleNotification(c *gin.Context) {
+	var req payment_model.Notification
+	if err := c.ShouldBindJSON(&req); err != nil || req.OrderID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification payload"})
+		return
+	}
+
+	err := h.PaymentService.HandleNotification(c.Request.Context(), req)
+	switch {
+	case errors.Is(err, payment_services.ErrInvalidSignature):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	case errors.Is(err, payment_services.ErrUnknownOrder):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown order"})
+		return
+	case err != nil:
+		// a non-2xx answer makes Midtrans retry the notification later; the cause stays in our logs
+		log.Printf("payment notification %s: %v", req.OrderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process notification"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification processed"})
+}
+
+// ListChannels godoc
+// @Summary List payment channels
+// @Description Lists the payment channels enabled for online order payments and wallet top-ups. Pass a channel code as channel when paying; requests without one use the default channel.
+// @Tags Payment
+// @Produce json
+// @Success 200 {object} map[string]interface{} "channels: enabled payment channels, default: channel used when none is chosen"
+// @Router /payments/channels [get]
+func (h *PaymentHandler) ListChannels(c *gin.Context) {
+	channels, defaultChannel := h.PaymentService.ListChannels()
+	c.JSON(http.StatusOK, gin.H{"channels": channels, "default": defaultChannel})
+}
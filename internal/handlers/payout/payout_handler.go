@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"dgw-technical-test/internal/auth"
+	payout_model "dgw-technical-test/internal/models/payout"
+	ledger_repo "dgw-technical-test/internal/repositories/ledger"
+	payout_services "dgw-technical-test/internal/services/payout"
+
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PayoutHandler struct {
+	PayoutService *payout_services.PayoutService
+}
+
+func NewPayoutHandler(payoutService *payout_services.PayoutService) *PayoutHandler {
+	return &PayoutHandler{PayoutService: payoutService}
+}
+
+// RequestPayout godoc
+// @Summary Pay wallet money out to a bank account
+// @Description Debits the farmer's wallet, holds the funds and submits a disbursement to the payout provider. A failed disbursement returns the funds to the wallet.
+// @Tags Farmer
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body payout_model.PayoutRequest true "Payout"
+// @Success 201 {object} payout_model.Payout "Payout created"
+// @Failure 400 {object} map[string]string "error: Invalid payout request"
+// @Failure 409 {object} map[string]string "error: Insufficient wallet balance"
+// @Failure 500 {object} map[string]string "error: Failed to request payout"
+// @Router /farmers/wallet/payouts [post]
+func (h *PayoutHandler) RequestPayout(c *gin.Context) {
+	var req payout_model.PayoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	p, err := h.PayoutService.RequestPayout(c.Request.Context(), auth.PrincipalFrom(c).ID, req)
+	switch {
+	case errors.Is(err, payout_services.ErrInvalidPayout):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Payout amount must be a positive whole number of rupiah"})
+		return
+	case errors.Is(err, ledger_repo.ErrInsufficientFunds):
+		c.JSON(http.StatusConflict, gin.H{"error": "Insufficient wallet balance"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request payout", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, p)
+}
+
+// GetPayout godoc
+// @Summary Check payout status
+// @Description Returns a payout of the farmer, resolving it with the payout provider while it is still in flight.
+// @Tags Farmer
+// @Produce json
+// @Security BearerAuth
+// @Param payout_id path int true "Payout ID"
+// @Success 200 {object} payout_model.Payout "Payout"
+// @Failure 400 {object} map[string]string "error: Invalid payout ID"
+// @Failure 404 {object} map[string]string "error: Payout not found"
+// @Failure 500 {object} map[string]string "error: Failed to fetch payout"
+// @Router /farmers/wallet/payouts/{payout_id} [get]
+func (h *PayoutHandler) GetPayout(c *gin.Context) {
+	payoutID, err := strconv.Atoi(c.Param("payout_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payout ID"})
+		return
+	}
+
+	p, err := h.PayoutService.GetPayout(c.Request.Context(), auth.PrincipalFrom(c).ID, payoutID)
+	switch {
+	case errors.Is(err, payout_services.ErrPayoutNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payout not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payout", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, p)
+}
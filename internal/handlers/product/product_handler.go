@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"dgw-technical-test/internal/models/product"
+	"dgw-technical-test/internal/money"
 	"dgw-technical-test/internal/services/product"
+	"errors"
 	"net/http"
-	_ "dgw-technical-test/internal/models/product"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,19 +20,82 @@ func NewProductHandler(productService *services.ProductService) *ProductHandler
 }
 
 // GetAllProducts godoc
-// @Summary Retrieve all products
-// @Description Retrieves a list of all available products from the database, providing detailed information about each product.
+// @Summary Browse the product catalog
+// @Description Searches and filters the catalog one page at a time. q is matched against name, description and brand in Indonesian and English. Every page reports the total number of matches; pass next_cursor as cursor, with the same filters and sort, to fetch the following page.
 // @Tags products
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.Product "An array of products with detailed information including ID, name, description, price, and stock quantity"
+// @Param q query string false "Search words, e.g. pupuk urea or \"organic fertilizer\""
+// @Param category query string false "Category"
+// @Param brand query string false "Brand"
+// @Param supplier_id query int false "Supplier ID"
+// @Param min_price query number false "Lowest price, inclusive"
+// @Param max_price query number false "Highest price, inclusive"
+// @Param in_stock query bool false "Only products with available quantity left"
+// @Param sort query string false "relevance (default when searching), newest (default otherwise), price_asc, price_desc or name"
+// @Param limit query int false "Page size, 20 by default and at most 100"
+// @Param cursor query string false "Cursor returned by the previous page"
+// @Success 200 {object} models.ProductPage "Products with their stock, reserved and available quantity, and the total number of matches"
+// @Failure 400 {object} map[string]string "error: Invalid filter"
 // @Failure 500 {object} map[string]string "error: Unable to fetch product data due to internal server error"
-// @Router /products [get]
+// @Router /products/view-products [get]
 func (h *ProductHandler) GetAllProducts(c *gin.Context) {
-	products, err := h.ProductService.GetAllProductsService()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve seed products"})
+	filter, ok := bindProductFilter(c)
+	if !ok {
 		return
 	}
-	c.JSON(http.StatusOK, products)
-}
\ No newline at end of file
+
+	page, err := h.ProductService.SearchProducts(c.Request.Context(), filter)
+	switch {
+	case errors.Is(err, services.ErrInvalidFilter):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve products", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func bindProductFilter(c *gin.Context) (models.ProductFilter, bool) {
+	filter := models.ProductFilter{
+		Query:    c.Query("q"),
+		Category: c.Query("category"),
+		Brand:    c.Query("brand"),
+		Sort:     c.Query("sort"),
+		Cursor:   c.Query("cursor"),
+	}
+
+	var err error
+	if v := c.Query("supplier_id"); v != "" {
+		if filter.SupplierID, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier_id"})
+			return filter, false
+		}
+	}
+	if v := c.Query("min_price"); v != "" {
+		if filter.MinPrice, err = money.Parse(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_price", "details": err.Error()})
+			return filter, false
+		}
+	}
+	if v := c.Query("max_price"); v != "" {
+		if filter.MaxPrice, err = money.Parse(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid max_price", "details": err.Error()})
+			return filter, false
+		}
+	}
+	if v := c.Query("in_stock"); v != "" {
+		if filter.InStock, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid in_stock, use true or false"})
+			return filter, false
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return filter, false
+		}
+	}
+	return filter, true
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"dgw-technical-test/internal/auth"
+	refund_model "dgw-technical-test/internal/models/refund"
+	refund_services "dgw-technical-test/internal/services/refund"
+
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RefundHandler struct {
+	RefundService *refund_services.RefundService
+}
+
+func NewRefundHandler(refundService *refund_services.RefundService) *RefundHandler {
+	return &RefundHandler{RefundService: refundService}
+}
+
+// RefundOrder godoc
+// @Summary Refund a paid order
+// @Description Admin refunds some or all remaining items of a paid order and restocks them. Without items every unit not yet refunded is returned; without a method the money goes back the way the order was paid (wallet, the payment gateway for online payments, or both for split payments). Gateway refunds stay pending until the gateway accepts them and fail when it refuses them.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param orderID path int true "Order ID"
+// @Param request body refund_model.RefundRequest true "Refund"
+// @Success 201 {object} refund_model.Refund "Refund created"
+// @Failure 400 {object} map[string]string "error: Invalid refund request"
+// @Failure 403 {object} map[string]string "message: Forbidden"
+// @Failure 404 {object} map[string]string "error: Order not found"
+// @Failure 409 {object} map[string]string "error: Order can't be refunded"
+// @Failure 500 {object} map[string]string "error: Failed to refund order"
+// @Router /admins/orders/{orderID}/refunds [post]
+func (h *RefundHandler) RefundOrder(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("orderID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req refund_model.RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	refund, err := h.RefundService.RefundOrder(c.Request.Context(), auth.PrincipalFrom(c).ID, orderID, req)
+	switch {
+	case errors.Is(err, refund_services.ErrInvalidRefund):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund request", "details": err.Error()})
+		return
+	case errors.Is(err, refund_services.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	case errors.Is(err, refund_services.ErrOrderNotRefundable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Order can't be refunded, it isn't paid or was already fully refunded"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refund order", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, refund)
+}
+
+// GetRefund godoc
+// @Summary Check refund status
+// @Description Returns a refund with its items, submitting it to the payment gateway again while it is still pending.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param refund_id path int true "Refund ID"
+// @Success 200 {object} refund_model.Refund "Refund"
+// @Failure 400 {object} map[string]string "error: Invalid refund ID"
+// @Failure 403 {object} map[string]string "message: Forbidden"
+// @Failure 404 {object} map[string]string "error: Refund not found"
+// @Failure 500 {object} map[string]string "error: Failed to fetch refund"
+// @Router /admins/refunds/{refund_id} [get]
+func (h *RefundHandler) GetRefund(c *gin.Context) {
+	refundID, err := strconv.Atoi(c.Param("refund_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund ID"})
+		return
+	}
+
+	refund, err := h.RefundService.GetRefund(c.Request.Context(), refundID)
+	switch {
+	case errors.Is(err, refund_services.ErrRefundNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch refund", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// RetryRefund godoc
+// @Summary Retry a failed refund
+// @Description Submits a refund the payment gateway refused to the gateway again under the same refund key. Only failed refunds can be retried.
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer token"
+// @Param refund_id path int true "Refund ID"
+// @Success 200 {object} refund_model.Refund "Refund"
+// @Failure 400 {object} map[string]string "error: Invalid refund ID"
+// @Failure 403 {object} map[string]string "message: Forbidden"
+// @Failure 404 {object} map[string]string "error: Refund not found"
+// @Failure 409 {object} map[string]string "error: Only failed refunds can be retried"
+// @Failure 500 {object} map[string]string "error: Failed to retry refund"
+// @Router /admins/refunds/{refund_id}/retry [post]
+func (h *RefundHandler) RetryRefund(c *gin.Context) {
+	refundID, err := strconv.Atoi(c.Param("refund_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund ID"})
+		return
+	}
+
+	refund, err := h.RefundService.RetryRefund(c.Request.Context(), auth.PrincipalFrom(c).ID, refundID)
+	switch {
+	case errors.Is(err, refund_services.ErrRefundNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund not found"})
+		return
+	case errors.Is(err, refund_services.ErrRefundNotRetryable):
+		c.JSON(http.StatusConflict, gin.H{"error": "Only failed refunds can be retried", "details": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry refund", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"dgw-technical-test/internal/auth"
+	wallet_model "dgw-technical-test/internal/models/wallet"
+	wallet_services "dgw-technical-test/internal/services/wallet"
+
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WalletHandler struct {
+	WalletService *wallet_services.WalletService
+}
+
+func NewWalletHandler(walletService *wallet_services.WalletService) *WalletHandler {
+	return &WalletHandler{WalletService: walletService}
+}
+
+// ListTransactions godoc
+// @Summary List wallet transactions
+// @Description Returns the farmer's wallet transactions newest first, one page at a time. Pass next_cursor as cursor to fetch the following page.
+// @Tags Farmer
+// @Produce json
+// @Security BearerAuth
+// @Param type query string false "Transaction type: TopUp, Payment, Payout, Refund or CreditRepayment"
+// @Param status query string false "Status: pending, settlement or failed"
+// @Param from query string false "Start date (YYYY-MM-DD), inclusive"
+// @Param to query string false "End date (YYYY-MM-DD), inclusive"
+// @Param limit query int false "Page size, 20 by default and at most 100"
+// @Param cursor query string false "Cursor returned by the previous page"
+// @Success 200 {object} wallet_model.TransactionPage "Transactions"
+// @Failure 400 {object} map[string]string "error: Invalid filter"
+// @Failure 500 {object} map[string]string "error: Failed to list wallet transactions"
+// @Router /farmers/wallet/transactions [get]
+func (h *WalletHandler) ListTransactions(c *gin.Context) {
+	filter := wallet_model.TransactionFilter{
+		Type:   c.Query("type"),
+		Status: c.Query("status"),
+		Cursor: c.Query("cursor"),
+	}
+
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		if filter.From, err = time.Parse(time.DateOnly, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, use YYYY-MM-DD"})
+			return
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.Parse(time.DateOnly, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date, use YYYY-MM-DD"})
+			return
+		}
+		// the whole end day is included
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	page, err := h.WalletService.ListTransactions(c.Request.Context(), auth.PrincipalFrom(c).ID, filter)
+	switch {
+	case errors.Is(err, wallet_services.ErrInvalidFilter):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list wallet transactions", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetStatement godoc
+// @Summary Export a monthly wallet statement
+// @Description Returns the farmer's wallet statement for a month with the opening balance, every movement (top-ups, order payments, refunds, payouts, adjustments) and the closing balance, taken from the ledger.
+// @Tags Farmer
+// @Produce json
+// @Produce text/csv
+// @Produce application/pdf
+// @Security BearerAuth
+// @Param month path string true "Month (YYYY-MM)"
+// @Param format query string false "json (default), csv or pdf"
+// @Success 200 {object} wallet_model.Statement "Statement"
+// @Failure 400 {object} map[string]string "error: Invalid month or format"
+// @Failure 500 {object} map[string]string "error: Failed to build statement"
+// @Router /farmers/wallet/statements/{month} [get]
+func (h *WalletHandler) GetStatement(c *gin.Context) {
+	month := c.Param("month")
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, use json, csv or pdf"})
+		return
+	}
+
+	statement, err := h.WalletService.GetStatement(c.Request.Context(), auth.PrincipalFrom(c).ID, month)
+	switch {
+	case errors.Is(err, wallet_services.ErrInvalidMonth):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month, use YYYY-MM"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build statement", "details": err.Error()})
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, statement)
+		return
+	}
+
+	// rendered into a buffer first so a failure can still be reported as JSON
+	var buf bytes.Buffer
+	contentType := "text/csv"
+	if format == "pdf" {
+		contentType = "application/pdf"
+		err = wallet_services.WriteStatementPDF(&buf, statement)
+	} else {
+		err = wallet_services.WriteStatementCSV(&buf, statement)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render statement", "details": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("wallet-statement-%s.%s", month, format)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
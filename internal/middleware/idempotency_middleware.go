@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"dgw-technical-test/internal/auth"
+	idempotency "dgw-technical-test/internal/models/idempotency"
+
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader is the header clients set to make a retried request safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyReleasedKey is the context key set by ReleaseIdempotencyKey
+const idempotencyReleasedKey = "idempotency_released"
+
+// ReleaseIdempotencyKey tells IdempotencyMiddleware that the handler failed without changing anything, so its
+// response isn't stored and the client can retry under the same key. Only call it when nothing was written
+// and no outside service was called, e.g. after the only transaction of the request was rolled back.
+func ReleaseIdempotencyKey(c *gin.Context) {
+	c.Set(idempotencyReleasedKey, true)
+}
+
+// IdempotencyStore remembers Idempotency-Key requests and their responses
+type IdempotencyStore interface {
+	Begin(ctx context.Context, subject, key, requestHash string) (*idempotency.Record, bool, error)
+	Complete(ctx context.Context, subject, key string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, subject, key string) error
+}
+
+// IdempotencyMiddleware makes a money-moving endpoint safe to retry. A request carrying an Idempotency-Key
+// runs once per key and principal; duplicates get the stored response replayed, and a key reused for a
+// different request is rejected with 409. Requests without the header run as usual.
+// Server errors are stored and replayed too, since the request may have moved money before it failed;
+// only a handler that calls ReleaseIdempotencyKey frees the key for a retry.
+// It must run after JWTAuthMiddleware since keys are scoped to the principal.
+func IdempotencyMiddleware(store IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// the fingerprint covers the endpoint too, so a key can't be replayed against another order
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+		requestHash := hex.EncodeToString(hash.Sum(nil))
+
+		subject := auth.PrincipalFrom(c).Subject()
+		ctx := c.Request.Context()
+
+		record, started, err := store.Begin(ctx, subject, key, requestHash)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to check Idempotency-Key"})
+			c.Abort()
+			return
+		}
+
+		if !started {
+			switch {
+			case record.RequestHash != requestHash:
+				c.JSON(http.StatusConflict, gin.H{"message": "Idempotency-Key was already used for a different request"})
+			case record.InProgress():
+				c.JSON(http.StatusConflict, gin.H{"message": "A request with this Idempotency-Key is still in progress"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(*record.StatusCode, record.ContentType, record.ResponseBody)
+			}
+			c.Abort()
+			return
+		}
+
+		// the key is stored or freed even when the client went away or the handler panicked,
+		// so it never stays in progress until it expires
+		storeCtx := context.WithoutCancel(ctx)
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if c.GetBool(idempotencyReleasedKey) {
+				if err := store.Release(storeCtx, subject, key); err != nil {
+					log.Printf("Failed to release Idempotency-Key %s: %v", key, err)
+				}
+				return
+			}
+			// the handler panicked part way through, a retry gets the error the recovery middleware answers with
+			if err := store.Complete(storeCtx, subject, key, http.StatusInternalServerError, "", nil); err != nil {
+				log.Printf("Failed to store response for Idempotency-Key %s: %v", key, err)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if c.GetBool(idempotencyReleasedKey) {
+			return
+		}
+		completed = true
+		if err := store.Complete(storeCtx, subject, key, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			log.Printf("Failed to store response for Idempotency-Key %s: %v", key, err)
+		}
+	}
+}
+
+// responseRecorder copies the response body while it is written to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
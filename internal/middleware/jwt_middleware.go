@@ -1,15 +1,22 @@
 package middleware
 
 import (
+	"dgw-technical-test/internal/auth"
+
+	"context"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"net/http"
-	"os"
 	"strings"
 )
 
-// JWTAuthMiddleware is the middleware to authenticate requests using JWT token
-func JWTAuthMiddleware() gin.HandlerFunc {
+// SessionValidator reports whether the session behind an access token (its jti) is still active
+type SessionValidator interface {
+	IsSessionActive(ctx context.Context, sessionID string) (bool, error)
+}
+
+// JWTAuthMiddleware is the middleware to authenticate requests using JWT token and its server-side session
+func JWTAuthMiddleware(signer auth.Signer, sessions SessionValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the JWT token from the Authorization header
 		authHeader := c.GetHeader("Authorization")
@@ -22,12 +29,9 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		// Remove "Bearer " prefix
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Parse and validate the JWT token
-		claims := jwt.MapClaims{}
-		_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			// Return the secret key used to sign the token
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		// Parse and validate the JWT token with the key named by its kid header
+		claims := &auth.Claims{}
+		_, err := jwt.ParseWithClaims(tokenString, claims, signer.Keyfunc)
 
 		// Handle errors with parsing the JWT token
 		if err != nil {
@@ -36,10 +40,31 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Set the user to context so we can access them in the handler
-		c.Set("user", claims)
+		// tokens issued before principals and sessions existed can't be authorized
+		principal, err := claims.Principal()
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+
+		// reject tokens whose session was logged out or revoked
+		active, err := sessions.IsSessionActive(c.Request.Context(), principal.SessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not verify session"})
+			c.Abort()
+			return
+		}
+		if !active {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Set the principal to context so handlers can read it with auth.PrincipalFrom
+		auth.SetPrincipal(c, principal)
 
 		// Continue to the next handler
 		c.Next()
 	}
-}
\ No newline at end of file
+}
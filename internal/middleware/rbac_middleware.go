@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"dgw-technical-test/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Permission names an action guarded by role-based access control
+type Permission string
+
+const (
+	PermInviteAdmin        Permission = "admins:invite"
+	PermFacilitatePurchase Permission = "orders:facilitate"
+	PermViewOrders         Permission = "orders:view"
+	PermCancelOrder        Permission = "orders:cancel"
+	PermRefundOrder        Permission = "orders:refund"
+	PermFulfilOrder        Permission = "orders:fulfil"
+	PermModerateReview     Permission = "reviews:moderate"
+	PermDeleteReview       Permission = "reviews:delete"
+	PermManageLedger       Permission = "ledger:manage"
+	PermManageCredit       Permission = "credit:manage"
+	PermViewCredit         Permission = "credit:view"
+	PermFarmerAccount      Permission = "farmer:account" // a farmer's own wallet, orders and reviews
+)
+
+// Permissions is the permission matrix: the roles allowed to perform each action
+var Permissions = map[Permission][]string{
+	PermInviteAdmin:        {auth.RoleSuperAdmin},
+	PermFacilitatePurchase: {auth.RoleSuperAdmin, auth.RoleStoreAdmin},
+	PermViewOrders:         {auth.RoleSuperAdmin, auth.RoleStoreAdmin},
+	PermCancelOrder:        {auth.RoleSuperAdmin, auth.RoleStoreAdmin},
+	PermRefundOrder:        {auth.RoleSuperAdmin, auth.RoleStoreAdmin},
+	PermFulfilOrder:        {auth.RoleSuperAdmin, auth.RoleStoreAdmin},
+	PermModerateReview:     {auth.RoleSuperAdmin, auth.RoleStoreAdmin},
+	PermDeleteReview:       {auth.RoleSuperAdmin},
+	PermManageLedger:       {auth.RoleSuperAdmin},
+	PermManageCredit:       {auth.RoleSuperAdmin},
+	PermViewCredit:         {auth.RoleSuperAdmin, auth.RoleStoreAdmin},
+	PermFarmerAccount:      {auth.RoleFarmer},
+}
+
+// RequireRole only lets through users whose role claim is one of roles; it must run behind JWTAuthMiddleware
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := auth.PrincipalFrom(c)
+
+		for _, role := range roles {
+			if principal.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"message": "You don't have permission to access this resource"})
+		c.Abort()
+	}
+}
+
+// RequirePermission applies RequireRole with the roles granted the permission in the matrix
+func RequirePermission(permission Permission) gin.HandlerFunc {
+	return RequireRole(Permissions[permission]...)
+}
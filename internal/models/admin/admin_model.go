@@ -2,12 +2,17 @@ package models
 
 import "time"
 
-// RegisterRequest represents the data needed to register an admin
-type RegisterRequest struct {
+// InvitationRequest represents the data a Super Admin sends to invite a new admin
+type InvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// AcceptInvitationRequest represents the data an invitee sends to redeem an invitation
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
 	Name     string `json:"name"`
-	Email    string `json:"email"`
 	Password string `json:"password"`
-	Role     string `json:"role"`
 }
 
 // LoginRequest represents the data needed to login an admin
@@ -18,10 +23,13 @@ type LoginRequest struct {
 
 // LoginResponse represents the data returned upon successful admin login
 type LoginResponse struct {
-	Token string `json:"token"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	Token                 string    `json:"token"`
+	ExpiresAt             time.Time `json:"expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	Name                  string    `json:"name"`
+	Email                 string    `json:"email"`
+	Role                  string    `json:"role"`
 }
 
 // Admin represents the structure of the admin data stored in the database
@@ -31,7 +39,17 @@ type Admin struct {
 	Email      string    `json:"email"`
 	Password   string    `json:"password"` // Not to be included in the JSON response
 	Role       string    `json:"role"`
-	JWTToken   string    `json:"jwt_token"` // Optional in response
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
-}
\ No newline at end of file
+}
+// Invitation represents a pending or redeemed admin invitation stored in the admin_invitations table
+type Invitation struct {
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	Role       string     `json:"role"`
+	TokenHash  string     `json:"-"`
+	InvitedBy  *int       `json:"invited_by"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Session represents a login session stored in the sessions table; rotated sessions share a family
+type Session struct {
+	ID               string     `json:"id"`
+	FamilyID         string     `json:"family_id"`
+	SubjectType      string     `json:"subject_type"`
+	SubjectID        int        `json:"subject_id"`
+	RefreshTokenHash string     `json:"-"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	RevokedReason    *string    `json:"revoked_reason"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// TokenPair represents the short-lived access token and rotating refresh token issued on login and refresh
+type TokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+// RefreshRequest represents the data needed to refresh a token pair
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
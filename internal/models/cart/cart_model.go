@@ -0,0 +1,59 @@
+package models
+
+import (
+	"dgw-technical-test/internal/money"
+	"time"
+)
+
+// Payment methods a farmer can choose at checkout
+const (
+	PaymentMethodWallet = "wallet" // paid from the wallet as part of the checkout
+	PaymentMethodOnline = "online" // a charge is created for the new order
+	PaymentMethodSplit  = "split"  // part is held from the wallet and the rest is charged online
+	PaymentMethodCredit = "credit" // bought on the farmer's credit facility and repaid in instalments
+)
+
+// CartItem represents the structure of the cart_items table in the database
+type CartItem struct {
+	ID        int       `json:"id"`
+	FarmerID  int       `json:"farmer_id"`
+	ProductID int       `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CartLine is a cart item with the current catalog name, price and available stock of its product
+type CartLine struct {
+	ProductID         int         `json:"product_id"`
+	Name              string      `json:"name"`
+	Quantity          int         `json:"quantity"`
+	Price             money.Money `json:"price"`
+	Subtotal          money.Money `json:"subtotal"`
+	AvailableQuantity int         `json:"available_quantity"`
+}
+
+// Cart is a farmer's cart at current catalog prices, the prices are only fixed at checkout
+type Cart struct {
+	FarmerID int         `json:"farmer_id"`
+	Items    []CartLine  `json:"items"`
+	Total    money.Money `json:"total"`
+}
+
+// AddCartItemRequest adds units of a product to the cart
+type AddCartItemRequest struct {
+	ProductID int `json:"product_id" binding:"required"`
+	Quantity  int `json:"quantity" binding:"required,gt=0"`
+}
+
+// UpdateCartItemRequest sets the quantity of a product already in the cart
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,gt=0"`
+}
+
+// CheckoutRequest turns the cart into an order paid with the chosen method
+type CheckoutRequest struct {
+	PaymentMethod string      `json:"payment_method" binding:"required,oneof=wallet online split credit"`
+	Channel       string      `json:"channel"`                                            // online payment channel, see GET /payments/channels; bca_va when empty
+	WalletAmount  money.Money `json:"wallet_amount" swaggertype:"number" example:"50000"` // wallet part of a split payment
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"dgw-technical-test/internal/money"
+	"time"
+)
+
+// Credit facility statuses recorded in credit_facilities.status
+const (
+	FacilityActive    = "active"
+	FacilitySuspended = "suspended" // no new orders on credit, open receivables are still repaid
+)
+
+// Receivable statuses recorded in credit_receivables.status
+const (
+	ReceivableOpen = "open"
+	ReceivablePaid = "paid"
+)
+
+// Instalment statuses recorded in credit_instalments.status
+const (
+	InstalmentDue  = "due"
+	InstalmentPaid = "paid"
+)
+
+// Repayment methods and statuses recorded in credit_repayments
+const (
+	RepaymentWallet = "wallet"
+	RepaymentOnline = "online"
+
+	RepaymentPending = "pending" // online charge created, waiting for the farmer to pay it
+	RepaymentSettled = "settled"
+	RepaymentFailed  = "failed"
+)
+
+// Facility is the pay-later credit an admin grants a farmer
+type Facility struct {
+	ID          int         `json:"id"`
+	FarmerID    int         `json:"farmer_id"`
+	CreditLimit money.Money `json:"credit_limit"` // most the farmer may owe at once
+	TenorDays   int         `json:"tenor_days"`   // days from the purchase to the last instalment
+	Instalments int         `json:"instalments"`  // instalments each receivable is repaid in
+	FeeBps      int         `json:"fee_bps"`      // flat fee on the order total in basis points, 250 is 2.5%
+	Status      string      `json:"status"`
+	AdminID     *int        `json:"admin_id"` // admin who last changed the facility
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// FacilityRequest creates or changes a farmer's facility; the terms apply to orders bought on credit afterwards
+type FacilityRequest struct {
+	CreditLimit money.Money `json:"credit_limit" binding:"required" swaggertype:"number" example:"5000000"`
+	TenorDays   int         `json:"tenor_days" binding:"required,gt=0,lte=365"`
+	Instalments int         `json:"instalments" binding:"required,gt=0,lte=12"`
+	FeeBps      int         `json:"fee_bps" binding:"gte=0,lte=5000"`
+	Status      string      `json:"status" binding:"omitempty,oneof=active suspended"` // active when empty
+}
+
+// Receivable is what a farmer owes for an order bought on credit
+type Receivable struct {
+	ID          int          `json:"id"`
+	FacilityID  int          `json:"facility_id"`
+	FarmerID    int          `json:"farmer_id"`
+	OrderID     int          `json:"order_id"`
+	Reference   string       `json:"reference"` // ledger reference of the credit sale
+	Principal   money.Money  `json:"principal"` // the order total
+	Fee         money.Money  `json:"fee"`
+	Amount      money.Money  `json:"amount"`      // principal and fee, the amount repaid in instalments
+	Outstanding money.Money  `json:"outstanding"` // what is left to repay
+	Status      string       `json:"status"`
+	Instalments []Instalment `json:"instalments,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// Instalment is one scheduled repayment of a receivable
+type Instalment struct {
+	ID           int         `json:"id"`
+	ReceivableID int         `json:"receivable_id"`
+	Sequence     int         `json:"sequence"`
+	DueDate      time.Time   `json:"due_date"`
+	Amount       money.Money `json:"amount"`
+	PaidAmount   money.Money `json:"paid_amount"`
+	Status       string      `json:"status"`
+	PaidAt       *time.Time  `json:"paid_at"`
+}
+
+// Repayment is money paid against a receivable from the wallet or through a payment channel
+type Repayment struct {
+	ID           int         `json:"id"`
+	ReceivableID int         `json:"receivable_id"`
+	FarmerID     int         `json:"farmer_id"`
+	Reference    string      `json:"reference"` // gateway order ID of an online repayment
+	Method       string      `json:"method"`
+	Channel      *string     `json:"channel"`
+	Amount       money.Money `json:"amount"`
+	Status       string      `json:"status"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+}
+
+// RepaymentRequest repays part or all of a receivable; online repayments are charged through the channel
+type RepaymentRequest struct {
+	Amount  money.Money `json:"amount" binding:"required" swaggertype:"number" example:"250000"`
+	Method  string      `json:"method" binding:"required,oneof=wallet online"`
+	Channel string      `json:"channel"` // online payment channel, see GET /payments/channels; bca_va when empty
+}
+
+// CreditAccount is a farmer's facility with what they can still buy on credit and their open receivables
+type CreditAccount struct {
+	Facility    *Facility    `json:"facility"`
+	Outstanding money.Money  `json:"outstanding"`
+	Available   money.Money  `json:"available"` // credit limit less outstanding, zero while suspended
+	Overdue     money.Money  `json:"overdue"`   // unpaid amount of instalments past their due date
+	Receivables []Receivable `json:"receivables"`
+}
+
+// OverdueInstalment is a row of the overdue report: an unpaid instalment past its due date
+type OverdueInstalment struct {
+	FarmerID     int         `json:"farmer_id"`
+	FarmerName   string      `json:"farmer_name"`
+	ReceivableID int         `json:"receivable_id"`
+	OrderID      int         `json:"order_id"`
+	Sequence     int         `json:"sequence"`
+	DueDate      time.Time   `json:"due_date"`
+	AmountDue    money.Money `json:"amount_due"`
+	DaysOverdue  int         `json:"days_overdue"`
+}
+
+// OverdueReport lists overdue instalments, oldest due date first
+type OverdueReport struct {
+	AsOf        time.Time           `json:"as_of"`
+	TotalDue    money.Money         `json:"total_due"`
+	Farmers     int                 `json:"farmers"` // farmers with at least one overdue instalment
+	Instalments []OverdueInstalment `json:"instalments"`
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"dgw-technical-test/internal/money"
+	"time"
+)
+
 // RegisterRequest represents the data needed to register a farmer
 type RegisterRequest struct {
 	Name     string `json:"name"`
@@ -15,10 +20,13 @@ type LoginRequest struct {
 
 // LoginResponse represents the data returned upon successful login
 type LoginResponse struct {
-	Token         string  `json:"token"`
+	Token                 string    `json:"token"`
+	ExpiresAt             time.Time `json:"expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
 	Name          string  `json:"name"`
 	Email         string  `json:"email"`
-	WalletBalance float64 `json:"wallet_balance"`
+	WalletBalance money.Money `json:"wallet_balance"`
 }
 
 // Farmer represents the structure of the farmer data stored in the database
@@ -30,8 +38,7 @@ type Farmer struct {
 	Address      string  `json:"address"`       
 	PhoneNumber  string  `json:"phone_number"`  
 	FarmType     string  `json:"farm_type"`     
-	WalletBalance float64 `json:"wallet_balance"` 
+	WalletBalance money.Money `json:"wallet_balance"` 
 	CreatedAt    string  `json:"created_at"`    
 	UpdatedAt    string  `json:"updated_at"`
-	JWTToken     string  `json:"jwt_token"`
 }
\ No newline at end of file
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"dgw-technical-test/internal/money"
+	"time"
+)
+
+// Hold statuses recorded in order_holds.status
+const (
+	HoldActive   = "held"     // wallet money set aside while the online part of a split payment is pending
+	HoldCaptured = "captured" // the order was paid, the held money went to sales
+	HoldReleased = "released" // the online part failed or the order ended unpaid, the money went back to the wallet
+)
+
+// Hold represents the wallet part of a split payment, held in the ledger until the online part settles
+type Hold struct {
+	ID        int         `json:"id"`
+	OrderID   int         `json:"order_id"`
+	FarmerID  int         `json:"farmer_id"`
+	Reference string      `json:"reference"`
+	Amount    money.Money `json:"amount"`
+	Status    string      `json:"status"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
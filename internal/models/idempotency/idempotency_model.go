@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Record is a request made with an Idempotency-Key and, once it finished, the response replayed for duplicates
+type Record struct {
+	ID           int       `json:"id"`
+	Subject      string    `json:"subject"` // principal that made the request, keys are scoped per subject
+	Key          string    `json:"key"`
+	RequestHash  string    `json:"request_hash"` // sha256 of method, path and body
+	StatusCode   *int      `json:"status_code"`  // nil while the original request is in progress
+	ContentType  string    `json:"content_type"`
+	ResponseBody []byte    `json:"response_body"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// InProgress reports whether the original request hasn't produced a response yet
+func (r *Record) InProgress() bool {
+	return r.StatusCode == nil
+}
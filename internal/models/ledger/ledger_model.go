@@ -0,0 +1,100 @@
+package models
+
+import (
+	"dgw-technical-test/internal/money"
+	"time"
+)
+
+// Entry types recorded in ledger_entries.entry_type
+const (
+	EntryTopUp        = "top_up"
+	EntryOrderPayment = "order_payment"
+	EntryRefund       = "refund"
+	EntryAdjustment   = "adjustment"
+
+	// a payout holds wallet money until the provider confirms the transfer, then settles or reverses it
+	EntryPayoutHold       = "payout_hold"
+	EntryPayoutSettlement = "payout_settlement"
+	EntryPayoutReversal   = "payout_reversal"
+
+	// the wallet part of a split payment is held until the online part settles, then captured or released
+	EntryOrderHold        = "order_hold"
+	EntryOrderHoldCapture = "order_hold_capture"
+	EntryOrderHoldRelease = "order_hold_release"
+
+	// an order bought on credit becomes a receivable, which repayments and refunds of the order reduce
+	EntryCreditSale      = "credit_sale"
+	EntryCreditFee       = "credit_fee"
+	EntryCreditRepayment = "credit_repayment"
+	EntryCreditReduction = "credit_reduction"
+)
+
+// Codes of the system accounts seeded in ledger_accounts; farmer wallets use WalletAccountCode
+const (
+	AccountGatewayClearing   = "gateway_clearing"   // money collected through the payment gateway
+	AccountSalesRevenue      = "sales_revenue"      // orders paid from wallets
+	AccountAdjustments       = "adjustments"        // manual corrections by a Super Admin
+	AccountPayoutHolding     = "payout_holding"     // wallet money held for payouts in flight
+	AccountOrderHolding      = "order_holding"      // wallet money held for split payments in flight
+	AccountCreditReceivables = "credit_receivables" // money farmers owe for orders bought on credit
+	AccountCreditFees        = "credit_fees"        // fees charged on orders bought on credit
+)
+
+// Account represents a ledger account; wallet accounts belong to a farmer
+type Account struct {
+	ID        int       `json:"id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	FarmerID  *int      `json:"farmer_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Entry represents an immutable journal entry; its lines must balance
+type Entry struct {
+	ID          int       `json:"id"`
+	EntryType   string    `json:"entry_type"`
+	Reference   string    `json:"reference"` // unique per entry type, e.g. the gateway order ID of a top-up
+	Description string    `json:"description"`
+	AdminID     *int      `json:"admin_id"`
+	Lines       []Line    `json:"lines"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Line represents one debit or credit of an entry
+type Line struct {
+	ID        int         `json:"id"`
+	EntryID   int         `json:"entry_id"`
+	AccountID int         `json:"account_id"`
+	Debit     money.Money `json:"debit"`
+	Credit    money.Money `json:"credit"`
+}
+
+// BalanceMismatch is a farmer whose cached wallet_balance differs from their ledger balance
+type BalanceMismatch struct {
+	FarmerID      int         `json:"farmer_id"`
+	CachedBalance money.Money `json:"cached_balance"`
+	LedgerBalance money.Money `json:"ledger_balance"`
+}
+
+// UnbalancedEntry is an entry whose debits and credits differ
+type UnbalancedEntry struct {
+	EntryID int         `json:"entry_id"`
+	Debit   money.Money `json:"debit"`
+	Credit  money.Money `json:"credit"`
+}
+
+// ReconciliationReport is the result of checking the cached balances against the ledger
+type ReconciliationReport struct {
+	Balanced          bool              `json:"balanced"`
+	CheckedAt         time.Time         `json:"checked_at"`
+	Mismatches        []BalanceMismatch `json:"mismatches"`
+	UnbalancedEntries []UnbalancedEntry `json:"unbalanced_entries"`
+}
+
+// AdjustmentRequest represents a manual wallet correction; a negative amount debits the wallet
+type AdjustmentRequest struct {
+	FarmerID int         `json:"farmer_id"`
+	Amount   money.Money `json:"amount"`
+	Reason   string      `json:"reason"`
+}
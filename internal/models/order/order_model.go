@@ -1,16 +1,23 @@
 package models
 
-import "time"
+import (
+	domain "dgw-technical-test/internal/domain/order"
+	"dgw-technical-test/internal/money"
+	"time"
+)
 
 // Order represents the structure of the orders table in the database
 type Order struct {
 	ID         int       `json:"id"`
 	FarmerID   int       `json:"farmer_id"`
-	Status     string    `json:"status"`
-	TotalPrice float64   `json:"total_price"`
+	Status     domain.Status `json:"status"`
+	TotalPrice money.Money   `json:"total_price"`
+	PaymentMethod *string   `json:"payment_method"` // wallet, online, split or credit once the order is paid
+	PaymentDueAt *time.Time `json:"payment_due_at"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 	Items     []OrderItem `json:"items"`
+	History   []StatusChange `json:"history,omitempty"` // only filled for the order detail
 }
 
 // OrderItem represents the structure of the order_items table in the database
@@ -18,8 +25,36 @@ type OrderItem struct {
 	ID        int       `json:"id"`
 	OrderID   int       `json:"order_id"`
 	ProductID int       `json:"product_id"`
+	ProductName string  `json:"product_name,omitempty"` // filled when orders are listed or viewed
 	Quantity  int       `json:"quantity"`
-	Price     float64   `json:"price"`
+	Price     money.Money   `json:"price"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
-}
\ No newline at end of file
+}
+
+// StatusChange represents a row of the order_status_history table in the database
+type StatusChange struct {
+	FromStatus *domain.Status `json:"from_status"` // nil for the creation of the order
+	ToStatus   domain.Status  `json:"to_status"`
+	ActorType  string         `json:"actor_type"`
+	ActorID    *int           `json:"actor_id"` // nil for the system
+	Reason     *string        `json:"reason"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// OrderFilter narrows an order listing; zero values don't filter
+type OrderFilter struct {
+	FarmerID      int
+	Status        domain.Status
+	PaymentMethod string
+	From          time.Time // inclusive
+	To            time.Time // exclusive
+	Limit         int
+	Cursor        string // opaque position returned as next_cursor by the previous page
+}
+
+// OrderPage is one page of orders with their items, newest first
+type OrderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"` // empty on the last page
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"dgw-technical-test/internal/money"
+	"encoding/json"
+	"time"
+)
+
+// Notification represents the HTTP notification (webhook) payload sent by Midtrans
+type Notification struct {
+	TransactionTime   string `json:"transaction_time"`
+	TransactionStatus string `json:"transaction_status"`
+	TransactionID     string `json:"transaction_id"`
+	StatusMessage     string `json:"status_message"`
+	StatusCode        string `json:"status_code"`
+	SignatureKey      string `json:"signature_key"`
+	PaymentType       string `json:"payment_type"`
+	OrderID           string `json:"order_id"`
+	MerchantID        string `json:"merchant_id"`
+	GrossAmount       string `json:"gross_amount"`
+	FraudStatus       string `json:"fraud_status"`
+	Currency          string `json:"currency"`
+}
+
+// Payment represents a charge attempt stored in the payments table
+type Payment struct {
+	ID             int             `json:"id"`
+	OrderID        int             `json:"order_id"`
+	GatewayOrderID string          `json:"gateway_order_id"`
+	TransactionID  string          `json:"transaction_id"`
+	Channel        string          `json:"channel"` // payment channel chosen by the farmer, e.g. bca_va or qris
+	PaymentType    string          `json:"payment_type"`
+	Bank           string          `json:"bank"`
+	VANumber       string          `json:"va_number"`
+	Amount         money.Money     `json:"amount"`
+	Status         string          `json:"status"`
+	RawResponse    json.RawMessage `json:"raw_response,omitempty"`
+	AppliedAt      *time.Time      `json:"applied_at"` // when the charge paid its order, nil for charges that didn't
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"dgw-technical-test/internal/money"
+	"time"
+)
+
+// Payout statuses recorded in payouts.status
+const (
+	PayoutPending    = "pending"    // funds held, disbursement not yet accepted by the provider
+	PayoutProcessing = "processing" // accepted by the provider, transfer in progress
+	PayoutCompleted  = "completed"
+	PayoutFailed     = "failed" // held funds were returned to the wallet
+)
+
+// Payout represents wallet money paid out to a farmer's bank account
+type Payout struct {
+	ID                int         `json:"id"`
+	FarmerID          int         `json:"farmer_id"`
+	Reference         string      `json:"reference"`
+	Amount            money.Money `json:"amount"`
+	BankCode          string      `json:"bank_code"`
+	AccountNumber     string      `json:"account_number"`
+	AccountName       string      `json:"account_name"`
+	Status            string      `json:"status"`
+	ProviderReference *string     `json:"provider_reference"`
+	FailureReason     *string     `json:"failure_reason"`
+	CreatedAt         time.Time   `json:"created_at"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+}
+
+// PayoutRequest is the body of a farmer's payout request
+type PayoutRequest struct {
+	Amount        money.Money `json:"amount" binding:"required"`
+	BankCode      string      `json:"bank_code" binding:"required"`
+	AccountNumber string      `json:"account_number" binding:"required"`
+	AccountName   string      `json:"account_name" binding:"required"`
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"dgw-technical-test/internal/money"
+	"time"
+)
 
 // Product represents the structure of a product data stored in the database
 type Product struct {
@@ -8,10 +11,41 @@ type Product struct {
 	SupplierID    int       `json:"supplier_id"`
 	Name          string    `json:"name"`
 	Description   string    `json:"description"`
-	Price         float64   `json:"price"`
+	Price         money.Money   `json:"price"`
 	StockQuantity int       `json:"stock_quantity"`
+	ReservedQuantity  int   `json:"reserved_quantity"`  // held by active stock reservations
+	AvailableQuantity int   `json:"available_quantity"` // stock_quantity - reserved_quantity
 	Category      string    `json:"category"`
 	Brand         string    `json:"brand"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
-}
\ No newline at end of file
+}
+// Catalog sort orders accepted by ProductFilter.Sort
+const (
+	SortNewest    = "newest"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortName      = "name"
+	SortRelevance = "relevance" // best search matches first, only with a search query
+)
+
+// ProductFilter narrows a catalog listing; zero values don't filter
+type ProductFilter struct {
+	Query      string // full-text search over name, description and brand
+	Category   string
+	Brand      string
+	SupplierID int
+	MinPrice   money.Money // inclusive
+	MaxPrice   money.Money // inclusive
+	InStock    bool        // only products with available quantity left
+	Sort       string      // relevance when searching, newest otherwise
+	Limit      int
+	Cursor     string // opaque position returned as next_cursor by the previous page
+}
+
+// ProductPage is one page of the catalog
+type ProductPage struct {
+	Products   []Product `json:"products"`
+	Total      int       `json:"total"`                 // products matching the filter across all pages
+	NextCursor string    `json:"next_cursor,omitempty"` // empty on the last page
+}
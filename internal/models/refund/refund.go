@@ -0,0 +1,74 @@
+package models
+
+import (
+	"dgw-technical-test/internal/money"
+	"time"
+)
+
+// Refund methods recorded in refunds.method
+const (
+	RefundMethodWallet  = "wallet"  // credited to the farmer's wallet through the ledger
+	RefundMethodGateway = "gateway" // returned through the payment gateway that collected the order
+	RefundMethodSplit   = "split"   // gateway_amount through the gateway, the rest of a split payment to the wallet
+)
+
+// Refund statuses recorded in refunds.status
+const (
+	RefundPending   = "pending" // recorded, the gateway hasn't accepted it yet
+	RefundCompleted = "completed"
+	RefundFailed    = "failed" // the gateway refused it, an admin can retry it
+)
+
+// Refund represents money returned to a farmer for some or all items of a paid order.
+// The stock of the refunded items is returned to the catalog when the refund is recorded.
+type Refund struct {
+	ID                int          `json:"id"`
+	OrderID           int          `json:"order_id"`
+	FarmerID          int          `json:"farmer_id"`
+	Reference         string       `json:"reference"`
+	Method            string       `json:"method"`
+	Amount            money.Money  `json:"amount"`
+	GatewayOrderID    *string      `json:"gateway_order_id"`
+	GatewayAmount     *money.Money `json:"gateway_amount"` // whole rupiah sent to the gateway
+	Status            string       `json:"status"`
+	Reason            string       `json:"reason"`
+	AdminID           *int         `json:"admin_id"`
+	ProviderReference *string      `json:"provider_reference"`
+	FailureReason     *string      `json:"failure_reason"` // gateway error of a failed refund
+	CreatedAt         time.Time    `json:"created_at"`
+	UpdatedAt         time.Time    `json:"updated_at"`
+	Items             []RefundItem `json:"items"`
+}
+
+// RefundItem is the part of an order item returned by a refund
+type RefundItem struct {
+	ID          int         `json:"id"`
+	RefundID    int         `json:"refund_id"`
+	OrderItemID int         `json:"order_item_id"`
+	ProductID   int         `json:"product_id"`
+	Quantity    int         `json:"quantity"`
+	Amount      money.Money `json:"amount"`
+}
+
+// RefundableItem is an order item with the quantity already returned by earlier refunds
+type RefundableItem struct {
+	OrderItemID      int
+	ProductID        int
+	Quantity         int
+	RefundedQuantity int
+	Price            money.Money
+}
+
+// RefundItemRequest selects the quantity of one order item to refund
+type RefundItemRequest struct {
+	OrderItemID int `json:"order_item_id" binding:"required"`
+	Quantity    int `json:"quantity" binding:"required,gt=0"`
+}
+
+// RefundRequest is the body of an admin's refund request. Without items, everything not yet
+// refunded is returned; without a method, the money goes back the way the order was paid.
+type RefundRequest struct {
+	Method string              `json:"method" binding:"omitempty,oneof=wallet gateway"`
+	Reason string              `json:"reason" binding:"required"`
+	Items  []RefundItemRequest `json:"items" binding:"dive"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// StockReservation represents a quantity of a product held for a pending order
+type StockReservation struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"order_id"`
+	ProductID int       `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `json:"status"` // 'active', 'released' or 'consumed'
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"dgw-technical-test/internal/money"
+	"time"
+)
+
+// Transaction types recorded in wallet_transactions.transaction_type
+const (
+	TransactionTopUp           = "TopUp"
+	TransactionPayment         = "Payment"
+	TransactionPayout          = "Payout"
+	TransactionRefund          = "Refund"
+	TransactionCreditRepayment = "CreditRepayment"
+)
+
+// Transaction represents a row of a farmer's wallet history (wallet_transactions)
+type Transaction struct {
+	ID              int         `json:"id"`
+	Reference       string      `json:"reference"` // the gateway order ID or internal reference (wallet_transactions.order_id)
+	TransactionType string      `json:"transaction_type"`
+	Amount          money.Money `json:"amount"`
+	Status          string      `json:"status"`
+	Description     string      `json:"description"`
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+}
+
+// TransactionFilter narrows a farmer's wallet history; zero values don't filter
+type TransactionFilter struct {
+	Type   string
+	Status string
+	From   time.Time // inclusive
+	To     time.Time // exclusive
+	Limit  int
+	Cursor string // opaque position returned as next_cursor by the previous page
+}
+
+// TransactionPage is one page of a farmer's wallet history, newest first
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+// StatementLine is a wallet movement on a statement, taken from the ledger
+type StatementLine struct {
+	Date        time.Time   `json:"date"`
+	EntryType   string      `json:"entry_type"`
+	Reference   string      `json:"reference"`
+	Description string      `json:"description"`
+	Credit      money.Money `json:"credit"`
+	Debit       money.Money `json:"debit"`
+	Balance     money.Money `json:"balance"` // running balance after the movement
+}
+
+// Statement is a farmer's monthly wallet statement
+type Statement struct {
+	FarmerID       int             `json:"farmer_id"`
+	FarmerName     string          `json:"farmer_name"`
+	Month          string          `json:"month"` // YYYY-MM
+	PeriodStart    time.Time       `json:"period_start"`
+	PeriodEnd      time.Time       `json:"period_end"`
+	OpeningBalance money.Money     `json:"opening_balance"`
+	ClosingBalance money.Money     `json:"closing_balance"`
+	TotalCredits   money.Money     `json:"total_credits"`
+	TotalDebits    money.Money     `json:"total_debits"`
+	Lines          []StatementLine `json:"lines"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+}
@@ -0,0 +1,209 @@
+// Package money represents IDR amounts exactly as an integer number of sen (1/100 rupiah).
+//
+// Rounding rules:
+//   - amounts sent by clients (JSON, query strings) are parsed exactly; more than two decimal
+//     places is an error rather than being rounded silently
+//   - arithmetic (Add, Sub, Mul) is exact integer arithmetic on sen
+//   - numeric values read from Postgres with more than two decimal places (e.g. aggregates)
+//     are rounded half away from zero to the sen
+//   - gateway requests, which only accept whole rupiah, use WholeRupiah: half away from zero
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Money is an IDR amount in sen. It scans from and encodes to Postgres NUMERIC columns
+// and marshals to JSON as a decimal number with two places, e.g. 12500.50.
+type Money int64
+
+// Zero is the zero amount
+const Zero Money = 0
+
+var (
+	// ErrInvalidAmount is returned when text isn't a decimal amount
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrTooPrecise is returned when an amount has more than two decimal places
+	ErrTooPrecise = errors.New("amount has more than two decimal places")
+	// ErrOverflow is returned when an amount doesn't fit in Money
+	ErrOverflow = errors.New("amount out of range")
+)
+
+// FromSen creates an amount from a number of sen
+func FromSen(sen int64) Money {
+	return Money(sen)
+}
+
+// FromRupiah creates an amount of whole rupiah
+func FromRupiah(rupiah int64) Money {
+	return Money(rupiah * 100)
+}
+
+// Parse reads a decimal amount such as "12500", "-3.5" or "12500.50" exactly
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" || (hasPoint && frac == "") || !digitsOnly(whole) || !digitsOnly(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("%w: %q", ErrTooPrecise, s)
+	}
+
+	frac += strings.Repeat("0", 2-len(frac))
+	sen, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrOverflow, s)
+	}
+	if negative {
+		sen = -sen
+	}
+	return Money(sen), nil
+}
+
+func digitsOnly(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Sen returns the amount in sen
+func (m Money) Sen() int64 {
+	return int64(m)
+}
+
+// WholeRupiah rounds the amount half away from zero to whole rupiah, for gateways that don't accept sen
+func (m Money) WholeRupiah() int64 {
+	sen := int64(m)
+	if sen < 0 {
+		return -((-sen + 50) / 100)
+	}
+	return (sen + 50) / 100
+}
+
+// Add returns m + o
+func (m Money) Add(o Money) Money { return m + o }
+
+// Sub returns m - o
+func (m Money) Sub(o Money) Money { return m - o }
+
+// Mul returns m multiplied by a quantity
+func (m Money) Mul(quantity int) Money { return m * Money(quantity) }
+
+// Neg returns -m
+func (m Money) Neg() Money { return -m }
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool { return m == 0 }
+
+// IsPositive reports whether the amount is greater than zero
+func (m Money) IsPositive() bool { return m > 0 }
+
+// IsNegative reports whether the amount is below zero
+func (m Money) IsNegative() bool { return m < 0 }
+
+// String formats the amount with two decimal places, e.g. -12500.50
+func (m Money) String() string {
+	sen := int64(m)
+	sign := ""
+	if sen < 0 {
+		sign = "-"
+	}
+	abs := new(big.Int).Abs(big.NewInt(sen)).String()
+	if len(abs) < 3 {
+		abs = strings.Repeat("0", 3-len(abs)) + abs
+	}
+	return sign + abs[:len(abs)-2] + "." + abs[len(abs)-2:]
+}
+
+// Format formats the amount the Indonesian way with thousands separators, e.g. 1.250.000,50
+func (m Money) Format() string {
+	s := m.String()
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+
+	var grouped []byte
+	for i := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped = append(grouped, '.')
+		}
+		grouped = append(grouped, whole[i])
+	}
+	return sign + string(grouped) + "," + frac
+}
+
+// MarshalJSON encodes the amount as a JSON number with two decimal places
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a string holding a decimal amount
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner so NUMERIC/DECIMAL columns scan into Money
+func (m *Money) ScanNumeric(n pgtype.Numeric) error {
+	if !n.Valid {
+		return errors.New("cannot scan NULL into money.Money")
+	}
+	if n.NaN || n.InfinityModifier != pgtype.Finite {
+		return fmt.Errorf("%w: not a finite number", ErrInvalidAmount)
+	}
+
+	// value = Int * 10^Exp, so sen = Int * 10^(Exp+2)
+	sen := new(big.Int).Set(n.Int)
+	shift := int64(n.Exp) + 2
+	ten := big.NewInt(10)
+	if shift >= 0 {
+		sen.Mul(sen, new(big.Int).Exp(ten, big.NewInt(shift), nil))
+	} else {
+		divisor := new(big.Int).Exp(ten, big.NewInt(-shift), nil)
+		negative := sen.Sign() < 0
+		sen.Abs(sen)
+		// half away from zero
+		sen.Add(sen, new(big.Int).Quo(divisor, big.NewInt(2)))
+		sen.Quo(sen, divisor)
+		if negative {
+			sen.Neg(sen)
+		}
+	}
+
+	if !sen.IsInt64() {
+		return ErrOverflow
+	}
+	*m = Money(sen.Int64())
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer so Money is sent to Postgres as an exact NUMERIC
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(m)), Exp: -2, Valid: true}, nil
+}
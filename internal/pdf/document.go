@@ -0,0 +1,156 @@
+// Package pdf writes simple text-only PDF documents, enough for statements and reports
+// without pulling in a PDF library. Text is set in Courier so columns can be aligned with padding.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size and margins in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 48.0
+)
+
+type line struct {
+	size float64
+	bold bool
+	text string
+}
+
+// Document collects lines of text and lays them out on A4 pages, starting a new page when one is full
+type Document struct {
+	pages [][]line
+	y     float64
+}
+
+// New creates an empty document
+func New() *Document {
+	return &Document{}
+}
+
+// Text adds a line set in Courier (Courier-Bold when bold) at the given font size
+func (d *Document) Text(size float64, bold bool, text string) {
+	leading := size * 1.35
+	if len(d.pages) == 0 || d.y-leading < margin {
+		d.pages = append(d.pages, nil)
+		d.y = pageHeight - margin
+	}
+	d.y -= leading
+	d.pages[len(d.pages)-1] = append(d.pages[len(d.pages)-1], line{size: size, bold: bold, text: text})
+}
+
+// Blank adds an empty line
+func (d *Document) Blank(size float64) {
+	d.Text(size, false, "")
+}
+
+// WriteTo renders the document as PDF 1.4
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	pages := d.pages
+	if len(pages) == 0 {
+		pages = [][]line{nil}
+	}
+
+	// objects 1-4 are the catalog, page tree and fonts; each page then takes a page and a content object
+	var objects [][]byte
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects = append(objects,
+		[]byte("<< /Type /Catalog /Pages 2 0 R >>"),
+		[]byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages))),
+		[]byte("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>"),
+		[]byte("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>"),
+	)
+	for i, page := range pages {
+		content := pageContent(page)
+		objects = append(objects,
+			[]byte(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 6+2*i)),
+			append([]byte(fmt.Sprintf("<< /Length %d >>\nstream\n", len(content))), append(content, []byte("\nendstream")...)...),
+		)
+	}
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	fmt.Fprint(cw, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int64, len(objects))
+	for i, obj := range objects {
+		offsets[i] = cw.n
+		fmt.Fprintf(cw, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(cw, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(cw, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%EOF\n", len(objects)+1, xref)
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, bw.Flush()
+}
+
+// pageContent renders the text operators of one page
+func pageContent(lines []line) []byte {
+	var b bytes.Buffer
+	y := pageHeight - margin
+	for _, l := range lines {
+		y -= l.size * 1.35
+		if l.text == "" {
+			continue
+		}
+		font := "F1"
+		if l.bold {
+			font = "F2"
+		}
+		fmt.Fprintf(&b, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, l.size, margin, y, escape(l.text))
+	}
+	return b.Bytes()
+}
+
+// escape encodes text as a PDF literal string in WinAnsi, replacing characters it can't represent
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// countingWriter tracks the byte offset needed by the xref table and keeps the first write error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"context"
+	admin "dgw-technical-test/internal/models/admin"
+	"fmt"
+	"time"
+)
+
+// CreateInvitation stores a new invitation keyed by the hash of its token
+func (r *AdminRepository) CreateInvitation(ctx context.Context, email, role, tokenHash string, invitedBy int, expiresAt time.Time) (*admin.Invitation, error) {
+	query := `
+		INSERT INTO admin_invitations (email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, email, role, token_hash, invited_by, expires_at, accepted_at, created_at`
+	var inv admin.Invitation
+	err := r.DB.QueryRow(ctx, query, email, role, tokenHash, invitedBy, expiresAt).Scan(
+		&inv.ID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.InvitedBy, &inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin invitation: %w", err)
+	}
+	return &inv, nil
+}
+
+// GetInvitationByTokenHashForUpdate fetches an invitation by token hash and locks it until the transaction ends
+func (r *AdminRepository) GetInvitationByTokenHashForUpdate(ctx context.Context, tokenHash string) (*admin.Invitation, error) {
+	query := `
+		SELECT id, email, role, token_hash, invited_by, expires_at, accepted_at, created_at
+		FROM admin_invitations
+		WHERE token_hash = $1
+		FOR UPDATE`
+	var inv admin.Invitation
+	err := r.DB.QueryRow(ctx, query, tokenHash).Scan(
+		&inv.ID, &inv.Email, &inv.Role, &inv.TokenHash, &inv.InvitedBy, &inv.ExpiresAt, &inv.AcceptedAt, &inv.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admin invitation: %w", err)
+	}
+	return &inv, nil
+}
+
+// MarkInvitationAccepted marks an invitation as redeemed so it can't be used again
+func (r *AdminRepository) MarkInvitationAccepted(ctx context.Context, invitationID int) error {
+	query := `UPDATE admin_invitations SET accepted_at = CURRENT_TIMESTAMP WHERE id = $1 AND accepted_at IS NULL`
+	tag, err := r.DB.Exec(ctx, query, invitationID)
+	if err != nil {
+		return fmt.Errorf("failed to mark admin invitation %d as accepted: %w", invitationID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("admin invitation %d was already accepted", invitationID)
+	}
+	return nil
+}
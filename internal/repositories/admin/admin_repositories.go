@@ -3,24 +3,31 @@ package repositories
 import (
 	"context"
 	admin "dgw-technical-test/internal/models/admin"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
 	"fmt"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // handle admin related query
 type AdminRepository struct {
-	DB *pgxpool.Pool
+	DB unitofwork.DBTX
 }
 
 func NewAdminRepository(db *pgxpool.Pool) *AdminRepository {
 	return &AdminRepository{DB: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *AdminRepository) WithTx(tx pgx.Tx) *AdminRepository {
+	return &AdminRepository{DB: tx}
+}
+
 // CreateAdmin inserts a new admin into the database
-func (r *AdminRepository) CreateAdmin(name, email, hashedPassword, role string) error {
+func (r *AdminRepository) CreateAdmin(ctx context.Context, name, email, hashedPassword, role string) error {
 	query := `INSERT INTO admins (name, email, password, role) VALUES ($1, $2, $3, $4) RETURNING id`
-	_, err := r.DB.Exec(context.Background(), query, name, email, hashedPassword, role)
+	_, err := r.DB.Exec(ctx, query, name, email, hashedPassword, role)
 	if err != nil {
 		return fmt.Errorf("failed to create admin: %w", err)
 	}
@@ -38,12 +45,33 @@ func (r *AdminRepository) GetAdminByEmail(email string) (*admin.Admin, error) {
 	return &ad, nil
 }
 
-// UpdateAdminJWTToken updates the JWT token for the admin in the database
-func (r *AdminRepository) UpdateAdminJWTToken(adminID int, token string) error {
-	query := `UPDATE admins SET jwt_token = $1 WHERE id = $2`
-	_, err := r.DB.Exec(context.Background(), query, token, adminID)
+// GetAdminByID fetches an admin by their ID
+func (r *AdminRepository) GetAdminByID(ctx context.Context, adminID int) (*admin.Admin, error) {
+	query := `SELECT id, name, email, password, role FROM admins WHERE id = $1`
+	var ad admin.Admin
+	err := r.DB.QueryRow(ctx, query, adminID).Scan(&ad.ID, &ad.Name, &ad.Email, &ad.Password, &ad.Role)
 	if err != nil {
-		return fmt.Errorf("failed to update admin JWT token: %w", err)
+		return nil, fmt.Errorf("failed to get admin: %w", err)
 	}
-	return nil
-}
\ No newline at end of file
+	return &ad, nil
+}
+
+// AdminExistsByEmail reports whether an admin with the given email is already registered
+func (r *AdminRepository) AdminExistsByEmail(ctx context.Context, email string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM admins WHERE email = $1)`
+	var exists bool
+	if err := r.DB.QueryRow(ctx, query, email).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check admin email: %w", err)
+	}
+	return exists, nil
+}
+
+// CountAdminsByRole counts the admins holding the given role
+func (r *AdminRepository) CountAdminsByRole(ctx context.Context, role string) (int, error) {
+	query := `SELECT COUNT(*) FROM admins WHERE role = $1`
+	var count int
+	if err := r.DB.QueryRow(ctx, query, role).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count admins with role %s: %w", role, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	cart "dgw-technical-test/internal/models/cart"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CartRepository stores the products farmers collected in their cart before checking out
+type CartRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewCartRepository(db *pgxpool.Pool) *CartRepository {
+	return &CartRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *CartRepository) WithTx(tx pgx.Tx) *CartRepository {
+	return &CartRepository{DB: tx}
+}
+
+// AddItem adds quantity units of a product to a farmer's cart and returns the quantity now in the cart
+func (r *CartRepository) AddItem(ctx context.Context, farmerID, productID, quantity int) (int, error) {
+	var total int
+	query := `
+		INSERT INTO cart_items (farmer_id, product_id, quantity) VALUES ($1, $2, $3)
+		ON CONFLICT (farmer_id, product_id)
+		DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity, updated_at = NOW()
+		RETURNING quantity`
+	if err := r.DB.QueryRow(ctx, query, farmerID, productID, quantity).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to add cart item: %w", err)
+	}
+	return total, nil
+}
+
+// SetItemQuantity sets the quantity of a product in a farmer's cart. It reports false when the product isn't in the cart.
+func (r *CartRepository) SetItemQuantity(ctx context.Context, farmerID, productID, quantity int) (bool, error) {
+	tag, err := r.DB.Exec(ctx, "UPDATE cart_items SET quantity = $3, updated_at = NOW() WHERE farmer_id = $1 AND product_id = $2", farmerID, productID, quantity)
+	if err != nil {
+		return false, fmt.Errorf("failed to update cart item: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RemoveItem removes a product from a farmer's cart. It reports false when the product isn't in the cart.
+func (r *CartRepository) RemoveItem(ctx context.Context, farmerID, productID int) (bool, error) {
+	tag, err := r.DB.Exec(ctx, "DELETE FROM cart_items WHERE farmer_id = $1 AND product_id = $2", farmerID, productID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove cart item: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetCartLines lists a farmer's cart with the current name, price and available stock of each product
+func (r *CartRepository) GetCartLines(ctx context.Context, farmerID int) ([]cart.CartLine, error) {
+	query := `
+		SELECT p.id, p.name, ci.quantity, p.price, p.stock_quantity - ` + reservation_repo.ReservedQuantitySQL + `
+		FROM cart_items ci
+		JOIN products p ON p.id = ci.product_id
+		WHERE ci.farmer_id = $1
+		ORDER BY ci.id`
+	rows, err := r.DB.Query(ctx, query, farmerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	lines, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (cart.CartLine, error) {
+		var line cart.CartLine
+		err := row.Scan(&line.ProductID, &line.Name, &line.Quantity, &line.Price, &line.AvailableQuantity)
+		line.Subtotal = line.Price.Mul(line.Quantity)
+		return line, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan cart line: %w", err)
+	}
+	return lines, nil
+}
+
+// GetItemsForUpdate lists a farmer's cart items and locks them until the transaction ends,
+// so the same cart can't be checked out twice concurrently; run it in a unit of work
+func (r *CartRepository) GetItemsForUpdate(ctx context.Context, farmerID int) ([]cart.CartItem, error) {
+	query := `SELECT id, farmer_id, product_id, quantity, created_at, updated_at FROM cart_items WHERE farmer_id = $1 ORDER BY id FOR UPDATE`
+	rows, err := r.DB.Query(ctx, query, farmerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart items: %w", err)
+	}
+
+	items, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (cart.CartItem, error) {
+		var item cart.CartItem
+		err := row.Scan(&item.ID, &item.FarmerID, &item.ProductID, &item.Quantity, &item.CreatedAt, &item.UpdatedAt)
+		return item, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan cart item: %w", err)
+	}
+	return items, nil
+}
+
+// ClearCart empties a farmer's cart
+func (r *CartRepository) ClearCart(ctx context.Context, farmerID int) error {
+	if _, err := r.DB.Exec(ctx, "DELETE FROM cart_items WHERE farmer_id = $1", farmerID); err != nil {
+		return fmt.Errorf("failed to clear cart: %w", err)
+	}
+	return nil
+}
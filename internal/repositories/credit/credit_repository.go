@@ -0,0 +1,306 @@
+package repositories
+
+import (
+	"context"
+	credit "dgw-technical-test/internal/models/credit"
+	"dgw-technical-test/internal/money"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CreditRepository stores farmers' credit facilities, the receivables of orders bought on credit,
+// their instalment schedules and the repayments made against them
+type CreditRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewCreditRepository(db *pgxpool.Pool) *CreditRepository {
+	return &CreditRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *CreditRepository) WithTx(tx pgx.Tx) *CreditRepository {
+	return &CreditRepository{DB: tx}
+}
+
+const facilityColumns = `id, farmer_id, credit_limit, tenor_days, instalments, fee_bps, status, admin_id, created_at, updated_at`
+
+func scanFacility(row pgx.Row) (*credit.Facility, error) {
+	var f credit.Facility
+	err := row.Scan(&f.ID, &f.FarmerID, &f.CreditLimit, &f.TenorDays, &f.Instalments, &f.FeeBps, &f.Status, &f.AdminID, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// SaveFacility creates the farmer's facility or replaces its terms and returns it
+func (r *CreditRepository) SaveFacility(ctx context.Context, farmerID, adminID int, req credit.FacilityRequest) (*credit.Facility, error) {
+	query := `
+		INSERT INTO credit_facilities (farmer_id, credit_limit, tenor_days, instalments, fee_bps, status, admin_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (farmer_id) DO UPDATE
+		SET credit_limit = EXCLUDED.credit_limit, tenor_days = EXCLUDED.tenor_days, instalments = EXCLUDED.instalments,
+			fee_bps = EXCLUDED.fee_bps, status = EXCLUDED.status, admin_id = EXCLUDED.admin_id, updated_at = NOW()
+		RETURNING ` + facilityColumns
+	f, err := scanFacility(r.DB.QueryRow(ctx, query, farmerID, req.CreditLimit, req.TenorDays, req.Instalments, req.FeeBps, req.Status, adminID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save credit facility: %w", err)
+	}
+	return f, nil
+}
+
+// GetFacility fetches the farmer's facility
+func (r *CreditRepository) GetFacility(ctx context.Context, farmerID int) (*credit.Facility, error) {
+	f, err := scanFacility(r.DB.QueryRow(ctx, `SELECT `+facilityColumns+` FROM credit_facilities WHERE farmer_id = $1`, farmerID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit facility: %w", err)
+	}
+	return f, nil
+}
+
+// GetFacilityForUpdate fetches and locks the farmer's facility, so concurrent credit purchases are checked against the limit one at a time
+func (r *CreditRepository) GetFacilityForUpdate(ctx context.Context, farmerID int) (*credit.Facility, error) {
+	f, err := scanFacility(r.DB.QueryRow(ctx, `SELECT `+facilityColumns+` FROM credit_facilities WHERE farmer_id = $1 FOR UPDATE`, farmerID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock credit facility: %w", err)
+	}
+	return f, nil
+}
+
+// GetOutstanding returns what the farmer still owes on open receivables
+func (r *CreditRepository) GetOutstanding(ctx context.Context, farmerID int) (money.Money, error) {
+	var outstanding money.Money
+	err := r.DB.QueryRow(ctx, `SELECT COALESCE(SUM(outstanding), 0) FROM credit_receivables WHERE farmer_id = $1 AND status = 'open'`, farmerID).Scan(&outstanding)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get outstanding credit: %w", err)
+	}
+	return outstanding, nil
+}
+
+// GetOverdueAmount returns the unpaid amount of the farmer's instalments that were due before today
+func (r *CreditRepository) GetOverdueAmount(ctx context.Context, farmerID int) (money.Money, error) {
+	var overdue money.Money
+	query := `
+		SELECT COALESCE(SUM(i.amount - i.paid_amount), 0)
+		FROM credit_instalments i
+		JOIN credit_receivables cr ON cr.id = i.receivable_id
+		WHERE cr.farmer_id = $1 AND i.status = 'due' AND i.due_date < CURRENT_DATE`
+	if err := r.DB.QueryRow(ctx, query, farmerID).Scan(&overdue); err != nil {
+		return 0, fmt.Errorf("failed to get overdue credit: %w", err)
+	}
+	return overdue, nil
+}
+
+const receivableColumns = `id, facility_id, farmer_id, order_id, reference, principal, fee, amount, outstanding, status, created_at, updated_at`
+
+func scanReceivable(row pgx.Row) (*credit.Receivable, error) {
+	var rc credit.Receivable
+	err := row.Scan(&rc.ID, &rc.FacilityID, &rc.FarmerID, &rc.OrderID, &rc.Reference, &rc.Principal, &rc.Fee, &rc.Amount, &rc.Outstanding, &rc.Status, &rc.CreatedAt, &rc.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rc, nil
+}
+
+// CreateReceivable inserts an open receivable for the whole amount and returns it
+func (r *CreditRepository) CreateReceivable(ctx context.Context, rc *credit.Receivable) (*credit.Receivable, error) {
+	query := `
+		INSERT INTO credit_receivables (facility_id, farmer_id, order_id, reference, principal, fee, amount, outstanding)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING ` + receivableColumns
+	created, err := scanReceivable(r.DB.QueryRow(ctx, query, rc.FacilityID, rc.FarmerID, rc.OrderID, rc.Reference, rc.Principal, rc.Fee, rc.Amount))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create receivable: %w", err)
+	}
+	return created, nil
+}
+
+// GetReceivable fetches a receivable
+func (r *CreditRepository) GetReceivable(ctx context.Context, receivableID int) (*credit.Receivable, error) {
+	rc, err := scanReceivable(r.DB.QueryRow(ctx, `SELECT `+receivableColumns+` FROM credit_receivables WHERE id = $1`, receivableID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receivable: %w", err)
+	}
+	return rc, nil
+}
+
+// GetReceivableForUpdate fetches and locks a receivable so repayments are applied one at a time
+func (r *CreditRepository) GetReceivableForUpdate(ctx context.Context, receivableID int) (*credit.Receivable, error) {
+	rc, err := scanReceivable(r.DB.QueryRow(ctx, `SELECT `+receivableColumns+` FROM credit_receivables WHERE id = $1 FOR UPDATE`, receivableID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock receivable: %w", err)
+	}
+	return rc, nil
+}
+
+// GetReceivableByOrderIDForUpdate fetches and locks the receivable of an order bought on credit
+func (r *CreditRepository) GetReceivableByOrderIDForUpdate(ctx context.Context, orderID int) (*credit.Receivable, error) {
+	rc, err := scanReceivable(r.DB.QueryRow(ctx, `SELECT `+receivableColumns+` FROM credit_receivables WHERE order_id = $1 FOR UPDATE`, orderID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock receivable: %w", err)
+	}
+	return rc, nil
+}
+
+// ListReceivables returns the farmer's receivables, newest first; only open ones unless all is set
+func (r *CreditRepository) ListReceivables(ctx context.Context, farmerID int, all bool) ([]credit.Receivable, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+receivableColumns+` FROM credit_receivables
+		WHERE farmer_id = $1 AND ($2 OR status = 'open')
+		ORDER BY created_at DESC, id DESC`, farmerID, all)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list receivables: %w", err)
+	}
+	defer rows.Close()
+
+	receivables := []credit.Receivable{}
+	for rows.Next() {
+		rc, err := scanReceivable(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan receivable: %w", err)
+		}
+		receivables = append(receivables, *rc)
+	}
+	return receivables, rows.Err()
+}
+
+// SetOutstanding records what is left to repay on a receivable, which is paid once nothing is
+func (r *CreditRepository) SetOutstanding(ctx context.Context, receivableID int, outstanding money.Money) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE credit_receivables
+		SET outstanding = $2, status = CASE WHEN $2 = 0 THEN 'paid' ELSE 'open' END, updated_at = NOW()
+		WHERE id = $1`, receivableID, outstanding)
+	if err != nil {
+		return fmt.Errorf("failed to update receivable: %w", err)
+	}
+	return nil
+}
+
+// AddInstalment inserts a due instalment of a receivable
+func (r *CreditRepository) AddInstalment(ctx context.Context, in credit.Instalment) error {
+	_, err := r.DB.Exec(ctx, `
+		INSERT INTO credit_instalments (receivable_id, sequence, due_date, amount)
+		VALUES ($1, $2, $3, $4)`, in.ReceivableID, in.Sequence, in.DueDate, in.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to add instalment: %w", err)
+	}
+	return nil
+}
+
+// ListInstalments returns the schedule of a receivable in order
+func (r *CreditRepository) ListInstalments(ctx context.Context, receivableID int) ([]credit.Instalment, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id, receivable_id, sequence, due_date, amount, paid_amount, status, paid_at
+		FROM credit_instalments WHERE receivable_id = $1 ORDER BY sequence`, receivableID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instalments: %w", err)
+	}
+	defer rows.Close()
+
+	instalments := []credit.Instalment{}
+	for rows.Next() {
+		var in credit.Instalment
+		if err := rows.Scan(&in.ID, &in.ReceivableID, &in.Sequence, &in.DueDate, &in.Amount, &in.PaidAmount, &in.Status, &in.PaidAt); err != nil {
+			return nil, fmt.Errorf("failed to scan instalment: %w", err)
+		}
+		instalments = append(instalments, in)
+	}
+	return instalments, rows.Err()
+}
+
+// UpdateInstalment records the amount and paid amount of an instalment, which is paid once they meet
+func (r *CreditRepository) UpdateInstalment(ctx context.Context, instalmentID int, amount, paidAmount money.Money) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE credit_instalments
+		SET amount = $2, paid_amount = $3,
+			status = CASE WHEN $3 >= $2 THEN 'paid' ELSE 'due' END,
+			paid_at = CASE WHEN $3 >= $2 THEN COALESCE(paid_at, NOW()) END
+		WHERE id = $1`, instalmentID, amount, paidAmount)
+	if err != nil {
+		return fmt.Errorf("failed to update instalment: %w", err)
+	}
+	return nil
+}
+
+// GetOverdueInstalments returns unpaid instalments due before today, oldest first; farmerID 0 returns every farmer's
+func (r *CreditRepository) GetOverdueInstalments(ctx context.Context, farmerID int) ([]credit.OverdueInstalment, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT f.id, f.name, cr.id, cr.order_id, i.sequence, i.due_date, i.amount - i.paid_amount, CURRENT_DATE - i.due_date
+		FROM credit_instalments i
+		JOIN credit_receivables cr ON cr.id = i.receivable_id
+		JOIN farmers f ON f.id = cr.farmer_id
+		WHERE i.status = 'due' AND i.due_date < CURRENT_DATE AND ($1 = 0 OR cr.farmer_id = $1)
+		ORDER BY i.due_date, cr.id, i.sequence`, farmerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get overdue instalments: %w", err)
+	}
+	defer rows.Close()
+
+	overdue := []credit.OverdueInstalment{}
+	for rows.Next() {
+		var o credit.OverdueInstalment
+		if err := rows.Scan(&o.FarmerID, &o.FarmerName, &o.ReceivableID, &o.OrderID, &o.Sequence, &o.DueDate, &o.AmountDue, &o.DaysOverdue); err != nil {
+			return nil, fmt.Errorf("failed to scan overdue instalment: %w", err)
+		}
+		overdue = append(overdue, o)
+	}
+	return overdue, rows.Err()
+}
+
+const repaymentColumns = `id, receivable_id, farmer_id, reference, method, channel, amount, status, created_at, updated_at`
+
+func scanRepayment(row pgx.Row) (*credit.Repayment, error) {
+	var p credit.Repayment
+	err := row.Scan(&p.ID, &p.ReceivableID, &p.FarmerID, &p.Reference, &p.Method, &p.Channel, &p.Amount, &p.Status, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreateRepayment inserts a repayment with its status and returns it
+func (r *CreditRepository) CreateRepayment(ctx context.Context, p *credit.Repayment) (*credit.Repayment, error) {
+	query := `
+		INSERT INTO credit_repayments (receivable_id, farmer_id, reference, method, channel, amount, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING ` + repaymentColumns
+	created, err := scanRepayment(r.DB.QueryRow(ctx, query, p.ReceivableID, p.FarmerID, p.Reference, p.Method, p.Channel, p.Amount, p.Status))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repayment: %w", err)
+	}
+	return created, nil
+}
+
+// GetRepaymentByID fetches a repayment
+func (r *CreditRepository) GetRepaymentByID(ctx context.Context, repaymentID int) (*credit.Repayment, error) {
+	p, err := scanRepayment(r.DB.QueryRow(ctx, `SELECT `+repaymentColumns+` FROM credit_repayments WHERE id = $1`, repaymentID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repayment: %w", err)
+	}
+	return p, nil
+}
+
+// GetRepaymentByReference fetches a repayment by its gateway order ID
+func (r *CreditRepository) GetRepaymentByReference(ctx context.Context, reference string) (*credit.Repayment, error) {
+	p, err := scanRepayment(r.DB.QueryRow(ctx, `SELECT `+repaymentColumns+` FROM credit_repayments WHERE reference = $1`, reference))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repayment: %w", err)
+	}
+	return p, nil
+}
+
+// ResolveRepayment moves a pending repayment to settled or failed. It reports false when another
+// caller resolved it first, so the repayment is only applied to the receivable once.
+func (r *CreditRepository) ResolveRepayment(ctx context.Context, repaymentID int, status string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE credit_repayments SET status = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'`, repaymentID, status)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve repayment: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
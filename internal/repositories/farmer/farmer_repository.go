@@ -3,20 +3,29 @@ package repositories
 import (
 	"context"
 	"dgw-technical-test/internal/models/farmer"
+	"dgw-technical-test/internal/money"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"errors"
 	"fmt"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // FarmerRepository interacts with the database to handle farmer-related queries
 type FarmerRepository struct {
-	DB *pgxpool.Pool
+	DB unitofwork.DBTX
 }
 
 func NewFarmerRepository(db *pgxpool.Pool) *FarmerRepository {
 	return &FarmerRepository{DB: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *FarmerRepository) WithTx(tx pgx.Tx) *FarmerRepository {
+	return &FarmerRepository{DB: tx}
+}
+
 // CreateFarmer inserts a new farmer into the database
 func (r *FarmerRepository) CreateFarmer(name, email, hashedPassword string) error {
 	query := `INSERT INTO farmers (name, email, password, wallet_balance) VALUES ($1, $2, $3, 0) RETURNING id`
@@ -38,16 +47,6 @@ func (r *FarmerRepository) GetFarmerByEmail(email string) (*models.Farmer, error
 	return &farmer, nil
 }
 
-// UpdateFarmerJWTToken updates the JWT token for the farmer in the database
-func (r *FarmerRepository) UpdateFarmerJWTToken(farmerID int, token string) error {
-	query := `UPDATE farmers SET jwt_token = $1 WHERE id = $2`
-	_, err := r.DB.Exec(context.Background(), query, token, farmerID)
-	if err != nil {
-		return fmt.Errorf("failed to update farmer JWT token: %w", err)
-	}
-	return nil
-}
-
 // GetFarmerByID fetches a farmer by their ID
 func (r *FarmerRepository) GetFarmerByID(farmerID int) (*models.Farmer, error) {
 	query := `SELECT id, name, email, password, wallet_balance FROM farmers WHERE id = $1`
@@ -60,8 +59,8 @@ func (r *FarmerRepository) GetFarmerByID(farmerID int) (*models.Farmer, error) {
 }
 
 // GetFarmerWalletBalance retrieves the wallet balance of the farmer by their ID
-func (r *FarmerRepository) GetFarmerWalletBalance(farmerID int) (float64, error) {
-    var walletBalance float64
+func (r *FarmerRepository) GetFarmerWalletBalance(farmerID int) (money.Money, error) {
+    var walletBalance money.Money
 	query := "SELECT wallet_balance FROM farmers WHERE id = $1"
 	err := r.DB.QueryRow(context.Background(), query, farmerID).Scan(&walletBalance)
     if err != nil {
@@ -70,12 +69,12 @@ func (r *FarmerRepository) GetFarmerWalletBalance(farmerID int) (float64, error)
     return walletBalance, nil
 }
 
-// LogWalletTransaction logs a new transaction in the wallet_transactions table (PENDING)
-func (r *FarmerRepository) LogWalletTransaction(farmerID int, orderID string, amount float64, description string) error {
+// LogTopUpTransaction logs a new top-up in the wallet_transactions table (PENDING)
+func (r *FarmerRepository) LogTopUpTransaction(farmerID int, orderID string, amount money.Money, description string) error {
 	// Insert the transaction into the farmers' transaction table (wallet_transactions)
 	transactionQuery := `
 		INSERT INTO wallet_transactions (farmer_id, order_id, transaction_type, amount, status, description, created_at, updated_at)
-		VALUES ($1, $2, 'Withdraw', $3, 'pending', $4, NOW(), NOW())
+		VALUES ($1, $2, 'TopUp', $3, 'pending', $4, NOW(), NOW())
 	`
 	_, txnErr := r.DB.Exec(context.Background(), transactionQuery, farmerID, orderID, amount, description)
 	if txnErr != nil {
@@ -84,18 +83,42 @@ func (r *FarmerRepository) LogWalletTransaction(farmerID int, orderID string, am
 	return nil
 }
 
-// get transaction status for wallet withdraw transaction in here
+// RecordWalletTransaction records a wallet movement that is already final, e.g. a wallet payment for an order
+func (r *FarmerRepository) RecordWalletTransaction(ctx context.Context, farmerID int, reference, transactionType string, amount money.Money, status, description string) error {
+	query := `
+		INSERT INTO wallet_transactions (farmer_id, order_id, transaction_type, amount, status, description, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+	`
+	_, err := r.DB.Exec(ctx, query, farmerID, reference, transactionType, amount, status, description)
+	if err != nil {
+		return fmt.Errorf("failed to record wallet transaction: %w", err)
+	}
+	return nil
+}
+
+// get transaction status for wallet top-up transactions in here
+
+// GetTopUpOwner retrieves the ID of the farmer whose wallet a top-up belongs to; other wallet transactions
+// sharing the reference aren't top-ups and aren't found
+func (r *FarmerRepository) GetTopUpOwner(ctx context.Context, orderID string) (int, error) {
+	var farmerID int
+	query := "SELECT farmer_id FROM wallet_transactions WHERE order_id = $1 AND transaction_type = 'TopUp' LIMIT 1"
+	if err := r.DB.QueryRow(ctx, query, orderID).Scan(&farmerID); err != nil {
+		return 0, fmt.Errorf("failed to get top-up owner: %w", err)
+	}
+	return farmerID, nil
+}
 
-// GetWithdrawalStatus retrieves the status of a withdrawal transaction
-func (r *FarmerRepository) GetWithdrawalStatus(orderID string) (map[string]interface{}, error) {
+// GetWalletTransactionStatus retrieves the status of a wallet transaction
+func (r *FarmerRepository) GetWalletTransactionStatus(ctx context.Context, orderID string) (map[string]interface{}, error) {
 	var status string
-	var amount float64
+	var amount money.Money
 
-	// Query the status and amount from wallet_transactions using the order_id (assuming order_id is unique for each transaction)
-	query := `SELECT status, amount FROM wallet_transactions WHERE order_id = $1`
-	err := r.DB.QueryRow(context.Background(), query, orderID).Scan(&status, &amount)
+	// Query the status and amount of the top-up with the order_id, other movements can share the reference
+	query := `SELECT status, amount FROM wallet_transactions WHERE order_id = $1 AND transaction_type = 'TopUp' LIMIT 1`
+	err := r.DB.QueryRow(ctx, query, orderID).Scan(&status, &amount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get withdrawal status: %v", err)
+		return nil, fmt.Errorf("failed to get wallet transaction status: %w", err)
 	}
 
 	// Return the transaction details
@@ -106,135 +129,31 @@ func (r *FarmerRepository) GetWithdrawalStatus(orderID string) (map[string]inter
 	}, nil
 }
 
-// GetWithdrawalAmount retrieves the amount of the withdrawal transaction
-func (r *FarmerRepository) GetWithdrawalAmount(orderID string) (float64, error) {
-	var amount float64
-	// Query the amount based on the order_id
-	query := `SELECT amount FROM wallet_transactions WHERE order_id = $1`
-	err := r.DB.QueryRow(context.Background(), query, orderID).Scan(&amount)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get withdrawal amount: %v", err)
+// SettleWalletTransaction moves a pending wallet transaction of transactionType to settlement and returns its farmer and amount.
+// settled is false when the transaction already left pending, so the caller credits or settles it at most once;
+// run it in the unit of work that posts the matching ledger entry. The type keeps a reference shared by
+// movements of different kinds from settling the wrong one.
+func (r *FarmerRepository) SettleWalletTransaction(ctx context.Context, orderID, transactionType string) (farmerID int, amount money.Money, settled bool, err error) {
+	query := `
+		UPDATE wallet_transactions SET status = 'settlement', updated_at = NOW()
+		WHERE order_id = $1 AND transaction_type = $2 AND status = 'pending'
+		RETURNING farmer_id, amount`
+	err = r.DB.QueryRow(ctx, query, orderID, transactionType).Scan(&farmerID, &amount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, false, nil
 	}
-	return amount, nil
-}
-
-// GetFarmerIDByOrderID retrieves the farmer ID associated with the given order ID
-func (r *FarmerRepository) GetFarmerIDByOrderID(orderID string) (int, error) {
-	var farmerID int
-	query := `SELECT farmer_id FROM wallet_transactions WHERE order_id = $1`
-	err := r.DB.QueryRow(context.Background(), query, orderID).Scan(&farmerID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get farmer ID: %v", err)
+		return 0, 0, false, fmt.Errorf("failed to settle wallet transaction: %w", err)
 	}
-	return farmerID, nil
+	return farmerID, amount, true, nil
 }
 
-// UpdateFarmerWalletBalance updates the farmer's wallet balance after the transaction
-func (r *FarmerRepository) UpdateFarmerWalletBalance(farmerID int, amount float64) error {
-	query := `UPDATE farmers SET wallet_balance = wallet_balance + $1 WHERE id = $2`
-	_, err := r.DB.Exec(context.Background(), query, amount, farmerID)
+// MarkTransactionAsFailed marks a pending transaction of transactionType as failed (denied, cancelled or expired at the gateway)
+func (r *FarmerRepository) MarkTransactionAsFailed(ctx context.Context, orderID, transactionType string) error {
+	query := `UPDATE wallet_transactions SET status = 'failed', updated_at = NOW() WHERE order_id = $1 AND transaction_type = $2 AND status = 'pending'`
+	_, err := r.DB.Exec(ctx, query, orderID, transactionType)
 	if err != nil {
-		return fmt.Errorf("failed to update wallet balance: %v", err)
+		return fmt.Errorf("failed to mark transaction as failed: %v", err)
 	}
 	return nil
 }
-
-// MarkTransactionAsProcessed marks the transaction as processed (completed)
-func (r *FarmerRepository) MarkTransactionAsProcessed(orderID string) error {
-	query := `UPDATE wallet_transactions SET status = 'settlement' WHERE order_id = $1`
-	_, err := r.DB.Exec(context.Background(), query, orderID)
-	if err != nil {
-		return fmt.Errorf("failed to mark transaction as processed: %v", err)
-	}
-	return nil
-}
-
-// ProcessOrder processes an order by deducting the total cost from the farmer's wallet and updating stock quantities
-func (r *FarmerRepository) ProcessOrder(ctx context.Context, orderID string, farmerID int) error {
-	tx, err := r.DB.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
-	var totalCost, walletBalance float64
-	err = tx.QueryRow(ctx, "SELECT total_price FROM orders WHERE id = $1 AND farmer_id = $2 AND status = 'pending'", orderID, farmerID).Scan(&totalCost)
-	if err != nil {
-		return fmt.Errorf("failed to get total cost: %w", err)
-	}
-
-	err = tx.QueryRow(ctx, "SELECT wallet_balance FROM farmers WHERE id = $1", farmerID).Scan(&walletBalance)
-	if err != nil {
-		return fmt.Errorf("failed to get wallet balance: %w", err)
-	}
-
-	if walletBalance < totalCost {
-		return fmt.Errorf("insufficient wallet balance")
-	}
-
-	rows, err := tx.Query(ctx, `SELECT product_id, quantity FROM order_items WHERE order_id = $1`, orderID)
-	if err != nil {
-		return fmt.Errorf("failed to get order items: %w", err)
-	}
-	defer rows.Close()
-
-	items := make([]struct {
-		ProductID int
-		Quantity  int
-	}, 0)
-
-	for rows.Next() {
-		var item struct {
-			ProductID int
-			Quantity  int
-		}
-		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
-			return fmt.Errorf("failed to scan order item: %w", err)
-		}
-		items = append(items, item)
-	}
-
-	for _, item := range items {
-		var stockQuantity int
-		err = tx.QueryRow(ctx, `SELECT stock_quantity FROM products WHERE id = $1`, item.ProductID).Scan(&stockQuantity)
-		if err != nil {
-			return fmt.Errorf("failed to get stock quantity: %w", err)
-		}
-		if stockQuantity < item.Quantity {
-			_, err := tx.Exec(ctx, "UPDATE orders SET status = 'cancelled' WHERE id = $1", orderID)
-			if err != nil {
-				return fmt.Errorf("failed to update order status: %w", err)
-			}
-			return fmt.Errorf("insufficient stock for product_id %d", item.ProductID)
-		}
-
-		_, err = tx.Exec(ctx, `UPDATE products SET stock_quantity = stock_quantity - $1 WHERE id = $2`, item.Quantity, item.ProductID)
-		if err != nil {
-			return fmt.Errorf("failed to update stock quantity: %w", err)
-		}
-	}
-
-	_, err = tx.Exec(ctx, "UPDATE farmers SET wallet_balance = wallet_balance - $1 WHERE id = $2", totalCost, farmerID)
-	if err != nil {
-		return fmt.Errorf("failed to update wallet balance: %w", err)
-	}
-
-	_, err = tx.Exec(ctx, "UPDATE orders SET status = 'settlement' WHERE id = $1", orderID)
-	if err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
-	}
-
-	// set orders is_processed to true
-	_, err = tx.Exec(ctx, "UPDATE orders SET is_processed = true WHERE id = $1", orderID)
-	if err != nil {
-		return fmt.Errorf("failed to set order as processed: %w", err)
-	}
-
-	// set payment_method to be wallet 
-	_, err = tx.Exec(ctx, "UPDATE orders SET payment_method = 'wallet' WHERE id = $1", orderID)
-	if err != nil {
-		return fmt.Errorf("failed to set order as processed: %w", err)
-	}
-
-	return tx.Commit(ctx)
-}
\ No newline at end of file
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	hold "dgw-technical-test/internal/models/hold"
+	"dgw-technical-test/internal/money"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HoldRepository stores the wallet money held for split payments of orders
+type HoldRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewHoldRepository(db *pgxpool.Pool) *HoldRepository {
+	return &HoldRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *HoldRepository) WithTx(tx pgx.Tx) *HoldRepository {
+	return &HoldRepository{DB: tx}
+}
+
+const holdColumns = `id, order_id, farmer_id, reference, amount, status, created_at, updated_at`
+
+func scanHold(row pgx.Row) (*hold.Hold, error) {
+	var h hold.Hold
+	err := row.Scan(&h.ID, &h.OrderID, &h.FarmerID, &h.Reference, &h.Amount, &h.Status, &h.CreatedAt, &h.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// CreateHold inserts an active hold for an order and returns it; an order has at most one active hold
+func (r *HoldRepository) CreateHold(ctx context.Context, orderID, farmerID int, reference string, amount money.Money) (*hold.Hold, error) {
+	query := `
+		INSERT INTO order_holds (order_id, farmer_id, reference, amount)
+		VALUES ($1, $2, $3, $4)
+		RETURNING ` + holdColumns
+	h, err := scanHold(r.DB.QueryRow(ctx, query, orderID, farmerID, reference, amount))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hold: %w", err)
+	}
+	return h, nil
+}
+
+// GetActiveHold fetches the active hold of an order, failing with pgx.ErrNoRows when it has none
+func (r *HoldRepository) GetActiveHold(ctx context.Context, orderID int) (*hold.Hold, error) {
+	h, err := scanHold(r.DB.QueryRow(ctx, `SELECT `+holdColumns+` FROM order_holds WHERE order_id = $1 AND status = 'held'`, orderID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active hold: %w", err)
+	}
+	return h, nil
+}
+
+// ResolveHold moves an active hold to captured or released. It reports false when another caller
+// resolved it first, so the ledger entry for the outcome is only posted once.
+func (r *HoldRepository) ResolveHold(ctx context.Context, holdID int, status string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE order_holds SET status = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'held'`, holdID, status)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve hold: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	idempotency "dgw-technical-test/internal/models/idempotency"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IdempotencyRepository stores Idempotency-Key requests and their responses
+type IdempotencyRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewIdempotencyRepository(db *pgxpool.Pool) *IdempotencyRepository {
+	return &IdempotencyRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *IdempotencyRepository) WithTx(tx pgx.Tx) *IdempotencyRepository {
+	return &IdempotencyRepository{DB: tx}
+}
+
+// ClaimKey records an in-progress request for the key. It reports false when the key is already held by an
+// unexpired record, in which case the caller must replay or reject; an expired record is taken over.
+func (r *IdempotencyRepository) ClaimKey(ctx context.Context, subject, key, requestHash string, expiresAt time.Time) (bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (subject, idempotency_key, request_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (subject, idempotency_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash, status_code = NULL, content_type = NULL, response_body = NULL,
+		    created_at = NOW(), expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at < NOW()
+		RETURNING id`
+	var id int
+	err := r.DB.QueryRow(ctx, query, subject, key, requestHash, expiresAt).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	return true, nil
+}
+
+// GetRecord fetches the record of a key
+func (r *IdempotencyRepository) GetRecord(ctx context.Context, subject, key string) (*idempotency.Record, error) {
+	query := `
+		SELECT id, subject, idempotency_key, request_hash, status_code, COALESCE(content_type, ''), response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE subject = $1 AND idempotency_key = $2`
+	var rec idempotency.Record
+	err := r.DB.QueryRow(ctx, query, subject, key).Scan(
+		&rec.ID, &rec.Subject, &rec.Key, &rec.RequestHash, &rec.StatusCode, &rec.ContentType, &rec.ResponseBody, &rec.CreatedAt, &rec.ExpiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	return &rec, nil
+}
+
+// SaveResponse stores the response of the request holding the key
+func (r *IdempotencyRepository) SaveResponse(ctx context.Context, subject, key string, statusCode int, contentType string, body []byte) error {
+	query := `
+		UPDATE idempotency_keys SET status_code = $3, content_type = $4, response_body = $5
+		WHERE subject = $1 AND idempotency_key = $2`
+	_, err := r.DB.Exec(ctx, query, subject, key, statusCode, contentType, body)
+	if err != nil {
+		return fmt.Errorf("failed to save idempotent response: %w", err)
+	}
+	return nil
+}
+
+// DeleteInProgress frees a key whose request didn't produce a response worth replaying
+func (r *IdempotencyRepository) DeleteInProgress(ctx context.Context, subject, key string) error {
+	_, err := r.DB.Exec(ctx, `DELETE FROM idempotency_keys WHERE subject = $1 AND idempotency_key = $2 AND status_code IS NULL`, subject, key)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package repositories
+
+import (
+	"context"
+	ledger "dgw-technical-test/internal/models/ledger"
+	"dgw-technical-test/internal/money"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrInsufficientFunds is returned when an entry would take a wallet below zero
+	ErrInsufficientFunds = errors.New("insufficient wallet balance")
+	// ErrDuplicateEntry is returned when an entry with the same type and reference was already posted
+	ErrDuplicateEntry = errors.New("ledger entry already posted")
+	// ErrUnbalancedEntry is returned when the debits of an entry don't equal its credits
+	ErrUnbalancedEntry = errors.New("ledger entry is unbalanced")
+)
+
+// LedgerRepository handles the double-entry wallet ledger; entries and lines are insert-only
+type LedgerRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewLedgerRepository(db *pgxpool.Pool) *LedgerRepository {
+	return &LedgerRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *LedgerRepository) WithTx(tx pgx.Tx) *LedgerRepository {
+	return &LedgerRepository{DB: tx}
+}
+
+// WalletAccountCode returns the code of a farmer's wallet account
+func WalletAccountCode(farmerID int) string {
+	return fmt.Sprintf("wallet:%d", farmerID)
+}
+
+// GetAccountIDByCode fetches the ID of a system account
+func (r *LedgerRepository) GetAccountIDByCode(ctx context.Context, code string) (int, error) {
+	var id int
+	err := r.DB.QueryRow(ctx, `SELECT id FROM ledger_accounts WHERE code = $1`, code).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ledger account %s: %w", code, err)
+	}
+	return id, nil
+}
+
+// GetOrCreateWalletAccountID returns the wallet account of a farmer, opening it on first use
+func (r *LedgerRepository) GetOrCreateWalletAccountID(ctx context.Context, farmerID int) (int, error) {
+	query := `
+		INSERT INTO ledger_accounts (code, name, type, farmer_id)
+		VALUES ($1, $2, 'liability', $3)
+		ON CONFLICT (code) DO UPDATE SET code = EXCLUDED.code
+		RETURNING id`
+	var id int
+	err := r.DB.QueryRow(ctx, query, WalletAccountCode(farmerID), fmt.Sprintf("Wallet of farmer %d", farmerID), farmerID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open wallet account of farmer %d: %w", farmerID, err)
+	}
+	return id, nil
+}
+
+// PostEntry records a balanced entry and applies its wallet lines to the cached farmers.wallet_balance.
+// A wallet account is a liability, so credits raise the balance and debits lower it.
+func (r *LedgerRepository) PostEntry(ctx context.Context, entry *ledger.Entry) (int, error) {
+	if err := validateEntry(entry); err != nil {
+		return 0, err
+	}
+
+	// runs in its own transaction, or a savepoint when the repository is already inside one
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var entryID int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO ledger_entries (entry_type, reference, description, admin_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (entry_type, reference) DO NOTHING
+		RETURNING id`,
+		entry.EntryType, entry.Reference, entry.Description, entry.AdminID,
+	).Scan(&entryID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %s %s", ErrDuplicateEntry, entry.EntryType, entry.Reference)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert ledger entry: %w", err)
+	}
+
+	for _, line := range entry.Lines {
+		_, err := tx.Exec(ctx, `INSERT INTO ledger_lines (entry_id, account_id, debit, credit) VALUES ($1, $2, $3, $4)`,
+			entryID, line.AccountID, line.Debit, line.Credit)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert ledger line: %w", err)
+		}
+	}
+
+	// refresh the cached balances of the wallets touched by the entry, refusing to go below zero
+	var wallets int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(DISTINCT a.farmer_id)
+		FROM ledger_lines l
+		JOIN ledger_accounts a ON a.id = l.account_id
+		WHERE l.entry_id = $1 AND a.farmer_id IS NOT NULL`, entryID).Scan(&wallets)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count wallet lines: %w", err)
+	}
+	if wallets > 0 {
+		tag, err := tx.Exec(ctx, `
+			UPDATE farmers f
+			SET wallet_balance = f.wallet_balance + d.delta, updated_at = NOW()
+			FROM (
+				SELECT a.farmer_id, SUM(l.credit - l.debit) AS delta
+				FROM ledger_lines l
+				JOIN ledger_accounts a ON a.id = l.account_id
+				WHERE l.entry_id = $1 AND a.farmer_id IS NOT NULL
+				GROUP BY a.farmer_id
+			) d
+			WHERE f.id = d.farmer_id AND f.wallet_balance + d.delta >= 0`, entryID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update wallet balance: %w", err)
+		}
+		if tag.RowsAffected() != int64(wallets) {
+			return 0, ErrInsufficientFunds
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit ledger entry: %w", err)
+	}
+	return entryID, nil
+}
+
+// GetWalletLedgerBalance derives a farmer's balance from the ledger lines of their wallet account
+func (r *LedgerRepository) GetWalletLedgerBalance(ctx context.Context, farmerID int) (money.Money, error) {
+	query := `
+		SELECT COALESCE(SUM(l.credit - l.debit), 0)
+		FROM ledger_lines l
+		JOIN ledger_accounts a ON a.id = l.account_id
+		WHERE a.farmer_id = $1`
+	var balance money.Money
+	if err := r.DB.QueryRow(ctx, query, farmerID).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("failed to get ledger balance of farmer %d: %w", farmerID, err)
+	}
+	return balance, nil
+}
+
+// GetBalanceMismatches lists farmers whose cached wallet_balance differs from the sum of their ledger lines
+func (r *LedgerRepository) GetBalanceMismatches(ctx context.Context) ([]ledger.BalanceMismatch, error) {
+	query := `
+		SELECT f.id, f.wallet_balance, COALESCE(b.balance, 0)
+		FROM farmers f
+		LEFT JOIN (
+			SELECT a.farmer_id, SUM(l.credit - l.debit) AS balance
+			FROM ledger_lines l
+			JOIN ledger_accounts a ON a.id = l.account_id
+			WHERE a.farmer_id IS NOT NULL
+			GROUP BY a.farmer_id
+		) b ON b.farmer_id = f.id
+		WHERE f.wallet_balance <> COALESCE(b.balance, 0)
+		ORDER BY f.id`
+	rows, err := r.DB.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile wallet balances: %w", err)
+	}
+	mismatches, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ledger.BalanceMismatch, error) {
+		var m ledger.BalanceMismatch
+		err := row.Scan(&m.FarmerID, &m.CachedBalance, &m.LedgerBalance)
+		return m, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan balance mismatches: %w", err)
+	}
+	return mismatches, nil
+}
+
+// GetUnbalancedEntries lists entries whose debits and credits differ
+func (r *LedgerRepository) GetUnbalancedEntries(ctx context.Context) ([]ledger.UnbalancedEntry, error) {
+	query := `
+		SELECT entry_id, SUM(debit), SUM(credit)
+		FROM ledger_lines
+		GROUP BY entry_id
+		HAVING SUM(debit) <> SUM(credit)
+		ORDER BY entry_id`
+	rows, err := r.DB.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check ledger entries: %w", err)
+	}
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (ledger.UnbalancedEntry, error) {
+		var e ledger.UnbalancedEntry
+		err := row.Scan(&e.EntryID, &e.Debit, &e.Credit)
+		return e, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan unbalanced entries: %w", err)
+	}
+	return entries, nil
+}
+
+// validateEntry checks an entry has positive one-sided lines whose debits equal its credits
+func validateEntry(entry *ledger.Entry) error {
+	if entry.Reference == "" || len(entry.Lines) < 2 {
+		return fmt.Errorf("%w: an entry needs a reference and at least two lines", ErrUnbalancedEntry)
+	}
+
+	var debits, credits money.Money
+	for _, line := range entry.Lines {
+		if line.Debit < 0 || line.Credit < 0 || (line.Debit == 0) == (line.Credit == 0) {
+			return fmt.Errorf("%w: each line must either debit or credit a positive amount", ErrUnbalancedEntry)
+		}
+		debits += line.Debit
+		credits += line.Credit
+	}
+	if debits != credits {
+		return fmt.Errorf("%w: debits %s != credits %s", ErrUnbalancedEntry, debits, credits)
+	}
+	return nil
+}
@@ -4,17 +4,24 @@ import (
     "context"
     "fmt"
 
+    unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+    "github.com/jackc/pgx/v5"
     "github.com/jackc/pgx/v5/pgxpool"
 )
 
 type LogRepository struct {
-    DB *pgxpool.Pool
+    DB unitofwork.DBTX
 }
 
 func NewLogRepository(db *pgxpool.Pool) *LogRepository {
     return &LogRepository{DB: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *LogRepository) WithTx(tx pgx.Tx) *LogRepository {
+    return &LogRepository{DB: tx}
+}
+
 // LogAction logs an administrative action in the database.
 func (r *LogRepository) LogAction(ctx context.Context, adminID int, action, details string) error {
     query := "INSERT INTO logs (admin_id, action, details) VALUES ($1, $2, $3)"
@@ -23,4 +30,14 @@ func (r *LogRepository) LogAction(ctx context.Context, adminID int, action, deta
         return fmt.Errorf("failed to log action: %w", err)
     }
     return nil
+}
+
+// LogSystemAction logs an action taken by the system itself (e.g. a background worker) rather than an admin.
+func (r *LogRepository) LogSystemAction(ctx context.Context, action, details string) error {
+    query := "INSERT INTO logs (admin_id, actor, action, details) VALUES (NULL, 'system', $1, $2)"
+    _, err := r.DB.Exec(ctx, query, action, details)
+    if err != nil {
+        return fmt.Errorf("failed to log system action: %w", err)
+    }
+    return nil
 }
\ No newline at end of file
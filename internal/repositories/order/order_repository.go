@@ -2,24 +2,45 @@ package repositories
 
 import (
 	"context"
+	domain "dgw-technical-test/internal/domain/order"
 	"dgw-technical-test/internal/models/order"
+	"dgw-technical-test/internal/money"
+	pagination "dgw-technical-test/internal/repositories/pagination"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type OrderRepository struct {
-	DB *pgxpool.Pool
+	DB unitofwork.DBTX
 }
 
 func NewOrderRepository(db *pgxpool.Pool) *OrderRepository {
 	return &OrderRepository{DB: db}
 }
 
-// CreateOrder creates a new order in the database
-func (r *OrderRepository) CreateOrder(ctx context.Context, farmerID int, totalPrice float64) (int, error) {
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *OrderRepository) WithTx(tx pgx.Tx) *OrderRepository {
+	return &OrderRepository{DB: tx}
+}
+
+// CreateOrder creates a new pending order in the database that has to be paid before paymentDueAt,
+// recording the actor who created it as the first entry of its status history
+func (r *OrderRepository) CreateOrder(ctx context.Context, farmerID int, totalPrice money.Money, paymentDueAt time.Time, actor domain.Actor) (int, error) {
+	query := `
+		WITH o AS (
+			INSERT INTO orders (farmer_id, status, total_price, payment_due_at) VALUES ($1, $2, $3, $4) RETURNING id
+		)
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor_type, actor_id, reason)
+		SELECT o.id, NULL, $2, $5, NULLIF($6, 0), 'order created' FROM o
+		RETURNING order_id`
 	var orderID int
-	err := r.DB.QueryRow(ctx, "INSERT INTO orders (farmer_id, status, total_price) VALUES ($1, 'pending', $2) RETURNING id", farmerID, totalPrice).Scan(&orderID)
+	err := r.DB.QueryRow(ctx, query, farmerID, domain.StatusPending, totalPrice, paymentDueAt, actor.Type, actor.ID).Scan(&orderID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create order: %w", err)
 	}
@@ -35,11 +56,11 @@ func (r *OrderRepository) AddOrderItem(ctx context.Context, orderID int, item mo
 	return nil
 }
 
-// GetOrderById retrieves an order by its ID
+// GetOrderById retrieves an order by its ID as long as it can still be paid
 func (r *OrderRepository) GetOrderById(ctx context.Context, orderID int) (*models.Order, error) {
 	var o models.Order
-	query := `SELECT id, farmer_id, status, total_price, created_at, updated_at FROM orders WHERE id = $1 AND status = 'pending'`
-	err := r.DB.QueryRow(ctx, query, orderID).Scan(&o.ID, &o.FarmerID, &o.Status, &o.TotalPrice, &o.CreatedAt, &o.UpdatedAt)
+	query := `SELECT id, farmer_id, status, total_price, payment_due_at, created_at, updated_at FROM orders WHERE id = $1 AND status IN ('pending', 'awaiting_payment')`
+	err := r.DB.QueryRow(ctx, query, orderID).Scan(&o.ID, &o.FarmerID, &o.Status, &o.TotalPrice, &o.PaymentDueAt, &o.CreatedAt, &o.UpdatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get order by id: %w", err)
 	}
@@ -66,74 +87,291 @@ func (r *OrderRepository) GetOrderById(ctx context.Context, orderID int) (*model
 	return &o, nil
 }
 
-// CheckOrderProcessed checks if an order has been processed
-func (r *OrderRepository) CheckOrderProcessed(ctx context.Context, orderID int) (bool, error) {
-	var isProcessed bool
-	err := r.DB.QueryRow(ctx, "SELECT is_processed FROM orders WHERE id = $1", orderID).Scan(&isProcessed)
+// ListOrders returns a page of orders with their items, newest first. Pages are keyed on (created_at, id)
+// so orders placed while paging don't shift or repeat results.
+func (r *OrderRepository) ListOrders(ctx context.Context, filter models.OrderFilter) (*models.OrderPage, error) {
+	conditions := []string{"TRUE"}
+	var args []any
+	add := func(condition string, values ...any) {
+		for _, v := range values {
+			args = append(args, v)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if filter.FarmerID != 0 {
+		add("farmer_id = ?", filter.FarmerID)
+	}
+	if filter.Status != "" {
+		add("status = ?", filter.Status)
+	}
+	if filter.PaymentMethod != "" {
+		add("payment_method = ?", filter.PaymentMethod)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < ?", filter.To)
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := pagination.DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		add("(created_at, id) < (?, ?)", createdAt, id)
+	}
+
+	// one extra row tells whether another page follows
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`
+		SELECT id, farmer_id, status, total_price, payment_method, payment_due_at, created_at, updated_at
+		FROM orders
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list orders: %w", err)
+	}
+	orders, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Order, error) {
+		var o models.Order
+		err := row.Scan(&o.ID, &o.FarmerID, &o.Status, &o.TotalPrice, &o.PaymentMethod, &o.PaymentDueAt, &o.CreatedAt, &o.UpdatedAt)
+		return o, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan order: %w", err)
+	}
+
+	page := &models.OrderPage{Orders: orders}
+	if len(orders) > filter.Limit {
+		page.Orders = orders[:filter.Limit]
+		last := page.Orders[filter.Limit-1]
+		page.NextCursor = pagination.EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	// embed the items of the whole page with a single query
+	orderIDs := make([]int, len(page.Orders))
+	for i, o := range page.Orders {
+		orderIDs[i] = o.ID
+	}
+	items, err := r.getItemsWithProductNames(ctx, orderIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range page.Orders {
+		page.Orders[i].Items = items[page.Orders[i].ID]
+	}
+	return page, nil
+}
+
+// GetOrderDetail retrieves an order in any status with its items, their product names and its status history
+func (r *OrderRepository) GetOrderDetail(ctx context.Context, orderID int) (*models.Order, error) {
+	var o models.Order
+	query := `SELECT id, farmer_id, status, total_price, payment_method, payment_due_at, created_at, updated_at FROM orders WHERE id = $1`
+	err := r.DB.QueryRow(ctx, query, orderID).Scan(&o.ID, &o.FarmerID, &o.Status, &o.TotalPrice, &o.PaymentMethod, &o.PaymentDueAt, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	items, err := r.getItemsWithProductNames(ctx, []int{orderID})
+	if err != nil {
+		return nil, err
+	}
+	o.Items = items[orderID]
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT from_status, to_status, actor_type, actor_id, reason, created_at
+		FROM order_status_history
+		WHERE order_id = $1
+		ORDER BY created_at, id`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order status history: %w", err)
+	}
+	o.History, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.StatusChange, error) {
+		var c models.StatusChange
+		err := row.Scan(&c.FromStatus, &c.ToStatus, &c.ActorType, &c.ActorID, &c.Reason, &c.CreatedAt)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan order status history: %w", err)
+	}
+
+	return &o, nil
+}
+
+// getItemsWithProductNames fetches the items of the given orders with the name of each product, grouped by order ID
+func (r *OrderRepository) getItemsWithProductNames(ctx context.Context, orderIDs []int) (map[int][]models.OrderItem, error) {
+	if len(orderIDs) == 0 {
+		return nil, nil
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT oi.id, oi.order_id, oi.product_id, COALESCE(p.name, ''), oi.quantity, oi.price, oi.created_at, oi.updated_at
+		FROM order_items oi
+		LEFT JOIN products p ON p.id = oi.product_id
+		WHERE oi.order_id = ANY($1)
+		ORDER BY oi.order_id, oi.id`, orderIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order items: %w", err)
+	}
+	items, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.OrderItem, error) {
+		var item models.OrderItem
+		err := row.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.ProductName, &item.Quantity, &item.Price, &item.CreatedAt, &item.UpdatedAt)
+		return item, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan order item: %w", err)
+	}
+
+	byOrder := make(map[int][]models.OrderItem, len(orderIDs))
+	for _, item := range items {
+		byOrder[item.OrderID] = append(byOrder[item.OrderID], item)
+	}
+	return byOrder, nil
+}
+
+// GetOrderOwner retrieves the ID of the farmer an order was placed for
+func (r *OrderRepository) GetOrderOwner(ctx context.Context, orderID int) (int, error) {
+	var farmerID int
+	if err := r.DB.QueryRow(ctx, "SELECT farmer_id FROM orders WHERE id = $1", orderID).Scan(&farmerID); err != nil {
+		return 0, fmt.Errorf("failed to get order owner: %w", err)
+	}
+	return farmerID, nil
+}
+
+// GetOrderStatus retrieves the current status of an order
+func (r *OrderRepository) GetOrderStatus(ctx context.Context, orderID int) (domain.Status, error) {
+	var status domain.Status
+	err := r.DB.QueryRow(ctx, "SELECT status FROM orders WHERE id = $1", orderID).Scan(&status)
+	if err != nil {
+		return "", fmt.Errorf("failed to get order status: %w", err)
+	}
+	return status, nil
+}
+
+// GetOrderForUpdate retrieves an order in any status, without its items, and locks its row until the
+// surrounding transaction ends
+func (r *OrderRepository) GetOrderForUpdate(ctx context.Context, orderID int) (*models.Order, error) {
+	var o models.Order
+	query := `SELECT id, farmer_id, status, total_price, payment_method, payment_due_at, created_at, updated_at FROM orders WHERE id = $1 FOR UPDATE`
+	err := r.DB.QueryRow(ctx, query, orderID).Scan(&o.ID, &o.FarmerID, &o.Status, &o.TotalPrice, &o.PaymentMethod, &o.PaymentDueAt, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock order: %w", err)
+	}
+	return &o, nil
+}
+
+// ClaimOverdueOrders returns up to limit unpaid orders whose payment was due before dueBefore and pushes their
+// next expiry check to checkAgainAt, so another scan doesn't pick them before then. Orders checked before come
+// after the ones never checked, and rows locked by another transaction are skipped.
+func (r *OrderRepository) ClaimOverdueOrders(ctx context.Context, dueBefore, now, checkAgainAt time.Time, limit int) ([]int, error) {
+	query := `
+		UPDATE orders SET next_expiry_check_at = $3
+		WHERE id IN (
+			SELECT id FROM orders
+			WHERE status IN ('pending', 'awaiting_payment') AND payment_due_at <= $1
+			  AND (next_expiry_check_at IS NULL OR next_expiry_check_at <= $2)
+			ORDER BY COALESCE(next_expiry_check_at, payment_due_at)
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`
+	rows, err := r.DB.Query(ctx, query, dueBefore, now, checkAgainAt, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim overdue orders: %w", err)
+	}
+
+	orderIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
 	if err != nil {
-		return false, fmt.Errorf("failed to check order processing status: %w", err)
+		return nil, fmt.Errorf("failed to scan overdue order: %w", err)
 	}
-	return isProcessed, nil
+	return orderIDs, nil
 }
 
-// UpdateOrderStatus updates the status of an order
-func (r *OrderRepository) UpdateOrderStatus(ctx context.Context, orderID int, status string) error {
-	_, err := r.DB.Exec(ctx, "UPDATE orders SET status = $1 WHERE id = $2", status, orderID)
+// TransitionOrder moves an order to the status to and records the change with its actor and reason in
+// order_status_history. A move the transition table doesn't allow is refused with a *domain.TransitionError.
+func (r *OrderRepository) TransitionOrder(ctx context.Context, orderID int, to domain.Status, actor domain.Actor, reason string) error {
+	tx, err := r.DB.Begin(ctx)
 	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var from domain.Status
+	if err := tx.QueryRow(ctx, "SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&from); err != nil {
+		return fmt.Errorf("failed to lock order: %w", err)
+	}
+	if err := domain.ValidateTransition(orderID, from, to); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2", to, orderID); err != nil {
 		return fmt.Errorf("failed to update order status: %w", err)
 	}
+
+	query := `
+		INSERT INTO order_status_history (order_id, from_status, to_status, actor_type, actor_id, reason)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6)`
+	if _, err := tx.Exec(ctx, query, orderID, from, to, actor.Type, actor.ID, reason); err != nil {
+		return fmt.Errorf("failed to record order status history: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SetPaymentMethod records how an order was paid (wallet, online, split or credit)
+func (r *OrderRepository) SetPaymentMethod(ctx context.Context, orderID int, paymentMethod string) error {
+	_, err := r.DB.Exec(ctx, "UPDATE orders SET payment_method = $1 WHERE id = $2", paymentMethod, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to set payment method: %w", err)
+	}
 	return nil
 }
 
-// MarkOrderAsProcessed marks the order as processed
-func (r *OrderRepository) MarkOrderAsProcessed(ctx context.Context, orderID int) error {
-	_, err := r.DB.Exec(ctx, "UPDATE orders SET is_processed = TRUE WHERE id = $1", orderID)
+// UpdateStoreQuantity decrements the stock of every product in an order that wasn't already taken from a
+// consumed reservation (reserved holds the consumed quantity per product). It should run inside a unit of
+// work together with the order status change, so a product without enough stock rolls everything back.
+func (r *OrderRepository) UpdateStoreQuantity(ctx context.Context, orderID int, reserved map[int]int) error {
+	// First, fetch the order items (the rows must be closed before running other statements on a transaction)
+	rows, err := r.DB.Query(ctx, "SELECT product_id, quantity FROM order_items WHERE order_id = $1", orderID)
 	if err != nil {
-		return fmt.Errorf("failed to mark order as processed: %w", err)
+		return fmt.Errorf("failed to fetch order items: %w", err)
 	}
 
-	_, err = r.DB.Exec(ctx, "UPDATE orders SET payment_method = 'online' WHERE id = $1", orderID)
+	items, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.OrderItem, error) {
+		var item models.OrderItem
+		err := row.Scan(&item.ProductID, &item.Quantity)
+		return item, err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to mark order as processed: %w", err)
+		return fmt.Errorf("failed to scan order item: %w", err)
+	}
+
+	// Decrement the unreserved remainder of each product only when enough unreserved stock is left
+	for _, item := range items {
+		fromReservation := min(item.Quantity, reserved[item.ProductID])
+		if fromReservation > 0 {
+			reserved[item.ProductID] -= fromReservation
+		}
+
+		remaining := item.Quantity - fromReservation
+		if remaining == 0 {
+			continue
+		}
+
+		query := `UPDATE products p SET stock_quantity = p.stock_quantity - $1, updated_at = NOW() WHERE p.id = $2 AND p.stock_quantity - ` + reservation_repo.ReservedQuantitySQL + ` >= $1`
+		tag, err := r.DB.Exec(ctx, query, remaining, item.ProductID)
+		if err != nil {
+			return fmt.Errorf("failed to update product stock: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("insufficient stock for product ID %d", item.ProductID)
+		}
 	}
 
 	return nil
 }
-
-// UpdateStoreQuantity updates the stock quantities for products based on an order without using transactions.
-func (r *OrderRepository) UpdateStoreQuantity(ctx context.Context, orderID int) error {
-    // First, fetch the order items.
-    rows, err := r.DB.Query(ctx, "SELECT product_id, quantity FROM order_items WHERE order_id = $1", orderID)
-    if err != nil {
-        return fmt.Errorf("failed to fetch order items: %w", err)
-    }
-    defer rows.Close()
-
-    // Iterate through each order item and update stock quantities directly.
-    for rows.Next() {
-        var productID, quantity int
-        if err := rows.Scan(&productID, &quantity); err != nil {
-            return fmt.Errorf("failed to scan order item: %w", err)
-        }
-
-        // Check current stock quantity to ensure there's enough stock.
-        var stockQuantity int
-        err = r.DB.QueryRow(ctx, "SELECT stock_quantity FROM products WHERE id = $1", productID).Scan(&stockQuantity)
-        if err != nil {
-            return fmt.Errorf("failed to fetch product stock quantity: %w", err)
-        }
-
-        if stockQuantity < quantity {
-            // Optionally handle the situation, e.g., log or adjust business logic to prevent this path.
-            return fmt.Errorf("insufficient stock for product ID %d", productID)
-        }
-
-        // Update the product stock quantity directly.
-        _, err = r.DB.Exec(ctx, "UPDATE products SET stock_quantity = stock_quantity - $1 WHERE id = $2", quantity, productID)
-        if err != nil {
-            return fmt.Errorf("failed to update product stock: %w", err)
-        }
-    }
-
-    return nil
-}
\ No newline at end of file
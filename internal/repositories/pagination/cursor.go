@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor wasn't issued by EncodeCursor
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// EncodeCursor makes the opaque cursor pointing after the row with the given (created_at, id) key
+func EncodeCursor(createdAt time.Time, id int) string {
+	raw := createdAt.Format(time.RFC3339Nano) + "|" + strconv.Itoa(id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor reads a cursor made by EncodeCursor
+func DecodeCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	createdAtPart, idPart, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtPart)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(idPart)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return createdAt, id, nil
+}
+
+// EncodeKeyCursor makes the opaque cursor pointing after the row with the given (key, id) position,
+// for listings sorted on something other than created_at; key is the sort value as text
+func EncodeKeyCursor(key string, id int) string {
+	raw := key + "|" + strconv.Itoa(id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeKeyCursor reads a cursor made by EncodeKeyCursor
+func DecodeKeyCursor(cursor string) (string, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+	// the key may contain the separator itself, the id never does
+	sep := strings.LastIndex(string(raw), "|")
+	if sep < 0 {
+		return "", 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(string(raw[sep+1:]))
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+	return string(raw[:sep]), id, nil
+}
@@ -0,0 +1,129 @@
+package repositories
+
+import (
+	"context"
+	"dgw-technical-test/internal/models/payment"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PaymentRepository stores the charge attempts made at the payment gateway
+type PaymentRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewPaymentRepository(db *pgxpool.Pool) *PaymentRepository {
+	return &PaymentRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *PaymentRepository) WithTx(tx pgx.Tx) *PaymentRepository {
+	return &PaymentRepository{DB: tx}
+}
+
+// paymentColumns lists the columns scanned by scanPayment
+const paymentColumns = `id, order_id, gateway_order_id, COALESCE(transaction_id, ''), COALESCE(channel, ''), COALESCE(payment_type, ''), COALESCE(bank, ''), COALESCE(va_number, ''), amount, status, raw_response, applied_at, created_at, updated_at`
+
+// CreatePayment records a new charge attempt for an order
+func (r *PaymentRepository) CreatePayment(ctx context.Context, p *models.Payment) (int, error) {
+	query := `
+		INSERT INTO payments (order_id, gateway_order_id, transaction_id, channel, payment_type, bank, va_number, amount, status, raw_response)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id
+	`
+	var paymentID int
+	err := r.DB.QueryRow(ctx, query, p.OrderID, p.GatewayOrderID, p.TransactionID, p.Channel, p.PaymentType, p.Bank, p.VANumber, p.Amount, p.Status, p.RawResponse).Scan(&paymentID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create payment: %w", err)
+	}
+	return paymentID, nil
+}
+
+// GetLatestPaymentByOrderID retrieves the most recent charge attempt of an order
+func (r *PaymentRepository) GetLatestPaymentByOrderID(ctx context.Context, orderID int) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE order_id = $1 ORDER BY created_at DESC, id DESC LIMIT 1`
+	p, err := scanPayment(r.DB.QueryRow(ctx, query, orderID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest payment: %w", err)
+	}
+	return p, nil
+}
+
+// GetPendingPaymentByOrderID retrieves the most recent charge attempt of an order the gateway hasn't resolved yet
+func (r *PaymentRepository) GetPendingPaymentByOrderID(ctx context.Context, orderID int) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE order_id = $1 AND status = 'pending' ORDER BY created_at DESC, id DESC LIMIT 1`
+	p, err := scanPayment(r.DB.QueryRow(ctx, query, orderID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending payment: %w", err)
+	}
+	return p, nil
+}
+
+// GetAppliedPaymentByOrderID retrieves the charge attempt that paid an order
+func (r *PaymentRepository) GetAppliedPaymentByOrderID(ctx context.Context, orderID int) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE order_id = $1 AND applied_at IS NOT NULL`
+	p, err := scanPayment(r.DB.QueryRow(ctx, query, orderID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied payment: %w", err)
+	}
+	return p, nil
+}
+
+// MarkPaymentApplied records that a settled charge attempt paid its order; run it in the unit of work that pays the order
+func (r *PaymentRepository) MarkPaymentApplied(ctx context.Context, paymentID int) error {
+	_, err := r.DB.Exec(ctx, `UPDATE payments SET applied_at = NOW(), updated_at = NOW() WHERE id = $1`, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to mark payment applied: %w", err)
+	}
+	return nil
+}
+
+// GetPaymentByGatewayOrderID retrieves a charge attempt by the order ID sent to the gateway
+func (r *PaymentRepository) GetPaymentByGatewayOrderID(ctx context.Context, gatewayOrderID string) (*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE gateway_order_id = $1`
+	p, err := scanPayment(r.DB.QueryRow(ctx, query, gatewayOrderID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	return p, nil
+}
+
+// RecordCharge stores what the gateway answered when a charge attempt recorded beforehand was created.
+// A status a notification already stored is kept.
+func (r *PaymentRepository) RecordCharge(ctx context.Context, p *models.Payment) error {
+	query := `
+		UPDATE payments
+		SET transaction_id = $2, payment_type = $3, bank = $4, va_number = $5,
+			status = CASE WHEN status = 'pending' THEN $6 ELSE status END,
+			raw_response = CASE WHEN status = 'pending' THEN $7 ELSE raw_response END,
+			updated_at = NOW()
+		WHERE id = $1`
+	_, err := r.DB.Exec(ctx, query, p.ID, p.TransactionID, p.PaymentType, p.Bank, p.VANumber, p.Status, p.RawResponse)
+	if err != nil {
+		return fmt.Errorf("failed to record charge: %w", err)
+	}
+	return nil
+}
+
+// UpdatePaymentStatus stores the latest gateway status and raw response of a charge attempt
+func (r *PaymentRepository) UpdatePaymentStatus(ctx context.Context, paymentID int, status string, rawResponse []byte) error {
+	query := `UPDATE payments SET status = $1, raw_response = COALESCE($2, raw_response), updated_at = NOW() WHERE id = $3`
+	_, err := r.DB.Exec(ctx, query, status, rawResponse, paymentID)
+	if err != nil {
+		return fmt.Errorf("failed to update payment status: %w", err)
+	}
+	return nil
+}
+
+// scanPayment scans a row selected with paymentColumns
+func scanPayment(row interface{ Scan(dest ...any) error }) (*models.Payment, error) {
+	var p models.Payment
+	err := row.Scan(&p.ID, &p.OrderID, &p.GatewayOrderID, &p.TransactionID, &p.Channel, &p.PaymentType, &p.Bank, &p.VANumber, &p.Amount, &p.Status, &p.RawResponse, &p.AppliedAt, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	payout "dgw-technical-test/internal/models/payout"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PayoutRepository stores payouts of wallet money to farmers' bank accounts
+type PayoutRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewPayoutRepository(db *pgxpool.Pool) *PayoutRepository {
+	return &PayoutRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *PayoutRepository) WithTx(tx pgx.Tx) *PayoutRepository {
+	return &PayoutRepository{DB: tx}
+}
+
+const payoutColumns = `id, farmer_id, reference, amount, bank_code, account_number, account_name, status, provider_reference, failure_reason, created_at, updated_at`
+
+func scanPayout(row pgx.Row) (*payout.Payout, error) {
+	var p payout.Payout
+	err := row.Scan(&p.ID, &p.FarmerID, &p.Reference, &p.Amount, &p.BankCode, &p.AccountNumber, &p.AccountName,
+		&p.Status, &p.ProviderReference, &p.FailureReason, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreatePayout inserts a pending payout and returns it
+func (r *PayoutRepository) CreatePayout(ctx context.Context, farmerID int, reference string, req payout.PayoutRequest) (*payout.Payout, error) {
+	query := `
+		INSERT INTO payouts (farmer_id, reference, amount, bank_code, account_number, account_name)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + payoutColumns
+	p, err := scanPayout(r.DB.QueryRow(ctx, query, farmerID, reference, req.Amount, req.BankCode, req.AccountNumber, req.AccountName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payout: %w", err)
+	}
+	return p, nil
+}
+
+// GetPayoutByID fetches a payout
+func (r *PayoutRepository) GetPayoutByID(ctx context.Context, payoutID int) (*payout.Payout, error) {
+	p, err := scanPayout(r.DB.QueryRow(ctx, `SELECT `+payoutColumns+` FROM payouts WHERE id = $1`, payoutID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payout: %w", err)
+	}
+	return p, nil
+}
+
+// ClaimPendingPayouts returns up to limit payouts still pending since before createdBefore and pushes their
+// next submission to submitAgainAt, so another scan doesn't pick them before then. Payouts submitted before
+// come after the ones never resubmitted, and rows locked by another transaction are skipped.
+func (r *PayoutRepository) ClaimPendingPayouts(ctx context.Context, createdBefore, now, submitAgainAt time.Time, limit int) ([]int, error) {
+	query := `
+		UPDATE payouts SET next_submit_at = $3
+		WHERE id IN (
+			SELECT id FROM payouts
+			WHERE status = 'pending' AND created_at <= $1
+			  AND (next_submit_at IS NULL OR next_submit_at <= $2)
+			ORDER BY COALESCE(next_submit_at, created_at)
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`
+	rows, err := r.DB.Query(ctx, query, createdBefore, now, submitAgainAt, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending payouts: %w", err)
+	}
+
+	payoutIDs, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan pending payout: %w", err)
+	}
+	return payoutIDs, nil
+}
+
+// MarkPayoutProcessing records that the provider accepted a pending payout
+func (r *PayoutRepository) MarkPayoutProcessing(ctx context.Context, payoutID int, providerReference string) error {
+	_, err := r.DB.Exec(ctx, `
+		UPDATE payouts SET status = 'processing', provider_reference = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'`, payoutID, providerReference)
+	if err != nil {
+		return fmt.Errorf("failed to mark payout as processing: %w", err)
+	}
+	return nil
+}
+
+// ResolvePayout moves an unresolved payout to completed or failed. It reports false when another
+// caller resolved it first, so the ledger entry for the outcome is only posted once.
+func (r *PayoutRepository) ResolvePayout(ctx context.Context, payoutID int, status, providerReference, failureReason string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE payouts
+		SET status = $2, provider_reference = COALESCE(NULLIF($3, ''), provider_reference), failure_reason = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $1 AND status IN ('pending', 'processing')`, payoutID, status, providerReference, failureReason)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve payout: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
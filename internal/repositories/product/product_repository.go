@@ -3,47 +3,208 @@ package repositories
 import (
 	"context"
 	"dgw-technical-test/internal/models/product"
+	"dgw-technical-test/internal/money"
+	pagination "dgw-technical-test/internal/repositories/pagination"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type ProductRepository struct {
-	DB *pgxpool.Pool
+	DB unitofwork.DBTX
 }
 
 func NewProductRepository(db *pgxpool.Pool) *ProductRepository {
 	return &ProductRepository{DB: db}
 }
 
-// GetAllProducts retrieves all products from the database that are available on the online store
-func (r *ProductRepository) GetAllProductsRepo() ([]models.Product, error) {
-	query := `SELECT id, supplier_id, name, description, price, stock_quantity, category, brand, created_at, updated_at FROM products`
-	rows, err := r.DB.Query(context.Background(), query)
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *ProductRepository) WithTx(tx pgx.Tx) *ProductRepository {
+	return &ProductRepository{DB: tx}
+}
+
+// SearchProducts returns a page of the catalog matching the filter together with the number of matches.
+// Pages are keyed on the sort value and id, so products added or repriced while paging don't shift or repeat results.
+func (r *ProductRepository) SearchProducts(ctx context.Context, filter models.ProductFilter) (*models.ProductPage, error) {
+	conditions := []string{"TRUE"}
+	var args []any
+	add := func(condition string, values ...any) {
+		for _, v := range values {
+			args = append(args, v)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	// the query is matched in both languages since the catalog mixes Indonesian and English names
+	rank := "0::real"
+	if filter.Query != "" {
+		args = append(args, filter.Query)
+		tsQuery := fmt.Sprintf("(websearch_to_tsquery('indonesian', $%[1]d) || websearch_to_tsquery('english', $%[1]d))", len(args))
+		conditions = append(conditions, "p.search_vector @@ "+tsQuery)
+		rank = fmt.Sprintf("ts_rank(p.search_vector, %s)", tsQuery)
+	}
+	if filter.Category != "" {
+		add("p.category = ?", filter.Category)
+	}
+	if filter.Brand != "" {
+		add("p.brand = ?", filter.Brand)
+	}
+	if filter.SupplierID != 0 {
+		add("p.supplier_id = ?", filter.SupplierID)
+	}
+	if filter.MinPrice.IsPositive() {
+		add("p.price >= ?", filter.MinPrice)
+	}
+	if filter.MaxPrice.IsPositive() {
+		add("p.price <= ?", filter.MaxPrice)
+	}
+	if filter.InStock {
+		add("p.stock_quantity - " + reservation_repo.ReservedQuantitySQL + " > 0")
+	}
+
+	// the total leaves out the cursor so every page reports the same count
+	var total int
+	countQuery := "SELECT COUNT(*) FROM products p WHERE " + strings.Join(conditions, " AND ")
+	if err := r.DB.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count products: %w", err)
+	}
+
+	key, desc := productSortKey(filter.Sort, rank)
+	direction, after := "ASC", ">"
+	if desc {
+		direction, after = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		value, id, err := decodeProductCursor(filter.Sort, filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		add(fmt.Sprintf("(%s, p.id) %s (?, ?)", key, after), value, id)
+	}
+
+	// one extra row tells whether another page follows
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`
+		SELECT p.id, p.supplier_id, p.name, p.description, p.price, p.stock_quantity, %s, p.category, p.brand, p.created_at, p.updated_at, %s
+		FROM products p
+		WHERE %s
+		ORDER BY %s %s, p.id %s
+		LIMIT $%d`, reservation_repo.ReservedQuantitySQL, rank, strings.Join(conditions, " AND "), key, direction, direction, len(args))
+
+	rows, err := r.DB.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve products: %w", err)
+		return nil, fmt.Errorf("failed to search products: %w", err)
 	}
 	defer rows.Close()
 
-	var products []models.Product
+	products := []models.Product{}
+	var ranks []float32
 	for rows.Next() {
 		var p models.Product
-		if err := rows.Scan(&p.ID, &p.SupplierID, &p.Name, &p.Description, &p.Price, &p.StockQuantity, &p.Category, &p.Brand, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		var rank float32
+		if err := rows.Scan(&p.ID, &p.SupplierID, &p.Name, &p.Description, &p.Price, &p.StockQuantity, &p.ReservedQuantity, &p.Category, &p.Brand, &p.CreatedAt, &p.UpdatedAt, &rank); err != nil {
 			return nil, fmt.Errorf("failed to scan product: %w", err)
 		}
+		p.AvailableQuantity = p.StockQuantity - p.ReservedQuantity
 		products = append(products, p)
+		ranks = append(ranks, rank)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search products: %w", err)
 	}
 
-	return products, nil
+	page := &models.ProductPage{Products: products, Total: total}
+	if len(products) > filter.Limit {
+		page.Products = products[:filter.Limit]
+		last := filter.Limit - 1
+		page.NextCursor = encodeProductCursor(filter.Sort, page.Products[last], ranks[last])
+	}
+	return page, nil
+}
+
+// productSortKey returns the ORDER BY key of a catalog sort and whether it runs descending; ties are broken on id in the same direction
+func productSortKey(sort, rank string) (string, bool) {
+	switch sort {
+	case models.SortPriceAsc:
+		return "p.price", false
+	case models.SortPriceDesc:
+		return "p.price", true
+	case models.SortName:
+		return "p.name", false
+	case models.SortRelevance:
+		return rank, true
+	default:
+		return "p.created_at", true
+	}
+}
+
+// encodeProductCursor points after p; the sort is part of the key so a cursor can't be reused under another sort
+func encodeProductCursor(sort string, p models.Product, rank float32) string {
+	var value string
+	switch sort {
+	case models.SortPriceAsc, models.SortPriceDesc:
+		value = strconv.FormatInt(p.Price.Sen(), 10)
+	case models.SortName:
+		value = p.Name
+	case models.SortRelevance:
+		value = strconv.FormatFloat(float64(rank), 'g', -1, 32)
+	default:
+		value = p.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return pagination.EncodeKeyCursor(sort+":"+value, p.ID)
+}
+
+// decodeProductCursor reads a cursor made by encodeProductCursor under the same sort into the typed sort value and id
+func decodeProductCursor(sort, cursor string) (any, int, error) {
+	key, id, err := pagination.DecodeKeyCursor(cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursorSort, value, ok := strings.Cut(key, ":")
+	if !ok || cursorSort != sort {
+		return nil, 0, pagination.ErrInvalidCursor
+	}
+
+	switch sort {
+	case models.SortPriceAsc, models.SortPriceDesc:
+		sen, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, 0, pagination.ErrInvalidCursor
+		}
+		return money.FromSen(sen), id, nil
+	case models.SortName:
+		return value, id, nil
+	case models.SortRelevance:
+		rank, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, 0, pagination.ErrInvalidCursor
+		}
+		return float32(rank), id, nil
+	default:
+		createdAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, 0, pagination.ErrInvalidCursor
+		}
+		return createdAt, id, nil
+	}
 }
 
 // get product by id
 func (r *ProductRepository) GetProductByID(ctx context.Context, productID int) (*models.Product, error) {
 	var p models.Product
-	err := r.DB.QueryRow(ctx, "SELECT id, name, price, stock_quantity FROM products WHERE id = $1", productID).Scan(&p.ID, &p.Name, &p.Price, &p.StockQuantity)
+	query := `SELECT p.id, p.name, p.price, p.stock_quantity, ` + reservation_repo.ReservedQuantitySQL + ` FROM products p WHERE p.id = $1`
+	err := r.DB.QueryRow(ctx, query, productID).Scan(&p.ID, &p.Name, &p.Price, &p.StockQuantity, &p.ReservedQuantity)
     if err != nil {
         return nil, err
     }
+	p.AvailableQuantity = p.StockQuantity - p.ReservedQuantity
     return &p, nil
 }
 
@@ -51,4 +212,13 @@ func (r *ProductRepository) GetProductByID(ctx context.Context, productID int) (
 func (r *ProductRepository) UpdateProductStock(ctx context.Context, productID, quantity int) error {
 	_, err := r.DB.Exec(ctx, "UPDATE products SET stock_quantity = stock_quantity - $1 WHERE id = $2", quantity, productID)
     return err
-}
\ No newline at end of file
+}
+
+// RestockProduct returns quantity units of a product to the catalog, e.g. for refunded order items
+func (r *ProductRepository) RestockProduct(ctx context.Context, productID, quantity int) error {
+	_, err := r.DB.Exec(ctx, "UPDATE products SET stock_quantity = stock_quantity + $1, updated_at = NOW() WHERE id = $2", quantity, productID)
+	if err != nil {
+		return fmt.Errorf("failed to restock product: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"context"
+	refund "dgw-technical-test/internal/models/refund"
+	"dgw-technical-test/internal/money"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RefundRepository stores refunds of paid orders and the order items they return
+type RefundRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewRefundRepository(db *pgxpool.Pool) *RefundRepository {
+	return &RefundRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *RefundRepository) WithTx(tx pgx.Tx) *RefundRepository {
+	return &RefundRepository{DB: tx}
+}
+
+const refundColumns = `id, order_id, farmer_id, reference, method, amount, gateway_order_id, gateway_amount, status, reason, admin_id, provider_reference, failure_reason, created_at, updated_at`
+
+func scanRefund(row pgx.Row) (*refund.Refund, error) {
+	var rf refund.Refund
+	err := row.Scan(&rf.ID, &rf.OrderID, &rf.FarmerID, &rf.Reference, &rf.Method, &rf.Amount, &rf.GatewayOrderID, &rf.GatewayAmount,
+		&rf.Status, &rf.Reason, &rf.AdminID, &rf.ProviderReference, &rf.FailureReason, &rf.CreatedAt, &rf.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rf, nil
+}
+
+// CreateRefund inserts a refund without its items and returns it
+func (r *RefundRepository) CreateRefund(ctx context.Context, rf *refund.Refund) (*refund.Refund, error) {
+	query := `
+		INSERT INTO refunds (order_id, farmer_id, reference, method, amount, gateway_order_id, gateway_amount, status, reason, admin_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING ` + refundColumns
+	created, err := scanRefund(r.DB.QueryRow(ctx, query, rf.OrderID, rf.FarmerID, rf.Reference, rf.Method, rf.Amount,
+		rf.GatewayOrderID, rf.GatewayAmount, rf.Status, rf.Reason, rf.AdminID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund: %w", err)
+	}
+	return created, nil
+}
+
+// AddRefundItem records the quantity of an order item returned by a refund
+func (r *RefundRepository) AddRefundItem(ctx context.Context, refundID int, item refund.RefundItem) error {
+	query := `INSERT INTO refund_items (refund_id, order_item_id, quantity, amount) VALUES ($1, $2, $3, $4)`
+	_, err := r.DB.Exec(ctx, query, refundID, item.OrderItemID, item.Quantity, item.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to add refund item: %w", err)
+	}
+	return nil
+}
+
+// GetRefundableItems lists the items of an order with the quantity earlier refunds already returned.
+// Lock the order first so concurrent refunds can't both return the same units.
+func (r *RefundRepository) GetRefundableItems(ctx context.Context, orderID int) ([]refund.RefundableItem, error) {
+	query := `
+		SELECT oi.id, oi.product_id, oi.quantity, COALESCE(SUM(ri.quantity), 0), oi.price
+		FROM order_items oi
+		LEFT JOIN refund_items ri ON ri.order_item_id = oi.id
+		WHERE oi.order_id = $1
+		GROUP BY oi.id
+		ORDER BY oi.id`
+	rows, err := r.DB.Query(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refundable items: %w", err)
+	}
+
+	items, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (refund.RefundableItem, error) {
+		var item refund.RefundableItem
+		err := row.Scan(&item.OrderItemID, &item.ProductID, &item.Quantity, &item.RefundedQuantity, &item.Price)
+		return item, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan refundable item: %w", err)
+	}
+	return items, nil
+}
+
+// GetGatewayRefundedAmount sums what earlier refunds of an order sent back, or are to send back, through the gateway
+func (r *RefundRepository) GetGatewayRefundedAmount(ctx context.Context, orderID int) (money.Money, error) {
+	var total money.Money
+	query := `SELECT COALESCE(SUM(gateway_amount), 0) FROM refunds WHERE order_id = $1 AND method IN ('gateway', 'split')`
+	if err := r.DB.QueryRow(ctx, query, orderID).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to sum gateway refunds: %w", err)
+	}
+	return total, nil
+}
+
+// GetRefundByID fetches a refund with its items
+func (r *RefundRepository) GetRefundByID(ctx context.Context, refundID int) (*refund.Refund, error) {
+	rf, err := scanRefund(r.DB.QueryRow(ctx, `SELECT `+refundColumns+` FROM refunds WHERE id = $1`, refundID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refund: %w", err)
+	}
+
+	query := `
+		SELECT ri.id, ri.refund_id, ri.order_item_id, oi.product_id, ri.quantity, ri.amount
+		FROM refund_items ri
+		JOIN order_items oi ON oi.id = ri.order_item_id
+		WHERE ri.refund_id = $1
+		ORDER BY ri.id`
+	rows, err := r.DB.Query(ctx, query, refundID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refund items: %w", err)
+	}
+
+	rf.Items, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (refund.RefundItem, error) {
+		var item refund.RefundItem
+		err := row.Scan(&item.ID, &item.RefundID, &item.OrderItemID, &item.ProductID, &item.Quantity, &item.Amount)
+		return item, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan refund item: %w", err)
+	}
+	return rf, nil
+}
+
+// CompleteRefund marks a pending refund as completed. It reports false when another caller
+// completed it first, so the completion is only logged once.
+func (r *RefundRepository) CompleteRefund(ctx context.Context, refundID int, providerReference string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE refunds
+		SET status = 'completed', provider_reference = NULLIF($2, ''), failure_reason = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'`, refundID, providerReference)
+	if err != nil {
+		return false, fmt.Errorf("failed to complete refund: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// FailRefund moves a pending refund the gateway refused to failed with the gateway error.
+// It reports false when the refund already left pending.
+func (r *RefundRepository) FailRefund(ctx context.Context, refundID int, reason string) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE refunds SET status = 'failed', failure_reason = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'`, refundID, reason)
+	if err != nil {
+		return false, fmt.Errorf("failed to record refund failure: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RetryRefund moves a failed refund back to pending so it is submitted again under the same refund key.
+// It reports false when the refund isn't failed.
+func (r *RefundRepository) RetryRefund(ctx context.Context, refundID int) (bool, error) {
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE refunds SET status = 'pending', updated_at = NOW()
+		WHERE id = $1 AND status = 'failed'`, refundID)
+	if err != nil {
+		return false, fmt.Errorf("failed to retry refund: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,113 @@
+package repositories
+
+import (
+	"context"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrInsufficientStock is returned when a product doesn't have enough unreserved stock
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ReservedQuantitySQL sums the active, unexpired reservations of the product aliased as p
+const ReservedQuantitySQL = `COALESCE((SELECT SUM(sr.quantity) FROM stock_reservations sr WHERE sr.product_id = p.id AND sr.status = 'active' AND sr.expires_at > NOW()), 0)`
+
+// ReservationRepository holds and releases product stock for pending orders.
+// A reservation counts against available stock while it is active and not expired,
+// so expired reservations stop blocking stock even before they are marked released.
+type ReservationRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewReservationRepository(db *pgxpool.Pool) *ReservationRepository {
+	return &ReservationRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *ReservationRepository) WithTx(tx pgx.Tx) *ReservationRepository {
+	return &ReservationRepository{DB: tx}
+}
+
+// Reserve holds quantity units of a product for an order until expiresAt. The product row is locked
+// so concurrent reservations of the same product can't both take the last units; run it in a unit of work.
+func (r *ReservationRepository) Reserve(ctx context.Context, orderID, productID, quantity int, expiresAt time.Time) error {
+	var available int
+	query := `SELECT p.stock_quantity - ` + ReservedQuantitySQL + ` FROM products p WHERE p.id = $1 FOR UPDATE`
+	if err := r.DB.QueryRow(ctx, query, productID).Scan(&available); err != nil {
+		return fmt.Errorf("failed to get available stock: %w", err)
+	}
+
+	if available < quantity {
+		return fmt.Errorf("%w for product ID %d: %d available", ErrInsufficientStock, productID, available)
+	}
+
+	_, err := r.DB.Exec(ctx, "INSERT INTO stock_reservations (order_id, product_id, quantity, expires_at) VALUES ($1, $2, $3, $4)", orderID, productID, quantity, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to reserve stock: %w", err)
+	}
+	return nil
+}
+
+// ReleaseOrderReservations releases every active reservation of an order
+func (r *ReservationRepository) ReleaseOrderReservations(ctx context.Context, orderID int) error {
+	_, err := r.DB.Exec(ctx, "UPDATE stock_reservations SET status = 'released', updated_at = NOW() WHERE order_id = $1 AND status = 'active'", orderID)
+	if err != nil {
+		return fmt.Errorf("failed to release reservations: %w", err)
+	}
+	return nil
+}
+
+// ReleaseExpiredReservations marks every active reservation past its expiry as released
+func (r *ReservationRepository) ReleaseExpiredReservations(ctx context.Context) (int64, error) {
+	tag, err := r.DB.Exec(ctx, "UPDATE stock_reservations SET status = 'released', updated_at = NOW() WHERE status = 'active' AND expires_at <= NOW()")
+	if err != nil {
+		return 0, fmt.Errorf("failed to release expired reservations: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ConsumeOrderReservations turns the unexpired reservations of a paid order into a stock decrement and
+// returns the consumed quantity per product. Expired reservations are released instead, so the caller
+// has to take the remaining quantities from available stock.
+func (r *ReservationRepository) ConsumeOrderReservations(ctx context.Context, orderID int) (map[int]int, error) {
+	_, err := r.DB.Exec(ctx, "UPDATE stock_reservations SET status = 'released', updated_at = NOW() WHERE order_id = $1 AND status = 'active' AND expires_at <= NOW()", orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release expired reservations: %w", err)
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		WITH consumed AS (
+			UPDATE stock_reservations SET status = 'consumed', updated_at = NOW()
+			WHERE order_id = $1 AND status = 'active'
+			RETURNING product_id, quantity
+		), totals AS (
+			SELECT product_id, SUM(quantity) AS quantity FROM consumed GROUP BY product_id
+		)
+		UPDATE products p SET stock_quantity = p.stock_quantity - t.quantity, updated_at = NOW()
+		FROM totals t WHERE p.id = t.product_id
+		RETURNING p.id, t.quantity
+	`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume reservations: %w", err)
+	}
+	defer rows.Close()
+
+	consumed := make(map[int]int)
+	for rows.Next() {
+		var productID, quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan consumed reservation: %w", err)
+		}
+		consumed[productID] = quantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over consumed reservations: %w", err)
+	}
+
+	return consumed, nil
+}
@@ -3,18 +3,25 @@ package repositories
 import (
     "context"
     "fmt"
+    "github.com/jackc/pgx/v5"
     "github.com/jackc/pgx/v5/pgxpool"
 	review_model "dgw-technical-test/internal/models/review"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
 )
 
 type ReviewRepository struct {
-    DB *pgxpool.Pool
+    DB unitofwork.DBTX
 }
 
 func NewReviewRepository(db *pgxpool.Pool) *ReviewRepository {
     return &ReviewRepository{DB: db}
 }
 
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *ReviewRepository) WithTx(tx pgx.Tx) *ReviewRepository {
+    return &ReviewRepository{DB: tx}
+}
+
 // CreateReview logs a new review in the database
 func (r *ReviewRepository) CreateReview(ctx context.Context, orderID, farmerID int, rating int, comment, status string) error {
     _, err := r.DB.Exec(ctx, "INSERT INTO reviews (order_id, farmer_id, rating, comment, status) VALUES ($1, $2, $3, $4, $5)", orderID, farmerID, rating, comment, status)
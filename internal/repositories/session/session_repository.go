@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"context"
+	auth_model "dgw-technical-test/internal/models/auth"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Reasons recorded in sessions.revoked_reason
+const (
+	RevokedLogout        = "logout"
+	RevokedRotated       = "rotated"
+	RevokedAll           = "revoke_all"
+	RevokedReuseDetected = "reuse_detected"
+)
+
+// SessionRepository handles the login sessions backing access and refresh tokens
+type SessionRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewSessionRepository(db *pgxpool.Pool) *SessionRepository {
+	return &SessionRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *SessionRepository) WithTx(tx pgx.Tx) *SessionRepository {
+	return &SessionRepository{DB: tx}
+}
+
+// CreateSession stores a new session keyed by its ID (the access token jti)
+func (r *SessionRepository) CreateSession(ctx context.Context, id, familyID, subjectType string, subjectID int, refreshTokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO sessions (id, family_id, subject_type, subject_id, refresh_token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := r.DB.Exec(ctx, query, id, familyID, subjectType, subjectID, refreshTokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// GetSessionByRefreshTokenHashForUpdate fetches a session by refresh token hash and locks it until the transaction ends
+func (r *SessionRepository) GetSessionByRefreshTokenHashForUpdate(ctx context.Context, refreshTokenHash string) (*auth_model.Session, error) {
+	query := `
+		SELECT id, family_id, subject_type, subject_id, refresh_token_hash, expires_at, revoked_at, revoked_reason, created_at
+		FROM sessions
+		WHERE refresh_token_hash = $1
+		FOR UPDATE`
+	var s auth_model.Session
+	err := r.DB.QueryRow(ctx, query, refreshTokenHash).Scan(
+		&s.ID, &s.FamilyID, &s.SubjectType, &s.SubjectID, &s.RefreshTokenHash, &s.ExpiresAt, &s.RevokedAt, &s.RevokedReason, &s.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return &s, nil
+}
+
+// IsSessionActive reports whether the session exists, is not revoked and has not expired
+func (r *SessionRepository) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP)`
+	var active bool
+	if err := r.DB.QueryRow(ctx, query, id).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to check session %s: %w", id, err)
+	}
+	return active, nil
+}
+
+// RevokeSession revokes a single session; revoking an already revoked session is a no-op
+func (r *SessionRepository) RevokeSession(ctx context.Context, id, reason string) error {
+	query := `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = $2 WHERE id = $1 AND revoked_at IS NULL`
+	if _, err := r.DB.Exec(ctx, query, id, reason); err != nil {
+		return fmt.Errorf("failed to revoke session %s: %w", id, err)
+	}
+	return nil
+}
+
+// RevokeFamily revokes every active session descended from the same login
+func (r *SessionRepository) RevokeFamily(ctx context.Context, familyID, reason string) (int64, error) {
+	query := `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = $2 WHERE family_id = $1 AND revoked_at IS NULL`
+	tag, err := r.DB.Exec(ctx, query, familyID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke session family %s: %w", familyID, err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RevokeSubjectSessions revokes every active session of an admin or farmer
+func (r *SessionRepository) RevokeSubjectSessions(ctx context.Context, subjectType string, subjectID int, reason string) (int64, error) {
+	query := `UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP, revoked_reason = $3 WHERE subject_type = $1 AND subject_id = $2 AND revoked_at IS NULL`
+	tag, err := r.DB.Exec(ctx, query, subjectType, subjectID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions of %s %d: %w", subjectType, subjectID, err)
+	}
+	return tag.RowsAffected(), nil
+}
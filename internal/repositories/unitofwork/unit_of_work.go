@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DBTX is implemented by both *pgxpool.Pool and pgx.Tx, so a repository can run
+// its queries either on the pool or inside a unit of work
+type DBTX interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// UnitOfWork runs a group of repository calls inside a single database transaction
+type UnitOfWork struct {
+	DB *pgxpool.Pool
+}
+
+func NewUnitOfWork(db *pgxpool.Pool) *UnitOfWork {
+	return &UnitOfWork{DB: db}
+}
+
+// Do begins a transaction and passes it to fn. The transaction is committed when fn
+// returns nil and rolled back otherwise. Repositories join it through their WithTx method.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := u.DB.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// TryAdvisoryLock takes a transaction-level Postgres advisory lock on key. It returns false when another
+// session already holds it; the lock is released automatically when tx commits or rolls back.
+func TryAdvisoryLock(ctx context.Context, tx pgx.Tx, key int64) (bool, error) {
+	var acquired bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", key).Scan(&acquired); err != nil {
+		return false, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	return acquired, nil
+}
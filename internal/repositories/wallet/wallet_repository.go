@@ -0,0 +1,136 @@
+package repositories
+
+import (
+	"context"
+	wallet "dgw-technical-test/internal/models/wallet"
+	"dgw-technical-test/internal/money"
+	pagination "dgw-technical-test/internal/repositories/pagination"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor wasn't issued by ListTransactions
+var ErrInvalidCursor = pagination.ErrInvalidCursor
+
+// WalletRepository reads a farmer's wallet history and ledger movements
+type WalletRepository struct {
+	DB unitofwork.DBTX
+}
+
+func NewWalletRepository(db *pgxpool.Pool) *WalletRepository {
+	return &WalletRepository{DB: db}
+}
+
+// WithTx returns a copy of the repository that runs its queries inside tx
+func (r *WalletRepository) WithTx(tx pgx.Tx) *WalletRepository {
+	return &WalletRepository{DB: tx}
+}
+
+// ListTransactions returns a page of a farmer's wallet_transactions, newest first. Pages are keyed on
+// (created_at, id) so rows inserted while paging don't shift or repeat results.
+func (r *WalletRepository) ListTransactions(ctx context.Context, farmerID int, filter wallet.TransactionFilter) (*wallet.TransactionPage, error) {
+	conditions := []string{"farmer_id = $1"}
+	args := []any{farmerID}
+	add := func(condition string, values ...any) {
+		for _, v := range values {
+			args = append(args, v)
+			condition = strings.Replace(condition, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if filter.Type != "" {
+		add("transaction_type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		add("status = ?", filter.Status)
+	}
+	if !filter.From.IsZero() {
+		add("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		add("created_at < ?", filter.To)
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := pagination.DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		add("(created_at, id) < (?, ?)", createdAt, id)
+	}
+
+	// one extra row tells whether another page follows
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`
+		SELECT id, order_id, COALESCE(transaction_type, ''), amount, status, COALESCE(description, ''), created_at, updated_at
+		FROM wallet_transactions
+		WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d`, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list wallet transactions: %w", err)
+	}
+	transactions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (wallet.Transaction, error) {
+		var t wallet.Transaction
+		err := row.Scan(&t.ID, &t.Reference, &t.TransactionType, &t.Amount, &t.Status, &t.Description, &t.CreatedAt, &t.UpdatedAt)
+		return t, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan wallet transactions: %w", err)
+	}
+
+	page := &wallet.TransactionPage{Transactions: transactions}
+	if len(transactions) > filter.Limit {
+		page.Transactions = transactions[:filter.Limit]
+		last := page.Transactions[filter.Limit-1]
+		page.NextCursor = pagination.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// GetWalletBalanceBefore derives a farmer's ledger balance from the entries posted before t
+func (r *WalletRepository) GetWalletBalanceBefore(ctx context.Context, farmerID int, t time.Time) (money.Money, error) {
+	query := `
+		SELECT COALESCE(SUM(l.credit - l.debit), 0)
+		FROM ledger_lines l
+		JOIN ledger_accounts a ON a.id = l.account_id
+		JOIN ledger_entries e ON e.id = l.entry_id
+		WHERE a.farmer_id = $1 AND e.created_at < $2`
+	var balance money.Money
+	if err := r.DB.QueryRow(ctx, query, farmerID, t).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("failed to get wallet balance of farmer %d: %w", farmerID, err)
+	}
+	return balance, nil
+}
+
+// GetWalletMovements lists the ledger lines of a farmer's wallet posted in [from, to), oldest first.
+// Balance is left for the caller to compute from the opening balance.
+func (r *WalletRepository) GetWalletMovements(ctx context.Context, farmerID int, from, to time.Time) ([]wallet.StatementLine, error) {
+	query := `
+		SELECT e.created_at, e.entry_type, e.reference, COALESCE(e.description, ''), l.credit, l.debit
+		FROM ledger_lines l
+		JOIN ledger_accounts a ON a.id = l.account_id
+		JOIN ledger_entries e ON e.id = l.entry_id
+		WHERE a.farmer_id = $1 AND e.created_at >= $2 AND e.created_at < $3
+		ORDER BY e.created_at, e.id, l.id`
+	rows, err := r.DB.Query(ctx, query, farmerID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet movements: %w", err)
+	}
+	lines, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (wallet.StatementLine, error) {
+		var l wallet.StatementLine
+		err := row.Scan(&l.Date, &l.EntryType, &l.Reference, &l.Description, &l.Credit, &l.Debit)
+		return l, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan wallet movements: %w", err)
+	}
+	return lines, nil
+}
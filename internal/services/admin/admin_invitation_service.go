@@ -0,0 +1,181 @@
+package services
+
+import (
+	"dgw-technical-test/internal/auth"
+	admin "dgw-technical-test/internal/models/admin"
+	"dgw-technical-test/utils"
+
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidInvitation is returned when an invitation token is unknown, expired or already redeemed
+	ErrInvalidInvitation = errors.New("invitation is invalid or expired")
+	// ErrAdminExists is returned when inviting or bootstrapping an email that already belongs to an admin
+	ErrAdminExists = errors.New("admin already exists")
+	// ErrSuperAdminExists is returned when bootstrapping while a Super Admin is already registered
+	ErrSuperAdminExists = errors.New("a super admin already exists")
+	// ErrInvalidAdminData is returned when the name, email or password of a new admin is missing or malformed
+	ErrInvalidAdminData = errors.New("invalid admin data")
+)
+
+// bootstrapLockKey serializes concurrent bootstrap runs so only one Super Admin can be created
+const bootstrapLockKey int64 = 7_400_002
+
+// CreateInvitation lets an admin invite a new admin; the returned plain token is only ever available here
+func (s *AdminService) CreateInvitation(ctx context.Context, invitedBy int, email, role string) (*admin.Invitation, string, error) {
+	email = strings.TrimSpace(email)
+	if !utils.ValidateEmail(email) {
+		return nil, "", fmt.Errorf("%w: invalid email", ErrInvalidAdminData)
+	}
+	if !auth.IsAdminRole(role) {
+		return nil, "", fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	exists, err := s.AdminRepo.AdminExistsByEmail(ctx, email)
+	if err != nil {
+		return nil, "", err
+	}
+	if exists {
+		return nil, "", ErrAdminExists
+	}
+
+	token, err := generateInvitationToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	invitation, err := s.AdminRepo.CreateInvitation(ctx, email, role, hashInvitationToken(token), invitedBy, time.Now().Add(s.InvitationTTL))
+	if err != nil {
+		return nil, "", err
+	}
+	return invitation, token, nil
+}
+
+// AcceptInvitation redeems an invitation token, creating the admin with the invited email and role
+func (s *AdminService) AcceptInvitation(ctx context.Context, token, name, password string) (*admin.Invitation, error) {
+	if err := validateAdminData(name, password); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitation *admin.Invitation
+	err = s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		adminRepo := s.AdminRepo.WithTx(tx)
+
+		// lock the invitation so the same token can't be redeemed twice concurrently
+		inv, err := adminRepo.GetInvitationByTokenHashForUpdate(ctx, hashInvitationToken(token))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidInvitation
+		}
+		if err != nil {
+			return err
+		}
+		if inv.AcceptedAt != nil || time.Now().After(inv.ExpiresAt) {
+			return ErrInvalidInvitation
+		}
+
+		exists, err := adminRepo.AdminExistsByEmail(ctx, inv.Email)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrAdminExists
+		}
+
+		if err := adminRepo.CreateAdmin(ctx, strings.TrimSpace(name), inv.Email, hashedPassword, inv.Role); err != nil {
+			return err
+		}
+		if err := adminRepo.MarkInvitationAccepted(ctx, inv.ID); err != nil {
+			return err
+		}
+
+		invitation = inv
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// BootstrapSuperAdmin creates the first Super Admin; it refuses to run once any Super Admin exists
+func (s *AdminService) BootstrapSuperAdmin(ctx context.Context, name, email, password string) error {
+	email = strings.TrimSpace(email)
+	if !utils.ValidateEmail(email) {
+		return fmt.Errorf("%w: invalid email", ErrInvalidAdminData)
+	}
+	if err := validateAdminData(name, password); err != nil {
+		return err
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", bootstrapLockKey); err != nil {
+			return fmt.Errorf("failed to acquire bootstrap lock: %w", err)
+		}
+
+		adminRepo := s.AdminRepo.WithTx(tx)
+
+		count, err := adminRepo.CountAdminsByRole(ctx, auth.RoleSuperAdmin)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrSuperAdminExists
+		}
+
+		exists, err := adminRepo.AdminExistsByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrAdminExists
+		}
+
+		return adminRepo.CreateAdmin(ctx, strings.TrimSpace(name), email, hashedPassword, auth.RoleSuperAdmin)
+	})
+}
+
+// validateAdminData checks the fields an admin chooses for themselves
+func validateAdminData(name, password string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAdminData)
+	}
+	if len(password) < 8 {
+		return fmt.Errorf("%w: password must be at least 8 characters", ErrInvalidAdminData)
+	}
+	return nil
+}
+
+// generateInvitationToken returns a random 32-byte token encoded as hex
+func generateInvitationToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashInvitationToken returns the SHA-256 hex digest stored in admin_invitations.token_hash
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -4,65 +4,37 @@ import (
 	admin "dgw-technical-test/internal/models/admin"
 	admin_repo "dgw-technical-test/internal/repositories/admin"
 	review_repo "dgw-technical-test/internal/repositories/review"	
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"dgw-technical-test/utils"
 
 	"errors"
 	"fmt"
-	"os"
 	"time"
-
-	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 	"context"
 )
 
+// ErrInvalidRole is returned when inviting an admin with a role outside auth.AdminRoles
+var ErrInvalidRole = errors.New("invalid admin role")
+
 type AdminService struct {
 	AdminRepo *admin_repo.AdminRepository
 	ReviewRepo *review_repo.ReviewRepository
+	UnitOfWork *unitofwork.UnitOfWork
+	InvitationTTL time.Duration // how long an invitation token can be redeemed, from ADMIN_INVITATION_TTL
 }
 
-func NewAdminService(adminRepo *admin_repo.AdminRepository, reviewRepo *review_repo.ReviewRepository) *AdminService {
+func NewAdminService(adminRepo *admin_repo.AdminRepository, reviewRepo *review_repo.ReviewRepository, unitOfWork *unitofwork.UnitOfWork) *AdminService {
 	return &AdminService{
 		AdminRepo: adminRepo,
 		ReviewRepo: reviewRepo,
+		UnitOfWork: unitOfWork,
+		InvitationTTL: utils.DurationFromEnv("ADMIN_INVITATION_TTL", 72*time.Hour),
 	}
 }
 
-// RegisterAdmin registers a new admin with the given data
-func (s *AdminService) RegisterAdmin(name, email, password, role string) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return err
-	}
-	return s.AdminRepo.CreateAdmin(name, email, string(hashedPassword), role)
-}
-
-// LoginAdmin logs in an admin using email and password
-func (s *AdminService) LoginAdmin(email, password string) (*admin.Admin, error) {
-	ad, err := s.AdminRepo.GetAdminByEmail(email)
-	if err != nil {
-		return nil, err
-	}
-
-	// Compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(ad.Password), []byte(password)); err != nil {
-		return nil, errors.New("invalid email or password")
-	}
-
-	// Generate the JWT token for the admin
-	token, err := s.GenerateJWT(ad)
-	if err != nil {
-		return nil, err
-	}
-
-	// Update the JWT token in the database
-	err = s.AdminRepo.UpdateAdminJWTToken(ad.ID, token)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return the admin with the new JWT token
-	ad.JWTToken = token
-	return ad, nil
+// GetAdminByID retrieves an admin by their ID
+func (s *AdminService) GetAdminByID(ctx context.Context, adminID int) (*admin.Admin, error) {
+	return s.AdminRepo.GetAdminByID(ctx, adminID)
 }
 
 // GetAdminByEmail retrieves an admin by their email
@@ -74,26 +46,6 @@ func (s *AdminService) GetAdminByEmail(email string) (*admin.Admin, error) {
 	return ad, nil
 }
 
-// GenerateJWT generates a JWT token for the admin
-func (s *AdminService) GenerateJWT(ad *admin.Admin) (string, error) {
-	// Fetch the secret key from environment variables
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return "", fmt.Errorf("JWT_SECRET not set in environment variables")
-	}
-
-	claims := jwt.MapClaims{
-		"admin_id":    ad.ID,
-		"name":        ad.Name,
-		"email":       ad.Email,
-		"role":        ad.Role,
-		"exp":         jwt.NewNumericDate(time.Now().Add(72 * time.Hour)),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	return tokenString, err
-}
-
 // update review status for admin
 func (s *AdminService) UpdateReviewStatus(ctx context.Context, reviewID int, status string) error {
 	return s.ReviewRepo.UpdateReviewStatus(ctx, reviewID, status)
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"dgw-technical-test/internal/auth"
+	admin "dgw-technical-test/internal/models/admin"
+	auth_model "dgw-technical-test/internal/models/auth"
+	farmer "dgw-technical-test/internal/models/farmer"
+	admin_repo "dgw-technical-test/internal/repositories/admin"
+	farmer_repo "dgw-technical-test/internal/repositories/farmer"
+	session_repo "dgw-technical-test/internal/repositories/session"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	"dgw-technical-test/utils"
+
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired, revoked or reused
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// AuthService logs admins and farmers in and issues access and refresh tokens backed by server-side sessions
+type AuthService struct {
+	SessionRepo     *session_repo.SessionRepository
+	AdminRepo       *admin_repo.AdminRepository
+	FarmerRepo      *farmer_repo.FarmerRepository
+	UnitOfWork      *unitofwork.UnitOfWork
+	Signer          auth.Signer
+	AccessTokenTTL  time.Duration // from ACCESS_TOKEN_TTL
+	RefreshTokenTTL time.Duration // from REFRESH_TOKEN_TTL
+}
+
+func NewAuthService(sessionRepo *session_repo.SessionRepository, adminRepo *admin_repo.AdminRepository, farmerRepo *farmer_repo.FarmerRepository, unitOfWork *unitofwork.UnitOfWork, signer auth.Signer) *AuthService {
+	return &AuthService{
+		SessionRepo:     sessionRepo,
+		AdminRepo:       adminRepo,
+		FarmerRepo:      farmerRepo,
+		UnitOfWork:      unitOfWork,
+		Signer:          signer,
+		AccessTokenTTL:  utils.DurationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: utils.DurationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+	}
+}
+
+// AdminPrincipal describes an admin as a principal
+func AdminPrincipal(ad *admin.Admin) auth.Principal {
+	return auth.Principal{SubjectType: auth.SubjectAdmin, ID: ad.ID, Role: ad.Role, Name: ad.Name, Email: ad.Email}
+}
+
+// FarmerPrincipal describes a farmer as a principal
+func FarmerPrincipal(f *farmer.Farmer) auth.Principal {
+	return auth.Principal{SubjectType: auth.SubjectFarmer, ID: f.ID, Role: auth.RoleFarmer, Name: f.Name, Email: f.Email}
+}
+
+// Login verifies the email and password of an admin or farmer and starts a new session.
+// Unknown emails and wrong passwords both return auth.ErrInvalidCredentials.
+func (s *AuthService) Login(ctx context.Context, subjectType, email, password string) (*auth.Principal, *auth_model.TokenPair, error) {
+	var principal auth.Principal
+	var hashedPassword string
+
+	switch subjectType {
+	case auth.SubjectAdmin:
+		ad, err := s.AdminRepo.GetAdminByEmail(email)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, auth.ErrInvalidCredentials
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		principal, hashedPassword = AdminPrincipal(ad), ad.Password
+	case auth.SubjectFarmer:
+		f, err := s.FarmerRepo.GetFarmerByEmail(email)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, auth.ErrInvalidCredentials
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		principal, hashedPassword = FarmerPrincipal(f), f.Password
+	default:
+		return nil, nil, fmt.Errorf("unknown subject type %q", subjectType)
+	}
+
+	if err := auth.CheckPassword(hashedPassword, password); err != nil {
+		return nil, nil, err
+	}
+
+	familyID, err := randomToken(16)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.startSession(ctx, s.SessionRepo, familyID, principal)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &principal, tokens, nil
+}
+
+// Refresh rotates a refresh token: the presented session is revoked and a new one is started in the same family.
+// Presenting an already rotated token means it leaked, so the whole family is revoked.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*auth_model.TokenPair, error) {
+	var pair *auth_model.TokenPair
+
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		sessionRepo := s.SessionRepo.WithTx(tx)
+
+		session, err := sessionRepo.GetSessionByRefreshTokenHashForUpdate(ctx, hashToken(refreshToken))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if session.RevokedAt != nil {
+			// only a rotated token indicates reuse; a logged out session is simply invalid
+			if session.RevokedReason != nil && *session.RevokedReason == session_repo.RevokedRotated {
+				if _, err := sessionRepo.RevokeFamily(ctx, session.FamilyID, session_repo.RevokedReuseDetected); err != nil {
+					return err
+				}
+			}
+			// commit the family revocation, the caller still gets ErrInvalidRefreshToken
+			return nil
+		}
+		if time.Now().After(session.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// reload the subject so deleted accounts can't refresh and role changes take effect
+		principal, err := s.currentPrincipal(ctx, tx, session.SubjectType, session.SubjectID)
+		if err != nil {
+			return err
+		}
+
+		if err := sessionRepo.RevokeSession(ctx, session.ID, session_repo.RevokedRotated); err != nil {
+			return err
+		}
+		pair, err = s.startSession(ctx, sessionRepo, session.FamilyID, principal)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	return pair, nil
+}
+
+// Logout revokes the session behind the presented access token
+func (s *AuthService) Logout(ctx context.Context, sessionID string) error {
+	return s.SessionRepo.RevokeSession(ctx, sessionID, session_repo.RevokedLogout)
+}
+
+// RevokeAllSessions revokes every session of an admin or farmer, returning how many were active
+func (s *AuthService) RevokeAllSessions(ctx context.Context, subjectType string, subjectID int) (int64, error) {
+	return s.SessionRepo.RevokeSubjectSessions(ctx, subjectType, subjectID, session_repo.RevokedAll)
+}
+
+// IsSessionActive reports whether access tokens carrying the session ID as jti are still accepted
+func (s *AuthService) IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	return s.SessionRepo.IsSessionActive(ctx, sessionID)
+}
+
+// startSession stores a new session in the family and signs its access token
+func (s *AuthService) startSession(ctx context.Context, sessionRepo *session_repo.SessionRepository, familyID string, principal auth.Principal) (*auth_model.TokenPair, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	refreshExpiresAt := now.Add(s.RefreshTokenTTL)
+	if err := sessionRepo.CreateSession(ctx, sessionID, familyID, principal.SubjectType, principal.ID, hashToken(refreshToken), refreshExpiresAt); err != nil {
+		return nil, err
+	}
+
+	accessExpiresAt := now.Add(s.AccessTokenTTL)
+	accessToken, err := s.Signer.Sign(auth.NewClaims(principal, sessionID, now, accessExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return &auth_model.TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// currentPrincipal loads the subject of a session as it is now
+func (s *AuthService) currentPrincipal(ctx context.Context, tx pgx.Tx, subjectType string, id int) (auth.Principal, error) {
+	switch subjectType {
+	case auth.SubjectAdmin:
+		ad, err := s.AdminRepo.WithTx(tx).GetAdminByID(ctx, id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return auth.Principal{}, ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return auth.Principal{}, err
+		}
+		return AdminPrincipal(ad), nil
+	case auth.SubjectFarmer:
+		f, err := s.FarmerRepo.WithTx(tx).GetFarmerByID(id)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return auth.Principal{}, ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return auth.Principal{}, err
+		}
+		return FarmerPrincipal(f), nil
+	default:
+		return auth.Principal{}, fmt.Errorf("unknown session subject type %q", subjectType)
+	}
+}
+
+// randomToken returns n random bytes encoded as hex
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the SHA-256 hex digest stored in sessions.refresh_token_hash
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
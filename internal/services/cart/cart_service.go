@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	domain "dgw-technical-test/internal/domain/order"
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
+	cart_model "dgw-technical-test/internal/models/cart"
+	credit_model "dgw-technical-test/internal/models/credit"
+	order_model "dgw-technical-test/internal/models/order"
+	product_model "dgw-technical-test/internal/models/product"
+	cart_repo "dgw-technical-test/internal/repositories/cart"
+	product_repo "dgw-technical-test/internal/repositories/product"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	farmer_service "dgw-technical-test/internal/services/farmer"
+	pricing_service "dgw-technical-test/internal/services/pricing"
+	purchase_service "dgw-technical-test/internal/services/purchase"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/midtrans/midtrans-go/coreapi"
+)
+
+var (
+	// ErrCartItemNotFound is returned when a product isn't in the farmer's cart
+	ErrCartItemNotFound = errors.New("product is not in the cart")
+	// ErrEmptyCart is returned when a farmer checks out an empty cart
+	ErrEmptyCart = errors.New("cart is empty")
+	// ErrChargeFailed is returned when the order was placed but its online charge couldn't be created
+	ErrChargeFailed = errors.New("order placed but the online charge failed")
+)
+
+// CheckoutResult describes the order a checkout placed and how it was paid
+type CheckoutResult struct {
+	Order         *purchase_service.PlacedOrder `json:"order"`
+	Status        domain.Status                 `json:"status"`
+	PaymentMethod string                        `json:"payment_method"`
+	Charge        *coreapi.ChargeResponse       `json:"charge,omitempty"`       // the charge of an online checkout
+	Instructions  *payment_gateway.Instructions `json:"instructions,omitempty"` // how to pay the charge of an online checkout
+	Receivable    *credit_model.Receivable      `json:"receivable,omitempty"`   // what is owed for a credit checkout and its instalments
+}
+
+// CartService manages farmers' carts and turns them into orders
+type CartService struct {
+	CartRepo        *cart_repo.CartRepository
+	ProductRepo     *product_repo.ProductRepository
+	UnitOfWork      *unitofwork.UnitOfWork
+	PricingService  *pricing_service.PricingService
+	PurchaseService *purchase_service.PurchaseService
+	FarmerService   *farmer_service.FarmerService
+}
+
+func NewCartService(cartRepo *cart_repo.CartRepository, productRepo *product_repo.ProductRepository, unitOfWork *unitofwork.UnitOfWork, pricingService *pricing_service.PricingService, purchaseService *purchase_service.PurchaseService, farmerService *farmer_service.FarmerService) *CartService {
+	return &CartService{
+		CartRepo:        cartRepo,
+		ProductRepo:     productRepo,
+		UnitOfWork:      unitOfWork,
+		PricingService:  pricingService,
+		PurchaseService: purchaseService,
+		FarmerService:   farmerService,
+	}
+}
+
+// GetCart returns a farmer's cart at current catalog prices
+func (s *CartService) GetCart(ctx context.Context, farmerID int) (*cart_model.Cart, error) {
+	lines, err := s.CartRepo.GetCartLines(ctx, farmerID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &cart_model.Cart{FarmerID: farmerID, Items: lines}
+	for _, line := range lines {
+		c.Total += line.Subtotal
+	}
+	return c, nil
+}
+
+// AddItem adds units of a product to a farmer's cart. The cart may not hold more units than the product has available.
+func (s *CartService) AddItem(ctx context.Context, farmerID int, req cart_model.AddCartItemRequest) (*cart_model.Cart, error) {
+	product, err := s.availableProduct(ctx, req.ProductID, req.Quantity)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		quantity, err := s.CartRepo.WithTx(tx).AddItem(ctx, farmerID, req.ProductID, req.Quantity)
+		if err != nil {
+			return err
+		}
+		// the units already in the cart count as well
+		if quantity > product.AvailableQuantity {
+			return fmt.Errorf("%w for product %s: %d available", reservation_repo.ErrInsufficientStock, product.Name, product.AvailableQuantity)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, farmerID)
+}
+
+// UpdateItem sets the quantity of a product already in a farmer's cart
+func (s *CartService) UpdateItem(ctx context.Context, farmerID, productID int, req cart_model.UpdateCartItemRequest) (*cart_model.Cart, error) {
+	if _, err := s.availableProduct(ctx, productID, req.Quantity); err != nil {
+		return nil, err
+	}
+
+	found, err := s.CartRepo.SetItemQuantity(ctx, farmerID, productID, req.Quantity)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrCartItemNotFound
+	}
+
+	return s.GetCart(ctx, farmerID)
+}
+
+// RemoveItem removes a product from a farmer's cart
+func (s *CartService) RemoveItem(ctx context.Context, farmerID, productID int) (*cart_model.Cart, error) {
+	found, err := s.CartRepo.RemoveItem(ctx, farmerID, productID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrCartItemNotFound
+	}
+
+	return s.GetCart(ctx, farmerID)
+}
+
+// availableProduct fetches a product and checks that quantity units of it are available
+func (s *CartService) availableProduct(ctx context.Context, productID, quantity int) (*product_model.Product, error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("%w for product_id %d", pricing_service.ErrInvalidQuantity, productID)
+	}
+
+	product, err := s.ProductRepo.GetProductByID(ctx, productID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: product_id %d", pricing_service.ErrProductNotFound, productID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if product.AvailableQuantity < quantity {
+		return nil, fmt.Errorf("%w for product %s: %d available", reservation_repo.ErrInsufficientStock, product.Name, product.AvailableQuantity)
+	}
+	return product, nil
+}
+
+// Checkout turns a farmer's cart into a pending order priced from the catalog with its stock reserved,
+// and empties the cart. A wallet checkout pays the order in the same transaction, so a low balance
+// leaves no order behind and keeps the cart. An online checkout creates a charge through the chosen channel once
+// the order is placed; when that charge fails the order stays pending and ErrChargeFailed is returned with it.
+// A split checkout holds the wallet part in the same transaction as a wallet checkout and charges the rest
+// online like an online checkout; the order is paid once that charge settles. A credit checkout is paid from the
+// farmer's credit facility in the same transaction, so an order the facility doesn't cover isn't placed either.
+func (s *CartService) Checkout(ctx context.Context, farmerID int, req cart_model.CheckoutRequest) (*CheckoutResult, error) {
+	result := &CheckoutResult{PaymentMethod: req.PaymentMethod, Status: domain.StatusPending}
+	charged := req.PaymentMethod == cart_model.PaymentMethodOnline || req.PaymentMethod == cart_model.PaymentMethodSplit
+	if charged {
+		// an unavailable channel is refused before an order is placed that couldn't be charged
+		if _, err := s.FarmerService.Channels.Lookup(req.Channel); err != nil {
+			return nil, err
+		}
+	}
+	var quote *pricing_service.Quote
+
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		cartRepo := s.CartRepo.WithTx(tx)
+
+		// lock the cart so a concurrent checkout waits and then finds it empty
+		cartItems, err := cartRepo.GetItemsForUpdate(ctx, farmerID)
+		if err != nil {
+			return err
+		}
+		if len(cartItems) == 0 {
+			return ErrEmptyCart
+		}
+
+		items := make([]order_model.OrderItem, len(cartItems))
+		for i, item := range cartItems {
+			items[i] = order_model.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity}
+		}
+		quote, err = s.PricingService.PriceItems(ctx, items)
+		if err != nil {
+			return err
+		}
+
+		result.Order, err = s.PurchaseService.PlaceOrder(ctx, tx, farmerID, quote, domain.FarmerActor(farmerID))
+		if err != nil {
+			return err
+		}
+		if err := cartRepo.ClearCart(ctx, farmerID); err != nil {
+			return err
+		}
+
+		switch req.PaymentMethod {
+		case cart_model.PaymentMethodSplit:
+			return s.FarmerService.HoldOrderFunds(ctx, tx, farmerID, result.Order.OrderID, req.WalletAmount)
+		case cart_model.PaymentMethodOnline:
+			return nil
+		case cart_model.PaymentMethodCredit:
+			result.Receivable, err = s.FarmerService.PayOrderOnCredit(ctx, tx, farmerID, result.Order.OrderID)
+			if err != nil {
+				return err
+			}
+			result.Status = domain.StatusPaid
+			return nil
+		}
+		if err := s.FarmerService.PayOrderWithWallet(ctx, tx, farmerID, result.Order.OrderID); err != nil {
+			return err
+		}
+		result.Status = domain.StatusPaid
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if charged {
+		amount := quote.Total
+		if req.PaymentMethod == cart_model.PaymentMethodSplit {
+			amount -= req.WalletAmount
+		}
+		charge, instructions, err := s.FarmerService.ExecuteOnlinePayment(ctx, farmerID, result.Order.OrderID, req.Channel, amount, quote.Descriptions)
+		if err != nil {
+			return result, fmt.Errorf("%w: %v", ErrChargeFailed, err)
+		}
+		result.Charge = charge
+		result.Instructions = instructions
+		if charge.TransactionStatus == "pending" {
+			result.Status = domain.StatusAwaitingPayment
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,512 @@
+package services
+
+import (
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
+	credit "dgw-technical-test/internal/models/credit"
+	wallet_model "dgw-technical-test/internal/models/wallet"
+	"dgw-technical-test/internal/money"
+	credit_repo "dgw-technical-test/internal/repositories/credit"
+	farmer_repo "dgw-technical-test/internal/repositories/farmer"
+	log_repo "dgw-technical-test/internal/repositories/log"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	ledger_service "dgw-technical-test/internal/services/ledger"
+	policy "dgw-technical-test/internal/services/policy"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidFacility is returned when the terms of a facility are out of range
+	ErrInvalidFacility = errors.New("invalid credit facility")
+	// ErrNoCreditFacility is returned when the farmer has no credit facility
+	ErrNoCreditFacility = errors.New("farmer has no credit facility")
+	// ErrFarmerNotFound is returned when a facility is granted to a farmer who doesn't exist
+	ErrFarmerNotFound = errors.New("farmer not found")
+	// ErrCreditUnavailable is returned when an order is bought on credit while the facility is suspended or instalments are overdue
+	ErrCreditUnavailable = errors.New("credit is not available")
+	// ErrCreditLimitExceeded is returned when an order would take the farmer over their credit limit
+	ErrCreditLimitExceeded = errors.New("credit limit exceeded")
+	// ErrReceivableNotFound is returned when a receivable doesn't exist or belongs to another farmer
+	ErrReceivableNotFound = errors.New("receivable not found")
+	// ErrInvalidRepayment is returned when a repayment isn't positive, is more than is owed or can't be charged online
+	ErrInvalidRepayment = errors.New("invalid repayment")
+	// ErrRepaymentNotFound is returned when a repayment doesn't exist or belongs to another farmer
+	ErrRepaymentNotFound = errors.New("repayment not found")
+)
+
+// CreditService runs the pay-later facilities admins grant farmers. An order bought on credit is paid at once
+// and becomes a receivable of the order total plus the facility fee, repaid in instalments from the wallet or
+// through a payment channel. Methods taking a transaction commit with the order change they belong to.
+type CreditService struct {
+	CreditRepo     *credit_repo.CreditRepository
+	FarmerRepo     *farmer_repo.FarmerRepository
+	LogRepo        *log_repo.LogRepository
+	UnitOfWork     *unitofwork.UnitOfWork
+	LedgerService  *ledger_service.LedgerService
+	PaymentGateway payment_gateway.PaymentGateway
+	Channels       *payment_gateway.ChannelCatalog
+}
+
+func NewCreditService(creditRepo *credit_repo.CreditRepository, farmerRepo *farmer_repo.FarmerRepository, logRepo *log_repo.LogRepository, unitOfWork *unitofwork.UnitOfWork, ledgerService *ledger_service.LedgerService, paymentGateway payment_gateway.PaymentGateway, channels *payment_gateway.ChannelCatalog) *CreditService {
+	return &CreditService{
+		CreditRepo:     creditRepo,
+		FarmerRepo:     farmerRepo,
+		LogRepo:        logRepo,
+		UnitOfWork:     unitOfWork,
+		LedgerService:  ledgerService,
+		PaymentGateway: paymentGateway,
+		Channels:       channels,
+	}
+}
+
+// SaveFacility grants a farmer a facility or changes its terms. New terms only apply to orders bought
+// on credit afterwards; lowering the limit below what is owed just stops further credit purchases.
+func (s *CreditService) SaveFacility(ctx context.Context, adminID, farmerID int, req credit.FacilityRequest) (*credit.Facility, error) {
+	if req.CreditLimit.IsNegative() {
+		return nil, fmt.Errorf("%w: the credit limit can't be negative", ErrInvalidFacility)
+	}
+	if req.Status == "" {
+		req.Status = credit.FacilityActive
+	}
+
+	if _, err := s.FarmerRepo.GetFarmerByID(farmerID); errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrFarmerNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f *credit.Facility
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		var err error
+		f, err = s.CreditRepo.WithTx(tx).SaveFacility(ctx, farmerID, adminID, req)
+		if err != nil {
+			return err
+		}
+		details := fmt.Sprintf("Admin ID %d set the credit facility of farmer ID %d to a limit of IDR %s over %d days in %d instalments with a fee of %d bps (%s)",
+			adminID, farmerID, req.CreditLimit, req.TenorDays, req.Instalments, req.FeeBps, req.Status)
+		return s.LogRepo.WithTx(tx).LogAction(ctx, adminID, "Save Credit Facility", details)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// GetAccount returns a farmer's facility with what they owe and can still buy on credit, and their receivables
+// with the instalment schedules; paid receivables are only included when all is set
+func (s *CreditService) GetAccount(ctx context.Context, farmerID int, all bool) (*credit.CreditAccount, error) {
+	f, err := s.CreditRepo.GetFacility(ctx, farmerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoCreditFacility
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	account := &credit.CreditAccount{Facility: f}
+	if account.Outstanding, err = s.CreditRepo.GetOutstanding(ctx, farmerID); err != nil {
+		return nil, err
+	}
+	if account.Overdue, err = s.CreditRepo.GetOverdueAmount(ctx, farmerID); err != nil {
+		return nil, err
+	}
+	if f.Status == credit.FacilityActive && f.CreditLimit > account.Outstanding {
+		account.Available = f.CreditLimit - account.Outstanding
+	}
+
+	if account.Receivables, err = s.CreditRepo.ListReceivables(ctx, farmerID, all); err != nil {
+		return nil, err
+	}
+	for i := range account.Receivables {
+		if account.Receivables[i].Instalments, err = s.CreditRepo.ListInstalments(ctx, account.Receivables[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return account, nil
+}
+
+// OpenReceivable records what a farmer owes for an order of principal bought on credit inside tx, which must
+// hold the lock on the order, and schedules its instalments. It fails with ErrNoCreditFacility,
+// ErrCreditUnavailable or ErrCreditLimitExceeded when the facility doesn't cover the order.
+func (s *CreditService) OpenReceivable(ctx context.Context, tx pgx.Tx, farmerID, orderID int, principal money.Money) (*credit.Receivable, error) {
+	creditRepo := s.CreditRepo.WithTx(tx)
+
+	// lock the facility so concurrent credit purchases are checked against the limit one at a time
+	f, err := creditRepo.GetFacilityForUpdate(ctx, farmerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoCreditFacility
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Status != credit.FacilityActive {
+		return nil, fmt.Errorf("%w: the credit facility is %s", ErrCreditUnavailable, f.Status)
+	}
+	overdue, err := creditRepo.GetOverdueAmount(ctx, farmerID)
+	if err != nil {
+		return nil, err
+	}
+	if overdue.IsPositive() {
+		return nil, fmt.Errorf("%w: IDR %s of instalments are overdue", ErrCreditUnavailable, overdue)
+	}
+
+	amount := withFee(principal, f.FeeBps)
+	outstanding, err := creditRepo.GetOutstanding(ctx, farmerID)
+	if err != nil {
+		return nil, err
+	}
+	if outstanding+amount > f.CreditLimit {
+		return nil, fmt.Errorf("%w: IDR %s owed with this order, the limit is IDR %s", ErrCreditLimitExceeded, outstanding+amount, f.CreditLimit)
+	}
+
+	rc, err := creditRepo.CreateReceivable(ctx, &credit.Receivable{
+		FacilityID: f.ID,
+		FarmerID:   farmerID,
+		OrderID:    orderID,
+		Reference:  fmt.Sprintf("rcv-%d", orderID),
+		Principal:  principal,
+		Fee:        amount - principal,
+		Amount:     amount,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rc.Instalments = schedule(rc, f, time.Now())
+	for _, in := range rc.Instalments {
+		if err := creditRepo.AddInstalment(ctx, in); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.LedgerService.RecordCreditSale(ctx, tx, rc.Principal, rc.Fee, rc.Reference); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// Repay repays part or all of one of the farmer's receivables. A wallet repayment is applied at once and fails
+// with ErrInsufficientFunds when the balance is too low; an online repayment creates a charge through the channel
+// and is applied when it settles, the returned instructions tell the farmer how to pay it.
+func (s *CreditService) Repay(ctx context.Context, farmerID, receivableID int, req credit.RepaymentRequest) (*credit.Repayment, *payment_gateway.Instructions, error) {
+	if !req.Amount.IsPositive() {
+		return nil, nil, fmt.Errorf("%w: the amount must be more than zero", ErrInvalidRepayment)
+	}
+	if req.Method == credit.RepaymentOnline {
+		return s.repayOnline(ctx, farmerID, receivableID, req)
+	}
+
+	var p *credit.Repayment
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		creditRepo := s.CreditRepo.WithTx(tx)
+		rc, err := s.lockReceivable(ctx, tx, farmerID, receivableID)
+		if err != nil {
+			return err
+		}
+		if req.Amount > rc.Outstanding {
+			return fmt.Errorf("%w: only IDR %s is left to repay", ErrInvalidRepayment, rc.Outstanding)
+		}
+
+		p, err = creditRepo.CreateRepayment(ctx, &credit.Repayment{
+			ReceivableID: rc.ID,
+			FarmerID:     farmerID,
+			Reference:    repaymentReference(rc.ID),
+			Method:       credit.RepaymentWallet,
+			Amount:       req.Amount,
+			Status:       credit.RepaymentSettled,
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.LedgerService.RecordCreditWalletRepayment(ctx, tx, farmerID, req.Amount, p.Reference); err != nil {
+			return err
+		}
+		description := fmt.Sprintf("Credit repayment for order %d", rc.OrderID)
+		if err := s.FarmerRepo.WithTx(tx).RecordWalletTransaction(ctx, farmerID, p.Reference, wallet_model.TransactionCreditRepayment, req.Amount, "settlement", description); err != nil {
+			return err
+		}
+		_, err = s.apply(ctx, tx, rc, req.Amount)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, nil, nil
+}
+
+// repayOnline records a pending repayment and charges it through the chosen channel
+func (s *CreditService) repayOnline(ctx context.Context, farmerID, receivableID int, req credit.RepaymentRequest) (*credit.Repayment, *payment_gateway.Instructions, error) {
+	// the gateway only charges whole rupiah
+	if req.Amount.Sen()%100 != 0 {
+		return nil, nil, fmt.Errorf("%w: online repayments must be a whole number of rupiah", ErrInvalidRepayment)
+	}
+	channel, err := s.Channels.Lookup(req.Channel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the repayment is recorded under the receivable lock before the charge is created, so the
+	// charge is always known when its notification arrives
+	var p *credit.Repayment
+	var description string
+	err = s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		rc, err := s.lockReceivable(ctx, tx, farmerID, receivableID)
+		if err != nil {
+			return err
+		}
+		if req.Amount > rc.Outstanding {
+			return fmt.Errorf("%w: only IDR %s is left to repay", ErrInvalidRepayment, rc.Outstanding)
+		}
+
+		description = fmt.Sprintf("credit repayment for order %d", rc.OrderID)
+		p, err = s.CreditRepo.WithTx(tx).CreateRepayment(ctx, &credit.Repayment{
+			ReceivableID: rc.ID,
+			FarmerID:     farmerID,
+			Reference:    repaymentReference(rc.ID),
+			Method:       credit.RepaymentOnline,
+			Channel:      &channel.Code,
+			Amount:       req.Amount,
+			Status:       credit.RepaymentPending,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := s.PaymentGateway.ChargeTransaction(s.Channels.ChargeRequest(channel, p.Reference, req.Amount.WholeRupiah(), description))
+	if err != nil {
+		if _, recordErr := s.CreditRepo.ResolveRepayment(ctx, p.ID, credit.RepaymentFailed); recordErr != nil {
+			return nil, nil, fmt.Errorf("failed to charge repayment: %v (and failed to record it: %v)", err, recordErr)
+		}
+		return nil, nil, fmt.Errorf("failed to charge repayment: %w", err)
+	}
+	return p, payment_gateway.InstructionsFor(channel, resp), nil
+}
+
+// GetRepayment returns one of the farmer's repayments, checking a pending online repayment at the gateway first
+func (s *CreditService) GetRepayment(ctx context.Context, farmerID, repaymentID int) (*credit.Repayment, error) {
+	p, err := s.CreditRepo.GetRepaymentByID(ctx, repaymentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRepaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.RequireOwner(farmerID, p.FarmerID, ErrRepaymentNotFound); err != nil {
+		return nil, err
+	}
+	if p.Status != credit.RepaymentPending {
+		return p, nil
+	}
+
+	resp, err := s.PaymentGateway.CheckTransaction(p.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch repayment status: %w", err)
+	}
+	if err := s.ProcessRepaymentStatus(ctx, p.Reference, resp.TransactionStatus); err != nil {
+		return nil, err
+	}
+	return s.CreditRepo.GetRepaymentByID(ctx, repaymentID)
+}
+
+// ProcessRepaymentStatus applies a gateway transaction status to a pending online repayment. Settlement is
+// applied to the receivable at most once; whatever exceeds what is still owed, because another repayment
+// settled first, is credited to the farmer's wallet.
+func (s *CreditService) ProcessRepaymentStatus(ctx context.Context, reference, transactionStatus string) error {
+	// unknown references surface as pgx.ErrNoRows
+	p, err := s.CreditRepo.GetRepaymentByReference(ctx, reference)
+	if err != nil {
+		return err
+	}
+
+	switch transactionStatus {
+	case "settlement", "capture":
+		return s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+			creditRepo := s.CreditRepo.WithTx(tx)
+			rc, err := creditRepo.GetReceivableForUpdate(ctx, p.ReceivableID)
+			if err != nil {
+				return err
+			}
+			resolved, err := creditRepo.ResolveRepayment(ctx, p.ID, credit.RepaymentSettled)
+			if err != nil || !resolved {
+				return err
+			}
+
+			applied, err := s.apply(ctx, tx, rc, p.Amount)
+			if err != nil {
+				return err
+			}
+			if applied.IsPositive() {
+				if err := s.LedgerService.RecordCreditOnlineRepayment(ctx, tx, applied, p.Reference); err != nil {
+					return err
+				}
+			}
+			excess := p.Amount - applied
+			if !excess.IsPositive() {
+				return nil
+			}
+			if err := s.LedgerService.RecordTopUp(ctx, tx, p.FarmerID, excess, p.Reference); err != nil {
+				return err
+			}
+			description := fmt.Sprintf("Credit repayment %s exceeded what was owed on order %d", p.Reference, rc.OrderID)
+			return s.FarmerRepo.WithTx(tx).RecordWalletTransaction(ctx, p.FarmerID, p.Reference, wallet_model.TransactionTopUp, excess, "settlement", description)
+		})
+	case "deny", "cancel", "expire", "failure":
+		_, err := s.CreditRepo.ResolveRepayment(ctx, p.ID, credit.RepaymentFailed)
+		return err
+	}
+	return nil
+}
+
+// ReduceReceivable takes up to amount off what is owed for a refunded order bought on credit inside tx, which
+// must hold the lock on the order. The last instalments are reduced first. It returns the amount taken off;
+// the rest of the refund was already repaid and goes back to the farmer some other way.
+func (s *CreditService) ReduceReceivable(ctx context.Context, tx pgx.Tx, orderID int, amount money.Money, refundReference string) (money.Money, error) {
+	creditRepo := s.CreditRepo.WithTx(tx)
+	rc, err := creditRepo.GetReceivableByOrderIDForUpdate(ctx, orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	reduction := min(amount, rc.Outstanding)
+	if !reduction.IsPositive() {
+		return 0, nil
+	}
+
+	instalments, err := creditRepo.ListInstalments(ctx, rc.ID)
+	if err != nil {
+		return 0, err
+	}
+	left := reduction
+	for i := len(instalments) - 1; i >= 0 && left.IsPositive(); i-- {
+		in := instalments[i]
+		cut := min(left, in.Amount-in.PaidAmount)
+		if !cut.IsPositive() {
+			continue
+		}
+		if err := creditRepo.UpdateInstalment(ctx, in.ID, in.Amount-cut, in.PaidAmount); err != nil {
+			return 0, err
+		}
+		left -= cut
+	}
+
+	if err := creditRepo.SetOutstanding(ctx, rc.ID, rc.Outstanding-reduction); err != nil {
+		return 0, err
+	}
+	if err := s.LedgerService.RecordCreditReduction(ctx, tx, reduction, refundReference); err != nil {
+		return 0, err
+	}
+	return reduction, nil
+}
+
+// OverdueReport lists unpaid instalments past their due date, of one farmer or of every farmer when farmerID is 0
+func (s *CreditService) OverdueReport(ctx context.Context, farmerID int) (*credit.OverdueReport, error) {
+	instalments, err := s.CreditRepo.GetOverdueInstalments(ctx, farmerID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &credit.OverdueReport{AsOf: time.Now(), Instalments: instalments}
+	farmers := map[int]bool{}
+	for _, in := range instalments {
+		report.TotalDue += in.AmountDue
+		farmers[in.FarmerID] = true
+	}
+	report.Farmers = len(farmers)
+	return report, nil
+}
+
+// repaymentReference returns a new reference for a repayment of the receivable, wallet and online alike.
+// Notifications are routed on the "credit" prefix, and the nanoseconds keep two repayments made in the
+// same second apart.
+func repaymentReference(receivableID int) string {
+	return fmt.Sprintf("credit-%d-%d", receivableID, time.Now().UnixNano())
+}
+
+// lockReceivable locks one of the farmer's open receivables inside tx
+func (s *CreditService) lockReceivable(ctx context.Context, tx pgx.Tx, farmerID, receivableID int) (*credit.Receivable, error) {
+	rc, err := s.CreditRepo.WithTx(tx).GetReceivableForUpdate(ctx, receivableID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrReceivableNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.RequireOwner(farmerID, rc.FarmerID, ErrReceivableNotFound); err != nil {
+		return nil, err
+	}
+	if rc.Status != credit.ReceivableOpen {
+		return nil, fmt.Errorf("%w: the receivable is already %s", ErrInvalidRepayment, rc.Status)
+	}
+	return rc, nil
+}
+
+// apply pays up to amount off a locked receivable, earliest instalment first, and returns the amount applied
+func (s *CreditService) apply(ctx context.Context, tx pgx.Tx, rc *credit.Receivable, amount money.Money) (money.Money, error) {
+	creditRepo := s.CreditRepo.WithTx(tx)
+	applied := min(amount, rc.Outstanding)
+	if !applied.IsPositive() {
+		return 0, nil
+	}
+
+	instalments, err := creditRepo.ListInstalments(ctx, rc.ID)
+	if err != nil {
+		return 0, err
+	}
+	left := applied
+	for _, in := range instalments {
+		if !left.IsPositive() {
+			break
+		}
+		pay := min(left, in.Amount-in.PaidAmount)
+		if !pay.IsPositive() {
+			continue
+		}
+		if err := creditRepo.UpdateInstalment(ctx, in.ID, in.Amount, in.PaidAmount+pay); err != nil {
+			return 0, err
+		}
+		left -= pay
+	}
+
+	if err := creditRepo.SetOutstanding(ctx, rc.ID, rc.Outstanding-applied); err != nil {
+		return 0, err
+	}
+	return applied, nil
+}
+
+// withFee adds the facility fee to principal and rounds the result up to whole rupiah,
+// so every instalment can also be paid through the gateway
+func withFee(principal money.Money, feeBps int) money.Money {
+	sen := ceilDiv(principal.Sen()*int64(10000+feeBps), 10000)
+	return money.FromSen(ceilDiv(sen, 100) * 100)
+}
+
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+// schedule splits a receivable into the facility's number of whole rupiah instalments, due at even intervals
+// over the tenor from the day of the purchase; the last instalment takes the remainder
+func schedule(rc *credit.Receivable, f *credit.Facility, purchased time.Time) []credit.Instalment {
+	day := time.Date(purchased.Year(), purchased.Month(), purchased.Day(), 0, 0, 0, 0, time.UTC)
+	each := money.FromRupiah(rc.Amount.WholeRupiah() / int64(f.Instalments))
+
+	instalments := make([]credit.Instalment, f.Instalments)
+	for i := range instalments {
+		instalments[i] = credit.Instalment{
+			ReceivableID: rc.ID,
+			Sequence:     i + 1,
+			DueDate:      day.AddDate(0, 0, f.TenorDays*(i+1)/f.Instalments),
+			Amount:       each,
+			Status:       credit.InstalmentDue,
+		}
+	}
+	instalments[len(instalments)-1].Amount = rc.Amount - each.Mul(f.Instalments-1)
+	return instalments
+}
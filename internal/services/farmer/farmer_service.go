@@ -1,39 +1,106 @@
 package services
 
 import (
-	"dgw-technical-test/internal/models/farmer"
+	domain "dgw-technical-test/internal/domain/order"
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
+	credit_model "dgw-technical-test/internal/models/credit"
+	payment_model "dgw-technical-test/internal/models/payment"
+	wallet_model "dgw-technical-test/internal/models/wallet"
+	"dgw-technical-test/internal/money"
 	farmer_repo "dgw-technical-test/internal/repositories/farmer"
-	product_repo "dgw-technical-test/internal/repositories/product"
+	ledger_repo "dgw-technical-test/internal/repositories/ledger"
+	log_repo "dgw-technical-test/internal/repositories/log"
 	order_repo "dgw-technical-test/internal/repositories/order"
+	payment_repo "dgw-technical-test/internal/repositories/payment"
+	product_repo "dgw-technical-test/internal/repositories/product"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
 	review_repo "dgw-technical-test/internal/repositories/review"
-
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	credit_service "dgw-technical-test/internal/services/credit"
+	hold_service "dgw-technical-test/internal/services/hold"
+	ledger_service "dgw-technical-test/internal/services/ledger"
+	policy "dgw-technical-test/internal/services/policy"
+	pricing_service "dgw-technical-test/internal/services/pricing"
+
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"time"
 
-	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/jackc/pgx/v5"
 
-	"github.com/midtrans/midtrans-go"
-	"github.com/midtrans/midtrans-go/coreapi"
 	"context"
-	"strings"	
+	"github.com/midtrans/midtrans-go/coreapi"
+	"strings"
+)
+
+var (
+	// ErrPaymentNotFound is returned when an order has no recorded online charge
+	ErrPaymentNotFound = errors.New("no online payment found for order")
+	// ErrWholeRupiahRequired is returned when a top-up amount has sen, which the gateway can't charge
+	ErrWholeRupiahRequired = errors.New("amount must be a whole number of rupiah")
+	// ErrOrderNotFound is returned when an order doesn't exist or belongs to another farmer
+	ErrOrderNotFound = policy.ErrOrderNotFound
+	// ErrTopUpNotFound is returned when a top-up doesn't exist or belongs to another farmer
+	ErrTopUpNotFound = policy.ErrTopUpNotFound
+	// ErrOrderNotReviewable is returned when a review is added to an order that isn't paid
+	ErrOrderNotReviewable = errors.New("reviews can only be added for paid orders")
+	// ErrInvalidSplit is returned when the wallet part of a split payment doesn't leave a whole rupiah remainder to charge online
+	ErrInvalidSplit = errors.New("invalid split payment")
+	// ErrChargePending is returned when an order gets a new charge while an earlier one may still be paid
+	ErrChargePending = errors.New("an earlier charge of the order is still pending")
+	// ErrChargeUnresolved is returned when the gateway couldn't say whether a pending charge was paid
+	ErrChargeUnresolved = errors.New("charge status unavailable")
 )
 
+// chargeCreationWindow is how long a recorded charge may be unknown to the gateway because its creation
+// is still in flight; after that the gateway not knowing it means it was never created
+const chargeCreationWindow = 5 * time.Minute
+
+// SplitPayment describes an order paid partly from the wallet and partly online
+type SplitPayment struct {
+	OrderID      int                           `json:"order_id"`
+	WalletAmount money.Money                   `json:"wallet_amount"` // held until the online part settles
+	OnlineAmount money.Money                   `json:"online_amount"`
+	Charge       *coreapi.ChargeResponse       `json:"charge,omitempty"`
+	Instructions *payment_gateway.Instructions `json:"instructions,omitempty"`
+}
+
 type FarmerService struct {
-	FarmerRepo  *farmer_repo.FarmerRepository
-	ProductRepo *product_repo.ProductRepository
-	OrderRepo   *order_repo.OrderRepository
-	ReviewRepo 	*review_repo.ReviewRepository
+	FarmerRepo      *farmer_repo.FarmerRepository
+	ProductRepo     *product_repo.ProductRepository
+	OrderRepo       *order_repo.OrderRepository
+	ReviewRepo      *review_repo.ReviewRepository
+	PaymentRepo     *payment_repo.PaymentRepository
+	ReservationRepo *reservation_repo.ReservationRepository
+	LogRepo         *log_repo.LogRepository
+	UnitOfWork      *unitofwork.UnitOfWork
+	PaymentGateway  payment_gateway.PaymentGateway
+	Channels        *payment_gateway.ChannelCatalog
+	LedgerService   *ledger_service.LedgerService
+	PricingService  *pricing_service.PricingService
+	Policy          *policy.OwnershipPolicy
+	HoldService     *hold_service.HoldService
+	CreditService   *credit_service.CreditService
 }
 
-func NewFarmerService(farmerRepo *farmer_repo.FarmerRepository, productRepo *product_repo.ProductRepository, orderRepo *order_repo.OrderRepository, reviewRepo *review_repo.ReviewRepository) *FarmerService {
+func NewFarmerService(farmerRepo *farmer_repo.FarmerRepository, productRepo *product_repo.ProductRepository, orderRepo *order_repo.OrderRepository, reviewRepo *review_repo.ReviewRepository, paymentRepo *payment_repo.PaymentRepository, reservationRepo *reservation_repo.ReservationRepository, logRepo *log_repo.LogRepository, unitOfWork *unitofwork.UnitOfWork, paymentGateway payment_gateway.PaymentGateway, channels *payment_gateway.ChannelCatalog, ledgerService *ledger_service.LedgerService, pricingService *pricing_service.PricingService, ownershipPolicy *policy.OwnershipPolicy, holdService *hold_service.HoldService, creditService *credit_service.CreditService) *FarmerService {
 	return &FarmerService{
-		FarmerRepo:  farmerRepo,
-		ProductRepo: productRepo,
-		OrderRepo:   orderRepo,
-		ReviewRepo:  reviewRepo,
+		FarmerRepo:      farmerRepo,
+		ProductRepo:     productRepo,
+		OrderRepo:       orderRepo,
+		ReviewRepo:      reviewRepo,
+		PaymentRepo:     paymentRepo,
+		ReservationRepo: reservationRepo,
+		LogRepo:         logRepo,
+		UnitOfWork:      unitOfWork,
+		PaymentGateway:  paymentGateway,
+		Channels:        channels,
+		LedgerService:   ledgerService,
+		PricingService:  pricingService,
+		Policy:          ownershipPolicy,
+		HoldService:     holdService,
+		CreditService:   creditService,
 	}
 }
 
@@ -42,55 +109,6 @@ func (s *FarmerService) RegisterFarmer(name, email, hashedPassword string) error
 	return s.FarmerRepo.CreateFarmer(name, email, hashedPassword)
 }
 
-// LoginFarmer logs in a farmer using email and password
-func (s *FarmerService) LoginFarmer(email, password string) (*models.Farmer, error) {
-	farmer, err := s.FarmerRepo.GetFarmerByEmail(email)
-	if err != nil {
-		return nil, err
-	}
-
-	// Compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(farmer.Password), []byte(password)); err != nil {
-		return nil, errors.New("invalid email or password")
-	}
-
-	// Generate the JWT token for the farmer
-	token, err := s.GenerateJWT(farmer)
-	if err != nil {
-		return nil, err
-	}
-
-	// Update the JWT token in the database
-	err = s.FarmerRepo.UpdateFarmerJWTToken(farmer.ID, token)
-	if err != nil {
-		return nil, err
-	}
-
-	// Return the farmer with the new JWT token
-	farmer.JWTToken = token
-	return farmer, nil
-}	
-
-// GenerateJWT generates a JWT token for the farmer
-func (s *FarmerService) GenerateJWT(farmer *models.Farmer) (string, error) {
-	// Fetch the secret key from environment variables
-    jwtSecret := os.Getenv("JWT_SECRET")
-    if jwtSecret == "" {
-        return "", fmt.Errorf("JWT_SECRET not set in environment variables")
-    }
-
-	claims := jwt.MapClaims{
-		"farmer_id":    farmer.ID,
-		"name":         farmer.Name,
-		"email":        farmer.Email,
-		"wallet_balance": farmer.WalletBalance,
-		"exp":          jwt.NewNumericDate(time.Now().Add(72 * time.Hour)),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(jwtSecret))
-	return tokenString, err
-}
-
 // IsFarmerRegistered checks if a farmer is registered by their ID
 func (s *FarmerService) IsFarmerRegistered(farmerID int) (bool, error) {
 	_, err := s.FarmerRepo.GetFarmerByID(farmerID)
@@ -112,7 +130,7 @@ func (s *FarmerService) GetFarmerIDByEmail(email string) (int, error) {
 }
 
 // GetFarmerWalletBalance retrieves the wallet balance of the farmer by their ID
-func (s *FarmerService) GetFarmerWalletBalance(farmerID int) (float64, error) {
+func (s *FarmerService) GetFarmerWalletBalance(farmerID int) (money.Money, error) {
 	walletBalance, err := s.FarmerRepo.GetFarmerWalletBalance(farmerID)
 	if err != nil {
 		return 0, err
@@ -120,207 +138,648 @@ func (s *FarmerService) GetFarmerWalletBalance(farmerID int) (float64, error) {
 	return walletBalance, nil
 }
 
-// transaction component for farmer
-var CoreAPI coreapi.Client
-
-func Init() {
-	// retrieve server key from .env
-	ServerKey := os.Getenv("MIDTRANS_SERVER_KEY")
+// TopUpWallet creates a charge through the chosen channel that credits the farmer's wallet once the farmer pays it
+func (s *FarmerService) TopUpWallet(farmerID int, amount money.Money, farmerName, channelCode string) (string, string, *payment_gateway.Instructions, error) {
+	// the gateway only charges whole rupiah, so the credited amount must be one
+	if amount.Sen()%100 != 0 {
+		return "", "", nil, ErrWholeRupiahRequired
+	}
 
-	CoreAPI = coreapi.Client{}
-	CoreAPI.New(ServerKey, midtrans.Sandbox)
-}
+	channel, err := s.Channels.Lookup(channelCode)
+	if err != nil {
+		return "", "", nil, err
+	}
 
-// WithdrawMoney handles the process of withdrawing funds for a farmer
-func (s *FarmerService) WithdrawMoney(farmerID int, amount float64, farmerName string) (string, string, string, error) {
 	// Generate order ID
-	orderID := fmt.Sprintf("wd-%d-%d", farmerID, time.Now().Unix())
+	orderID := fmt.Sprintf("topup-%d-%d", farmerID, time.Now().Unix())
 
 	// Generate Customer Field Value
-	customFieldValue := fmt.Sprintf("facilitating withdraw request for %s", farmerName)
+	customFieldValue := fmt.Sprintf("facilitating wallet top-up for %s", farmerName)
 
-	// Create a Midtrans charge request
-	request := &coreapi.ChargeReq{
-		PaymentType: coreapi.PaymentTypeBankTransfer,
-		TransactionDetails: midtrans.TransactionDetails{
-			OrderID:  orderID,
-			GrossAmt: int64(amount), // Midtrans uses IDR natively
-		},
-		BankTransfer: &coreapi.BankTransferDetails{
-			Bank: midtrans.BankBca, // Use a specific bank for withdrawals
-		},
-		CustomField1: &customFieldValue,
-	}
+	// Create a Midtrans charge request for the chosen channel
+	request := s.Channels.ChargeRequest(channel, orderID, amount.WholeRupiah(), customFieldValue) // Midtrans uses IDR natively
 
-	// Send the charge request to Midtrans
-	resp, err := CoreAPI.ChargeTransaction(request)
+	// Send the charge request to the payment gateway
+	resp, err := s.PaymentGateway.ChargeTransaction(request)
 	if err != nil {
-		return "", "", "", fmt.Errorf("Failed to process withdrawal: %v", err)
-	}
-
-	// Check if VA numbers exist
-	var vaNumber string
-	if len(resp.VaNumbers) > 0 {
-		vaNumber = resp.VaNumbers[0].VANumber // Get the first VA number
-	} else {
-		vaNumber = "No virtual account number available" // Fallback if no VA is provided
+		return "", "", nil, fmt.Errorf("Failed to process top-up: %v", err)
 	}
 
 	// Log the transaction in the wallet_transactions table
-	description := fmt.Sprintf("Withdrawal initiated for %s", farmerName)
-	if err := s.FarmerRepo.LogWalletTransaction(farmerID, orderID, amount, description); err != nil {
-		return "", "", "", fmt.Errorf("Failed to log transaction: %v", err)
+	description := fmt.Sprintf("Wallet top-up initiated for %s via %s", farmerName, channel.Name)
+	if err := s.FarmerRepo.LogTopUpTransaction(farmerID, orderID, amount, description); err != nil {
+		return "", "", nil, fmt.Errorf("Failed to log transaction: %v", err)
 	}
 
-	return resp.TransactionID, resp.OrderID, vaNumber, nil
+	return resp.TransactionID, resp.OrderID, payment_gateway.InstructionsFor(channel, resp), nil
 }
 
-// CheckWithdrawalStatus checks the withdrawal status and updates the farmer's wallet if successful
-func (s *FarmerService) CheckWithdrawalStatus(orderID string) (map[string]interface{}, error) {
-	resp , err := CoreAPI.CheckTransaction(orderID)
+// CheckTopUpStatus checks one of the farmer's top-up charges at the gateway and credits the wallet if it settled
+func (s *FarmerService) CheckTopUpStatus(ctx context.Context, farmerID int, orderID string) (map[string]interface{}, error) {
+	if err := s.Policy.AuthorizeTopUp(ctx, farmerID, orderID); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.PaymentGateway.CheckTransaction(orderID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch transaction status: %v", err)
 	}
 
-	// If the transaction is successful (settlement), update the wallet balance
-	if resp.TransactionStatus == "settlement" {
-		// Get the withdrawal amount
-		amount, err := s.FarmerRepo.GetWithdrawalAmount(orderID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch withdrawal amount: %v", err)
-		}
+	// Apply the gateway status to the wallet transaction
+	if err := s.ProcessWalletTransactionStatus(ctx, orderID, resp.TransactionStatus); err != nil {
+		return nil, err
+	}
 
-		// Get the farmer ID associated with this order
-		farmerID, err := s.FarmerRepo.GetFarmerIDByOrderID(orderID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch farmer ID: %v", err)
-		}
+	// Return the updated status of the transaction
+	return map[string]interface{}{"transaction_status": resp.TransactionStatus}, nil
+}
 
-		// Update the farmer's wallet balance
-		err = s.FarmerRepo.UpdateFarmerWalletBalance(farmerID, amount)
-		if err != nil {
-			return nil, fmt.Errorf("failed to update wallet balance: %v", err)
-		}
+// ProcessWalletTransactionStatus applies a gateway transaction status to a pending wallet top-up.
+// Settlement is a conditional pending -> settlement transition committed together with the ledger credit,
+// so repeated polls, notifications and retries credit the wallet at most once.
+func (s *FarmerService) ProcessWalletTransactionStatus(ctx context.Context, orderID, transactionStatus string) error {
+	// unknown order IDs surface as pgx.ErrNoRows
+	if _, err := s.FarmerRepo.GetWalletTransactionStatus(ctx, orderID); err != nil {
+		return fmt.Errorf("failed to fetch wallet transaction: %w", err)
+	}
 
-		// Mark the transaction as processed
-		err = s.FarmerRepo.MarkTransactionAsProcessed(orderID)
+	switch transactionStatus {
+	case "settlement":
+		err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+			farmerID, amount, settled, err := s.FarmerRepo.WithTx(tx).SettleWalletTransaction(ctx, orderID, wallet_model.TransactionTopUp)
+			if err != nil || !settled {
+				// already settled or failed by an earlier call
+				return err
+			}
+
+			// the ledger reference is the gateway order ID, a second credit for it is refused
+			err = s.LedgerService.RecordTopUp(ctx, tx, farmerID, amount, orderID)
+			if errors.Is(err, ledger_repo.ErrDuplicateEntry) {
+				return nil
+			}
+			return err
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to mark transaction as processed: %v", err)
+			return fmt.Errorf("failed to credit wallet: %w", err)
+		}
+	case "deny", "cancel", "expire", "failure":
+		// the farmer never paid, so the transaction can no longer settle
+		if err := s.FarmerRepo.MarkTransactionAsFailed(ctx, orderID, wallet_model.TransactionTopUp); err != nil {
+			return fmt.Errorf("failed to mark transaction as failed: %v", err)
 		}
 	}
 
-	// Return the updated status of the transaction
-	return map[string]interface{}{"transaction_status": resp.TransactionStatus}, nil
+	return nil
 }
 
 // process wallet payment for farmers
 func (s *FarmerService) ProcessWalletPayment(ctx context.Context, farmerID, orderID int) error {
-	// Process the order payment
-	err := s.FarmerRepo.ProcessOrder(ctx, fmt.Sprintf("%d", orderID), farmerID)
+	// Settle the order, debit the wallet through the ledger and take its stock in one transaction
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		return s.PayOrderWithWallet(ctx, tx, farmerID, orderID)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to process order: %v", err)
+		return fmt.Errorf("failed to process order: %w", err)
 	}
 
 	// return no error because there appears to be no error :)
 	return nil
 }
 
-// prepare online statement
-func (s *FarmerService) PrepareOnlinePayment(ctx context.Context, orderID int) (float64, []string, error) {
-    // Fetch the order to calculate total cost and prepare item descriptions
-    order, err := s.OrderRepo.GetOrderById(ctx, orderID)
-    if err != nil {
-        return 0, nil, err
-    }
-
-    var itemDescriptions []string
-    totalCost := 0.0
-
-    for _, item := range order.Items {
-		product, err := s.ProductRepo.GetProductByID(ctx, item.ProductID)
-        if err != nil {
-            return 0, nil, err
-        }
-        itemDescription := fmt.Sprintf("%s x%d", product.Name, item.Quantity)
-        itemDescriptions = append(itemDescriptions, itemDescription)
-        totalCost += product.Price * float64(item.Quantity)
-    }
-
-    return totalCost, itemDescriptions, nil
+// PayOrderWithWallet pays a farmer's order from their wallet inside tx: the order moves to paid, the wallet
+// is debited through the ledger and the order's stock is taken. Money held for a split payment of the order
+// goes back to the wallet first, so the whole order is paid from it. It fails with ledger_repo.ErrInsufficientFunds
+// when the balance is too low and ErrOrderNotFound when the order belongs to another farmer.
+func (s *FarmerService) PayOrderWithWallet(ctx context.Context, tx pgx.Tx, farmerID, orderID int) error {
+	farmerRepo := s.FarmerRepo.WithTx(tx)
+	orderRepo := s.OrderRepo.WithTx(tx)
+
+	order, err := orderRepo.GetOrderForUpdate(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := policy.RequireOwner(farmerID, order.FarmerID, ErrOrderNotFound); err != nil {
+		return err
+	}
+
+	// only pending and awaiting_payment orders can move to paid
+	if err := orderRepo.TransitionOrder(ctx, orderID, domain.StatusPaid, domain.FarmerActor(farmerID), "paid by wallet"); err != nil {
+		return err
+	}
+	if err := orderRepo.SetPaymentMethod(ctx, orderID, "wallet"); err != nil {
+		return err
+	}
+
+	if _, err := s.HoldService.ReleaseOrderHold(ctx, tx, orderID); err != nil {
+		return err
+	}
+
+	totalCost := order.TotalPrice
+	if err := s.LedgerService.RecordOrderPayment(ctx, tx, farmerID, orderID, totalCost); err != nil {
+		return err
+	}
+	description := fmt.Sprintf("Wallet payment for order %d", orderID)
+	if err := farmerRepo.RecordWalletTransaction(ctx, farmerID, fmt.Sprintf("order-%d", orderID), wallet_model.TransactionPayment, totalCost, "settlement", description); err != nil {
+		return err
+	}
+	return s.takeOrderStock(ctx, tx, orderID)
+}
+
+// ProcessCreditPayment pays one of the farmer's unpaid orders on credit
+func (s *FarmerService) ProcessCreditPayment(ctx context.Context, farmerID, orderID int) (*credit_model.Receivable, error) {
+	var receivable *credit_model.Receivable
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		var err error
+		receivable, err = s.PayOrderOnCredit(ctx, tx, farmerID, orderID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receivable, nil
+}
+
+// PayOrderOnCredit pays a farmer's order from their credit facility inside tx: the order moves to paid, the
+// receivable and its instalments are recorded and the order's stock is taken. Money held for a split payment
+// of the order goes back to the wallet first. It fails with the credit service errors when the facility doesn't
+// cover the order and ErrOrderNotFound when the order belongs to another farmer.
+func (s *FarmerService) PayOrderOnCredit(ctx context.Context, tx pgx.Tx, farmerID, orderID int) (*credit_model.Receivable, error) {
+	orderRepo := s.OrderRepo.WithTx(tx)
+
+	order, err := orderRepo.GetOrderForUpdate(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.RequireOwner(farmerID, order.FarmerID, ErrOrderNotFound); err != nil {
+		return nil, err
+	}
+
+	// only pending and awaiting_payment orders can move to paid
+	if err := orderRepo.TransitionOrder(ctx, orderID, domain.StatusPaid, domain.FarmerActor(farmerID), "bought on credit"); err != nil {
+		return nil, err
+	}
+	if err := orderRepo.SetPaymentMethod(ctx, orderID, "credit"); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.HoldService.ReleaseOrderHold(ctx, tx, orderID); err != nil {
+		return nil, err
+	}
+
+	receivable, err := s.CreditService.OpenReceivable(ctx, tx, farmerID, orderID, order.TotalPrice)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.takeOrderStock(ctx, tx, orderID); err != nil {
+		return nil, err
+	}
+	return receivable, nil
+}
+
+// PrepareOnlinePayment prices one of the farmer's unpaid orders for an online charge at the prices stored
+// when it was placed, less the wallet money held for a split payment of the order.
+// An order that can't be paid any more fails with domain.ErrIllegalTransition.
+func (s *FarmerService) PrepareOnlinePayment(ctx context.Context, farmerID, orderID int) (money.Money, []string, error) {
+	if err := s.Policy.AuthorizeOrder(ctx, farmerID, orderID); err != nil {
+		return 0, nil, err
+	}
+
+	// Fetch the order to calculate total cost and prepare item descriptions
+	order, err := s.OrderRepo.GetOrderById(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil, fmt.Errorf("%w: order %d is no longer awaiting payment", domain.ErrIllegalTransition, orderID)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	quote, err := s.PricingService.QuoteOrder(ctx, order)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// a new charge for a split payment only covers what the wallet doesn't
+	held, err := s.HoldService.ActiveHold(ctx, nil, orderID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if held != nil {
+		return quote.Total - held.Amount, quote.Descriptions, nil
+	}
+	return quote.Total, quote.Descriptions, nil
+}
+
+// PayOrderSplit pays one of the farmer's unpaid orders partly from the wallet and charges the rest through the
+// chosen channel. The wallet part is held at once and only taken when the online charge settles; it goes back
+// to the wallet when the charge fails at the gateway or the order expires or is cancelled. When the charge
+// can't be created the hold stays, and /farmers/pay-order/online charges the remainder again.
+func (s *FarmerService) PayOrderSplit(ctx context.Context, farmerID, orderID int, walletAmount money.Money, channelCode string) (*SplitPayment, error) {
+	// refuse an unavailable channel before any money is held
+	if _, err := s.Channels.Lookup(channelCode); err != nil {
+		return nil, err
+	}
+
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		return s.HoldOrderFunds(ctx, tx, farmerID, orderID, walletAmount)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	remainder, descriptions, err := s.PrepareOnlinePayment(ctx, farmerID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	result := &SplitPayment{OrderID: orderID, WalletAmount: walletAmount, OnlineAmount: remainder}
+	result.Charge, result.Instructions, err = s.ExecuteOnlinePayment(ctx, farmerID, orderID, channelCode, remainder, descriptions)
+	if err != nil {
+		return result, err
+	}
+	return result, nil
 }
 
-// execute online statement for the farmer
-func (s *FarmerService) ExecuteOnlinePayment(orderID int, totalCost float64, description []string) (*coreapi.ChargeResponse, error) {
+// HoldOrderFunds holds walletAmount of the farmer's wallet for the split payment of one of their unpaid orders
+// inside tx. The amount must leave a whole rupiah remainder for the gateway; it fails with ErrInvalidSplit
+// otherwise, with ledger_repo.ErrInsufficientFunds when the balance is too low and hold_service.ErrHoldExists
+// when money is already held for the order.
+func (s *FarmerService) HoldOrderFunds(ctx context.Context, tx pgx.Tx, farmerID, orderID int, walletAmount money.Money) error {
+	order, err := s.OrderRepo.WithTx(tx).GetOrderForUpdate(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := policy.RequireOwner(farmerID, order.FarmerID, ErrOrderNotFound); err != nil {
+		return err
+	}
+	if !order.Status.AwaitsPayment() {
+		return domain.ValidateTransition(orderID, order.Status, domain.StatusPaid)
+	}
+	// a charge that may still be paid covers the whole order, holding wallet money as well would take too much
+	if err := s.RequireNoPendingCharge(ctx, tx, orderID); err != nil {
+		return err
+	}
+
+	remainder := order.TotalPrice - walletAmount
+	if !walletAmount.IsPositive() || !remainder.IsPositive() {
+		return fmt.Errorf("%w: the wallet part must be more than zero and less than the order total %s", ErrInvalidSplit, order.TotalPrice)
+	}
+	if remainder.Sen()%100 != 0 {
+		return fmt.Errorf("%w: the online part %s must be a whole number of rupiah", ErrInvalidSplit, remainder)
+	}
+
+	_, err = s.HoldService.HoldOrderFunds(ctx, tx, farmerID, orderID, walletAmount)
+	return err
+}
+
+// execute online statement for the farmer through the chosen channel (DefaultChannel when empty); every charge
+// attempt is recorded in the payments table and a pending order moves to awaiting_payment once its first charge is created.
+// An order whose earlier charge may still be paid gets no second charge and fails with ErrChargePending.
+func (s *FarmerService) ExecuteOnlinePayment(ctx context.Context, farmerID, orderID int, channelCode string, totalCost money.Money, description []string) (*coreapi.ChargeResponse, *payment_gateway.Instructions, error) {
+	channel, err := s.Channels.Lookup(channelCode)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	orderIDStr := fmt.Sprintf("store-%d-%d", orderID, time.Now().Unix())
 	descriptionStr := strings.Join(description, ", ")
 
-    req := &coreapi.ChargeReq{
-        PaymentType: coreapi.PaymentTypeBankTransfer,
-        TransactionDetails: midtrans.TransactionDetails{
-            OrderID:  orderIDStr,
-            GrossAmt: int64(totalCost),
-        },
-        BankTransfer: &coreapi.BankTransferDetails{
-            Bank: midtrans.BankBca,
-        },
-        CustomField1: &descriptionStr,
-    }
-
-    response, err := CoreAPI.ChargeTransaction(req)
-    if err != nil {
-        return nil, err
-    }
-
-    return response, nil
+	// Midtrans only charges whole rupiah, sen are rounded half away from zero
+	req := s.Channels.ChargeRequest(channel, orderIDStr, totalCost.WholeRupiah(), descriptionStr)
+
+	payment := &payment_model.Payment{
+		OrderID:        orderID,
+		GatewayOrderID: orderIDStr,
+		Channel:        channel.Code,
+		PaymentType:    string(req.PaymentType),
+		Amount:         totalCost,
+		Status:         "pending",
+	}
+
+	// the attempt is recorded under the order lock before the charge is created, so a concurrent
+	// request for the same order finds it and doesn't charge the farmer a second time
+	err = s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		order, err := s.OrderRepo.WithTx(tx).GetOrderForUpdate(ctx, orderID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !order.Status.AwaitsPayment() {
+			return domain.ValidateTransition(orderID, order.Status, domain.StatusAwaitingPayment)
+		}
+		if err := s.RequireNoPendingCharge(ctx, tx, orderID); err != nil {
+			return err
+		}
+		payment.ID, err = s.PaymentRepo.WithTx(tx).CreatePayment(ctx, payment)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response, err := s.PaymentGateway.ChargeTransaction(req)
+	if err != nil {
+		// keep a trace of the rejected attempt before reporting the error
+		raw, _ := json.Marshal(map[string]string{"error": err.Error()})
+		if recordErr := s.PaymentRepo.UpdatePaymentStatus(ctx, payment.ID, "failed", raw); recordErr != nil {
+			return nil, nil, fmt.Errorf("%v (and failed to record payment: %v)", err, recordErr)
+		}
+		return nil, nil, err
+	}
+
+	instructions := payment_gateway.InstructionsFor(channel, response)
+	payment.TransactionID = response.TransactionID
+	payment.Status = response.TransactionStatus
+	payment.Bank = instructions.Bank
+	payment.VANumber = instructions.VANumber
+	payment.RawResponse, _ = json.Marshal(response)
+
+	if err := s.PaymentRepo.RecordCharge(ctx, payment); err != nil {
+		return nil, nil, fmt.Errorf("failed to record payment: %w", err)
+	}
+
+	// the charge is recorded first so it is known even when the order changed in the meantime
+	err = s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		orderRepo := s.OrderRepo.WithTx(tx)
+		order, err := orderRepo.GetOrderForUpdate(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		// a new charge for an order already awaiting payment keeps it there
+		if order.Status != domain.StatusPending || response.TransactionStatus != "pending" {
+			return nil
+		}
+		return orderRepo.TransitionOrder(ctx, orderID, domain.StatusAwaitingPayment, domain.FarmerActor(farmerID), fmt.Sprintf("online charge %s created", orderIDStr))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return response, instructions, nil
+}
+
+// RequireNoPendingCharge fails with ErrChargePending while a charge of the order may still be paid; lock the order first
+func (s *FarmerService) RequireNoPendingCharge(ctx context.Context, tx pgx.Tx, orderID int) error {
+	_, err := s.PaymentRepo.WithTx(tx).GetPendingPaymentByOrderID(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrChargePending
+}
+
+// CheckOrderPaymentStatus resolves the latest charge of one of the farmer's orders server-side, fetches its gateway status and applies it
+func (s *FarmerService) CheckOrderPaymentStatus(ctx context.Context, farmerID, orderID int) (*coreapi.TransactionStatusResponse, error) {
+	if err := s.Policy.AuthorizeOrder(ctx, farmerID, orderID); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.PaymentRepo.GetLatestPaymentByOrderID(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.CheckTransaction(payment.GatewayOrderID)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, _ := json.Marshal(resp)
+	if err := s.ProcessPaymentStatus(ctx, payment.GatewayOrderID, resp.TransactionStatus, raw); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// ProcessPaymentStatus records a gateway status on a charge attempt and applies it to the order the charge pays for
+func (s *FarmerService) ProcessPaymentStatus(ctx context.Context, gatewayOrderID, transactionStatus string, rawResponse []byte) error {
+	return s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		payment, err := s.PaymentRepo.WithTx(tx).GetPaymentByGatewayOrderID(ctx, gatewayOrderID)
+		if err != nil {
+			return err
+		}
+		return s.recordPaymentStatus(ctx, tx, payment, transactionStatus, rawResponse)
+	})
+}
+
+// SettlePendingCharge asks the gateway about the latest unresolved charge of an order and applies its status,
+// so a charge paid just before the payment deadline pays the order instead of landing on an expired one.
+// The gateway is asked before any row is locked. A charge the gateway doesn't know is failed once it is older
+// than chargeCreationWindow, as nothing can pay it. It reports whether the order is paid afterwards; when
+// the gateway can't tell, it fails with ErrChargeUnresolved.
+func (s *FarmerService) SettlePendingCharge(ctx context.Context, orderID int) (bool, error) {
+	payment, err := s.PaymentRepo.GetPendingPaymentByOrderID(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var status string
+	var raw []byte
+	resp, err := s.PaymentGateway.CheckTransaction(payment.GatewayOrderID)
+	switch {
+	case errors.Is(err, payment_gateway.ErrTransactionNotFound) && time.Since(payment.CreatedAt) > chargeCreationWindow:
+		status = "failure"
+		raw, _ = json.Marshal(map[string]string{"error": err.Error()})
+	case err != nil:
+		return false, fmt.Errorf("%w: %v", ErrChargeUnresolved, err)
+	default:
+		status = resp.TransactionStatus
+		raw, _ = json.Marshal(resp)
+	}
+	if err := s.ProcessPaymentStatus(ctx, payment.GatewayOrderID, status, raw); err != nil {
+		return false, err
+	}
+
+	orderStatus, err := s.OrderRepo.GetOrderStatus(ctx, orderID)
+	if err != nil {
+		return false, fmt.Errorf("service failed to get order status: %w", err)
+	}
+	return orderStatus.IsPaid(), nil
 }
 
-// CheckIfOrderIsProcessed checks if a specific order has already been processed
-func (s *FarmerService) CheckIfOrderIsProcessed(ctx context.Context, orderID int) (bool, error) {
-	isProcessed, err := s.OrderRepo.CheckOrderProcessed(ctx, orderID)
+// CancelPendingCharge cancels the latest unresolved charge of an order at the gateway, so it can't be paid
+// any more, and then applies the charge's status like SettlePendingCharge. A charge that settled before it
+// could be cancelled pays the order instead; it reports whether the order is paid afterwards.
+func (s *FarmerService) CancelPendingCharge(ctx context.Context, orderID int) (bool, error) {
+	payment, err := s.PaymentRepo.GetPendingPaymentByOrderID(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// a refused cancellation means the charge settled or ended already, the status check tells which
+	_, err = s.PaymentGateway.CancelTransaction(payment.GatewayOrderID)
+	if err != nil && !errors.Is(err, payment_gateway.ErrRejected) {
+		return false, fmt.Errorf("%w: %v", ErrChargeUnresolved, err)
+	}
+	return s.SettlePendingCharge(ctx, orderID)
+}
+
+// recordPaymentStatus stores a gateway status on a charge attempt and applies it to its order inside tx
+func (s *FarmerService) recordPaymentStatus(ctx context.Context, tx pgx.Tx, payment *payment_model.Payment, transactionStatus string, rawResponse []byte) error {
+	if err := s.PaymentRepo.WithTx(tx).UpdatePaymentStatus(ctx, payment.ID, transactionStatus, rawResponse); err != nil {
+		return err
+	}
+	return s.applyOrderPaymentStatus(ctx, tx, payment, transactionStatus)
+}
+
+// GetOrderStatus returns the current status of one of the farmer's orders
+func (s *FarmerService) GetOrderStatus(ctx context.Context, farmerID, orderID int) (domain.Status, error) {
+	if err := s.Policy.AuthorizeOrder(ctx, farmerID, orderID); err != nil {
+		return "", err
+	}
+
+	status, err := s.OrderRepo.GetOrderStatus(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrOrderNotFound
+	}
 	if err != nil {
-		return false, fmt.Errorf("service failed to check if order is processed: %v", err)
+		return "", fmt.Errorf("service failed to get order status: %w", err)
 	}
-	return isProcessed, nil
+	return status, nil
 }
 
 // CheckTransaction checks the status of a transaction by order ID
 func (s *FarmerService) CheckTransaction(orderID string) (*coreapi.TransactionStatusResponse, error) {
-	resp, err := CoreAPI.CheckTransaction(orderID)
+	resp, err := s.PaymentGateway.CheckTransaction(orderID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to check transaction: %v", err)
 	}
 	return resp, nil
 }
 
-// UpdateOrderStatus updates the order status for an order id
-func (s *FarmerService) UpdateOrderStatus(ctx context.Context, orderID int, status string) error {
-	// Call the repository function to update the order status
-	err := s.OrderRepo.UpdateOrderStatus(ctx, orderID, status)
+// applyOrderPaymentStatus applies the gateway status of one of an order's charges to the order inside tx.
+// Settlement moves the order to paid, takes its stock, captures the wallet part of a split payment and records
+// the payment method together; the last pending charge failing sends an order awaiting payment back to pending
+// so it can be paid again, and returns the wallet part of a split payment to the wallet.
+func (s *FarmerService) applyOrderPaymentStatus(ctx context.Context, tx pgx.Tx, payment *payment_model.Payment, transactionStatus string) error {
+	orderRepo := s.OrderRepo.WithTx(tx)
+	orderID, gatewayOrderID, amount := payment.OrderID, payment.GatewayOrderID, payment.Amount
+
+	// lock the order so concurrent polls and notifications settle it only once
+	order, err := orderRepo.GetOrderForUpdate(ctx, orderID)
 	if err != nil {
-		return fmt.Errorf("error updating order status: %v", err)
+		return fmt.Errorf("service failed to lock order: %w", err)
 	}
-	return nil
-}
+	reason := fmt.Sprintf("payment gateway reported %s for charge %s", transactionStatus, gatewayOrderID)
+
+	switch transactionStatus {
+	case "settlement", "capture":
+		if !order.Status.AwaitsPayment() {
+			// repeated notifications of the charge that paid the order are expected, anything else, including
+			// a second charge of an order another charge already paid, means money arrived for an order that
+			// can't take it and has to be returned by hand
+			applied, err := s.PaymentRepo.WithTx(tx).GetAppliedPaymentByOrderID(ctx, orderID)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return err
+			}
+			if err == nil && applied.ID == payment.ID {
+				return nil
+			}
+			details := fmt.Sprintf("Charge %s settled for order ID %d which is %s, refund the farmer manually", gatewayOrderID, orderID, order.Status)
+			return s.LogRepo.WithTx(tx).LogSystemAction(ctx, "Unexpected Payment", details)
+		}
 
-// MarkOrderAsProcessed marks an order as processed in the database
-func (s *FarmerService) MarkOrderAsProcessed(ctx context.Context, orderID int) error {
-	err := s.OrderRepo.MarkOrderAsProcessed(ctx, orderID)
-	if err != nil {
-		return fmt.Errorf("service failed to mark order as processed: %v", err)
+		held, err := s.HoldService.ActiveHold(ctx, tx, orderID)
+		if err != nil {
+			return err
+		}
+		paid := amount
+		if held != nil {
+			paid += held.Amount
+		}
+		if paid < order.TotalPrice {
+			// a remainder charge whose wallet part was already released doesn't pay the order
+			details := fmt.Sprintf("Charge %s of %s settled for order ID %d of %s without enough wallet money held, refund the farmer manually", gatewayOrderID, amount, orderID, order.TotalPrice)
+			return s.LogRepo.WithTx(tx).LogSystemAction(ctx, "Unexpected Payment", details)
+		}
+
+		if err := orderRepo.TransitionOrder(ctx, orderID, domain.StatusPaid, domain.SystemActor(), reason); err != nil {
+			return err
+		}
+		if err := s.PaymentRepo.WithTx(tx).MarkPaymentApplied(ctx, payment.ID); err != nil {
+			return err
+		}
+
+		// update store quantity after settlement
+		if err := s.takeOrderStock(ctx, tx, orderID); err != nil {
+			return err
+		}
+
+		paymentMethod := "online"
+		if held != nil {
+			if _, err := s.HoldService.CaptureOrderHold(ctx, tx, orderID); err != nil {
+				return err
+			}
+			paymentMethod = "split"
+		}
+		if err := orderRepo.SetPaymentMethod(ctx, orderID, paymentMethod); err != nil {
+			return fmt.Errorf("service failed to set payment method: %w", err)
+		}
+	case "deny", "cancel", "expire", "failure":
+		if order.Status != domain.StatusAwaitingPayment {
+			return nil
+		}
+		// the payment row is already updated, so a charge still pending is a newer one that can pay the
+		// order and keeps it awaiting payment together with the hold
+		_, err := s.PaymentRepo.WithTx(tx).GetPendingPaymentByOrderID(ctx, orderID)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if err := orderRepo.TransitionOrder(ctx, orderID, domain.StatusPending, domain.SystemActor(), reason); err != nil {
+			return err
+		}
+		_, err = s.HoldService.ReleaseOrderHold(ctx, tx, orderID)
+		return err
 	}
 	return nil
 }
 
-// update store quantity after transaction reaches settlement status
-func (s *FarmerService) UpdateStoreQuantity(ctx context.Context, orderID int) error {
-	err := s.OrderRepo.UpdateStoreQuantity(ctx, orderID)
+// takeOrderStock removes the stock of a paid order inside tx: reserved quantities are consumed first and
+// anything not covered by an unexpired reservation is taken from unreserved stock
+func (s *FarmerService) takeOrderStock(ctx context.Context, tx pgx.Tx, orderID int) error {
+	consumed, err := s.ReservationRepo.WithTx(tx).ConsumeOrderReservations(ctx, orderID)
 	if err != nil {
-		return fmt.Errorf("service failed to update store quantity: %v", err)
+		return fmt.Errorf("service failed to consume stock reservations: %w", err)
+	}
+
+	if err := s.OrderRepo.WithTx(tx).UpdateStoreQuantity(ctx, orderID, consumed); err != nil {
+		return fmt.Errorf("service failed to update store quantity: %w", err)
 	}
 	return nil
 }
 
-// AddReview allows a farmer to add a review for an order
+// AddReview allows a farmer to add a review for one of their orders once it was paid
 func (s *FarmerService) AddReview(ctx context.Context, orderID, farmerID, rating int, comment string) error {
-    return s.ReviewRepo.CreateReview(ctx, orderID, farmerID, rating, comment, "pending")
-}
\ No newline at end of file
+	status, err := s.GetOrderStatus(ctx, farmerID, orderID)
+	if err != nil {
+		return err
+	}
+	if !status.IsPaid() {
+		return ErrOrderNotReviewable
+	}
+
+	return s.ReviewRepo.CreateReview(ctx, orderID, farmerID, rating, comment, "pending")
+}
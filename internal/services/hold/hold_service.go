@@ -0,0 +1,119 @@
+package services
+
+import (
+	hold "dgw-technical-test/internal/models/hold"
+	wallet_model "dgw-technical-test/internal/models/wallet"
+	"dgw-technical-test/internal/money"
+	farmer_repo "dgw-technical-test/internal/repositories/farmer"
+	hold_repo "dgw-technical-test/internal/repositories/hold"
+	ledger_service "dgw-technical-test/internal/services/ledger"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrHoldExists is returned when wallet money is already held for the order
+var ErrHoldExists = errors.New("wallet funds are already held for this order")
+
+// HoldService holds the wallet part of split payments. The held money leaves the wallet at once,
+// then goes to sales when the order is paid or back to the wallet when the order isn't.
+// Methods that change a hold take the caller's transaction, which must hold the lock on the order.
+type HoldService struct {
+	HoldRepo      *hold_repo.HoldRepository
+	FarmerRepo    *farmer_repo.FarmerRepository
+	LedgerService *ledger_service.LedgerService
+}
+
+func NewHoldService(holdRepo *hold_repo.HoldRepository, farmerRepo *farmer_repo.FarmerRepository, ledgerService *ledger_service.LedgerService) *HoldService {
+	return &HoldService{
+		HoldRepo:      holdRepo,
+		FarmerRepo:    farmerRepo,
+		LedgerService: ledgerService,
+	}
+}
+
+// ActiveHold returns the active hold of an order, nil when it has none; tx is nil outside a transaction
+func (s *HoldService) ActiveHold(ctx context.Context, tx pgx.Tx, orderID int) (*hold.Hold, error) {
+	h, err := s.repo(tx).GetActiveHold(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return h, err
+}
+
+// HoldOrderFunds moves amount from the farmer's wallet into order holding and logs it as a pending
+// wallet payment. It fails with ErrInsufficientFunds when the balance is too low.
+func (s *HoldService) HoldOrderFunds(ctx context.Context, tx pgx.Tx, farmerID, orderID int, amount money.Money) (*hold.Hold, error) {
+	existing, err := s.ActiveHold(ctx, tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrHoldExists
+	}
+
+	reference := fmt.Sprintf("hold-%d-%d", orderID, time.Now().UnixNano())
+	h, err := s.repo(tx).CreateHold(ctx, orderID, farmerID, reference, amount)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.LedgerService.RecordOrderHold(ctx, tx, farmerID, amount, reference); err != nil {
+		return nil, err
+	}
+	description := fmt.Sprintf("Wallet part of order %d, held until the online payment settles", orderID)
+	if err := s.FarmerRepo.WithTx(tx).RecordWalletTransaction(ctx, farmerID, reference, wallet_model.TransactionPayment, amount, "pending", description); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// CaptureOrderHold turns the active hold of a paid order into sales and returns it, nil when the order has none
+func (s *HoldService) CaptureOrderHold(ctx context.Context, tx pgx.Tx, orderID int) (*hold.Hold, error) {
+	return s.resolve(ctx, tx, orderID, hold.HoldCaptured, func(h *hold.Hold) error {
+		if err := s.LedgerService.RecordOrderHoldCapture(ctx, tx, h.Amount, h.Reference); err != nil {
+			return err
+		}
+		_, _, _, err := s.FarmerRepo.WithTx(tx).SettleWalletTransaction(ctx, h.Reference, wallet_model.TransactionPayment)
+		return err
+	})
+}
+
+// ReleaseOrderHold returns the active hold of an order to the wallet and returns it, nil when the order has none
+func (s *HoldService) ReleaseOrderHold(ctx context.Context, tx pgx.Tx, orderID int) (*hold.Hold, error) {
+	return s.resolve(ctx, tx, orderID, hold.HoldReleased, func(h *hold.Hold) error {
+		if err := s.LedgerService.RecordOrderHoldRelease(ctx, tx, h.FarmerID, h.Amount, h.Reference); err != nil {
+			return err
+		}
+		return s.FarmerRepo.WithTx(tx).MarkTransactionAsFailed(ctx, h.Reference, wallet_model.TransactionPayment)
+	})
+}
+
+// resolve moves the active hold of an order to status and posts its outcome, only once per hold
+func (s *HoldService) resolve(ctx context.Context, tx pgx.Tx, orderID int, status string, post func(h *hold.Hold) error) (*hold.Hold, error) {
+	h, err := s.ActiveHold(ctx, tx, orderID)
+	if err != nil || h == nil {
+		return nil, err
+	}
+
+	resolved, err := s.repo(tx).ResolveHold(ctx, h.ID, status)
+	if err != nil || !resolved {
+		return nil, err
+	}
+	if err := post(h); err != nil {
+		return nil, err
+	}
+	h.Status = status
+	return h, nil
+}
+
+// repo returns the hold repository bound to tx, or to the pool when tx is nil
+func (s *HoldService) repo(tx pgx.Tx) *hold_repo.HoldRepository {
+	if tx == nil {
+		return s.HoldRepo
+	}
+	return s.HoldRepo.WithTx(tx)
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	idempotency "dgw-technical-test/internal/models/idempotency"
+	idempotency_repo "dgw-technical-test/internal/repositories/idempotency"
+	"dgw-technical-test/utils"
+
+	"context"
+	"time"
+)
+
+// IdempotencyService remembers requests made with an Idempotency-Key so retries get the original response
+type IdempotencyService struct {
+	IdempotencyRepo *idempotency_repo.IdempotencyRepository
+	KeyTTL          time.Duration
+}
+
+func NewIdempotencyService(idempotencyRepo *idempotency_repo.IdempotencyRepository) *IdempotencyService {
+	return &IdempotencyService{
+		IdempotencyRepo: idempotencyRepo,
+		KeyTTL:          utils.DurationFromEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+	}
+}
+
+// Begin claims the key for a new request. When the key was already used, started is false
+// and the existing record is returned for the caller to replay or reject.
+func (s *IdempotencyService) Begin(ctx context.Context, subject, key, requestHash string) (*idempotency.Record, bool, error) {
+	claimed, err := s.IdempotencyRepo.ClaimKey(ctx, subject, key, requestHash, time.Now().Add(s.KeyTTL))
+	if err != nil {
+		return nil, false, err
+	}
+	if claimed {
+		return nil, true, nil
+	}
+
+	record, err := s.IdempotencyRepo.GetRecord(ctx, subject, key)
+	if err != nil {
+		return nil, false, err
+	}
+	return record, false, nil
+}
+
+// Complete stores the response of a request started with Begin
+func (s *IdempotencyService) Complete(ctx context.Context, subject, key string, statusCode int, contentType string, body []byte) error {
+	return s.IdempotencyRepo.SaveResponse(ctx, subject, key, statusCode, contentType, body)
+}
+
+// Release frees a key whose request failed, so the client can retry with it
+func (s *IdempotencyService) Release(ctx context.Context, subject, key string) error {
+	return s.IdempotencyRepo.DeleteInProgress(ctx, subject, key)
+}
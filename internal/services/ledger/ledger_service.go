@@ -0,0 +1,198 @@
+package services
+
+import (
+	ledger "dgw-technical-test/internal/models/ledger"
+	"dgw-technical-test/internal/money"
+	ledger_repo "dgw-technical-test/internal/repositories/ledger"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidAdjustment is returned when an adjustment has no amount or reason
+var ErrInvalidAdjustment = errors.New("invalid adjustment")
+
+// LedgerService posts wallet movements to the double-entry ledger.
+// Record* methods take the caller's transaction so the entry commits with the change it pays for.
+type LedgerService struct {
+	LedgerRepo *ledger_repo.LedgerRepository
+	UnitOfWork *unitofwork.UnitOfWork
+}
+
+func NewLedgerService(ledgerRepo *ledger_repo.LedgerRepository, unitOfWork *unitofwork.UnitOfWork) *LedgerService {
+	return &LedgerService{
+		LedgerRepo: ledgerRepo,
+		UnitOfWork: unitOfWork,
+	}
+}
+
+// RecordTopUp credits a farmer's wallet with money collected by the payment gateway
+func (s *LedgerService) RecordTopUp(ctx context.Context, tx pgx.Tx, farmerID int, amount money.Money, gatewayOrderID string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postWalletEntry(ctx, repo, ledger.EntryTopUp, gatewayOrderID, fmt.Sprintf("Wallet top-up %s", gatewayOrderID), nil, farmerID, ledger.AccountGatewayClearing, amount)
+}
+
+// RecordOrderPayment debits a farmer's wallet for an order, failing with ErrInsufficientFunds when the balance is too low
+func (s *LedgerService) RecordOrderPayment(ctx context.Context, tx pgx.Tx, farmerID, orderID int, amount money.Money) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postWalletEntry(ctx, repo, ledger.EntryOrderPayment, fmt.Sprintf("order-%d", orderID), fmt.Sprintf("Wallet payment for order %d", orderID), nil, farmerID, ledger.AccountSalesRevenue, -amount)
+}
+
+// RecordRefund credits a farmer's wallet with money returned for an order
+func (s *LedgerService) RecordRefund(ctx context.Context, tx pgx.Tx, farmerID int, amount money.Money, reference, description string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postWalletEntry(ctx, repo, ledger.EntryRefund, reference, description, nil, farmerID, ledger.AccountSalesRevenue, amount)
+}
+
+// RecordPayoutHold moves money from a farmer's wallet into payout holding before the disbursement is submitted,
+// failing with ErrInsufficientFunds when the balance is too low
+func (s *LedgerService) RecordPayoutHold(ctx context.Context, tx pgx.Tx, farmerID int, amount money.Money, payoutReference string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postWalletEntry(ctx, repo, ledger.EntryPayoutHold, payoutReference, fmt.Sprintf("Funds held for payout %s", payoutReference), nil, farmerID, ledger.AccountPayoutHolding, -amount)
+}
+
+// RecordPayoutSettlement releases held money once the provider transferred it out of the gateway account
+func (s *LedgerService) RecordPayoutSettlement(ctx context.Context, tx pgx.Tx, amount money.Money, payoutReference string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postSystemEntry(ctx, repo, ledger.EntryPayoutSettlement, payoutReference, fmt.Sprintf("Payout %s disbursed", payoutReference), ledger.AccountPayoutHolding, ledger.AccountGatewayClearing, amount)
+}
+
+// RecordPayoutReversal returns held money to the farmer's wallet when the disbursement failed
+func (s *LedgerService) RecordPayoutReversal(ctx context.Context, tx pgx.Tx, farmerID int, amount money.Money, payoutReference string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postWalletEntry(ctx, repo, ledger.EntryPayoutReversal, payoutReference, fmt.Sprintf("Payout %s failed, funds returned", payoutReference), nil, farmerID, ledger.AccountPayoutHolding, amount)
+}
+
+// RecordOrderHold moves the wallet part of a split payment into order holding,
+// failing with ErrInsufficientFunds when the balance is too low
+func (s *LedgerService) RecordOrderHold(ctx context.Context, tx pgx.Tx, farmerID int, amount money.Money, holdReference string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postWalletEntry(ctx, repo, ledger.EntryOrderHold, holdReference, fmt.Sprintf("Funds held for split payment %s", holdReference), nil, farmerID, ledger.AccountOrderHolding, -amount)
+}
+
+// RecordOrderHoldCapture turns held money into sales once the online part of the split payment settled
+func (s *LedgerService) RecordOrderHoldCapture(ctx context.Context, tx pgx.Tx, amount money.Money, holdReference string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postSystemEntry(ctx, repo, ledger.EntryOrderHoldCapture, holdReference, fmt.Sprintf("Split payment %s settled", holdReference), ledger.AccountOrderHolding, ledger.AccountSalesRevenue, amount)
+}
+
+// RecordOrderHoldRelease returns held money to the farmer's wallet when the split payment didn't complete
+func (s *LedgerService) RecordOrderHoldRelease(ctx context.Context, tx pgx.Tx, farmerID int, amount money.Money, holdReference string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postWalletEntry(ctx, repo, ledger.EntryOrderHoldRelease, holdReference, fmt.Sprintf("Split payment %s not completed, funds returned", holdReference), nil, farmerID, ledger.AccountOrderHolding, amount)
+}
+
+// RecordCreditSale books an order bought on credit as sales owed by the farmer, and the fee on it as fee income
+func (s *LedgerService) RecordCreditSale(ctx context.Context, tx pgx.Tx, principal, fee money.Money, receivableReference string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	if err := s.postSystemEntry(ctx, repo, ledger.EntryCreditSale, receivableReference, fmt.Sprintf("Order bought on credit, receivable %s", receivableReference), ledger.AccountCreditReceivables, ledger.AccountSalesRevenue, principal); err != nil {
+		return err
+	}
+	if !fee.IsPositive() {
+		return nil
+	}
+	return s.postSystemEntry(ctx, repo, ledger.EntryCreditFee, receivableReference, fmt.Sprintf("Credit fee on receivable %s", receivableReference), ledger.AccountCreditReceivables, ledger.AccountCreditFees, fee)
+}
+
+// RecordCreditWalletRepayment debits a farmer's wallet to repay a receivable, failing with ErrInsufficientFunds when the balance is too low
+func (s *LedgerService) RecordCreditWalletRepayment(ctx context.Context, tx pgx.Tx, farmerID int, amount money.Money, repaymentReference string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postWalletEntry(ctx, repo, ledger.EntryCreditRepayment, repaymentReference, fmt.Sprintf("Credit repayment %s from the wallet", repaymentReference), nil, farmerID, ledger.AccountCreditReceivables, -amount)
+}
+
+// RecordCreditOnlineRepayment settles a receivable with money collected by the payment gateway
+func (s *LedgerService) RecordCreditOnlineRepayment(ctx context.Context, tx pgx.Tx, amount money.Money, gatewayOrderID string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postSystemEntry(ctx, repo, ledger.EntryCreditRepayment, gatewayOrderID, fmt.Sprintf("Credit repayment %s", gatewayOrderID), ledger.AccountGatewayClearing, ledger.AccountCreditReceivables, amount)
+}
+
+// RecordCreditReduction writes off what a farmer owed for the refunded part of an order bought on credit
+func (s *LedgerService) RecordCreditReduction(ctx context.Context, tx pgx.Tx, amount money.Money, refundReference string) error {
+	repo := s.LedgerRepo.WithTx(tx)
+	return s.postSystemEntry(ctx, repo, ledger.EntryCreditReduction, refundReference, fmt.Sprintf("Receivable reduced by refund %s", refundReference), ledger.AccountSalesRevenue, ledger.AccountCreditReceivables, amount)
+}
+
+// RecordAdjustment lets an admin correct a wallet; a positive amount credits it and a negative amount debits it
+func (s *LedgerService) RecordAdjustment(ctx context.Context, adminID int, req ledger.AdjustmentRequest) error {
+	if req.Amount.IsZero() || req.Reason == "" || req.FarmerID <= 0 {
+		return ErrInvalidAdjustment
+	}
+
+	reference := fmt.Sprintf("adj-%d-%d", req.FarmerID, time.Now().UnixNano())
+	return s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		return s.postWalletEntry(ctx, s.LedgerRepo.WithTx(tx), ledger.EntryAdjustment, reference, req.Reason, &adminID, req.FarmerID, ledger.AccountAdjustments, req.Amount)
+	})
+}
+
+// Reconcile checks that every cached wallet_balance matches the ledger and every entry balances
+func (s *LedgerService) Reconcile(ctx context.Context) (*ledger.ReconciliationReport, error) {
+	mismatches, err := s.LedgerRepo.GetBalanceMismatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unbalanced, err := s.LedgerRepo.GetUnbalancedEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ledger.ReconciliationReport{
+		Balanced:          len(mismatches) == 0 && len(unbalanced) == 0,
+		CheckedAt:         time.Now(),
+		Mismatches:        mismatches,
+		UnbalancedEntries: unbalanced,
+	}, nil
+}
+
+// postWalletEntry moves amount between a farmer's wallet and a system account: a positive amount
+// credits the wallet (debiting the system account), a negative amount debits it
+func (s *LedgerService) postWalletEntry(ctx context.Context, repo *ledger_repo.LedgerRepository, entryType, reference, description string, adminID *int, farmerID int, systemAccount string, amount money.Money) error {
+	walletID, err := repo.GetOrCreateWalletAccountID(ctx, farmerID)
+	if err != nil {
+		return err
+	}
+	systemID, err := repo.GetAccountIDByCode(ctx, systemAccount)
+	if err != nil {
+		return err
+	}
+
+	debit, credit := systemID, walletID
+	if amount < 0 {
+		debit, credit, amount = walletID, systemID, -amount
+	}
+
+	return postEntry(ctx, repo, entryType, reference, description, adminID, debit, credit, amount)
+}
+
+// postSystemEntry moves amount between two system accounts, debiting the first and crediting the second
+func (s *LedgerService) postSystemEntry(ctx context.Context, repo *ledger_repo.LedgerRepository, entryType, reference, description, debitAccount, creditAccount string, amount money.Money) error {
+	debit, err := repo.GetAccountIDByCode(ctx, debitAccount)
+	if err != nil {
+		return err
+	}
+	credit, err := repo.GetAccountIDByCode(ctx, creditAccount)
+	if err != nil {
+		return err
+	}
+
+	return postEntry(ctx, repo, entryType, reference, description, nil, debit, credit, amount)
+}
+
+// postEntry posts a two-line entry debiting one account and crediting another
+func postEntry(ctx context.Context, repo *ledger_repo.LedgerRepository, entryType, reference, description string, adminID *int, debit, credit int, amount money.Money) error {
+	_, err := repo.PostEntry(ctx, &ledger.Entry{
+		EntryType:   entryType,
+		Reference:   reference,
+		Description: description,
+		AdminID:     adminID,
+		Lines: []ledger.Line{
+			{AccountID: debit, Debit: amount},
+			{AccountID: credit, Credit: amount},
+		},
+	})
+	return err
+}
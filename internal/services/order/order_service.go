@@ -0,0 +1,95 @@
+package services
+
+import (
+	order_model "dgw-technical-test/internal/models/order"
+	order_repo "dgw-technical-test/internal/repositories/order"
+	pagination "dgw-technical-test/internal/repositories/pagination"
+	policy "dgw-technical-test/internal/services/policy"
+
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidFilter is returned when order list filters can't be applied
+	ErrInvalidFilter = errors.New("invalid order filter")
+	// ErrOrderNotFound is returned when an order doesn't exist or belongs to another farmer
+	ErrOrderNotFound = policy.ErrOrderNotFound
+)
+
+// page sizes of order listings
+const (
+	defaultOrderLimit = 20
+	maxOrderLimit     = 100
+)
+
+// OrderService serves order history to farmers and order lookups to admins
+type OrderService struct {
+	OrderRepo *order_repo.OrderRepository
+}
+
+func NewOrderService(orderRepo *order_repo.OrderRepository) *OrderService {
+	return &OrderService{OrderRepo: orderRepo}
+}
+
+// ListFarmerOrders returns a page of the farmer's own orders, newest first
+func (s *OrderService) ListFarmerOrders(ctx context.Context, farmerID int, filter order_model.OrderFilter) (*order_model.OrderPage, error) {
+	filter.FarmerID = farmerID
+	return s.ListOrders(ctx, filter)
+}
+
+// ListOrders returns a page of orders of every farmer, newest first
+func (s *OrderService) ListOrders(ctx context.Context, filter order_model.OrderFilter) (*order_model.OrderPage, error) {
+	if filter.Status != "" && !filter.Status.Valid() {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidFilter, filter.Status)
+	}
+	switch filter.PaymentMethod {
+	case "", "wallet", "online", "split", "credit":
+	default:
+		return nil, fmt.Errorf("%w: unknown payment method %q", ErrInvalidFilter, filter.PaymentMethod)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidFilter)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultOrderLimit
+	}
+	if filter.Limit > maxOrderLimit {
+		filter.Limit = maxOrderLimit
+	}
+
+	page, err := s.OrderRepo.ListOrders(ctx, filter)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	return page, err
+}
+
+// GetFarmerOrder returns one of the farmer's orders with its items and status history.
+// Another farmer's order is reported as ErrOrderNotFound so its existence isn't revealed.
+func (s *OrderService) GetFarmerOrder(ctx context.Context, farmerID, orderID int) (*order_model.Order, error) {
+	order, err := s.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.RequireOwner(farmerID, order.FarmerID, ErrOrderNotFound); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// GetOrder returns any order with its items and status history
+func (s *OrderService) GetOrder(ctx context.Context, orderID int) (*order_model.Order, error) {
+	order, err := s.OrderRepo.GetOrderDetail(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
+	payment_model "dgw-technical-test/internal/models/payment"
+	credit_service "dgw-technical-test/internal/services/credit"
+	farmer_service "dgw-technical-test/internal/services/farmer"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidSignature is returned when a notification signature_key doesn't match
+	ErrInvalidSignature = errors.New("invalid notification signature")
+
+	// ErrUnknownOrder is returned when a notification refers to an order this service never charged
+	ErrUnknownOrder = errors.New("unknown notification order id")
+)
+
+// PaymentService handles asynchronous payment notifications from the payment gateway and lists the payment channels
+type PaymentService struct {
+	FarmerService  *farmer_service.FarmerService
+	CreditService  *credit_service.CreditService
+	PaymentGateway payment_gateway.PaymentGateway
+	Channels       *payment_gateway.ChannelCatalog
+}
+
+func NewPaymentService(farmerService *farmer_service.FarmerService, creditService *credit_service.CreditService, paymentGateway payment_gateway.PaymentGateway, channels *payment_gateway.ChannelCatalog) *PaymentService {
+	return &PaymentService{
+		FarmerService:  farmerService,
+		CreditService:  creditService,
+		PaymentGateway: paymentGateway,
+		Channels:       channels,
+	}
+}
+
+// ListChannels returns the payment channels enabled by PAYMENT_CHANNELS and the code of the default one
+func (s *PaymentService) ListChannels() ([]payment_gateway.Channel, string) {
+	return s.Channels.Enabled(), s.Channels.Default()
+}
+
+// HandleNotification verifies a gateway notification and settles the order, wallet top-up or credit repayment it refers to.
+// Order IDs follow the formats created by the farmer service: store-<orderID>-<unix> charges are resolved
+// through the payments table and topup-<farmerID>-<unix> top-ups through wallet_transactions
+// (wd-<farmerID>-<unix> is the prefix of top-ups created before they were told apart from payouts).
+// credit-<receivableID>-<unix> repayments created by the credit service are resolved through credit_repayments.
+// The signature doesn't cover transaction_status, so a signed notification only says that the charge changed:
+// its status is fetched from the gateway and the notification's own status is never applied.
+func (s *PaymentService) HandleNotification(ctx context.Context, n payment_model.Notification) error {
+	if !s.PaymentGateway.VerifySignature(n.OrderID, n.StatusCode, n.GrossAmount, n.SignatureKey) {
+		return ErrInvalidSignature
+	}
+
+	parts := strings.SplitN(n.OrderID, "-", 3)
+	if len(parts) != 3 {
+		return ErrUnknownOrder
+	}
+
+	resp, err := s.PaymentGateway.CheckTransaction(n.OrderID)
+	if err != nil {
+		return fmt.Errorf("failed to check transaction %s: %w", n.OrderID, err)
+	}
+	status := transactionStatus(resp.TransactionStatus, resp.FraudStatus)
+
+	switch parts[0] {
+	case "store":
+		raw, _ := json.Marshal(resp)
+		err = s.FarmerService.ProcessPaymentStatus(ctx, n.OrderID, status, raw)
+	case "topup", "wd":
+		err = s.FarmerService.ProcessWalletTransactionStatus(ctx, n.OrderID, status)
+	case "credit":
+		err = s.CreditService.ProcessRepaymentStatus(ctx, n.OrderID, status)
+	default:
+		return ErrUnknownOrder
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrUnknownOrder
+	}
+	if err != nil {
+		return fmt.Errorf("failed to process notification for %s: %w", n.OrderID, err)
+	}
+	return nil
+}
+
+// transactionStatus normalises a gateway transaction status: an accepted card capture is a settlement
+func transactionStatus(status, fraudStatus string) string {
+	if status == "capture" && (fraudStatus == "" || fraudStatus == "accept") {
+		return "settlement"
+	}
+	return status
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	payout_gateway "dgw-technical-test/internal/gateways/payout"
+	payout "dgw-technical-test/internal/models/payout"
+	wallet_model "dgw-technical-test/internal/models/wallet"
+	farmer_repo "dgw-technical-test/internal/repositories/farmer"
+	payout_repo "dgw-technical-test/internal/repositories/payout"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	ledger_service "dgw-technical-test/internal/services/ledger"
+	policy "dgw-technical-test/internal/services/policy"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidPayout is returned when a payout request isn't a positive whole number of rupiah
+	ErrInvalidPayout = errors.New("invalid payout request")
+	// ErrPayoutNotFound is returned when a payout doesn't exist or belongs to another farmer
+	ErrPayoutNotFound = errors.New("payout not found")
+)
+
+// PayoutService pays wallet money out to farmers' bank accounts. The amount is held in the ledger
+// before the disbursement is submitted, then settled when the provider completes the transfer or
+// returned to the wallet when it fails.
+type PayoutService struct {
+	PayoutRepo     *payout_repo.PayoutRepository
+	FarmerRepo     *farmer_repo.FarmerRepository
+	UnitOfWork     *unitofwork.UnitOfWork
+	LedgerService  *ledger_service.LedgerService
+	PayoutProvider payout_gateway.PayoutProvider
+}
+
+func NewPayoutService(payoutRepo *payout_repo.PayoutRepository, farmerRepo *farmer_repo.FarmerRepository, unitOfWork *unitofwork.UnitOfWork, ledgerService *ledger_service.LedgerService, payoutProvider payout_gateway.PayoutProvider) *PayoutService {
+	return &PayoutService{
+		PayoutRepo:     payoutRepo,
+		FarmerRepo:     farmerRepo,
+		UnitOfWork:     unitOfWork,
+		LedgerService:  ledgerService,
+		PayoutProvider: payoutProvider,
+	}
+}
+
+// RequestPayout debits the farmer's wallet into payout holding and submits the disbursement.
+// It fails with ErrInsufficientFunds before anything is submitted when the balance is too low.
+// A submission that errors leaves the payout pending, and the payout worker (or GetPayout) submits
+// it again under the same reference through ResubmitPayout.
+func (s *PayoutService) RequestPayout(ctx context.Context, farmerID int, req payout.PayoutRequest) (*payout.Payout, error) {
+	// the provider only transfers whole rupiah
+	if !req.Amount.IsPositive() || req.Amount.Sen()%100 != 0 {
+		return nil, ErrInvalidPayout
+	}
+
+	reference := fmt.Sprintf("po-%d-%d", farmerID, time.Now().UnixNano())
+
+	// create the payout, hold its funds and log it in the wallet history together
+	var p *payout.Payout
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		var err error
+		p, err = s.PayoutRepo.WithTx(tx).CreatePayout(ctx, farmerID, reference, req)
+		if err != nil {
+			return err
+		}
+		if err := s.LedgerService.RecordPayoutHold(ctx, tx, farmerID, req.Amount, reference); err != nil {
+			return err
+		}
+		description := fmt.Sprintf("Payout to %s %s", req.BankCode, req.AccountNumber)
+		return s.FarmerRepo.WithTx(tx).RecordWalletTransaction(ctx, farmerID, reference, wallet_model.TransactionPayout, req.Amount, "pending", description)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to hold payout funds: %w", err)
+	}
+
+	// the disbursement is submitted outside the transaction so a slow provider doesn't hold row locks
+	d, err := s.submit(ctx, p)
+	if err != nil {
+		return p, nil
+	}
+	return s.apply(ctx, p, d)
+}
+
+// GetPayout returns a farmer's payout, resolving it with the provider while it is still in flight
+func (s *PayoutService) GetPayout(ctx context.Context, farmerID, payoutID int) (*payout.Payout, error) {
+	p, err := s.PayoutRepo.GetPayoutByID(ctx, payoutID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPayoutNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := policy.RequireOwner(farmerID, p.FarmerID, ErrPayoutNotFound); err != nil {
+		return nil, err
+	}
+
+	var d *payout_gateway.Disbursement
+	switch p.Status {
+	case payout.PayoutPending:
+		return s.resubmit(ctx, p)
+	case payout.PayoutProcessing:
+		d, err = s.PayoutProvider.GetDisbursement(ctx, p.Reference)
+	default:
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch disbursement status: %w", err)
+	}
+
+	return s.apply(ctx, p, d)
+}
+
+// ResubmitPayout submits a payout the provider never accepted again and returns it as it now stands
+func (s *PayoutService) ResubmitPayout(ctx context.Context, payoutID int) (*payout.Payout, error) {
+	p, err := s.PayoutRepo.GetPayoutByID(ctx, payoutID)
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != payout.PayoutPending {
+		return p, nil
+	}
+	return s.resubmit(ctx, p)
+}
+
+// resubmit sends a pending payout to the provider again, which dedupes by reference, so a payout
+// it did receive isn't paid out twice
+func (s *PayoutService) resubmit(ctx context.Context, p *payout.Payout) (*payout.Payout, error) {
+	d, err := s.submit(ctx, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit payout %s: %w", p.Reference, err)
+	}
+	return s.apply(ctx, p, d)
+}
+
+// submit sends the payout to the provider
+func (s *PayoutService) submit(ctx context.Context, p *payout.Payout) (*payout_gateway.Disbursement, error) {
+	return s.PayoutProvider.CreateDisbursement(ctx, payout_gateway.DisbursementRequest{
+		Reference:     p.Reference,
+		Amount:        p.Amount.WholeRupiah(), // exact, RequestPayout only accepts whole rupiah
+		BankCode:      p.BankCode,
+		AccountNumber: p.AccountNumber,
+		AccountName:   p.AccountName,
+		Description:   fmt.Sprintf("Wallet payout %s", p.Reference),
+	})
+}
+
+// apply records the provider's view of a disbursement and returns the updated payout.
+// Only the caller that moves the payout out of pending/processing posts the ledger entry, so polls can race safely.
+func (s *PayoutService) apply(ctx context.Context, p *payout.Payout, d *payout_gateway.Disbursement) (*payout.Payout, error) {
+	var err error
+	switch d.Status {
+	case payout_gateway.DisbursementCompleted:
+		err = s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+			resolved, err := s.PayoutRepo.WithTx(tx).ResolvePayout(ctx, p.ID, payout.PayoutCompleted, d.ProviderReference, "")
+			if err != nil || !resolved {
+				return err
+			}
+			if err := s.LedgerService.RecordPayoutSettlement(ctx, tx, p.Amount, p.Reference); err != nil {
+				return err
+			}
+			_, _, _, err = s.FarmerRepo.WithTx(tx).SettleWalletTransaction(ctx, p.Reference, wallet_model.TransactionPayout)
+			return err
+		})
+	case payout_gateway.DisbursementFailed:
+		err = s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+			resolved, err := s.PayoutRepo.WithTx(tx).ResolvePayout(ctx, p.ID, payout.PayoutFailed, d.ProviderReference, d.FailureReason)
+			if err != nil || !resolved {
+				return err
+			}
+			// the transfer never happened, so the held funds go back to the wallet
+			if err := s.LedgerService.RecordPayoutReversal(ctx, tx, p.FarmerID, p.Amount, p.Reference); err != nil {
+				return err
+			}
+			return s.FarmerRepo.WithTx(tx).MarkTransactionAsFailed(ctx, p.Reference, wallet_model.TransactionPayout)
+		})
+	default:
+		err = s.PayoutRepo.MarkPayoutProcessing(ctx, p.ID, d.ProviderReference)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update payout %s: %w", p.Reference, err)
+	}
+
+	return s.PayoutRepo.GetPayoutByID(ctx, p.ID)
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	farmer_repo "dgw-technical-test/internal/repositories/farmer"
+	order_repo "dgw-technical-test/internal/repositories/order"
+
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// A farmer asking for another farmer's resource gets the same not found error as for a resource
+// that doesn't exist, so IDs can't be probed for their existence
+var (
+	// ErrOrderNotFound is returned when an order doesn't exist or belongs to another farmer
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrTopUpNotFound is returned when a wallet top-up doesn't exist or belongs to another farmer
+	ErrTopUpNotFound = errors.New("top-up not found")
+)
+
+// RequireOwner returns notFound unless the farmer acting owns the resource
+func RequireOwner(farmerID, ownerID int, notFound error) error {
+	if farmerID != ownerID {
+		return notFound
+	}
+	return nil
+}
+
+// OwnershipPolicy scopes lookups made on behalf of a farmer to the resources of that farmer.
+// Services call it before acting on an ID taken from the request.
+type OwnershipPolicy struct {
+	OrderRepo  *order_repo.OrderRepository
+	FarmerRepo *farmer_repo.FarmerRepository
+}
+
+func NewOwnershipPolicy(orderRepo *order_repo.OrderRepository, farmerRepo *farmer_repo.FarmerRepository) *OwnershipPolicy {
+	return &OwnershipPolicy{OrderRepo: orderRepo, FarmerRepo: farmerRepo}
+}
+
+// AuthorizeOrder returns ErrOrderNotFound unless the order exists and was placed for farmerID
+func (p *OwnershipPolicy) AuthorizeOrder(ctx context.Context, farmerID, orderID int) error {
+	ownerID, err := p.OrderRepo.GetOrderOwner(ctx, orderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to authorize order: %w", err)
+	}
+	return RequireOwner(farmerID, ownerID, ErrOrderNotFound)
+}
+
+// AuthorizeTopUp returns ErrTopUpNotFound unless the top-up with the gateway order ID exists and tops up farmerID's wallet
+func (p *OwnershipPolicy) AuthorizeTopUp(ctx context.Context, farmerID int, topUpOrderID string) error {
+	ownerID, err := p.FarmerRepo.GetTopUpOwner(ctx, topUpOrderID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTopUpNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to authorize top-up: %w", err)
+	}
+	return RequireOwner(farmerID, ownerID, ErrTopUpNotFound)
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	farmer_repo "dgw-technical-test/internal/repositories/farmer"
+	order_repo "dgw-technical-test/internal/repositories/order"
+
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var errDatabaseDown = errors.New("database is down")
+
+// ownerRow is the result of an owner lookup, either the owner or an error
+type ownerRow struct {
+	ownerID int
+	err     error
+}
+
+func (r ownerRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int) = r.ownerID
+	return nil
+}
+
+// ownerDB answers the owner lookups of OrderRepository and FarmerRepository from memory
+type ownerDB struct {
+	orders       map[int]int    // order ID to farmer ID
+	transactions map[string]int // wallet transaction order ID to farmer ID
+	types        map[string]string
+	err          error
+}
+
+func (db *ownerDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (db *ownerDB) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("not supported")
+}
+
+func (db *ownerDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func (db *ownerDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if db.err != nil {
+		return ownerRow{err: db.err}
+	}
+
+	switch {
+	case strings.Contains(sql, "FROM orders"):
+		if ownerID, ok := db.orders[args[0].(int)]; ok {
+			return ownerRow{ownerID: ownerID}
+		}
+	case strings.Contains(sql, "FROM wallet_transactions"):
+		ref := args[0].(string)
+		ownerID, ok := db.transactions[ref]
+		if ok && (!strings.Contains(sql, "transaction_type = 'TopUp'") || db.types[ref] == "TopUp") {
+			return ownerRow{ownerID: ownerID}
+		}
+	default:
+		return ownerRow{err: errors.New("unexpected query: " + sql)}
+	}
+	return ownerRow{err: pgx.ErrNoRows}
+}
+
+func newTestPolicy(db *ownerDB) *OwnershipPolicy {
+	return NewOwnershipPolicy(&order_repo.OrderRepository{DB: db}, &farmer_repo.FarmerRepository{DB: db})
+}
+
+func TestRequireOwner(t *testing.T) {
+	notFound := errors.New("not found")
+
+	if err := RequireOwner(1, 1, notFound); err != nil {
+		t.Errorf("owner: got %v, want nil", err)
+	}
+	if err := RequireOwner(1, 2, notFound); err != notFound {
+		t.Errorf("another farmer: got %v, want %v", err, notFound)
+	}
+}
+
+func TestAuthorizeOrder(t *testing.T) {
+	db := &ownerDB{orders: map[int]int{10: 1, 20: 2}}
+
+	cases := []struct {
+		name     string
+		farmerID int
+		orderID  int
+		dbErr    error
+		want     error
+	}{
+		{"own order", 1, 10, nil, nil},
+		{"order of another farmer", 1, 20, nil, ErrOrderNotFound},
+		{"order that doesn't exist", 1, 30, nil, ErrOrderNotFound},
+		{"database error", 1, 10, errDatabaseDown, errDatabaseDown},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.err = tc.dbErr
+			err := newTestPolicy(db).AuthorizeOrder(context.Background(), tc.farmerID, tc.orderID)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+			if tc.dbErr != nil && errors.Is(err, ErrOrderNotFound) {
+				t.Errorf("a database error must not read as not found: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizeTopUp(t *testing.T) {
+	db := &ownerDB{
+		transactions: map[string]int{"topup-1-1": 1, "topup-2-1": 2, "wallet-10-1": 1},
+		types:        map[string]string{"topup-1-1": "TopUp", "topup-2-1": "TopUp", "wallet-10-1": "Payment"},
+	}
+
+	cases := []struct {
+		name     string
+		farmerID int
+		ref      string
+		dbErr    error
+		want     error
+	}{
+		{"own top-up", 1, "topup-1-1", nil, nil},
+		{"top-up of another farmer", 1, "topup-2-1", nil, ErrTopUpNotFound},
+		{"top-up that doesn't exist", 1, "topup-1-2", nil, ErrTopUpNotFound},
+		{"own wallet payment is not a top-up", 1, "wallet-10-1", nil, ErrTopUpNotFound},
+		{"database error", 1, "topup-1-1", errDatabaseDown, errDatabaseDown},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			db.err = tc.dbErr
+			err := newTestPolicy(db).AuthorizeTopUp(context.Background(), tc.farmerID, tc.ref)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("got %v, want %v", err, tc.want)
+			}
+			if tc.dbErr != nil && errors.Is(err, ErrTopUpNotFound) {
+				t.Errorf("a database error must not read as not found: %v", err)
+			}
+		})
+	}
+}
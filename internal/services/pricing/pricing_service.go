@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	order_model "dgw-technical-test/internal/models/order"
+	"dgw-technical-test/internal/money"
+	product_repo "dgw-technical-test/internal/repositories/product"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrInvalidQuantity is returned when an item asks for zero or fewer units
+	ErrInvalidQuantity = errors.New("quantity must be greater than zero")
+	// ErrProductNotFound is returned when an item names a product that doesn't exist
+	ErrProductNotFound = errors.New("product not found")
+)
+
+// Quote is the server-side price of a list of order items
+type Quote struct {
+	Items        []order_model.OrderItem `json:"items"` // every item carries its unit price
+	Total        money.Money             `json:"total"`
+	Descriptions []string                `json:"descriptions"` // "<product> x<quantity>" per item, used as the charge description
+}
+
+// PricingService prices order items from the catalog. Admin purchases, farmer checkouts and online
+// charges all go through it so an order is never priced from client input.
+type PricingService struct {
+	ProductRepo *product_repo.ProductRepository
+}
+
+func NewPricingService(productRepo *product_repo.ProductRepository) *PricingService {
+	return &PricingService{ProductRepo: productRepo}
+}
+
+// PriceItems prices new order items at the current catalog price. It fails with ErrInvalidQuantity,
+// ErrProductNotFound or reservation_repo.ErrInsufficientStock when an item can't be ordered; the stock
+// check is advisory, the reservation taken when the order is placed is authoritative.
+func (s *PricingService) PriceItems(ctx context.Context, items []order_model.OrderItem) (*Quote, error) {
+	quote := &Quote{Items: make([]order_model.OrderItem, len(items))}
+
+	for i, item := range items {
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w for product_id %d", ErrInvalidQuantity, item.ProductID)
+		}
+
+		product, err := s.ProductRepo.GetProductByID(ctx, item.ProductID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: product_id %d", ErrProductNotFound, item.ProductID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// check if enough unreserved stock is readily available
+		if product.AvailableQuantity < item.Quantity {
+			return nil, fmt.Errorf("%w for product %s", reservation_repo.ErrInsufficientStock, product.Name)
+		}
+
+		item.Price = product.Price
+		quote.Items[i] = item
+		quote.Total += product.Price.Mul(item.Quantity)
+		quote.Descriptions = append(quote.Descriptions, fmt.Sprintf("%s x%d", product.Name, item.Quantity))
+	}
+
+	return quote, nil
+}
+
+// QuoteOrder prices an existing order at the unit prices stored on its items when it was placed,
+// so a charge always matches the order total even after catalog prices changed
+func (s *PricingService) QuoteOrder(ctx context.Context, order *order_model.Order) (*Quote, error) {
+	quote := &Quote{Items: order.Items}
+
+	for _, item := range order.Items {
+		product, err := s.ProductRepo.GetProductByID(ctx, item.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		quote.Total += item.Price.Mul(item.Quantity)
+		quote.Descriptions = append(quote.Descriptions, fmt.Sprintf("%s x%d", product.Name, item.Quantity))
+	}
+
+	return quote, nil
+}
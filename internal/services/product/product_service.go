@@ -1,9 +1,22 @@
 package services
 
 import (
+	"context"
 	"dgw-technical-test/internal/models/product"
+	pagination "dgw-technical-test/internal/repositories/pagination"
 	"dgw-technical-test/internal/repositories/product"
+	"errors"
 	"fmt"
+	"strings"
+)
+
+// ErrInvalidFilter is returned when catalog filters can't be applied
+var ErrInvalidFilter = errors.New("invalid product filter")
+
+// page sizes of catalog listings
+const (
+	defaultProductLimit = 20
+	maxProductLimit     = 100
 )
 
 type ProductService struct {
@@ -14,11 +27,48 @@ func NewProductService(productRepo *repositories.ProductRepository) *ProductServ
 	return &ProductService{ProductRepo: productRepo}
 }
 
-// GetAllProductsService retrieves all products from the database
-func (s *ProductService) GetAllProductsService() ([]models.Product, error) {
-	products, err := s.ProductRepo.GetAllProductsRepo()
+// SearchProducts returns a page of the catalog. Searches are sorted by relevance
+// and plain listings newest first unless another sort is asked for.
+func (s *ProductService) SearchProducts(ctx context.Context, filter models.ProductFilter) (*models.ProductPage, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	if filter.Sort == "" {
+		filter.Sort = models.SortNewest
+		if filter.Query != "" {
+			filter.Sort = models.SortRelevance
+		}
+	}
+	switch filter.Sort {
+	case models.SortNewest, models.SortPriceAsc, models.SortPriceDesc, models.SortName:
+	case models.SortRelevance:
+		if filter.Query == "" {
+			return nil, fmt.Errorf("%w: relevance sort needs a search query", ErrInvalidFilter)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidFilter, filter.Sort)
+	}
+	if filter.MinPrice.IsNegative() || filter.MaxPrice.IsNegative() {
+		return nil, fmt.Errorf("%w: prices can't be negative", ErrInvalidFilter)
+	}
+	if filter.MaxPrice.IsPositive() && filter.MinPrice > filter.MaxPrice {
+		return nil, fmt.Errorf("%w: min_price must not be above max_price", ErrInvalidFilter)
+	}
+	if filter.SupplierID < 0 {
+		return nil, fmt.Errorf("%w: invalid supplier", ErrInvalidFilter)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultProductLimit
+	}
+	if filter.Limit > maxProductLimit {
+		filter.Limit = maxProductLimit
+	}
+
+	page, err := s.ProductRepo.SearchProducts(ctx, filter)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve seed products: %w", err)
+		return nil, fmt.Errorf("failed to search products: %w", err)
 	}
-	return products, nil
-}
\ No newline at end of file
+	return page, nil
+}
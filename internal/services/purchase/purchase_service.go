@@ -5,21 +5,63 @@ import (
 	product_repo "dgw-technical-test/internal/repositories/product"
 	order_repo 	 "dgw-technical-test/internal/repositories/order"
 	log_repo 	 "dgw-technical-test/internal/repositories/log"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	unitofwork   "dgw-technical-test/internal/repositories/unitofwork"
+	domain       "dgw-technical-test/internal/domain/order"
 	order_model  "dgw-technical-test/internal/models/order"
+	refund_model "dgw-technical-test/internal/models/refund"
+	refund_service "dgw-technical-test/internal/services/refund"
+	hold_service "dgw-technical-test/internal/services/hold"
+	farmer_service "dgw-technical-test/internal/services/farmer"
+	pricing_service "dgw-technical-test/internal/services/pricing"
+	"dgw-technical-test/internal/money"
+	"dgw-technical-test/utils"
+	"errors"
 	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// defaultReservationTTL is how long stock stays reserved for an unpaid order when STOCK_RESERVATION_TTL is not set
+	defaultReservationTTL = 24 * time.Hour
+
+	// defaultPaymentTerm is how long a farmer has to pay an order when ORDER_PAYMENT_TERM is not set
+	defaultPaymentTerm = 24 * time.Hour
 )
 
+// ErrInvalidFulfilmentStatus is returned when an admin sets a status that isn't a fulfilment step
+var ErrInvalidFulfilmentStatus = errors.New("invalid fulfilment status")
+
 type PurchaseService struct {
 	ProductRepo product_repo.ProductRepository 
 	OrderRepo   order_repo.OrderRepository
 	LogRepo		log_repo.LogRepository
+	ReservationRepo reservation_repo.ReservationRepository
+	UnitOfWork  *unitofwork.UnitOfWork
+	RefundService *refund_service.RefundService
+	PricingService *pricing_service.PricingService
+	HoldService *hold_service.HoldService
+	FarmerService *farmer_service.FarmerService
+	ReservationTTL time.Duration
+	PaymentTerm    time.Duration
 }
 
-func NewPurchaseService(productRepo product_repo.ProductRepository, orderRepo order_repo.OrderRepository, logRepo log_repo.LogRepository) *PurchaseService {
+func NewPurchaseService(productRepo product_repo.ProductRepository, orderRepo order_repo.OrderRepository, logRepo log_repo.LogRepository, reservationRepo reservation_repo.ReservationRepository, unitOfWork *unitofwork.UnitOfWork, refundService *refund_service.RefundService, pricingService *pricing_service.PricingService, holdService *hold_service.HoldService, farmerService *farmer_service.FarmerService) *PurchaseService {
 	return &PurchaseService{
 		ProductRepo: productRepo,
 		OrderRepo: orderRepo,
 		LogRepo: logRepo,	// Initialize the log repo
+		ReservationRepo: reservationRepo,
+		UnitOfWork: unitOfWork,
+		RefundService: refundService,
+		PricingService: pricingService,
+		HoldService: holdService,
+		FarmerService: farmerService,
+		ReservationTTL: utils.DurationFromEnv("STOCK_RESERVATION_TTL", defaultReservationTTL),
+		PaymentTerm:    utils.DurationFromEnv("ORDER_PAYMENT_TERM", defaultPaymentTerm),
 	}
 }
 
@@ -28,65 +70,160 @@ type FacilitatePurchaseRequest struct {
 	Items    []order_model.OrderItem `json:"Items"`
 }
 
-func (s *PurchaseService) FacilitatePurchase(ctx context.Context, adminID int, req FacilitatePurchaseRequest) error {
-	var total float64
+// PlacedOrder describes a pending order created for a farmer
+type PlacedOrder struct {
+	OrderID       int       `json:"order_id"`
+	TotalPrice    money.Money `json:"total_price"`
+	PaymentDueAt  time.Time `json:"payment_due_at"`
+	ReservedUntil time.Time `json:"reserved_until"`
+}
 
-	// validation for the product inputted
-	for i, item := range req.Items {
-		fmt.Println("item: ", item)
-		fmt.Println("item.ProductID: ", item.ProductID)
+// FacilitatePurchase creates a pending order due within PaymentTerm and reserves its stock until ReservationTTL passes
+func (s *PurchaseService) FacilitatePurchase(ctx context.Context, adminID int, req FacilitatePurchaseRequest) (*PlacedOrder, error) {
+	// price the items from the catalog, client prices are ignored
+	quote, err := s.PricingService.PriceItems(ctx, req.Items)
+	if err != nil {
+		return nil, err
+	}
 
-		// check if the product is available at the store
-		product, err := s.ProductRepo.GetProductByID(ctx, item.ProductID)
+	var placed *PlacedOrder
+	err = s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		placed, err = s.PlaceOrder(ctx, tx, req.FarmerID, quote, domain.AdminActor(adminID))
 		if err != nil {
 			return err
 		}
-		
-		// check if the stock quantity is readily available 
-		if product.StockQuantity < item.Quantity {
-			return fmt.Errorf("insufficient stock for product %s", product.Name)
+
+		// log successful order creation
+		logDetails := fmt.Sprintf("Admin %d facilitated a purchase for farmerID %d with total IDR %s (order %d, stock reserved until %s)", adminID, req.FarmerID, placed.TotalPrice, placed.OrderID, placed.ReservedUntil.Format(time.RFC3339))
+		if err := s.LogRepo.WithTx(tx).LogAction(ctx, adminID, "Facilitate Purchase", logDetails); err != nil {
+			return fmt.Errorf("failed to log purchase facilitation: %w", err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// update the price and the total amount that you have to pay
-		req.Items[i].Price = product.Price
-		total += product.Price * float64(item.Quantity)
+	return placed, nil
+}
+
+// PlaceOrder creates a pending order from a quote inside tx, with its items and their stock reservations.
+// The order is due within PaymentTerm and its stock stays reserved until ReservationTTL passes.
+func (s *PurchaseService) PlaceOrder(ctx context.Context, tx pgx.Tx, farmerID int, quote *pricing_service.Quote, actor domain.Actor) (*PlacedOrder, error) {
+	orderRepo := s.OrderRepo.WithTx(tx)
+	reservationRepo := s.ReservationRepo.WithTx(tx)
+
+	now := time.Now()
+	placed := &PlacedOrder{
+		TotalPrice:    quote.Total,
+		PaymentDueAt:  now.Add(s.PaymentTerm),
+		ReservedUntil: now.Add(s.ReservationTTL),
 	}
 
 	// create the order with the status pending
-	orderID, err := s.OrderRepo.CreateOrder(ctx, req.FarmerID, total)
+	orderID, err := orderRepo.CreateOrder(ctx, farmerID, quote.Total, placed.PaymentDueAt, actor)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	placed.OrderID = orderID
 
-	for _, item := range req.Items {
+	for _, item := range quote.Items {
 		// add each order item to the order
-		err := s.OrderRepo.AddOrderItem(ctx, orderID, item)
-		if err != nil {
-			return err
+		if err := orderRepo.AddOrderItem(ctx, orderID, item); err != nil {
+			return nil, err
+		}
+
+		// hold the stock so no other order can sell it before this one is paid
+		if err := reservationRepo.Reserve(ctx, orderID, item.ProductID, item.Quantity, placed.ReservedUntil); err != nil {
+			return nil, err
 		}
 	}
 
-	// log successful order creation
-    logDetails := fmt.Sprintf("Admin %d facilitated a purchase for farmerID %d with total $%.2f", adminID, req.FarmerID, total)
-    if err := s.LogRepo.LogAction(ctx, adminID, "Facilitate Purchase", logDetails); err != nil {
-        return fmt.Errorf("failed to log purchase facilitation: %w", err)
-    }
-	
-	return nil
+	return placed, nil
 }
 
-// CancelOrder updates the status of an order to "cancelled"
-func (s *PurchaseService) CancelOrder(ctx context.Context,adminID int, orderID int) error {
-	if err := s.OrderRepo.UpdateOrderStatus(ctx, orderID, "cancelled"); err != nil {
-		return fmt.Errorf("failed to cancel order: %v", err)
+// CancelOrder cancels an order. An unpaid order releases its stock reservations and the wallet money held for
+// its split payment; a paid order is refunded the way it was paid and its items are restocked, the refund is
+// returned in that case. A charge the order is awaiting is cancelled at the gateway first, and if it settled
+// before that the order is paid and refunded; while the gateway can't tell, the order isn't cancelled.
+// Orders past the point the transition table allows cancelling fail with a *domain.TransitionError.
+func (s *PurchaseService) CancelOrder(ctx context.Context,adminID int, orderID int) (*refund_model.Refund, error) {
+	// the gateway is asked before the order is locked, like the expiry worker does
+	if _, err := s.FarmerService.CancelPendingCharge(ctx, orderID); err != nil {
+		return nil, fmt.Errorf("failed to cancel order: %w", err)
 	}
 
-	// Log this action
-	action := "Cancel Order"
-	details := fmt.Sprintf("Order ID %d cancelled by Admin ID %d", orderID, adminID)
-	if err := s.LogRepo.LogAction(ctx, adminID, action, details); err != nil {
-		return fmt.Errorf("failed to log cancel order action: %v", err)
+	var paid bool
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		orderRepo := s.OrderRepo.WithTx(tx)
+
+		// lock the order so a payment settling concurrently can't slip past the cancellation
+		order, err := orderRepo.GetOrderForUpdate(ctx, orderID)
+		if err != nil {
+			return fmt.Errorf("failed to cancel order: %w", err)
+		}
+		if order.Status.IsPaid() {
+			paid = true
+			return nil
+		}
+		// a charge created since it was cancelled could still pay the order
+		if err := s.FarmerService.RequireNoPendingCharge(ctx, tx, orderID); err != nil {
+			return fmt.Errorf("failed to cancel order: %w", err)
+		}
+
+		if err := orderRepo.TransitionOrder(ctx, orderID, domain.StatusCancelled, domain.AdminActor(adminID), "cancelled by admin"); err != nil {
+			return fmt.Errorf("failed to cancel order: %w", err)
+		}
+
+		// give the reserved stock back to the catalog
+		if err := s.ReservationRepo.WithTx(tx).ReleaseOrderReservations(ctx, orderID); err != nil {
+			return fmt.Errorf("failed to release order reservations: %v", err)
+		}
+
+		// the wallet part of a split payment goes back to the wallet
+		if _, err := s.HoldService.ReleaseOrderHold(ctx, tx, orderID); err != nil {
+			return fmt.Errorf("failed to release held wallet funds: %w", err)
+		}
+
+		// Log this action
+		action := "Cancel Order"
+		details := fmt.Sprintf("Order ID %d cancelled by Admin ID %d", orderID, adminID)
+		if err := s.LogRepo.WithTx(tx).LogAction(ctx, adminID, action, details); err != nil {
+			return fmt.Errorf("failed to log cancel order action: %v", err)
+		}
+
+		return nil
+	})
+	if err != nil || !paid {
+		return nil, err
 	}
 
-	return nil
-}
\ No newline at end of file
+	// the money and the stock of a paid order go back before it is cancelled
+	return s.RefundService.CancelPaidOrder(ctx, adminID, orderID)
+}
+
+// FulfilmentStatuses are the statuses an admin moves a paid order through while it is delivered
+var FulfilmentStatuses = []domain.Status{domain.StatusPacked, domain.StatusShipped, domain.StatusDelivered}
+
+// UpdateFulfilmentStatus moves a paid order to packed, shipped or delivered. Steps can't be skipped or
+// undone, an illegal move fails with a *domain.TransitionError.
+func (s *PurchaseService) UpdateFulfilmentStatus(ctx context.Context, adminID, orderID int, status domain.Status, reason string) error {
+	if !slices.Contains(FulfilmentStatuses, status) {
+		return fmt.Errorf("%w: %s is not a fulfilment status", ErrInvalidFulfilmentStatus, status)
+	}
+
+	return s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		if err := s.OrderRepo.WithTx(tx).TransitionOrder(ctx, orderID, status, domain.AdminActor(adminID), reason); err != nil {
+			return err
+		}
+
+		details := fmt.Sprintf("Order ID %d marked %s by Admin ID %d", orderID, status, adminID)
+		if reason != "" {
+			details += ": " + reason
+		}
+		if err := s.LogRepo.WithTx(tx).LogAction(ctx, adminID, "Update Order Status", details); err != nil {
+			return fmt.Errorf("failed to log order status update: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,497 @@
+package services
+
+import (
+	domain "dgw-technical-test/internal/domain/order"
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
+	refund "dgw-technical-test/internal/models/refund"
+	wallet_model "dgw-technical-test/internal/models/wallet"
+	"dgw-technical-test/internal/money"
+	farmer_repo "dgw-technical-test/internal/repositories/farmer"
+	log_repo "dgw-technical-test/internal/repositories/log"
+	order_repo "dgw-technical-test/internal/repositories/order"
+	payment_repo "dgw-technical-test/internal/repositories/payment"
+	product_repo "dgw-technical-test/internal/repositories/product"
+	refund_repo "dgw-technical-test/internal/repositories/refund"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	credit_service "dgw-technical-test/internal/services/credit"
+	ledger_service "dgw-technical-test/internal/services/ledger"
+
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/midtrans/midtrans-go/coreapi"
+)
+
+var (
+	// ErrOrderNotFound is returned when the order to refund doesn't exist
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderNotRefundable is returned when the order isn't paid or nothing is left to refund
+	ErrOrderNotRefundable = errors.New("order can't be refunded")
+	// ErrInvalidRefund is returned when a refund names an unknown item, more units than are left
+	// or a method the order wasn't paid with
+	ErrInvalidRefund = errors.New("invalid refund request")
+	// ErrRefundNotFound is returned when a refund doesn't exist
+	ErrRefundNotFound = errors.New("refund not found")
+	// ErrRefundNotRetryable is returned when a refund that the gateway didn't refuse is retried
+	ErrRefundNotRetryable = errors.New("only failed refunds can be retried")
+)
+
+// RefundService returns money for paid orders. The refund, the restocked items, the order status
+// and, for wallet refunds and the wallet part of split refunds, the ledger credit are recorded together;
+// gateway refunds are submitted afterwards and stay pending until the gateway accepts or refuses them.
+type RefundService struct {
+	RefundRepo     *refund_repo.RefundRepository
+	OrderRepo      *order_repo.OrderRepository
+	ProductRepo    *product_repo.ProductRepository
+	PaymentRepo    *payment_repo.PaymentRepository
+	FarmerRepo     *farmer_repo.FarmerRepository
+	LogRepo        *log_repo.LogRepository
+	UnitOfWork     *unitofwork.UnitOfWork
+	LedgerService  *ledger_service.LedgerService
+	PaymentGateway payment_gateway.PaymentGateway
+	CreditService  *credit_service.CreditService
+}
+
+func NewRefundService(refundRepo *refund_repo.RefundRepository, orderRepo *order_repo.OrderRepository, productRepo *product_repo.ProductRepository, paymentRepo *payment_repo.PaymentRepository, farmerRepo *farmer_repo.FarmerRepository, logRepo *log_repo.LogRepository, unitOfWork *unitofwork.UnitOfWork, ledgerService *ledger_service.LedgerService, paymentGateway payment_gateway.PaymentGateway, creditService *credit_service.CreditService) *RefundService {
+	return &RefundService{
+		RefundRepo:     refundRepo,
+		OrderRepo:      orderRepo,
+		ProductRepo:    productRepo,
+		PaymentRepo:    paymentRepo,
+		FarmerRepo:     farmerRepo,
+		LogRepo:        logRepo,
+		UnitOfWork:     unitOfWork,
+		LedgerService:  ledgerService,
+		PaymentGateway: paymentGateway,
+		CreditService:  creditService,
+	}
+}
+
+// RefundOrder refunds some or all remaining items of a paid order. The order becomes refunded once
+// every unit was returned and keeps its status before that.
+func (s *RefundService) RefundOrder(ctx context.Context, adminID, orderID int, req refund.RefundRequest) (*refund.Refund, error) {
+	rf, err := s.record(ctx, adminID, orderID, req, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.submit(ctx, rf)
+}
+
+// CancelPaidOrder refunds everything not yet refunded of a paid order the way it was paid and cancels it.
+// Orders that were already shipped can't be cancelled, only refunded.
+func (s *RefundService) CancelPaidOrder(ctx context.Context, adminID, orderID int) (*refund.Refund, error) {
+	rf, err := s.record(ctx, adminID, orderID, refund.RefundRequest{Reason: "Order cancelled"}, true)
+	if err != nil {
+		return nil, err
+	}
+	return s.submit(ctx, rf)
+}
+
+// RetryRefund submits a refund the gateway refused again under the same refund key and returns it as it now stands.
+// Like every submission it is first looked up at the gateway, so a refund that went through after all isn't
+// refunded twice. Refunds that didn't fail are refused with ErrRefundNotRetryable.
+func (s *RefundService) RetryRefund(ctx context.Context, adminID, refundID int) (*refund.Refund, error) {
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		rf, err := s.RefundRepo.WithTx(tx).GetRefundByID(ctx, refundID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRefundNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		retried, err := s.RefundRepo.WithTx(tx).RetryRefund(ctx, refundID)
+		if err != nil {
+			return err
+		}
+		if !retried {
+			return fmt.Errorf("%w: refund %s is %s", ErrRefundNotRetryable, rf.Reference, rf.Status)
+		}
+		details := fmt.Sprintf("Admin ID %d retried refund %s of IDR %s for order ID %d", adminID, rf.Reference, *rf.GatewayAmount, rf.OrderID)
+		return s.LogRepo.WithTx(tx).LogAction(ctx, adminID, "Retry Refund", details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rf, err := s.RefundRepo.GetRefundByID(ctx, refundID)
+	if err != nil {
+		return nil, err
+	}
+	return s.submit(ctx, rf)
+}
+
+// GetRefund returns a refund, checking it with the gateway and submitting it again while it is still pending,
+// e.g. when the gateway timed out or the service stopped before it answered
+func (s *RefundService) GetRefund(ctx context.Context, refundID int) (*refund.Refund, error) {
+	rf, err := s.RefundRepo.GetRefundByID(ctx, refundID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefundNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.submit(ctx, rf)
+}
+
+// record validates the refund against what is left of the order and records it in one transaction.
+// With cancel set the order ends up cancelled.
+func (s *RefundService) record(ctx context.Context, adminID, orderID int, req refund.RefundRequest, cancel bool) (*refund.Refund, error) {
+	var created *refund.Refund
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		orderRepo := s.OrderRepo.WithTx(tx)
+		refundRepo := s.RefundRepo.WithTx(tx)
+		logRepo := s.LogRepo.WithTx(tx)
+
+		// lock the order so concurrent refunds can't return the same units twice
+		order, err := orderRepo.GetOrderForUpdate(ctx, orderID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !order.Status.IsPaid() || order.PaymentMethod == nil {
+			return ErrOrderNotRefundable
+		}
+		if cancel {
+			if err := domain.ValidateTransition(orderID, order.Status, domain.StatusCancelled); err != nil {
+				return err
+			}
+		}
+
+		items, err := refundRepo.GetRefundableItems(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		lines, err := refundLines(items, req.Items)
+		if err != nil {
+			return err
+		}
+
+		if len(lines) == 0 {
+			return ErrOrderNotRefundable
+		}
+
+		var amount money.Money
+		for _, line := range lines {
+			amount += line.Amount
+		}
+
+		method, err := refundMethod(req.Method, *order.PaymentMethod)
+		if err != nil {
+			return err
+		}
+
+		rf := &refund.Refund{
+			OrderID:   orderID,
+			FarmerID:  order.FarmerID,
+			Reference: fmt.Sprintf("rf-%d-%d", orderID, time.Now().UnixNano()),
+			Method:    method,
+			Amount:    amount,
+			Status:    refund.RefundCompleted,
+			Reason:    req.Reason,
+			AdminID:   &adminID,
+		}
+
+		// what doesn't go back through the gateway goes to the wallet
+		walletAmount := amount
+		if method == refund.RefundMethodGateway || method == refund.RefundMethodSplit {
+			payment, err := s.PaymentRepo.WithTx(tx).GetAppliedPaymentByOrderID(ctx, orderID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("%w: order %d has no settled payment", ErrInvalidRefund, orderID)
+			}
+			if err != nil {
+				return err
+			}
+			refunded, err := refundRepo.GetGatewayRefundedAmount(ctx, orderID)
+			if err != nil {
+				return err
+			}
+			chargeLeft := money.FromRupiah(payment.Amount.WholeRupiah()) - refunded
+
+			var gatewayAmount money.Money
+			if method == refund.RefundMethodGateway {
+				// the gateway moves whole rupiah, so rounding of partial refunds must not exceed what was charged
+				gatewayAmount = min(money.FromRupiah(amount.WholeRupiah()), chargeLeft)
+				if !gatewayAmount.IsPositive() {
+					return fmt.Errorf("%w: nothing left to refund through the gateway", ErrInvalidRefund)
+				}
+			} else {
+				// the online part of a split payment goes back through the gateway first, in whole rupiah,
+				// and the rest, which the wallet paid, goes back to the wallet
+				gatewayAmount = min(money.FromSen(amount.Sen()/100*100), chargeLeft)
+				walletAmount = amount - gatewayAmount
+				if !walletAmount.IsPositive() {
+					rf.Method = refund.RefundMethodGateway
+				}
+			}
+
+			if gatewayAmount.IsPositive() {
+				rf.GatewayOrderID = &payment.GatewayOrderID
+				rf.GatewayAmount = &gatewayAmount
+				rf.Status = refund.RefundPending
+			} else {
+				rf.Method = refund.RefundMethodWallet
+			}
+		}
+
+		created, err = refundRepo.CreateRefund(ctx, rf)
+		if err != nil {
+			return err
+		}
+
+		// return the refunded units to the catalog
+		productRepo := s.ProductRepo.WithTx(tx)
+		for _, line := range lines {
+			if err := refundRepo.AddRefundItem(ctx, created.ID, line); err != nil {
+				return err
+			}
+			if err := productRepo.RestockProduct(ctx, line.ProductID, line.Quantity); err != nil {
+				return err
+			}
+		}
+		created.Items = lines
+
+		var reduced money.Money
+		if created.Method == refund.RefundMethodWallet || created.Method == refund.RefundMethodSplit {
+			if *order.PaymentMethod == "credit" {
+				// what the farmer still owes for the order is written off first, only what they repaid goes back to the wallet
+				reduced, err = s.CreditService.ReduceReceivable(ctx, tx, orderID, amount, created.Reference)
+				if err != nil {
+					return err
+				}
+				walletAmount -= reduced
+			}
+
+			description := fmt.Sprintf("Refund for order %d", orderID)
+			if walletAmount.IsPositive() {
+				if err := s.LedgerService.RecordRefund(ctx, tx, order.FarmerID, walletAmount, created.Reference, description); err != nil {
+					return err
+				}
+				if err := s.FarmerRepo.WithTx(tx).RecordWalletTransaction(ctx, order.FarmerID, created.Reference, wallet_model.TransactionRefund, walletAmount, "settlement", description); err != nil {
+					return err
+				}
+			}
+		}
+
+		// a partial refund leaves the order where it is in its lifecycle
+		status := order.Status
+		switch {
+		case cancel:
+			status = domain.StatusCancelled
+		case fullyRefunded(items, lines):
+			status = domain.StatusRefunded
+		}
+		if status != order.Status {
+			if err := orderRepo.TransitionOrder(ctx, orderID, status, domain.AdminActor(adminID), req.Reason); err != nil {
+				return err
+			}
+		}
+
+		action := "Refund Order"
+		if cancel {
+			action = "Cancel Order"
+		}
+		details := fmt.Sprintf("Admin ID %d refunded IDR %s of order ID %d to the %s (refund %s, %d items restocked, order %s): %s",
+			adminID, amount, orderID, created.Method, created.Reference, len(lines), status, req.Reason)
+		if created.Method == refund.RefundMethodSplit {
+			details += fmt.Sprintf(" (IDR %s through the gateway, IDR %s to the wallet)", *created.GatewayAmount, walletAmount)
+		}
+		if reduced.IsPositive() {
+			details += fmt.Sprintf(" (IDR %s of it written off the credit receivable)", reduced)
+		}
+		if err := logRepo.LogAction(ctx, adminID, action, details); err != nil {
+			return fmt.Errorf("failed to log refund: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// submit sends the gateway part of a pending refund to the gateway and returns the refund as it now stands.
+// A refund the gateway already knows under its refund key, because an earlier submission went through
+// without an answer, is completed without being sent again. Only a refund the gateway explicitly refuses
+// is moved to failed with the gateway error, and RetryRefund submits it again under the same key; after
+// a timeout or a gateway error it stays pending and GetRefund submits it again.
+func (s *RefundService) submit(ctx context.Context, rf *refund.Refund) (*refund.Refund, error) {
+	if rf.Status != refund.RefundPending || rf.GatewayAmount == nil {
+		return rf, nil
+	}
+
+	providerReference, found, err := s.gatewayRefund(rf)
+	if err == nil && !found {
+		var resp *coreapi.RefundResponse
+		resp, err = s.PaymentGateway.RefundTransaction(*rf.GatewayOrderID, &coreapi.RefundReq{
+			RefundKey: rf.Reference,
+			Amount:    rf.GatewayAmount.WholeRupiah(),
+			Reason:    rf.Reason,
+		})
+		if err == nil {
+			providerReference = refundProviderReference(resp.RefundChargebackUUID, resp.RefundChargebackID)
+		}
+	}
+	if errors.Is(err, payment_gateway.ErrRejected) {
+		return s.fail(ctx, rf, err)
+	}
+	if err != nil {
+		return s.leavePending(ctx, rf, err)
+	}
+
+	err = s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		completed, err := s.RefundRepo.WithTx(tx).CompleteRefund(ctx, rf.ID, providerReference)
+		if err != nil || !completed {
+			return err
+		}
+		details := fmt.Sprintf("Gateway accepted refund %s of IDR %s for order ID %d", rf.Reference, *rf.GatewayAmount, rf.OrderID)
+		return s.LogRepo.WithTx(tx).LogSystemAction(ctx, "Refund Completed", details)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete refund %s: %w", rf.Reference, err)
+	}
+
+	return s.RefundRepo.GetRefundByID(ctx, rf.ID)
+}
+
+// gatewayRefund looks for the refund among the refunds of its charge at the gateway and returns its provider reference when found
+func (s *RefundService) gatewayRefund(rf *refund.Refund) (string, bool, error) {
+	resp, err := s.PaymentGateway.CheckTransaction(*rf.GatewayOrderID)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to check charge %s: %w", *rf.GatewayOrderID, err)
+	}
+	for _, r := range resp.Refunds {
+		if r.RefundKey == rf.Reference {
+			return refundProviderReference(r.RefundChargebackUUID, r.RefundChargebackID), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// fail moves a refund the gateway refused to failed and returns it as it now stands
+func (s *RefundService) fail(ctx context.Context, rf *refund.Refund, refusal error) (*refund.Refund, error) {
+	err := s.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		failed, err := s.RefundRepo.WithTx(tx).FailRefund(ctx, rf.ID, refusal.Error())
+		if err != nil || !failed {
+			return err
+		}
+		details := fmt.Sprintf("Gateway refused refund %s of IDR %s for order ID %d: %v", rf.Reference, *rf.GatewayAmount, rf.OrderID, refusal)
+		return s.LogRepo.WithTx(tx).LogSystemAction(ctx, "Refund Failed", details)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record failure of refund %s: %w", rf.Reference, err)
+	}
+	return s.RefundRepo.GetRefundByID(ctx, rf.ID)
+}
+
+// leavePending logs why a refund couldn't be settled with the gateway and returns it still pending.
+// The gateway may have acted on it, so it is checked again before it is sent again.
+func (s *RefundService) leavePending(ctx context.Context, rf *refund.Refund, cause error) (*refund.Refund, error) {
+	details := fmt.Sprintf("Refund %s of IDR %s for order ID %d stays pending: %v", rf.Reference, *rf.GatewayAmount, rf.OrderID, cause)
+	if err := s.LogRepo.LogSystemAction(ctx, "Refund Pending", details); err != nil {
+		return nil, fmt.Errorf("failed to log refund %s: %w", rf.Reference, err)
+	}
+	return rf, nil
+}
+
+// refundProviderReference returns the gateway's reference of a refund, its UUID or else its numeric ID
+func refundProviderReference(uuid string, id int) string {
+	if uuid == "" && id != 0 {
+		return strconv.Itoa(id)
+	}
+	return uuid
+}
+
+// refundLines resolves the requested items against the order, or takes every unit left when none are requested
+func refundLines(items []refund.RefundableItem, requested []refund.RefundItemRequest) ([]refund.RefundItem, error) {
+	var lines []refund.RefundItem
+	if len(requested) == 0 {
+		for _, item := range items {
+			if left := item.Quantity - item.RefundedQuantity; left > 0 {
+				lines = append(lines, refundLine(item, left))
+			}
+		}
+		return lines, nil
+	}
+
+	// add up repeated items so they are checked against what is left as a whole
+	quantities := make(map[int]int, len(requested))
+	for _, r := range requested {
+		if r.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be positive", ErrInvalidRefund)
+		}
+		quantities[r.OrderItemID] += r.Quantity
+	}
+
+	for _, item := range items {
+		quantity, ok := quantities[item.OrderItemID]
+		if !ok {
+			continue
+		}
+		delete(quantities, item.OrderItemID)
+
+		if left := item.Quantity - item.RefundedQuantity; quantity > left {
+			return nil, fmt.Errorf("%w: only %d units of order item %d are left to refund", ErrInvalidRefund, left, item.OrderItemID)
+		}
+		lines = append(lines, refundLine(item, quantity))
+	}
+
+	for orderItemID := range quantities {
+		return nil, fmt.Errorf("%w: order item %d is not part of the order", ErrInvalidRefund, orderItemID)
+	}
+	return lines, nil
+}
+
+func refundLine(item refund.RefundableItem, quantity int) refund.RefundItem {
+	return refund.RefundItem{
+		OrderItemID: item.OrderItemID,
+		ProductID:   item.ProductID,
+		Quantity:    quantity,
+		Amount:      item.Price.Mul(quantity),
+	}
+}
+
+// fullyRefunded reports whether the lines return every unit of the order that earlier refunds didn't
+func fullyRefunded(items []refund.RefundableItem, lines []refund.RefundItem) bool {
+	returned := make(map[int]int, len(lines))
+	for _, line := range lines {
+		returned[line.OrderItemID] = line.Quantity
+	}
+	for _, item := range items {
+		if item.RefundedQuantity+returned[item.OrderItemID] < item.Quantity {
+			return false
+		}
+	}
+	return true
+}
+
+// refundMethod picks how the money goes back: the way the order was paid unless the admin asked for the wallet.
+// Only orders paid online or split can be refunded through the gateway, split ones partly to the wallet;
+// refunds of orders bought on credit go to the wallet, which only receives what the farmer already repaid.
+func refundMethod(requested, paymentMethod string) (string, error) {
+	switch requested {
+	case refund.RefundMethodWallet:
+		return refund.RefundMethodWallet, nil
+	case refund.RefundMethodGateway:
+		if paymentMethod != "online" && paymentMethod != "split" {
+			return "", fmt.Errorf("%w: order was paid by %s, not through the gateway", ErrInvalidRefund, paymentMethod)
+		}
+		return refundMethod("", paymentMethod)
+	case "":
+		switch paymentMethod {
+		case "online":
+			return refund.RefundMethodGateway, nil
+		case "split":
+			return refund.RefundMethodSplit, nil
+		}
+		return refund.RefundMethodWallet, nil
+	default:
+		return "", fmt.Errorf("%w: unknown refund method %q", ErrInvalidRefund, requested)
+	}
+}
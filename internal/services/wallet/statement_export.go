@@ -0,0 +1,88 @@
+package services
+
+import (
+	ledger "dgw-technical-test/internal/models/ledger"
+	wallet "dgw-technical-test/internal/models/wallet"
+	"dgw-technical-test/internal/money"
+	"dgw-technical-test/internal/pdf"
+
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// movementLabels names ledger entry types on statements
+var movementLabels = map[string]string{
+	ledger.EntryTopUp:           "Top-up",
+	ledger.EntryOrderPayment:    "Order payment",
+	ledger.EntryRefund:          "Refund",
+	ledger.EntryAdjustment:      "Adjustment",
+	ledger.EntryPayoutHold:      "Payout",
+	ledger.EntryPayoutReversal:  "Payout returned",
+	ledger.EntryCreditRepayment: "Credit repayment",
+}
+
+func movementLabel(entryType string) string {
+	if label, ok := movementLabels[entryType]; ok {
+		return label
+	}
+	return entryType
+}
+
+// WriteStatementCSV writes a statement as CSV: the opening balance row, one row per movement, then the closing balance row
+func WriteStatementCSV(w io.Writer, st *wallet.Statement) error {
+	amount := money.Money.String
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "type", "reference", "description", "credit", "debit", "balance"})
+	cw.Write([]string{st.PeriodStart.Format("2006-01-02"), "Opening balance", "", "", "", "", amount(st.OpeningBalance)})
+	for _, l := range st.Lines {
+		cw.Write([]string{l.Date.Format("2006-01-02 15:04:05"), movementLabel(l.EntryType), l.Reference, l.Description, amount(l.Credit), amount(l.Debit), amount(l.Balance)})
+	}
+	cw.Write([]string{st.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02"), "Closing balance", "", "", amount(st.TotalCredits), amount(st.TotalDebits), amount(st.ClosingBalance)})
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteStatementPDF writes a statement as a one-column PDF report
+func WriteStatementPDF(w io.Writer, st *wallet.Statement) error {
+	doc := pdf.New()
+	doc.Text(14, true, "DGW Wallet Statement")
+	doc.Blank(9)
+	doc.Text(9, false, fmt.Sprintf("Farmer    : %s (ID %d)", st.FarmerName, st.FarmerID))
+	doc.Text(9, false, fmt.Sprintf("Period    : %s to %s", st.PeriodStart.Format("02 Jan 2006"), st.PeriodEnd.AddDate(0, 0, -1).Format("02 Jan 2006")))
+	doc.Text(9, false, fmt.Sprintf("Generated : %s", st.GeneratedAt.Format("02 Jan 2006 15:04")))
+	doc.Blank(9)
+
+	row := "%-16s %-15s %-22s %13s %13s %13s"
+	doc.Text(8, true, fmt.Sprintf(row, "Date", "Type", "Reference", "Credit", "Debit", "Balance"))
+	doc.Text(8, false, fmt.Sprintf(row, st.PeriodStart.Format("2006-01-02"), "Opening", "", "", "", st.OpeningBalance.Format()))
+	for _, l := range st.Lines {
+		doc.Text(8, false, fmt.Sprintf(row, l.Date.Format("2006-01-02 15:04"), movementLabel(l.EntryType), truncate(l.Reference, 22),
+			formatOptionalIDR(l.Credit), formatOptionalIDR(l.Debit), l.Balance.Format()))
+	}
+	doc.Text(8, true, fmt.Sprintf(row, st.PeriodEnd.AddDate(0, 0, -1).Format("2006-01-02"), "Closing", "", st.TotalCredits.Format(), st.TotalDebits.Format(), st.ClosingBalance.Format()))
+
+	if len(st.Lines) == 0 {
+		doc.Blank(8)
+		doc.Text(8, false, "No wallet movements in this period.")
+	}
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+func formatOptionalIDR(v money.Money) string {
+	if v.IsZero() {
+		return ""
+	}
+	return v.Format()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "~"
+}
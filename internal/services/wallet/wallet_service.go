@@ -0,0 +1,110 @@
+package services
+
+import (
+	wallet "dgw-technical-test/internal/models/wallet"
+	farmer_repo "dgw-technical-test/internal/repositories/farmer"
+	wallet_repo "dgw-technical-test/internal/repositories/wallet"
+
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrInvalidFilter is returned when wallet history filters can't be applied
+	ErrInvalidFilter = errors.New("invalid wallet transaction filter")
+	// ErrInvalidMonth is returned when a statement month isn't formatted as YYYY-MM
+	ErrInvalidMonth = errors.New("invalid statement month")
+)
+
+// page sizes of the wallet history
+const (
+	defaultTransactionLimit = 20
+	maxTransactionLimit     = 100
+)
+
+// WalletService serves a farmer's wallet history and monthly statements
+type WalletService struct {
+	WalletRepo *wallet_repo.WalletRepository
+	FarmerRepo *farmer_repo.FarmerRepository
+}
+
+func NewWalletService(walletRepo *wallet_repo.WalletRepository, farmerRepo *farmer_repo.FarmerRepository) *WalletService {
+	return &WalletService{
+		WalletRepo: walletRepo,
+		FarmerRepo: farmerRepo,
+	}
+}
+
+// ListTransactions returns a page of the farmer's wallet transactions, newest first
+func (s *WalletService) ListTransactions(ctx context.Context, farmerID int, filter wallet.TransactionFilter) (*wallet.TransactionPage, error) {
+	switch filter.Status {
+	case "", "pending", "settlement", "failed":
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidFilter, filter.Status)
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidFilter)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultTransactionLimit
+	}
+	if filter.Limit > maxTransactionLimit {
+		filter.Limit = maxTransactionLimit
+	}
+
+	page, err := s.WalletRepo.ListTransactions(ctx, farmerID, filter)
+	if errors.Is(err, wallet_repo.ErrInvalidCursor) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+	}
+	return page, err
+}
+
+// GetStatement builds the farmer's statement for a month (YYYY-MM) from the ledger: the opening balance,
+// every movement of the wallet with its running balance, and the closing balance
+func (s *WalletService) GetStatement(ctx context.Context, farmerID int, month string) (*wallet.Statement, error) {
+	start, err := time.Parse("2006-01", month)
+	if err != nil {
+		return nil, ErrInvalidMonth
+	}
+	end := start.AddDate(0, 1, 0)
+
+	farmer, err := s.FarmerRepo.GetFarmerByID(farmerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get farmer: %w", err)
+	}
+
+	opening, err := s.WalletRepo.GetWalletBalanceBefore(ctx, farmerID, start)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := s.WalletRepo.GetWalletMovements(ctx, farmerID, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := &wallet.Statement{
+		FarmerID:       farmerID,
+		FarmerName:     farmer.Name,
+		Month:          month,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		OpeningBalance: opening,
+		Lines:          lines,
+		GeneratedAt:    time.Now(),
+	}
+
+	balance := opening
+	for i := range statement.Lines {
+		line := &statement.Lines[i]
+		balance += line.Credit - line.Debit
+		line.Balance = balance
+		statement.TotalCredits += line.Credit
+		statement.TotalDebits += line.Debit
+	}
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
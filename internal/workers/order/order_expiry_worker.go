@@ -0,0 +1,182 @@
+package workers
+
+import (
+	domain "dgw-technical-test/internal/domain/order"
+	log_repo "dgw-technical-test/internal/repositories/log"
+	order_repo "dgw-technical-test/internal/repositories/order"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	farmer_service "dgw-technical-test/internal/services/farmer"
+	hold_service "dgw-technical-test/internal/services/hold"
+	"dgw-technical-test/utils"
+
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// orderExpiryLockKey is the Postgres advisory lock key that keeps replicas from scanning at the same time
+	orderExpiryLockKey int64 = 7_400_001
+
+	defaultGracePeriod  = 15 * time.Minute
+	defaultScanInterval = 5 * time.Minute
+	defaultBatchSize    = 100
+)
+
+// OrderExpiryWorker periodically expires orders that weren't paid before their payment_due_at
+// (plus a grace period), releases their stock reservations and the wallet money held for their split payments,
+// and records the action in logs as the system actor. The gateway is asked about an order's pending charge first,
+// and an order whose charge settled is paid instead of expired.
+type OrderExpiryWorker struct {
+	OrderRepo       *order_repo.OrderRepository
+	ReservationRepo *reservation_repo.ReservationRepository
+	LogRepo         *log_repo.LogRepository
+	UnitOfWork      *unitofwork.UnitOfWork
+	HoldService     *hold_service.HoldService
+	FarmerService   *farmer_service.FarmerService
+	GracePeriod     time.Duration
+	ScanInterval    time.Duration
+	BatchSize       int
+}
+
+// NewOrderExpiryWorker creates the worker, configured by ORDER_EXPIRY_GRACE_PERIOD,
+// ORDER_EXPIRY_SCAN_INTERVAL and ORDER_EXPIRY_BATCH_SIZE
+func NewOrderExpiryWorker(orderRepo *order_repo.OrderRepository, reservationRepo *reservation_repo.ReservationRepository, logRepo *log_repo.LogRepository, unitOfWork *unitofwork.UnitOfWork, holdService *hold_service.HoldService, farmerService *farmer_service.FarmerService) *OrderExpiryWorker {
+	return &OrderExpiryWorker{
+		OrderRepo:       orderRepo,
+		ReservationRepo: reservationRepo,
+		LogRepo:         logRepo,
+		UnitOfWork:      unitOfWork,
+		HoldService:     holdService,
+		FarmerService:   farmerService,
+		GracePeriod:     utils.DurationFromEnv("ORDER_EXPIRY_GRACE_PERIOD", defaultGracePeriod),
+		ScanInterval:    utils.DurationFromEnv("ORDER_EXPIRY_SCAN_INTERVAL", defaultScanInterval),
+		BatchSize:       utils.IntFromEnv("ORDER_EXPIRY_BATCH_SIZE", defaultBatchSize),
+	}
+}
+
+// Start runs the worker in the background until ctx is cancelled. A zero scan interval disables it.
+func (w *OrderExpiryWorker) Start(ctx context.Context) {
+	if w.ScanInterval <= 0 {
+		log.Println("Order expiry worker disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(w.ScanInterval)
+		defer ticker.Stop()
+
+		for {
+			if cancelled, err := w.RunOnce(ctx); err != nil {
+				log.Printf("Order expiry worker failed: %v", err)
+			} else if cancelled > 0 {
+				log.Printf("Order expiry worker expired %d overdue orders", cancelled)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce expires one batch of overdue orders and returns how many were expired. When another
+// replica holds the advisory lock the scan is skipped and 0 is returned. Each order is handled in a
+// transaction of its own, and one that can't be handled now is logged and left for a later scan.
+func (w *OrderExpiryWorker) RunOnce(ctx context.Context) (int, error) {
+	orderIDs, err := w.claimOverdueOrders(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	for _, orderID := range orderIDs {
+		expired, err := w.expireOrder(ctx, orderID)
+		if err != nil {
+			log.Printf("Order expiry worker skipped order %d: %v", orderID, err)
+			continue
+		}
+		if expired {
+			cancelled++
+		}
+	}
+
+	// housekeeping: mark reservations that expired on orders still awaiting payment
+	if _, err := w.ReservationRepo.ReleaseExpiredReservations(ctx); err != nil {
+		return cancelled, err
+	}
+	return cancelled, nil
+}
+
+// claimOverdueOrders picks a batch of overdue orders under the advisory lock. The orders aren't checked
+// again before the next scan, so one that is skipped doesn't come back first and hold up the others.
+func (w *OrderExpiryWorker) claimOverdueOrders(ctx context.Context) ([]int, error) {
+	var orderIDs []int
+	err := w.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		acquired, err := unitofwork.TryAdvisoryLock(ctx, tx, orderExpiryLockKey)
+		if err != nil || !acquired {
+			return err
+		}
+
+		now := time.Now()
+		orderIDs, err = w.OrderRepo.WithTx(tx).ClaimOverdueOrders(ctx, now.Add(-w.GracePeriod), now, now.Add(w.ScanInterval), w.BatchSize)
+		return err
+	})
+	return orderIDs, err
+}
+
+// expireOrder expires one overdue order and reports whether it did. The gateway is asked about the
+// order's pending charge first, outside any transaction: a charge that settled pays the order instead.
+func (w *OrderExpiryWorker) expireOrder(ctx context.Context, orderID int) (bool, error) {
+	paid, err := w.FarmerService.SettlePendingCharge(ctx, orderID)
+	if err != nil || paid {
+		return false, err
+	}
+
+	expired := false
+	err = w.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		orderRepo := w.OrderRepo.WithTx(tx)
+		order, err := orderRepo.GetOrderForUpdate(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		// paid, cancelled or charged again since it was claimed
+		if !order.Status.AwaitsPayment() {
+			return nil
+		}
+		err = w.FarmerService.RequireNoPendingCharge(ctx, tx, orderID)
+		if errors.Is(err, farmer_service.ErrChargePending) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := orderRepo.TransitionOrder(ctx, orderID, domain.StatusExpired, domain.SystemActor(), "payment deadline passed"); err != nil {
+			return err
+		}
+
+		if err := w.ReservationRepo.WithTx(tx).ReleaseOrderReservations(ctx, orderID); err != nil {
+			return err
+		}
+
+		if _, err := w.HoldService.ReleaseOrderHold(ctx, tx, orderID); err != nil {
+			return err
+		}
+
+		details := fmt.Sprintf("Order ID %d expired: payment deadline passed (grace period %s)", orderID, w.GracePeriod)
+		if err := w.LogRepo.WithTx(tx).LogSystemAction(ctx, "Expire Order", details); err != nil {
+			return err
+		}
+		expired = true
+		return nil
+	})
+	return expired, err
+}
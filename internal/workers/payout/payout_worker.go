@@ -0,0 +1,110 @@
+package workers
+
+import (
+	payout_repo "dgw-technical-test/internal/repositories/payout"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	payout_service "dgw-technical-test/internal/services/payout"
+	"dgw-technical-test/utils"
+
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// payoutLockKey is the Postgres advisory lock key that keeps replicas from scanning at the same time
+	payoutLockKey int64 = 7_400_002
+
+	// submissionWindow is how long RequestPayout is left to submit a new payout before the worker does
+	submissionWindow = time.Minute
+
+	defaultScanInterval = time.Minute
+	defaultBatchSize    = 100
+)
+
+// PayoutWorker periodically submits payouts that are still pending because their submission to the provider
+// failed, so a payout isn't left holding the farmer's money until someone looks it up.
+type PayoutWorker struct {
+	PayoutRepo    *payout_repo.PayoutRepository
+	UnitOfWork    *unitofwork.UnitOfWork
+	PayoutService *payout_service.PayoutService
+	ScanInterval  time.Duration
+	BatchSize     int
+}
+
+// NewPayoutWorker creates the worker, configured by PAYOUT_RETRY_SCAN_INTERVAL and PAYOUT_RETRY_BATCH_SIZE
+func NewPayoutWorker(payoutRepo *payout_repo.PayoutRepository, unitOfWork *unitofwork.UnitOfWork, payoutService *payout_service.PayoutService) *PayoutWorker {
+	return &PayoutWorker{
+		PayoutRepo:    payoutRepo,
+		UnitOfWork:    unitOfWork,
+		PayoutService: payoutService,
+		ScanInterval:  utils.DurationFromEnv("PAYOUT_RETRY_SCAN_INTERVAL", defaultScanInterval),
+		BatchSize:     utils.IntFromEnv("PAYOUT_RETRY_BATCH_SIZE", defaultBatchSize),
+	}
+}
+
+// Start runs the worker in the background until ctx is cancelled. A zero scan interval disables it.
+func (w *PayoutWorker) Start(ctx context.Context) {
+	if w.ScanInterval <= 0 {
+		log.Println("Payout worker disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(w.ScanInterval)
+		defer ticker.Stop()
+
+		for {
+			if submitted, err := w.RunOnce(ctx); err != nil {
+				log.Printf("Payout worker failed: %v", err)
+			} else if submitted > 0 {
+				log.Printf("Payout worker submitted %d pending payouts", submitted)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce submits one batch of pending payouts again and returns how many the provider accepted or resolved.
+// When another replica holds the advisory lock the scan is skipped and 0 is returned. A payout whose
+// submission fails again is logged and left for a later scan.
+func (w *PayoutWorker) RunOnce(ctx context.Context) (int, error) {
+	payoutIDs, err := w.claimPendingPayouts(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	submitted := 0
+	for _, payoutID := range payoutIDs {
+		if _, err := w.PayoutService.ResubmitPayout(ctx, payoutID); err != nil {
+			log.Printf("Payout worker skipped payout %d: %v", payoutID, err)
+			continue
+		}
+		submitted++
+	}
+	return submitted, nil
+}
+
+// claimPendingPayouts picks a batch of pending payouts under the advisory lock. The payouts aren't submitted
+// again before the next scan, so one the provider keeps failing on doesn't come back first and hold up the others.
+func (w *PayoutWorker) claimPendingPayouts(ctx context.Context) ([]int, error) {
+	var payoutIDs []int
+	err := w.UnitOfWork.Do(ctx, func(tx pgx.Tx) error {
+		acquired, err := unitofwork.TryAdvisoryLock(ctx, tx, payoutLockKey)
+		if err != nil || !acquired {
+			return err
+		}
+
+		now := time.Now()
+		payoutIDs, err = w.PayoutRepo.WithTx(tx).ClaimPendingPayouts(ctx, now.Add(-submissionWindow), now, now.Add(w.ScanInterval), w.BatchSize)
+		return err
+	})
+	return payoutIDs, err
+}
@@ -5,13 +5,39 @@ import (
 	farmer_handler "dgw-technical-test/internal/handlers/farmer"
 	admin_handler "dgw-technical-test/internal/handlers/admin"
 	product_handler "dgw-technical-test/internal/handlers/product"
+	payment_handler "dgw-technical-test/internal/handlers/payment"
+	auth_handler "dgw-technical-test/internal/handlers/auth"
+	ledger_handler "dgw-technical-test/internal/handlers/ledger"
+	payout_handler "dgw-technical-test/internal/handlers/payout"
+	wallet_handler "dgw-technical-test/internal/handlers/wallet"
+	refund_handler "dgw-technical-test/internal/handlers/refund"
+	cart_handler "dgw-technical-test/internal/handlers/cart"
+	order_handler "dgw-technical-test/internal/handlers/order"
+	credit_handler "dgw-technical-test/internal/handlers/credit"
 	
 	"dgw-technical-test/internal/middleware"
+	"dgw-technical-test/internal/auth"
+
+	payment_gateway "dgw-technical-test/internal/gateways/payment"
+	payout_gateway "dgw-technical-test/internal/gateways/payout"
 	
 	farmer_service "dgw-technical-test/internal/services/farmer"
 	admin_service "dgw-technical-test/internal/services/admin"
 	product_service "dgw-technical-test/internal/services/product"
 	purchase_service "dgw-technical-test/internal/services/purchase"
+	payment_service "dgw-technical-test/internal/services/payment"
+	auth_service "dgw-technical-test/internal/services/auth"
+	ledger_service "dgw-technical-test/internal/services/ledger"
+	payout_service "dgw-technical-test/internal/services/payout"
+	idempotency_service "dgw-technical-test/internal/services/idempotency"
+	wallet_service "dgw-technical-test/internal/services/wallet"
+	refund_service "dgw-technical-test/internal/services/refund"
+	pricing_service "dgw-technical-test/internal/services/pricing"
+	policy_service "dgw-technical-test/internal/services/policy"
+	cart_service "dgw-technical-test/internal/services/cart"
+	order_service "dgw-technical-test/internal/services/order"
+	hold_service "dgw-technical-test/internal/services/hold"
+	credit_service "dgw-technical-test/internal/services/credit"
 	
 	farmer_repo "dgw-technical-test/internal/repositories/farmer"
 	admin_repo "dgw-technical-test/internal/repositories/admin"	
@@ -19,14 +45,46 @@ import (
 	order_repo "dgw-technical-test/internal/repositories/order"
 	log_repo   "dgw-technical-test/internal/repositories/log"
 	review_repo "dgw-technical-test/internal/repositories/review"
+	unitofwork "dgw-technical-test/internal/repositories/unitofwork"
+	payment_repo "dgw-technical-test/internal/repositories/payment"
+	reservation_repo "dgw-technical-test/internal/repositories/reservation"
+	session_repo "dgw-technical-test/internal/repositories/session"
+	ledger_repo "dgw-technical-test/internal/repositories/ledger"
+	payout_repo "dgw-technical-test/internal/repositories/payout"
+	idempotency_repo "dgw-technical-test/internal/repositories/idempotency"
+	wallet_repo "dgw-technical-test/internal/repositories/wallet"
+	refund_repo "dgw-technical-test/internal/repositories/refund"
+	cart_repo "dgw-technical-test/internal/repositories/cart"
+	hold_repo "dgw-technical-test/internal/repositories/hold"
+	credit_repo "dgw-technical-test/internal/repositories/credit"
+
+	order_worker "dgw-technical-test/internal/workers/order"
+	payout_worker "dgw-technical-test/internal/workers/payout"
 
 	_ "dgw-technical-test/internal/models/admin"
 	_  "dgw-technical-test/internal/models/farmer"
 	_  "dgw-technical-test/internal/models/order"
 	_ "dgw-technical-test/internal/models/product"
 	_ "dgw-technical-test/internal/models/review"
-
+	_ "dgw-technical-test/internal/models/payment"
+	_ "dgw-technical-test/internal/models/reservation"
+	_ "dgw-technical-test/internal/models/auth"
+	_ "dgw-technical-test/internal/models/ledger"
+	_ "dgw-technical-test/internal/models/payout"
+	_ "dgw-technical-test/internal/models/idempotency"
+	_ "dgw-technical-test/internal/models/wallet"
+	_ "dgw-technical-test/internal/models/refund"
+	_ "dgw-technical-test/internal/models/cart"
+	_ "dgw-technical-test/internal/models/credit"
+
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -37,7 +95,8 @@ import (
 	swaggerFiles "github.com/swaggo/files"
 )
 
-func InitializeApp() *gin.Engine {
+// InitializeApp wires the dependencies and routes; background workers run until ctx is cancelled
+func InitializeApp(ctx context.Context) *gin.Engine {
 	// Initialize Gin
 	router := gin.Default()
 
@@ -57,17 +116,94 @@ func InitializeApp() *gin.Engine {
 	orderRepository := order_repo.NewOrderRepository(config.Pool)
 	logRepository := log_repo.NewLogRepository(config.Pool)
 	reviewRepository := review_repo.NewReviewRepository(config.Pool)
+	paymentRepository := payment_repo.NewPaymentRepository(config.Pool)
+	reservationRepository := reservation_repo.NewReservationRepository(config.Pool)
+	sessionRepository := session_repo.NewSessionRepository(config.Pool)
+	ledgerRepository := ledger_repo.NewLedgerRepository(config.Pool)
+	payoutRepository := payout_repo.NewPayoutRepository(config.Pool)
+	idempotencyRepository := idempotency_repo.NewIdempotencyRepository(config.Pool)
+	walletRepository := wallet_repo.NewWalletRepository(config.Pool)
+	refundRepository := refund_repo.NewRefundRepository(config.Pool)
+	cartRepository := cart_repo.NewCartRepository(config.Pool)
+	holdRepository := hold_repo.NewHoldRepository(config.Pool)
+	creditRepository := credit_repo.NewCreditRepository(config.Pool)
+
+	// unit of work shared by services that need several repositories in one transaction
+	unitOfWork := unitofwork.NewUnitOfWork(config.Pool)
+
+	// Create the payment gateway selected by PAYMENT_GATEWAY (midtrans or fake)
+	paymentGateway, err := payment_gateway.NewPaymentGateway()
+	if err != nil {
+		log.Fatalf("Failed to initialize payment gateway: %v", err)
+	}
+
+	// Create the catalog of payment channels enabled by PAYMENT_CHANNELS (all of them by default)
+	paymentChannels, err := payment_gateway.NewChannelCatalog()
+	if err != nil {
+		log.Fatalf("Failed to initialize payment channels: %v", err)
+	}
+
+	// Create the payout provider selected by PAYOUT_PROVIDER, the server doesn't start without one
+	payoutProvider, err := payout_gateway.NewPayoutProvider()
+	if err != nil {
+		log.Fatalf("Failed to initialize payout provider: %v", err)
+	}
+
+	// Create the token signer selected by JWT_ALGORITHM (HS256, RS256 or EdDSA)
+	signer, err := auth.NewSignerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize token signer: %v", err)
+	}
 
 	// Create the necessary services
-	farmerService := farmer_service.NewFarmerService(farmerRepository, productRepository, orderRepository, reviewRepository)
-	adminService := admin_service.NewAdminService(adminRepository, reviewRepository)
+	authService := auth_service.NewAuthService(sessionRepository, adminRepository, farmerRepository, unitOfWork, signer)
+	ledgerService := ledger_service.NewLedgerService(ledgerRepository, unitOfWork)
+	pricingService := pricing_service.NewPricingService(productRepository)
+	ownershipPolicy := policy_service.NewOwnershipPolicy(orderRepository, farmerRepository)
+	holdService := hold_service.NewHoldService(holdRepository, farmerRepository, ledgerService)
+	creditService := credit_service.NewCreditService(creditRepository, farmerRepository, logRepository, unitOfWork, ledgerService, paymentGateway, paymentChannels)
+	farmerService := farmer_service.NewFarmerService(farmerRepository, productRepository, orderRepository, reviewRepository, paymentRepository, reservationRepository, logRepository, unitOfWork, paymentGateway, paymentChannels, ledgerService, pricingService, ownershipPolicy, holdService, creditService)
+	payoutService := payout_service.NewPayoutService(payoutRepository, farmerRepository, unitOfWork, ledgerService, payoutProvider)
+	walletService := wallet_service.NewWalletService(walletRepository, farmerRepository)
+	idempotencyService := idempotency_service.NewIdempotencyService(idempotencyRepository)
+	adminService := admin_service.NewAdminService(adminRepository, reviewRepository, unitOfWork)
 	productService := product_service.NewProductService(productRepository)
-	purchaseService := purchase_service.NewPurchaseService(*productRepository, *orderRepository, *logRepository)
+	refundService := refund_service.NewRefundService(refundRepository, orderRepository, productRepository, paymentRepository, farmerRepository, logRepository, unitOfWork, ledgerService, paymentGateway, creditService)
+	purchaseService := purchase_service.NewPurchaseService(*productRepository, *orderRepository, *logRepository, *reservationRepository, unitOfWork, refundService, pricingService, holdService, farmerService)
+	cartService := cart_service.NewCartService(cartRepository, productRepository, unitOfWork, pricingService, purchaseService, farmerService)
+	paymentService := payment_service.NewPaymentService(farmerService, creditService, paymentGateway, paymentChannels)
+	orderService := order_service.NewOrderService(orderRepository)
+
+	// start the background worker that cancels orders left unpaid past their deadline
+	orderExpiryWorker := order_worker.NewOrderExpiryWorker(orderRepository, reservationRepository, logRepository, unitOfWork, holdService, farmerService)
+	orderExpiryWorker.Start(ctx)
+
+	// start the background worker that submits payouts again when their submission failed
+	payoutWorker := payout_worker.NewPayoutWorker(payoutRepository, unitOfWork, payoutService)
+	payoutWorker.Start(ctx)
 
 	// create farmer handler and inject service
-	farmerHandler := farmer_handler.NewFarmerHandler(farmerService)
-	adminHandler := admin_handler.NewAdminHandler(adminService, purchaseService)
+	farmerHandler := farmer_handler.NewFarmerHandler(farmerService, authService)
+	adminHandler := admin_handler.NewAdminHandler(adminService, purchaseService, authService)
 	productHandler := product_handler.NewProductHandler(productService)
+	paymentHandler := payment_handler.NewPaymentHandler(paymentService)
+	authHandler := auth_handler.NewAuthHandler(authService)
+	ledgerHandler := ledger_handler.NewLedgerHandler(ledgerService)
+	payoutHandler := payout_handler.NewPayoutHandler(payoutService)
+	walletHandler := wallet_handler.NewWalletHandler(walletService)
+	refundHandler := refund_handler.NewRefundHandler(refundService)
+	cartHandler := cart_handler.NewCartHandler(cartService)
+	orderHandler := order_handler.NewOrderHandler(orderService)
+	creditHandler := credit_handler.NewCreditHandler(creditService, farmerService)
+
+	// JWT authentication backed by server-side sessions, shared by every protected route
+	authMiddleware := middleware.JWTAuthMiddleware(signer, authService)
+
+	// Idempotency-Key support for the money-moving endpoints, placed after authentication
+	idempotent := middleware.IdempotencyMiddleware(idempotencyService)
+
+	// every protected route is guarded by JWTAuthMiddleware followed by the permission it requires,
+	// see middleware.Permissions for the role matrix
 
 	// farmers route grouping under "farmers"
 	farmerRoutes := router.Group("/farmers")
@@ -79,47 +215,115 @@ func InitializeApp() *gin.Engine {
 		farmerRoutes.POST("/login", farmerHandler.LoginFarmer)
 
 		// get wallet balance (protected by JWT middleware)
-		farmerRoutes.GET("/wallet-balance", middleware.JWTAuthMiddleware(), farmerHandler.GetWalletBalance)
+		farmerRoutes.GET("/wallet-balance", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), farmerHandler.GetWalletBalance)
+
+		// wallet history with cursor pagination and filters
+		farmerRoutes.GET("/wallet/transactions", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), walletHandler.ListTransactions)
+
+		// monthly wallet statement as JSON, CSV or PDF
+		farmerRoutes.GET("/wallet/statements/:month", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), walletHandler.GetStatement)
+
+		// top up the wallet through a charge on the chosen payment channel (protected by JWT middleware)
+		farmerRoutes.POST("/wallet/top-up", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), idempotent, farmerHandler.TopUpWallet)
 
-		// withdraw money from the bank (protected by JWT middleware)
-		farmerRoutes.POST("/withdraw", middleware.JWTAuthMiddleware(), farmerHandler.WithdrawMoney)
+		// route to check a top-up and credit the wallet once it settled
+		farmerRoutes.GET("/wallet/top-up/:order_id/status", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), farmerHandler.GetTopUpStatus)
 
-		// route to check withdrawal status (Top-Up)
-		farmerRoutes.GET("/withdrawal-status/:order_id", middleware.JWTAuthMiddleware(), farmerHandler.GetWithdrawalStatus)
+		// pay wallet money out to the farmer's bank account
+		farmerRoutes.POST("/wallet/payouts", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), idempotent, payoutHandler.RequestPayout)
+
+		// route to check a payout and resolve it with the payout provider
+		farmerRoutes.GET("/wallet/payouts/:payout_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), payoutHandler.GetPayout)
 		
 		// route to pay the pending order using wallet payment
-		farmerRoutes.POST("/pay-order/wallet/:order_id", middleware.JWTAuthMiddleware(), farmerHandler.PayOrder)
+		farmerRoutes.POST("/pay-order/wallet/:order_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), idempotent, farmerHandler.PayOrder)
 
 		// route to pay the pending order using online payment
-		farmerRoutes.POST("/pay-order/online/:order_id", middleware.JWTAuthMiddleware(), farmerHandler.ProcessOnlinePayment)
+		farmerRoutes.POST("/pay-order/online/:order_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), idempotent, farmerHandler.ProcessOnlinePayment)
+
+		// pay an order partly from the wallet and the rest online
+		farmerRoutes.POST("/pay-order/split/:order_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), idempotent, farmerHandler.PaySplit)
+
+		// buy an order on the farmer's credit facility
+		farmerRoutes.POST("/pay-order/credit/:order_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), idempotent, creditHandler.PayOrderOnCredit)
 
-		// route to check transaction status
-		farmerRoutes.GET("/check-status/:order_id/:midtrans_order_id", middleware.JWTAuthMiddleware(), farmerHandler.CheckAndProcessOrderStatus)
+		// the farmer's credit facility and receivables, and repayments from the wallet or through a payment channel
+		farmerRoutes.GET("/credit", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), creditHandler.GetCreditAccount)
+		farmerRoutes.POST("/credit/receivables/:receivable_id/repayments", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), idempotent, creditHandler.RepayReceivable)
+		farmerRoutes.GET("/credit/repayments/:repayment_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), creditHandler.GetRepayment)
+
+		// route to check transaction status (the gateway order ID is resolved server-side)
+		farmerRoutes.GET("/check-status/:order_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), farmerHandler.CheckAndProcessOrderStatus)
+
+		// the farmer's order history and order detail
+		farmerRoutes.GET("/orders", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), orderHandler.ListFarmerOrders)
+		farmerRoutes.GET("/orders/:order_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), orderHandler.GetFarmerOrder)
+
+		// the farmer's cart, priced from the catalog
+		farmerRoutes.GET("/cart", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), cartHandler.GetCart)
+		farmerRoutes.POST("/cart/items", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), cartHandler.AddCartItem)
+		farmerRoutes.PUT("/cart/items/:product_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), cartHandler.UpdateCartItem)
+		farmerRoutes.DELETE("/cart/items/:product_id", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), cartHandler.RemoveCartItem)
+
+		// turn the cart into an order paid from the wallet, by an online charge or on credit
+		farmerRoutes.POST("/checkout", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), idempotent, cartHandler.Checkout)
 
 		// route to leave a review 
-		farmerRoutes.POST("/:order_id/add-review", middleware.JWTAuthMiddleware(), farmerHandler.AddReview)
+		farmerRoutes.POST("/:order_id/add-review", authMiddleware, middleware.RequirePermission(middleware.PermFarmerAccount), farmerHandler.AddReview)
 	}
 
 	// admin route grouping under "admins" hehe
 	adminRoutes := router.Group("/admins")
 	{
-		// Register admin
-		adminRoutes.POST("/register", adminHandler.RegisterAdmin)
+		// invite a new admin (Super Admin only); there is no open admin registration
+		adminRoutes.POST("/invitations", authMiddleware, middleware.RequirePermission(middleware.PermInviteAdmin), adminHandler.CreateInvitation)
+
+		// redeem an invitation token to create the invited admin
+		adminRoutes.POST("/invitations/accept", adminHandler.AcceptInvitation)
 
 		// Login admin
 		adminRoutes.POST("/login", adminHandler.LoginAdmin)
 
 		// protected route for admin facilitating purchase for farmers
-		adminRoutes.POST("/facilitate-purchase/:farmerID", middleware.JWTAuthMiddleware(), adminHandler.FacilitatePurchase)
+		adminRoutes.POST("/facilitate-purchase/:farmerID", authMiddleware, middleware.RequirePermission(middleware.PermFacilitatePurchase), idempotent, adminHandler.FacilitatePurchase)
 		
-		// protected route for admin facilitating purchase for farmers
-		adminRoutes.PUT("/cancel-order/:orderID", middleware.JWTAuthMiddleware(), adminHandler.CancelOrderHandler)
+		// protected route for admin cancelling an order, paid orders are refunded first
+		adminRoutes.PUT("/cancel-order/:orderID", authMiddleware, middleware.RequirePermission(middleware.PermCancelOrder), idempotent, adminHandler.CancelOrderHandler)
+
+		// list orders of every farmer with filters, and view one with its status history
+		adminRoutes.GET("/orders", authMiddleware, middleware.RequirePermission(middleware.PermViewOrders), orderHandler.ListOrders)
+		adminRoutes.GET("/orders/:orderID", authMiddleware, middleware.RequirePermission(middleware.PermViewOrders), orderHandler.GetOrder)
+
+		// move a paid order through packed, shipped and delivered
+		adminRoutes.PUT("/orders/:orderID/status", authMiddleware, middleware.RequirePermission(middleware.PermFulfilOrder), adminHandler.UpdateOrderStatus)
+
+		// refund some or all items of a paid order to the wallet or through the payment gateway
+		adminRoutes.POST("/orders/:orderID/refunds", authMiddleware, middleware.RequirePermission(middleware.PermRefundOrder), idempotent, refundHandler.RefundOrder)
+
+		// route to check a refund and submit it to the payment gateway again while it is pending
+		adminRoutes.GET("/refunds/:refund_id", authMiddleware, middleware.RequirePermission(middleware.PermRefundOrder), refundHandler.GetRefund)
+
+		// submit a refund the payment gateway refused again
+		adminRoutes.POST("/refunds/:refund_id/retry", authMiddleware, middleware.RequirePermission(middleware.PermRefundOrder), idempotent, refundHandler.RetryRefund)
 
 		// protected route for admin to update review status for farmers (using query parameter)
-		adminRoutes.POST("/reviews/:review_id", middleware.JWTAuthMiddleware(), adminHandler.ApproveOrRejectReview)
+		adminRoutes.POST("/reviews/:review_id", authMiddleware, middleware.RequirePermission(middleware.PermModerateReview), adminHandler.ApproveOrRejectReview)
+
+		// protected route for admin to delete a rejected review (Super Admin only)
+		adminRoutes.DELETE("/reviews/:review_id", authMiddleware, middleware.RequirePermission(middleware.PermDeleteReview), adminHandler.HandleDeleteRejectedReview)
+
+		// check cached wallet balances against the ledger (Super Admin only)
+		adminRoutes.GET("/ledger/reconciliation", authMiddleware, middleware.RequirePermission(middleware.PermManageLedger), ledgerHandler.Reconcile)
 
-		// protected route for admin to delete review status for farmers (using query parameter)
-		adminRoutes.DELETE("/reviews/:review_id", middleware.JWTAuthMiddleware(), adminHandler.HandleDeleteRejectedReview)
+		// post a manual wallet adjustment to the ledger (Super Admin only)
+		adminRoutes.POST("/ledger/adjustments", authMiddleware, middleware.RequirePermission(middleware.PermManageLedger), idempotent, ledgerHandler.CreateAdjustment)
+
+		// grant or change a farmer's credit facility (Super Admin only), and view their credit account
+		adminRoutes.PUT("/farmers/:farmerID/credit", authMiddleware, middleware.RequirePermission(middleware.PermManageCredit), creditHandler.SaveFacility)
+		adminRoutes.GET("/farmers/:farmerID/credit", authMiddleware, middleware.RequirePermission(middleware.PermViewCredit), creditHandler.GetFarmerCreditAccount)
+
+		// instalments past their due date
+		adminRoutes.GET("/credit/overdue", authMiddleware, middleware.RequirePermission(middleware.PermViewCredit), creditHandler.OverdueReport)
 	}
 
 	// product route grouping under "products"
@@ -129,6 +333,32 @@ func InitializeApp() *gin.Engine {
 		productRoutes.GET("/view-products", productHandler.GetAllProducts)
 	}
 
+	// auth route grouping under "auth" (shared by admins and farmers)
+	authRoutes := router.Group("/auth")
+	{
+		// exchange a refresh token for a new token pair
+		authRoutes.POST("/refresh", authHandler.RefreshToken)
+
+		// revoke the current session
+		authRoutes.POST("/logout", authMiddleware, authHandler.Logout)
+
+		// revoke every session of the current user
+		authRoutes.POST("/sessions/revoke-all", authMiddleware, authHandler.RevokeAllSessions)
+	}
+
+	// public keys verifying access tokens, for clients and services validating tokens themselves
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+
+	// payment route grouping under "payments"
+	paymentRoutes := router.Group("/payments")
+	{
+		// Midtrans HTTP notification (verified by signature_key instead of JWT)
+		paymentRoutes.POST("/notifications", paymentHandler.HandleNotification)
+
+		// payment channels farmers can choose when paying online or topping up
+		paymentRoutes.GET("/channels", paymentHandler.ListChannels)
+	}
+
 	return router
 }
 
@@ -136,11 +366,32 @@ func main() {
 	// Migrate data to database
 	// config.MigrateData()
 
+	// one-off CLI command creating the first Super Admin: go run . bootstrap-admin -name ... -email ...
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap-admin" {
+		if err := runBootstrapAdmin(os.Args[2:]); err != nil {
+			log.Fatalf("Could not bootstrap admin: %v", err)
+		}
+		return
+	}
+
+	// one-off CLI command applying a SQL migration: go run . migrate config/database/migrations/<file>.sql
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if len(os.Args) != 3 {
+			log.Fatalf("Usage: %s migrate <file.sql>", os.Args[0])
+		}
+		if err := config.RunSQLFile(os.Args[2]); err != nil {
+			log.Fatalf("Could not run migration %s: %v", os.Args[2], err)
+		}
+		log.Printf("Migration %s applied", os.Args[2])
+		return
+	}
+
+	// cancelled on SIGINT or SIGTERM, which stops the background workers and shuts the server down
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize the application with Gin and dependencies
-	router := InitializeApp()
-	
-	// init midtrans
-	farmer_service.Init()
+	router := InitializeApp(ctx)
 
 	// Start the Gin server on port 8080
 	// close the database connection when the server exits
@@ -160,8 +411,17 @@ func main() {
     url := ginSwagger.URL("http://localhost:8080/swagger/doc.json") // The url pointing to API definition
     router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
 
-	// run the route at port 8080
-	if err := router.Run(":8080"); err != nil {
+	// run the route at port 8080 until shutdown, letting requests in flight finish
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server shutdown failed: %v", err)
+		}
+	}()
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Could not start server: %v", err)
 	}
 }
\ No newline at end of file